@@ -36,6 +36,8 @@ const (
 	TypeVectorOperationFailed         Type = "vector_operation_failed"
 	TypeAuthorizationServiceError     Type = "authorization_service_error"
 	TypeAppCardNotFound               Type = "app_card_not_found"
+	TypeUnknownTenant                 Type = "unknown_tenant"
+	TypeTenantUnavailable             Type = "tenant_unavailable"
 )
 
 type Error struct {
@@ -0,0 +1,173 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// SchemaVersionKey is the reserved key stamped into every stored config
+// document. Documents written before versioning existed have no key and are
+// treated as version 0.
+const SchemaVersionKey = "_schema_version"
+
+// SchemaUpgrader migrates a decoded document from one schema version to the
+// next. It receives and returns the document without the version key.
+type SchemaUpgrader func(doc map[string]json.RawMessage) (map[string]json.RawMessage, error)
+
+var (
+	schemaUpgradersMu sync.RWMutex
+	schemaUpgraders   = map[Type]map[int]SchemaUpgrader{}
+)
+
+func init() {
+	// Version 1 is the first stamped version; the layouts are unchanged from
+	// the unversioned documents so the upgrade only adds the stamp.
+	for _, t := range KnownTypes() {
+		RegisterSchemaUpgrader(Type(t), 0, identityUpgrader)
+	}
+}
+
+func identityUpgrader(doc map[string]json.RawMessage) (map[string]json.RawMessage, error) {
+	return doc, nil
+}
+
+// RegisterSchemaUpgrader registers the upgrader that moves documents of
+// configType from fromVersion to fromVersion+1. The current schema version of
+// a type is one past its highest registered upgrader.
+func RegisterSchemaUpgrader(configType Type, fromVersion int, upgrader SchemaUpgrader) {
+	if fromVersion < 0 || upgrader == nil {
+		panic(fmt.Sprintf("invalid schema upgrader registration for %s from version %d", configType, fromVersion))
+	}
+	schemaUpgradersMu.Lock()
+	defer schemaUpgradersMu.Unlock()
+	if schemaUpgraders[configType] == nil {
+		schemaUpgraders[configType] = map[int]SchemaUpgrader{}
+	}
+	if _, exists := schemaUpgraders[configType][fromVersion]; exists {
+		panic(fmt.Sprintf("schema upgrader for %s from version %d already registered", configType, fromVersion))
+	}
+	schemaUpgraders[configType][fromVersion] = upgrader
+}
+
+// CurrentSchemaVersion returns the version new documents of configType are
+// stamped with.
+func CurrentSchemaVersion(configType Type) int {
+	schemaUpgradersMu.RLock()
+	defer schemaUpgradersMu.RUnlock()
+	current := 0
+	for from := range schemaUpgraders[configType] {
+		if from+1 > current {
+			current = from + 1
+		}
+	}
+	return current
+}
+
+// DocumentSchemaVersion reports the version stamped in raw, or 0 when the
+// document predates versioning.
+func DocumentSchemaVersion(raw []byte) (int, error) {
+	doc, err := decodeVersionedDocument(raw)
+	if err != nil {
+		return 0, err
+	}
+	return schemaVersionOf(doc)
+}
+
+// StampSchemaVersion sets the current schema version of configType on raw.
+func StampSchemaVersion(configType Type, raw []byte) ([]byte, error) {
+	doc, err := decodeVersionedDocument(raw)
+	if err != nil {
+		return nil, err
+	}
+	return encodeVersionedDocument(doc, CurrentSchemaVersion(configType))
+}
+
+// UpgradeDocument runs every upgrader between the stamped version of raw and
+// the current version of configType. It returns the upgraded, stamped
+// document together with the version it was read at. Documents already at
+// the current version are returned unchanged.
+func UpgradeDocument(configType Type, raw []byte) ([]byte, int, error) {
+	doc, err := decodeVersionedDocument(raw)
+	if err != nil {
+		return nil, 0, err
+	}
+	from, err := schemaVersionOf(doc)
+	if err != nil {
+		return nil, 0, err
+	}
+	current := CurrentSchemaVersion(configType)
+	if from == current {
+		return raw, from, nil
+	}
+	if from > current {
+		return nil, from, fmt.Errorf("%s document has schema version %d, newer than supported version %d", configType, from, current)
+	}
+
+	delete(doc, SchemaVersionKey)
+	schemaUpgradersMu.RLock()
+	steps := schemaUpgraders[configType]
+	schemaUpgradersMu.RUnlock()
+	for version := from; version < current; version++ {
+		upgrader, ok := steps[version]
+		if !ok {
+			return nil, from, fmt.Errorf("no schema upgrader for %s from version %d", configType, version)
+		}
+		doc, err = upgrader(doc)
+		if err != nil {
+			return nil, from, fmt.Errorf("upgrading %s from schema version %d: %w", configType, version, err)
+		}
+		if doc == nil {
+			doc = map[string]json.RawMessage{}
+		}
+	}
+	upgraded, err := encodeVersionedDocument(doc, current)
+	if err != nil {
+		return nil, from, err
+	}
+	return upgraded, from, nil
+}
+
+// SchemaVersions lists the current schema version for every known type.
+func SchemaVersions() map[string]int {
+	versions := map[string]int{}
+	for _, t := range KnownTypes() {
+		versions[t] = CurrentSchemaVersion(Type(t))
+	}
+	return versions
+}
+
+func decodeVersionedDocument(raw []byte) (map[string]json.RawMessage, error) {
+	doc := map[string]json.RawMessage{}
+	if len(raw) == 0 || string(raw) == "null" {
+		return doc, nil
+	}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return nil, fmt.Errorf("config document must be a JSON object: %w", err)
+	}
+	if doc == nil {
+		doc = map[string]json.RawMessage{}
+	}
+	return doc, nil
+}
+
+func schemaVersionOf(doc map[string]json.RawMessage) (int, error) {
+	raw, ok := doc[SchemaVersionKey]
+	if !ok {
+		return 0, nil
+	}
+	var version int
+	if err := json.Unmarshal(raw, &version); err != nil || version < 0 {
+		return 0, fmt.Errorf("invalid %s value %s", SchemaVersionKey, string(raw))
+	}
+	return version, nil
+}
+
+func encodeVersionedDocument(doc map[string]json.RawMessage, version int) ([]byte, error) {
+	stamp, err := json.Marshal(version)
+	if err != nil {
+		return nil, err
+	}
+	doc[SchemaVersionKey] = stamp
+	return json.Marshal(doc)
+}
@@ -0,0 +1,72 @@
+package config
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+const testSchemaType Type = "schema_version_test"
+
+func init() {
+	RegisterSchemaUpgrader(testSchemaType, 0, func(doc map[string]json.RawMessage) (map[string]json.RawMessage, error) {
+		doc["title"] = doc["name"]
+		delete(doc, "name")
+		return doc, nil
+	})
+	RegisterSchemaUpgrader(testSchemaType, 1, func(doc map[string]json.RawMessage) (map[string]json.RawMessage, error) {
+		doc["visible"] = json.RawMessage(`true`)
+		return doc, nil
+	})
+}
+
+func TestUpgradeDocumentRunsUpgraderChain(t *testing.T) {
+	if got := CurrentSchemaVersion(testSchemaType); got != 2 {
+		t.Fatalf("expected current version 2, got %d", got)
+	}
+
+	upgraded, from, err := UpgradeDocument(testSchemaType, []byte(`{"name":"legacy"}`))
+	if err != nil {
+		t.Fatalf("upgrade failed: %v", err)
+	}
+	if from != 0 {
+		t.Fatalf("expected legacy document at version 0, got %d", from)
+	}
+	var doc map[string]any
+	if err := json.Unmarshal(upgraded, &doc); err != nil {
+		t.Fatalf("decode upgraded document: %v", err)
+	}
+	if doc["title"] != "legacy" || doc["visible"] != true || doc["name"] != nil {
+		t.Fatalf("unexpected upgraded document: %s", upgraded)
+	}
+	if version, err := DocumentSchemaVersion(upgraded); err != nil || version != 2 {
+		t.Fatalf("expected stamped version 2, got %d (%v)", version, err)
+	}
+
+	again, from, err := UpgradeDocument(testSchemaType, upgraded)
+	if err != nil || from != 2 || string(again) != string(upgraded) {
+		t.Fatalf("expected current document to be returned unchanged, got %s from %d (%v)", again, from, err)
+	}
+}
+
+func TestUpgradeDocumentRejectsNewerVersion(t *testing.T) {
+	if _, _, err := UpgradeDocument(TypeNav, []byte(`{"_schema_version":99}`)); err == nil {
+		t.Fatal("expected error for document newer than the supported schema")
+	}
+}
+
+func TestStampSchemaVersionOnKnownTypes(t *testing.T) {
+	stamped, err := StampSchemaVersion(TypeProjects, []byte(`{"title":"p"}`))
+	if err != nil {
+		t.Fatalf("stamp failed: %v", err)
+	}
+	var project ProjectConfig
+	if err := json.Unmarshal(stamped, &project); err != nil {
+		t.Fatalf("stamped document should still decode: %v", err)
+	}
+	if project.Title != "p" {
+		t.Fatalf("unexpected project after stamp: %+v", project)
+	}
+	if version, _ := DocumentSchemaVersion(stamped); version != CurrentSchemaVersion(TypeProjects) {
+		t.Fatalf("expected version %d, got %d", CurrentSchemaVersion(TypeProjects), version)
+	}
+}
@@ -47,6 +47,21 @@ BEGIN
 END
 $$ LANGUAGE plpgsql;
 
+CREATE TABLE IF NOT EXISTS config_schema.config_promotion (
+    id BIGSERIAL PRIMARY KEY,
+    config_type TEXT NOT NULL,
+    config_id TEXT NOT NULL,
+    source_environment TEXT NOT NULL,
+    source_url TEXT NOT NULL,
+    source_revision TEXT NOT NULL,
+    previous_revision TEXT NULL,
+    promoted_by TEXT NULL,
+    promoted_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS config_promotion_document_idx
+    ON config_schema.config_promotion (config_type, config_id, promoted_at DESC);
+
 CREATE TABLE IF NOT EXISTS config_schema.git_project_state (
     project_id TEXT PRIMARY KEY,
     repo_host TEXT NOT NULL,
@@ -62,6 +77,120 @@ CREATE TABLE IF NOT EXISTS config_schema.git_project_state (
     last_error TEXT NULL
 );
 
+CREATE TABLE IF NOT EXISTS config_schema.git_webhook_delivery (
+    delivery_id TEXT PRIMARY KEY,
+    event TEXT NOT NULL,
+    action TEXT NULL,
+    status TEXT NOT NULL,
+    error TEXT NULL,
+    received_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    processed_at TIMESTAMPTZ NULL
+);
+
+CREATE TABLE IF NOT EXISTS config_schema.git_refresh_job (
+    id TEXT PRIMARY KEY,
+    project_id TEXT NOT NULL,
+    status TEXT NOT NULL,
+    phase TEXT NOT NULL,
+    stage TEXT NULL,
+    objects_done BIGINT NOT NULL DEFAULT 0,
+    objects_total BIGINT NOT NULL DEFAULT 0,
+    percent INTEGER NOT NULL DEFAULT 0,
+    message TEXT NULL,
+    error TEXT NULL,
+    requested_by TEXT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    started_at TIMESTAMPTZ NULL,
+    finished_at TIMESTAMPTZ NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS git_refresh_job_project_idx
+    ON config_schema.git_refresh_job (project_id, created_at DESC);
+
+CREATE TABLE IF NOT EXISTS config_schema.git_upload_session (
+    id TEXT PRIMARY KEY,
+    project_id TEXT NOT NULL,
+    organization TEXT NOT NULL,
+    project TEXT NOT NULL,
+    repo_host TEXT NOT NULL,
+    repo_owner TEXT NOT NULL,
+    repo_name TEXT NOT NULL,
+    base_branch TEXT NOT NULL,
+    target_subdirectory TEXT NULL,
+    branch_name TEXT NOT NULL,
+    pr_title TEXT NOT NULL,
+    pr_body TEXT NOT NULL,
+    status TEXT NOT NULL,
+    pull_request_url TEXT NULL,
+    pull_request_number BIGINT NULL,
+    pull_request_state TEXT NULL,
+    pull_request_head_sha TEXT NULL,
+    pull_request_mergeable TEXT NULL,
+    pull_request_review_decision TEXT NULL,
+    pull_request_checks TEXT NULL,
+    pull_request_comments BIGINT NULL,
+    pull_request_merged_at TIMESTAMPTZ NULL,
+    pull_request_merge_commit_sha TEXT NULL,
+    pull_request_checked_at TIMESTAMPTZ NULL,
+    gitattributes_added TEXT[] NULL,
+    commit_mode TEXT NOT NULL DEFAULT 'pull_request',
+    base_sha TEXT NULL,
+    finalize_step TEXT NULL,
+    finalize_parent_sha TEXT NULL,
+    finalize_tree_sha TEXT NULL,
+    finalize_idempotency_key TEXT NULL,
+    finalize_claimed_until TIMESTAMPTZ NULL,
+    manifest_complete BOOLEAN NOT NULL DEFAULT TRUE,
+    conflict_policy TEXT NOT NULL DEFAULT 'fail',
+    commit_sha TEXT NULL,
+    last_error TEXT NULL,
+    created_by_user_id TEXT NULL,
+    expires_at TIMESTAMPTZ NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS git_upload_session_project_idx
+    ON config_schema.git_upload_session (project_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS git_upload_session_user_idx
+    ON config_schema.git_upload_session (created_by_user_id, created_at DESC);
+
+CREATE TABLE IF NOT EXISTS config_schema.git_upload_session_file (
+    session_id TEXT NOT NULL,
+    file_name TEXT NOT NULL,
+    target_path TEXT NOT NULL,
+    size BIGINT NOT NULL,
+    checksum TEXT NULL,
+    drs_object_id TEXT NULL,
+    status TEXT NOT NULL,
+    error TEXT NULL,
+    operation TEXT NOT NULL DEFAULT 'add',
+    source_path TEXT NULL,
+    source_sha TEXT NULL,
+    source_mode TEXT NULL,
+    storage TEXT NOT NULL DEFAULT 'lfs',
+    conflict_policy TEXT NULL,
+    requested_path TEXT NULL,
+    object_created BOOLEAN NOT NULL DEFAULT FALSE,
+    PRIMARY KEY (session_id, target_path)
+);
+
+CREATE TABLE IF NOT EXISTS config_schema.git_upload_session_content (
+    session_id TEXT NOT NULL,
+    target_path TEXT NOT NULL,
+    content BYTEA NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (session_id, target_path)
+);
+
+CREATE TABLE IF NOT EXISTS config_schema.git_mirror_usage (
+    mirror_path TEXT PRIMARY KEY,
+    size_bytes BIGINT NOT NULL DEFAULT 0,
+    measured_at TIMESTAMPTZ NULL,
+    accessed_at TIMESTAMPTZ NULL,
+    repacked_at TIMESTAMPTZ NULL,
+    evicted_at TIMESTAMPTZ NULL
+);
+
 DROP FUNCTION create_config_table(TEXT, TEXT);
 \q
 EOFSQL
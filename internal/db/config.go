@@ -7,6 +7,7 @@ import (
 	"errors"
 	"fmt"
 
+	"github.com/calypr/gecko/config"
 	"github.com/jmoiron/sqlx"
 	"github.com/lib/pq"
 )
@@ -83,7 +84,11 @@ func ConfigGETGenericContext(ctx context.Context, db *sqlx.DB, configId string,
 	if doc == nil {
 		return sql.ErrNoRows
 	}
-	err = json.Unmarshal(doc.Content, target)
+	content, _, err := config.UpgradeDocument(config.Type(configType), doc.Content)
+	if err != nil {
+		return fmt.Errorf("error upgrading content for %s from table %s: %w", configId, configType, err)
+	}
+	err = json.Unmarshal(content, target)
 	if err != nil {
 		return fmt.Errorf("error unmarshalling content for %s from table %s: %w", configId, configType, err)
 	}
@@ -118,6 +123,10 @@ func configPutGenericContext(ctx context.Context, execFn func(context.Context, s
 	if err != nil {
 		return fmt.Errorf("error marshalling data for %s: %w", configId, err)
 	}
+	jsonData, err = config.StampSchemaVersion(config.Type(configType), jsonData)
+	if err != nil {
+		return fmt.Errorf("error stamping schema version for %s: %w", configId, err)
+	}
 
 	// NOTE: configType is validated in the handler against a fixed list, making this safe.
 	stmt := fmt.Sprintf(`
@@ -0,0 +1,117 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ConfigPromotion records a config document copied from a peer environment.
+type ConfigPromotion struct {
+	ID                int64          `db:"id"`
+	ConfigType        string         `db:"config_type"`
+	ConfigID          string         `db:"config_id"`
+	SourceEnvironment string         `db:"source_environment"`
+	SourceURL         string         `db:"source_url"`
+	SourceRevision    string         `db:"source_revision"`
+	PreviousRevision  sql.NullString `db:"previous_revision"`
+	PromotedBy        sql.NullString `db:"promoted_by"`
+	PromotedAt        time.Time      `db:"promoted_at"`
+}
+
+func EnsureConfigPromotionTable(db *sqlx.DB) error {
+	if db == nil {
+		return nil
+	}
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS config_schema.config_promotion (
+			id BIGSERIAL PRIMARY KEY,
+			config_type TEXT NOT NULL,
+			config_id TEXT NOT NULL,
+			source_environment TEXT NOT NULL,
+			source_url TEXT NOT NULL,
+			source_revision TEXT NOT NULL,
+			previous_revision TEXT NULL,
+			promoted_by TEXT NULL,
+			promoted_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		);
+		CREATE INDEX IF NOT EXISTS config_promotion_document_idx
+			ON config_schema.config_promotion (config_type, config_id, promoted_at DESC);
+	`)
+	if err != nil {
+		return fmt.Errorf("ensure config promotion table: %w", err)
+	}
+	return nil
+}
+
+func InsertConfigPromotionTxContext(ctx context.Context, tx *sqlx.Tx, promotion ConfigPromotion) error {
+	if tx == nil {
+		return nil
+	}
+	_, err := tx.NamedExecContext(ctx, `
+		INSERT INTO config_schema.config_promotion (
+			config_type, config_id, source_environment, source_url, source_revision, previous_revision, promoted_by, promoted_at
+		) VALUES (
+			:config_type, :config_id, :source_environment, :source_url, :source_revision, :previous_revision, :promoted_by, :promoted_at
+		)
+	`, promotion)
+	if err != nil {
+		return fmt.Errorf("insert config promotion for %s/%s: %w", promotion.ConfigType, promotion.ConfigID, err)
+	}
+	return nil
+}
+
+// LatestConfigPromotions returns the most recent promotion of every document
+// of configType, keyed by config ID.
+func LatestConfigPromotions(db *sqlx.DB, configType string) (map[string]ConfigPromotion, error) {
+	return LatestConfigPromotionsContext(context.Background(), db, configType)
+}
+
+func LatestConfigPromotionsContext(ctx context.Context, db *sqlx.DB, configType string) (map[string]ConfigPromotion, error) {
+	out := map[string]ConfigPromotion{}
+	if db == nil {
+		return out, nil
+	}
+	var promotions []ConfigPromotion
+	err := db.SelectContext(ctx, &promotions, `
+		SELECT DISTINCT ON (config_id) id, config_type, config_id, source_environment, source_url, source_revision, previous_revision, promoted_by, promoted_at
+		FROM config_schema.config_promotion
+		WHERE config_type = $1
+		ORDER BY config_id, promoted_at DESC, id DESC
+	`, configType)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return out, nil
+		}
+		return nil, fmt.Errorf("list config promotions for %s: %w", configType, err)
+	}
+	for _, promotion := range promotions {
+		out[promotion.ConfigID] = promotion
+	}
+	return out, nil
+}
+
+// ConfigPromotionHistory lists the promotions of one document, newest first.
+func ConfigPromotionHistory(db *sqlx.DB, configType string, configID string) ([]ConfigPromotion, error) {
+	if db == nil {
+		return []ConfigPromotion{}, nil
+	}
+	promotions := []ConfigPromotion{}
+	err := db.Select(&promotions, `
+		SELECT id, config_type, config_id, source_environment, source_url, source_revision, previous_revision, promoted_by, promoted_at
+		FROM config_schema.config_promotion
+		WHERE config_type = $1 AND config_id = $2
+		ORDER BY promoted_at DESC, id DESC
+	`, configType, configID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return []ConfigPromotion{}, nil
+		}
+		return nil, fmt.Errorf("list config promotion history for %s/%s: %w", configType, configID, err)
+	}
+	return promotions, nil
+}
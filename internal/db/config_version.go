@@ -0,0 +1,148 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/calypr/gecko/config"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// ConfigVersionSummary reports the schema versions stored for one config type.
+type ConfigVersionSummary struct {
+	ConfigType     string            `json:"config_type"`
+	CurrentVersion int               `json:"current_version"`
+	Total          int               `json:"total"`
+	Versions       map[int]int       `json:"versions"`
+	Outdated       []string          `json:"outdated"`
+	Invalid        map[string]string `json:"invalid,omitempty"`
+}
+
+// ConfigUpgradeResult reports the outcome of rewriting one config type.
+// Changed lists the documents that were written by someone else while they
+// were upgraded and were left as they are.
+type ConfigUpgradeResult struct {
+	ConfigType string            `json:"config_type"`
+	Upgraded   []string          `json:"upgraded"`
+	Changed    []string          `json:"changed,omitempty"`
+	Failed     map[string]string `json:"failed,omitempty"`
+}
+
+// ConfigVersionReport scans every document of the given types (all known types
+// when none are given) and reports which are behind the current schema version.
+func ConfigVersionReport(db *sqlx.DB, configTypes ...string) ([]ConfigVersionSummary, error) {
+	return ConfigVersionReportContext(context.Background(), db, configTypes...)
+}
+
+func ConfigVersionReportContext(ctx context.Context, db *sqlx.DB, configTypes ...string) ([]ConfigVersionSummary, error) {
+	if db == nil {
+		return nil, nil
+	}
+	if len(configTypes) == 0 {
+		configTypes = config.KnownTypes()
+	}
+	summaries := make([]ConfigVersionSummary, 0, len(configTypes))
+	for _, configType := range configTypes {
+		docs, err := configDocumentsByTypeContext(ctx, db, configType)
+		if err != nil {
+			return nil, err
+		}
+		summary := ConfigVersionSummary{
+			ConfigType:     configType,
+			CurrentVersion: config.CurrentSchemaVersion(config.Type(configType)),
+			Total:          len(docs),
+			Versions:       map[int]int{},
+			Outdated:       []string{},
+		}
+		for _, doc := range docs {
+			version, err := config.DocumentSchemaVersion(doc.Content)
+			if err != nil {
+				if summary.Invalid == nil {
+					summary.Invalid = map[string]string{}
+				}
+				summary.Invalid[doc.Name] = err.Error()
+				continue
+			}
+			summary.Versions[version]++
+			if version < summary.CurrentVersion {
+				summary.Outdated = append(summary.Outdated, doc.Name)
+			}
+		}
+		summaries = append(summaries, summary)
+	}
+	return summaries, nil
+}
+
+// UpgradeStoredConfigs rewrites every outdated document of the given types
+// (all known types when none are given) at the current schema version. A
+// document that fails to upgrade is recorded and left untouched.
+func UpgradeStoredConfigs(db *sqlx.DB, configTypes ...string) ([]ConfigUpgradeResult, error) {
+	return UpgradeStoredConfigsContext(context.Background(), db, configTypes...)
+}
+
+func UpgradeStoredConfigsContext(ctx context.Context, db *sqlx.DB, configTypes ...string) ([]ConfigUpgradeResult, error) {
+	if db == nil {
+		return nil, nil
+	}
+	if len(configTypes) == 0 {
+		configTypes = config.KnownTypes()
+	}
+	results := make([]ConfigUpgradeResult, 0, len(configTypes))
+	for _, configType := range configTypes {
+		docs, err := configDocumentsByTypeContext(ctx, db, configType)
+		if err != nil {
+			return nil, err
+		}
+		result := ConfigUpgradeResult{ConfigType: configType, Upgraded: []string{}}
+		for _, doc := range docs {
+			upgraded, from, err := config.UpgradeDocument(config.Type(configType), doc.Content)
+			if err != nil {
+				if result.Failed == nil {
+					result.Failed = map[string]string{}
+				}
+				result.Failed[doc.Name] = err.Error()
+				continue
+			}
+			if from == config.CurrentSchemaVersion(config.Type(configType)) {
+				continue
+			}
+			// Only rewrite rows still holding the content that was upgraded so a
+			// concurrent PUT is never overwritten with stale data.
+			stmt := fmt.Sprintf("UPDATE %s.%s SET content = $2::jsonb WHERE name = $1 AND content = $3::jsonb", ConfigSchema, configType)
+			updated, err := db.ExecContext(ctx, stmt, doc.Name, string(upgraded), string(doc.Content))
+			if err != nil {
+				return nil, fmt.Errorf("error rewriting %s in table %s: %w", doc.Name, configType, err)
+			}
+			affected, err := updated.RowsAffected()
+			if err != nil {
+				return nil, fmt.Errorf("error counting rewritten %s in table %s: %w", doc.Name, configType, err)
+			}
+			if affected == 0 {
+				result.Changed = append(result.Changed, doc.Name)
+				continue
+			}
+			result.Upgraded = append(result.Upgraded, doc.Name)
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+func configDocumentsByTypeContext(ctx context.Context, db *sqlx.DB, configType string) ([]Document, error) {
+	// NOTE: configType is validated against the known types, making this safe.
+	if !config.IsKnownType(configType) {
+		return nil, fmt.Errorf("unknown config type %s", configType)
+	}
+	docs := []Document{}
+	stmt := fmt.Sprintf("SELECT name, content FROM %s.%s ORDER BY name", ConfigSchema, configType)
+	if err := db.SelectContext(ctx, &docs, stmt); err != nil {
+		var pgErr *pq.Error
+		if errors.As(err, &pgErr) && pgErr.Code == "42P01" {
+			return []Document{}, nil
+		}
+		return nil, fmt.Errorf("error fetching documents from table %s: %w", configType, err)
+	}
+	return docs, nil
+}
@@ -0,0 +1,83 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const gitMirrorUsageColumns = `mirror_path, size_bytes, measured_at, accessed_at, repacked_at, evicted_at`
+
+// RecordGitMirrorAccessContext notes that mirrorPath was read at accessedAt.
+// An older time never replaces a newer one.
+func RecordGitMirrorAccessContext(ctx context.Context, db *sqlx.DB, mirrorPath string, accessedAt time.Time) error {
+	if db == nil {
+		return nil
+	}
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO config_schema.git_mirror_usage (mirror_path, accessed_at)
+		VALUES ($1, $2)
+		ON CONFLICT (mirror_path) DO UPDATE SET
+			accessed_at = GREATEST(config_schema.git_mirror_usage.accessed_at, EXCLUDED.accessed_at)
+	`, mirrorPath, accessedAt)
+	if err != nil {
+		return fmt.Errorf("record git mirror access: %w", err)
+	}
+	return nil
+}
+
+// UpsertGitMirrorUsageContext stores the measured size and maintenance times
+// of a mirror. The access time is kept when usage has an older one.
+func UpsertGitMirrorUsageContext(ctx context.Context, db *sqlx.DB, usage GitMirrorUsage) error {
+	if db == nil {
+		return nil
+	}
+	_, err := db.NamedExecContext(ctx, `
+		INSERT INTO config_schema.git_mirror_usage (
+			`+gitMirrorUsageColumns+`
+		) VALUES (
+			:mirror_path, :size_bytes, :measured_at, :accessed_at, :repacked_at, :evicted_at
+		)
+		ON CONFLICT (mirror_path) DO UPDATE SET
+			size_bytes = EXCLUDED.size_bytes,
+			measured_at = EXCLUDED.measured_at,
+			accessed_at = GREATEST(config_schema.git_mirror_usage.accessed_at, EXCLUDED.accessed_at),
+			repacked_at = EXCLUDED.repacked_at,
+			evicted_at = EXCLUDED.evicted_at
+	`, usage)
+	if err != nil {
+		return fmt.Errorf("upsert git mirror usage: %w", err)
+	}
+	return nil
+}
+
+// ListGitMirrorUsageContext returns the recorded usage of every mirror,
+// keyed by mirror path.
+func ListGitMirrorUsageContext(ctx context.Context, db *sqlx.DB) (map[string]GitMirrorUsage, error) {
+	if db == nil {
+		return map[string]GitMirrorUsage{}, nil
+	}
+	usages := []GitMirrorUsage{}
+	if err := db.SelectContext(ctx, &usages, `SELECT `+gitMirrorUsageColumns+` FROM config_schema.git_mirror_usage`); err != nil {
+		return nil, fmt.Errorf("list git mirror usage: %w", err)
+	}
+	indexed := make(map[string]GitMirrorUsage, len(usages))
+	for _, usage := range usages {
+		indexed[usage.MirrorPath] = usage
+	}
+	return indexed, nil
+}
+
+// DeleteGitMirrorUsageContext forgets a mirror whose directory was removed
+// for good.
+func DeleteGitMirrorUsageContext(ctx context.Context, db *sqlx.DB, mirrorPath string) error {
+	if db == nil {
+		return nil
+	}
+	if _, err := db.ExecContext(ctx, `DELETE FROM config_schema.git_mirror_usage WHERE mirror_path = $1`, mirrorPath); err != nil {
+		return fmt.Errorf("delete git mirror usage: %w", err)
+	}
+	return nil
+}
@@ -8,6 +8,7 @@ import (
 	"strings"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 )
 
 func EnsureGitProjectStateTable(db *sqlx.DB) error {
@@ -100,6 +101,83 @@ func EnsureGitProjectStateTable(db *sqlx.DB) error {
 			updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
 			completed_at TIMESTAMPTZ NULL
 		);
+		CREATE TABLE IF NOT EXISTS config_schema.git_webhook_delivery (
+			delivery_id TEXT PRIMARY KEY,
+			event TEXT NOT NULL,
+			action TEXT NULL,
+			status TEXT NOT NULL,
+			error TEXT NULL,
+			received_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			processed_at TIMESTAMPTZ NULL
+		);
+		CREATE TABLE IF NOT EXISTS config_schema.git_refresh_job (
+			id TEXT PRIMARY KEY,
+			project_id TEXT NOT NULL,
+			status TEXT NOT NULL,
+			phase TEXT NOT NULL,
+			stage TEXT NULL,
+			objects_done BIGINT NOT NULL DEFAULT 0,
+			objects_total BIGINT NOT NULL DEFAULT 0,
+			percent INTEGER NOT NULL DEFAULT 0,
+			message TEXT NULL,
+			error TEXT NULL,
+			requested_by TEXT NULL,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			started_at TIMESTAMPTZ NULL,
+			finished_at TIMESTAMPTZ NULL,
+			updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		);
+		CREATE INDEX IF NOT EXISTS git_refresh_job_project_idx
+			ON config_schema.git_refresh_job (project_id, created_at DESC);
+		ALTER TABLE config_schema.git_upload_session ADD COLUMN IF NOT EXISTS pull_request_number BIGINT NULL;
+		ALTER TABLE config_schema.git_upload_session ADD COLUMN IF NOT EXISTS pull_request_state TEXT NULL;
+		ALTER TABLE config_schema.git_upload_session_file ADD COLUMN IF NOT EXISTS operation TEXT NOT NULL DEFAULT 'add';
+		ALTER TABLE config_schema.git_upload_session_file ADD COLUMN IF NOT EXISTS source_path TEXT NULL;
+		ALTER TABLE config_schema.git_upload_session_file ADD COLUMN IF NOT EXISTS source_sha TEXT NULL;
+		ALTER TABLE config_schema.git_upload_session_file ADD COLUMN IF NOT EXISTS source_mode TEXT NULL;
+		ALTER TABLE config_schema.git_upload_session ADD COLUMN IF NOT EXISTS created_by_user_id TEXT NULL;
+		ALTER TABLE config_schema.git_upload_session ADD COLUMN IF NOT EXISTS expires_at TIMESTAMPTZ NULL;
+		ALTER TABLE config_schema.git_upload_session ADD COLUMN IF NOT EXISTS pull_request_head_sha TEXT NULL;
+		ALTER TABLE config_schema.git_upload_session ADD COLUMN IF NOT EXISTS pull_request_mergeable TEXT NULL;
+		ALTER TABLE config_schema.git_upload_session ADD COLUMN IF NOT EXISTS pull_request_review_decision TEXT NULL;
+		ALTER TABLE config_schema.git_upload_session ADD COLUMN IF NOT EXISTS pull_request_checks TEXT NULL;
+		ALTER TABLE config_schema.git_upload_session ADD COLUMN IF NOT EXISTS pull_request_comments BIGINT NULL;
+		ALTER TABLE config_schema.git_upload_session ADD COLUMN IF NOT EXISTS pull_request_merged_at TIMESTAMPTZ NULL;
+		ALTER TABLE config_schema.git_upload_session ADD COLUMN IF NOT EXISTS pull_request_merge_commit_sha TEXT NULL;
+		ALTER TABLE config_schema.git_upload_session ADD COLUMN IF NOT EXISTS pull_request_checked_at TIMESTAMPTZ NULL;
+		ALTER TABLE config_schema.git_upload_session ADD COLUMN IF NOT EXISTS gitattributes_added TEXT[] NULL;
+		ALTER TABLE config_schema.git_upload_session_file ADD COLUMN IF NOT EXISTS storage TEXT NOT NULL DEFAULT 'lfs';
+		ALTER TABLE config_schema.git_upload_session ADD COLUMN IF NOT EXISTS commit_mode TEXT NOT NULL DEFAULT 'pull_request';
+		ALTER TABLE config_schema.git_upload_session ADD COLUMN IF NOT EXISTS base_sha TEXT NULL;
+		ALTER TABLE config_schema.git_upload_session ADD COLUMN IF NOT EXISTS finalize_step TEXT NULL;
+		ALTER TABLE config_schema.git_upload_session ADD COLUMN IF NOT EXISTS finalize_parent_sha TEXT NULL;
+		ALTER TABLE config_schema.git_upload_session ADD COLUMN IF NOT EXISTS finalize_tree_sha TEXT NULL;
+		ALTER TABLE config_schema.git_upload_session ADD COLUMN IF NOT EXISTS finalize_idempotency_key TEXT NULL;
+		ALTER TABLE config_schema.git_upload_session ADD COLUMN IF NOT EXISTS finalize_claimed_until TIMESTAMPTZ NULL;
+		ALTER TABLE config_schema.git_upload_session ADD COLUMN IF NOT EXISTS manifest_complete BOOLEAN NOT NULL DEFAULT TRUE;
+		ALTER TABLE config_schema.git_upload_session ADD COLUMN IF NOT EXISTS conflict_policy TEXT NOT NULL DEFAULT 'fail';
+		ALTER TABLE config_schema.git_upload_session_file ADD COLUMN IF NOT EXISTS conflict_policy TEXT NULL;
+		ALTER TABLE config_schema.git_upload_session_file ADD COLUMN IF NOT EXISTS requested_path TEXT NULL;
+		ALTER TABLE config_schema.git_upload_session_file ADD COLUMN IF NOT EXISTS object_created BOOLEAN NOT NULL DEFAULT FALSE;
+		CREATE TABLE IF NOT EXISTS config_schema.git_mirror_usage (
+			mirror_path TEXT PRIMARY KEY,
+			size_bytes BIGINT NOT NULL DEFAULT 0,
+			measured_at TIMESTAMPTZ NULL,
+			accessed_at TIMESTAMPTZ NULL,
+			repacked_at TIMESTAMPTZ NULL,
+			evicted_at TIMESTAMPTZ NULL
+		);
+		CREATE TABLE IF NOT EXISTS config_schema.git_upload_session_content (
+			session_id TEXT NOT NULL,
+			target_path TEXT NOT NULL,
+			content BYTEA NOT NULL,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			PRIMARY KEY (session_id, target_path)
+		);
+		CREATE INDEX IF NOT EXISTS git_upload_session_project_idx
+			ON config_schema.git_upload_session (project_id, created_at DESC);
+		CREATE INDEX IF NOT EXISTS git_upload_session_user_idx
+			ON config_schema.git_upload_session (created_by_user_id, created_at DESC);
 		ALTER TABLE config_schema.git_pending_repository ADD COLUMN IF NOT EXISTS setup_session_id TEXT NULL;
 		ALTER TABLE config_schema.git_pending_repository ADD COLUMN IF NOT EXISTS created_by_user_id TEXT NULL;
 		ALTER TABLE config_schema.git_pending_repository ADD COLUMN IF NOT EXISTS source TEXT NOT NULL DEFAULT 'webhook';
@@ -187,6 +265,71 @@ func upsertGitProjectStateContext(ctx context.Context, namedExecFn func(context.
 	return nil
 }
 
+// UpdateGitProjectSyncStateContext sets only the sync state and last error
+// of projectID, so a refresh never overwrites installation or repository
+// changes made while it ran. It reports false when the project has no row.
+func UpdateGitProjectSyncStateContext(ctx context.Context, db *sqlx.DB, projectID string, syncState string, lastError sql.NullString) (bool, error) {
+	if db == nil {
+		return false, nil
+	}
+	result, err := db.ExecContext(ctx, `
+		UPDATE config_schema.git_project_state
+		SET sync_state = $2, last_error = $3
+		WHERE project_id = $1
+	`, projectID, syncState, lastError)
+	if err != nil {
+		return false, fmt.Errorf("update git project sync state: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("count updated git project sync states: %w", err)
+	}
+	return affected > 0, nil
+}
+
+// UpdateGitProjectInstallationContext sets only the installation columns of
+// state.ProjectID, so an installation change never overwrites the sync state
+// a concurrent refresh records.
+func UpdateGitProjectInstallationContext(ctx context.Context, db *sqlx.DB, state GitProjectState) error {
+	if db == nil {
+		return nil
+	}
+	if _, err := db.NamedExecContext(ctx, `
+		UPDATE config_schema.git_project_state
+		SET installation_id = :installation_id,
+			installation_target_type = :installation_target_type,
+			installation_target = :installation_target
+		WHERE project_id = :project_id
+	`, state); err != nil {
+		return fmt.Errorf("update git project installation: %w", err)
+	}
+	return nil
+}
+
+// RecordGitProjectSyncContext stores the outcome of a completed refresh of
+// state.ProjectID: its sync state, last error, refresh time and default
+// branch. The mirror path and installation target are only filled in when
+// the row has none yet.
+func RecordGitProjectSyncContext(ctx context.Context, db *sqlx.DB, state GitProjectState) error {
+	if db == nil {
+		return nil
+	}
+	if _, err := db.NamedExecContext(ctx, `
+		UPDATE config_schema.git_project_state
+		SET sync_state = :sync_state,
+			last_error = :last_error,
+			last_refreshed_at = :last_refreshed_at,
+			default_branch = :default_branch,
+			mirror_path = CASE WHEN mirror_path = '' THEN :mirror_path ELSE mirror_path END,
+			installation_target_type = COALESCE(installation_target_type, :installation_target_type),
+			installation_target = COALESCE(installation_target, :installation_target)
+		WHERE project_id = :project_id
+	`, state); err != nil {
+		return fmt.Errorf("record git project sync: %w", err)
+	}
+	return nil
+}
+
 func ListGitProjectStates(db *sqlx.DB) (map[string]GitProjectState, error) {
 	states := []GitProjectState{}
 	if err := db.Select(&states, `SELECT project_id, repo_host, repo_owner, repo_name, installation_id, installation_target_type, installation_target, mirror_path, sync_state, default_branch, last_refreshed_at, last_error FROM config_schema.git_project_state`); err != nil {
@@ -202,6 +345,37 @@ func ListGitProjectStates(db *sqlx.DB) (map[string]GitProjectState, error) {
 	return indexed, nil
 }
 
+// ResetInterruptedGitProjectSyncs moves projects left in the updating state by
+// a previous process back to ready (or never_synced when no refresh has ever
+// completed) and records the interruption in last_error. Projects in skip are
+// still being refreshed by this process and are left alone.
+func ResetInterruptedGitProjectSyncs(db *sqlx.DB, skip []string) (int64, error) {
+	return ResetInterruptedGitProjectSyncsContext(context.Background(), db, skip)
+}
+
+func ResetInterruptedGitProjectSyncsContext(ctx context.Context, db *sqlx.DB, skip []string) (int64, error) {
+	if db == nil {
+		return 0, nil
+	}
+	if skip == nil {
+		skip = []string{}
+	}
+	result, err := db.ExecContext(ctx, `
+		UPDATE config_schema.git_project_state
+		SET sync_state = CASE WHEN last_refreshed_at IS NULL THEN 'never_synced' ELSE 'ready' END,
+			last_error = 'previous refresh was interrupted before it finished'
+		WHERE sync_state = 'updating' AND NOT (project_id = ANY($1))
+	`, pq.Array(skip))
+	if err != nil {
+		return 0, fmt.Errorf("reset interrupted git project syncs: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("count reset git project syncs: %w", err)
+	}
+	return affected, nil
+}
+
 func DeleteGitProjectArtifacts(db *sqlx.DB, projectID string) error {
 	if db == nil || strings.TrimSpace(projectID) == "" {
 		return nil
@@ -221,6 +395,14 @@ func DeleteGitProjectArtifacts(db *sqlx.DB, projectID string) error {
 	`, projectID); err != nil {
 		return fmt.Errorf("delete git upload session files for %s: %w", projectID, err)
 	}
+	if _, err := tx.Exec(`
+		DELETE FROM config_schema.git_upload_session_content
+		WHERE session_id IN (
+			SELECT id FROM config_schema.git_upload_session WHERE project_id = $1
+		)
+	`, projectID); err != nil {
+		return fmt.Errorf("delete git upload session contents for %s: %w", projectID, err)
+	}
 	if _, err := tx.Exec(`DELETE FROM config_schema.git_upload_session WHERE project_id = $1`, projectID); err != nil {
 		return fmt.Errorf("delete git upload sessions for %s: %w", projectID, err)
 	}
@@ -0,0 +1,122 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const gitRefreshJobColumns = `id, project_id, status, phase, stage, objects_done, objects_total, percent, message, error, requested_by, created_at, started_at, finished_at, updated_at`
+
+func UpsertGitRefreshJobContext(ctx context.Context, db *sqlx.DB, job GitRefreshJob) error {
+	if db == nil {
+		return nil
+	}
+	_, err := db.NamedExecContext(ctx, `
+		INSERT INTO config_schema.git_refresh_job (
+			`+gitRefreshJobColumns+`
+		) VALUES (
+			:id, :project_id, :status, :phase, :stage, :objects_done, :objects_total, :percent, :message, :error, :requested_by, :created_at, :started_at, :finished_at, :updated_at
+		)
+		ON CONFLICT (id) DO UPDATE SET
+			status = EXCLUDED.status,
+			phase = EXCLUDED.phase,
+			stage = EXCLUDED.stage,
+			objects_done = EXCLUDED.objects_done,
+			objects_total = EXCLUDED.objects_total,
+			percent = EXCLUDED.percent,
+			message = EXCLUDED.message,
+			error = EXCLUDED.error,
+			started_at = EXCLUDED.started_at,
+			finished_at = EXCLUDED.finished_at,
+			updated_at = EXCLUDED.updated_at
+	`, job)
+	if err != nil {
+		return fmt.Errorf("upsert git refresh job: %w", err)
+	}
+	return nil
+}
+
+func GitRefreshJobByIDContext(ctx context.Context, db *sqlx.DB, id string) (*GitRefreshJob, error) {
+	if db == nil {
+		return nil, nil
+	}
+	var job GitRefreshJob
+	if err := db.GetContext(ctx, &job, `SELECT `+gitRefreshJobColumns+` FROM config_schema.git_refresh_job WHERE id = $1`, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("get git refresh job: %w", err)
+	}
+	return &job, nil
+}
+
+// ActiveGitRefreshJobByProjectContext returns the newest queued or running
+// refresh job of projectID.
+func ActiveGitRefreshJobByProjectContext(ctx context.Context, db *sqlx.DB, projectID string) (*GitRefreshJob, error) {
+	if db == nil {
+		return nil, nil
+	}
+	var job GitRefreshJob
+	if err := db.GetContext(ctx, &job, `
+		SELECT `+gitRefreshJobColumns+`
+		FROM config_schema.git_refresh_job
+		WHERE project_id = $1 AND status IN ('queued', 'running')
+		ORDER BY created_at DESC
+		LIMIT 1
+	`, projectID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("get active git refresh job: %w", err)
+	}
+	return &job, nil
+}
+
+// FailInterruptedGitRefreshJobs marks jobs a previous process left queued or
+// running as failed.
+func FailInterruptedGitRefreshJobs(db *sqlx.DB) (int64, error) {
+	if db == nil {
+		return 0, nil
+	}
+	result, err := db.Exec(`
+		UPDATE config_schema.git_refresh_job
+		SET status = 'failed',
+			error = 'refresh was interrupted by a gecko restart',
+			finished_at = NOW(),
+			updated_at = NOW()
+		WHERE status IN ('queued', 'running')
+	`)
+	if err != nil {
+		return 0, fmt.Errorf("fail interrupted git refresh jobs: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("count interrupted git refresh jobs: %w", err)
+	}
+	return affected, nil
+}
+
+// DeleteFinishedGitRefreshJobsContext deletes succeeded and failed refresh
+// jobs that finished before cutoff.
+func DeleteFinishedGitRefreshJobsContext(ctx context.Context, db *sqlx.DB, cutoff time.Time) (int64, error) {
+	if db == nil {
+		return 0, nil
+	}
+	result, err := db.ExecContext(ctx, `
+		DELETE FROM config_schema.git_refresh_job
+		WHERE status IN ('succeeded', 'failed') AND finished_at IS NOT NULL AND finished_at < $1
+	`, cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("delete finished git refresh jobs: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("count deleted git refresh jobs: %w", err)
+	}
+	return affected, nil
+}
@@ -3,6 +3,8 @@ package db
 import (
 	"database/sql"
 	"time"
+
+	"github.com/lib/pq"
 )
 
 type GitProjectState struct {
@@ -67,24 +69,84 @@ type GitSetupSession struct {
 }
 
 type GitUploadSession struct {
-	ID             string         `db:"id"`
-	ProjectID      string         `db:"project_id"`
-	Organization   string         `db:"organization"`
-	Project        string         `db:"project"`
-	RepoHost       string         `db:"repo_host"`
-	RepoOwner      string         `db:"repo_owner"`
-	RepoName       string         `db:"repo_name"`
-	BaseBranch     string         `db:"base_branch"`
-	TargetSubdir   sql.NullString `db:"target_subdirectory"`
-	BranchName     string         `db:"branch_name"`
-	PRTitle        string         `db:"pr_title"`
-	PRBody         string         `db:"pr_body"`
-	Status         string         `db:"status"`
-	PullRequestURL sql.NullString `db:"pull_request_url"`
-	CommitSHA      sql.NullString `db:"commit_sha"`
-	LastError      sql.NullString `db:"last_error"`
-	CreatedAt      time.Time      `db:"created_at"`
-	UpdatedAt      time.Time      `db:"updated_at"`
+	ID               string         `db:"id"`
+	ProjectID        string         `db:"project_id"`
+	Organization     string         `db:"organization"`
+	Project          string         `db:"project"`
+	RepoHost         string         `db:"repo_host"`
+	RepoOwner        string         `db:"repo_owner"`
+	RepoName         string         `db:"repo_name"`
+	BaseBranch       string         `db:"base_branch"`
+	TargetSubdir     sql.NullString `db:"target_subdirectory"`
+	BranchName       string         `db:"branch_name"`
+	PRTitle          string         `db:"pr_title"`
+	PRBody           string         `db:"pr_body"`
+	Status           string         `db:"status"`
+	PullRequestURL   sql.NullString `db:"pull_request_url"`
+	PRNumber         sql.NullInt64  `db:"pull_request_number"`
+	PRState          sql.NullString `db:"pull_request_state"`
+	PRHeadSHA        sql.NullString `db:"pull_request_head_sha"`
+	PRMergeable      sql.NullString `db:"pull_request_mergeable"`
+	PRReviewDecision sql.NullString `db:"pull_request_review_decision"`
+	PRChecks         sql.NullString `db:"pull_request_checks"`
+	PRComments       sql.NullInt64  `db:"pull_request_comments"`
+	PRMergedAt       sql.NullTime   `db:"pull_request_merged_at"`
+	PRMergeCommitSHA sql.NullString `db:"pull_request_merge_commit_sha"`
+	PRCheckedAt      sql.NullTime   `db:"pull_request_checked_at"`
+	AttributesAdded  pq.StringArray `db:"gitattributes_added"`
+	CommitMode       string         `db:"commit_mode"`
+	BaseSHA          sql.NullString `db:"base_sha"`
+	FinalizeStep     sql.NullString `db:"finalize_step"`
+	ParentSHA        sql.NullString `db:"finalize_parent_sha"`
+	TreeSHA          sql.NullString `db:"finalize_tree_sha"`
+	IdempotencyKey   sql.NullString `db:"finalize_idempotency_key"`
+	ManifestComplete bool           `db:"manifest_complete"`
+	ConflictPolicy   string         `db:"conflict_policy"`
+	CommitSHA        sql.NullString `db:"commit_sha"`
+	LastError        sql.NullString `db:"last_error"`
+	CreatedByUserID  sql.NullString `db:"created_by_user_id"`
+	ExpiresAt        sql.NullTime   `db:"expires_at"`
+	CreatedAt        time.Time      `db:"created_at"`
+	UpdatedAt        time.Time      `db:"updated_at"`
+}
+
+type GitWebhookDelivery struct {
+	DeliveryID  string         `db:"delivery_id"`
+	Event       string         `db:"event"`
+	Action      sql.NullString `db:"action"`
+	Status      string         `db:"status"`
+	Error       sql.NullString `db:"error"`
+	ReceivedAt  time.Time      `db:"received_at"`
+	ProcessedAt sql.NullTime   `db:"processed_at"`
+}
+
+type GitRefreshJob struct {
+	ID           string         `db:"id"`
+	ProjectID    string         `db:"project_id"`
+	Status       string         `db:"status"`
+	Phase        string         `db:"phase"`
+	Stage        sql.NullString `db:"stage"`
+	ObjectsDone  int64          `db:"objects_done"`
+	ObjectsTotal int64          `db:"objects_total"`
+	Percent      int            `db:"percent"`
+	Message      sql.NullString `db:"message"`
+	Error        sql.NullString `db:"error"`
+	RequestedBy  sql.NullString `db:"requested_by"`
+	CreatedAt    time.Time      `db:"created_at"`
+	StartedAt    sql.NullTime   `db:"started_at"`
+	FinishedAt   sql.NullTime   `db:"finished_at"`
+	UpdatedAt    time.Time      `db:"updated_at"`
+}
+
+// GitMirrorUsage records the size and maintenance of one mirror directory.
+// Projects that point at the same repository share a mirror and its row.
+type GitMirrorUsage struct {
+	MirrorPath string       `db:"mirror_path"`
+	SizeBytes  int64        `db:"size_bytes"`
+	MeasuredAt sql.NullTime `db:"measured_at"`
+	AccessedAt sql.NullTime `db:"accessed_at"`
+	RepackedAt sql.NullTime `db:"repacked_at"`
+	EvictedAt  sql.NullTime `db:"evicted_at"`
 }
 
 type GitUploadSessionFile struct {
@@ -96,6 +158,23 @@ type GitUploadSessionFile struct {
 	DRSObjectID sql.NullString `db:"drs_object_id"`
 	Status      string         `db:"status"`
 	Error       sql.NullString `db:"error"`
+	Operation   string         `db:"operation"`
+	SourcePath  sql.NullString `db:"source_path"`
+	SourceSHA   sql.NullString `db:"source_sha"`
+	SourceMode  sql.NullString `db:"source_mode"`
+	Storage     string         `db:"storage"`
+	// ConflictPolicy overrides the conflict policy of the session for the
+	// file. RequestedPath is the target path the file asked for when a
+	// conflict policy resolved its collision.
+	ConflictPolicy sql.NullString `db:"conflict_policy"`
+	RequestedPath  sql.NullString `db:"requested_path"`
+	// ObjectCreated records that the DRS object was registered for this
+	// session rather than imported or attached from before it. Releasing
+	// the session deletes only such objects.
+	ObjectCreated bool `db:"object_created"`
+	// Content holds the bytes of an inline file while finalize builds the
+	// commit; it is stored in git_upload_session_content, not in this row.
+	Content []byte `db:"-"`
 }
 
 func (state GitProjectState) RefreshedAt() *time.Time {
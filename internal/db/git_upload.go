@@ -1,19 +1,27 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 )
 
+func gitUploadSessionSelectSQL() string {
+	return `SELECT id, project_id, organization, project, repo_host, repo_owner, repo_name, base_branch, target_subdirectory, branch_name, pr_title, pr_body, status, pull_request_url, pull_request_number, pull_request_state, pull_request_head_sha, pull_request_mergeable, pull_request_review_decision, pull_request_checks, pull_request_comments, pull_request_merged_at, pull_request_merge_commit_sha, pull_request_checked_at, gitattributes_added, commit_mode, base_sha, finalize_step, finalize_parent_sha, finalize_tree_sha, finalize_idempotency_key, manifest_complete, conflict_policy, commit_sha, last_error, created_by_user_id, expires_at, created_at, updated_at FROM config_schema.git_upload_session`
+}
+
 func GitUploadSessionByID(db *sqlx.DB, sessionID string) (*GitUploadSession, error) {
 	if db == nil {
 		return nil, nil
 	}
 	var session GitUploadSession
-	err := db.Get(&session, `SELECT id, project_id, organization, project, repo_host, repo_owner, repo_name, base_branch, target_subdirectory, branch_name, pr_title, pr_body, status, pull_request_url, commit_sha, last_error, created_at, updated_at FROM config_schema.git_upload_session WHERE id = $1`, sessionID)
+	err := db.Get(&session, gitUploadSessionSelectSQL()+` WHERE id = $1`, sessionID)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, nil
@@ -29,9 +37,9 @@ func UpsertGitUploadSession(db *sqlx.DB, session GitUploadSession) error {
 	}
 	_, err := db.NamedExec(`
 		INSERT INTO config_schema.git_upload_session (
-			id, project_id, organization, project, repo_host, repo_owner, repo_name, base_branch, target_subdirectory, branch_name, pr_title, pr_body, status, pull_request_url, commit_sha, last_error, created_at, updated_at
+			id, project_id, organization, project, repo_host, repo_owner, repo_name, base_branch, target_subdirectory, branch_name, pr_title, pr_body, status, pull_request_url, pull_request_number, pull_request_state, pull_request_head_sha, pull_request_mergeable, pull_request_review_decision, pull_request_checks, pull_request_comments, pull_request_merged_at, pull_request_merge_commit_sha, pull_request_checked_at, gitattributes_added, commit_mode, base_sha, finalize_step, finalize_parent_sha, finalize_tree_sha, finalize_idempotency_key, manifest_complete, conflict_policy, commit_sha, last_error, created_by_user_id, expires_at, created_at, updated_at
 		) VALUES (
-			:id, :project_id, :organization, :project, :repo_host, :repo_owner, :repo_name, :base_branch, :target_subdirectory, :branch_name, :pr_title, :pr_body, :status, :pull_request_url, :commit_sha, :last_error, :created_at, :updated_at
+			:id, :project_id, :organization, :project, :repo_host, :repo_owner, :repo_name, :base_branch, :target_subdirectory, :branch_name, :pr_title, :pr_body, :status, :pull_request_url, :pull_request_number, :pull_request_state, :pull_request_head_sha, :pull_request_mergeable, :pull_request_review_decision, :pull_request_checks, :pull_request_comments, :pull_request_merged_at, :pull_request_merge_commit_sha, :pull_request_checked_at, :gitattributes_added, :commit_mode, :base_sha, :finalize_step, :finalize_parent_sha, :finalize_tree_sha, :finalize_idempotency_key, :manifest_complete, :conflict_policy, :commit_sha, :last_error, :created_by_user_id, :expires_at, :created_at, :updated_at
 		)
 		ON CONFLICT (id) DO UPDATE SET
 			project_id = EXCLUDED.project_id,
@@ -47,8 +55,28 @@ func UpsertGitUploadSession(db *sqlx.DB, session GitUploadSession) error {
 			pr_body = EXCLUDED.pr_body,
 			status = EXCLUDED.status,
 			pull_request_url = EXCLUDED.pull_request_url,
+			pull_request_number = EXCLUDED.pull_request_number,
+			pull_request_state = EXCLUDED.pull_request_state,
+			pull_request_head_sha = EXCLUDED.pull_request_head_sha,
+			pull_request_mergeable = EXCLUDED.pull_request_mergeable,
+			pull_request_review_decision = EXCLUDED.pull_request_review_decision,
+			pull_request_checks = EXCLUDED.pull_request_checks,
+			pull_request_comments = EXCLUDED.pull_request_comments,
+			pull_request_merged_at = EXCLUDED.pull_request_merged_at,
+			pull_request_merge_commit_sha = EXCLUDED.pull_request_merge_commit_sha,
+			pull_request_checked_at = EXCLUDED.pull_request_checked_at,
+			gitattributes_added = EXCLUDED.gitattributes_added,
+			commit_mode = EXCLUDED.commit_mode,
+			base_sha = EXCLUDED.base_sha,
+			finalize_step = EXCLUDED.finalize_step,
+			finalize_parent_sha = EXCLUDED.finalize_parent_sha,
+			finalize_tree_sha = EXCLUDED.finalize_tree_sha,
+			finalize_idempotency_key = EXCLUDED.finalize_idempotency_key,
+			manifest_complete = EXCLUDED.manifest_complete,
+			conflict_policy = EXCLUDED.conflict_policy,
 			commit_sha = EXCLUDED.commit_sha,
 			last_error = EXCLUDED.last_error,
+			expires_at = EXCLUDED.expires_at,
 			updated_at = EXCLUDED.updated_at;
 	`, session)
 	if err != nil {
@@ -57,6 +85,202 @@ func UpsertGitUploadSession(db *sqlx.DB, session GitUploadSession) error {
 	return nil
 }
 
+// gitUploadSessionOpenStatuses are the statuses of sessions still taking
+// uploads.
+var gitUploadSessionOpenStatuses = []string{"pending_upload", "ready_for_pr"}
+
+// TouchGitUploadSessionContext records activity on an open session: its
+// status after the change, updated_at and the expiry pushed out from it. It
+// reports false when the session is no longer open, for example because it
+// was cancelled or expired in the meantime.
+func TouchGitUploadSessionContext(ctx context.Context, db *sqlx.DB, sessionID string, status string, updatedAt time.Time, expiresAt sql.NullTime) (bool, error) {
+	if db == nil {
+		return true, nil
+	}
+	result, err := db.ExecContext(ctx, `
+		UPDATE config_schema.git_upload_session
+		SET status = $2, updated_at = $3, expires_at = $4
+		WHERE id = $1 AND status = ANY($5)
+	`, sessionID, status, updatedAt, expiresAt, pq.Array(gitUploadSessionOpenStatuses))
+	if err != nil {
+		return false, fmt.Errorf("touch git upload session: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("count touched git upload sessions: %w", err)
+	}
+	return affected > 0, nil
+}
+
+// UpdateGitUploadSessionStatusContext moves sessionID to status when its
+// current status is one of from. It reports false when the session was in
+// another status, so callers can tell a concurrent change from success.
+func UpdateGitUploadSessionStatusContext(ctx context.Context, db *sqlx.DB, sessionID string, from []string, status string, updatedAt time.Time) (bool, error) {
+	if db == nil {
+		return true, nil
+	}
+	result, err := db.ExecContext(ctx, `
+		UPDATE config_schema.git_upload_session
+		SET status = $2, updated_at = $3
+		WHERE id = $1 AND status = ANY($4)
+	`, sessionID, status, updatedAt, pq.Array(from))
+	if err != nil {
+		return false, fmt.Errorf("update git upload session status: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("count updated git upload sessions: %w", err)
+	}
+	return affected > 0, nil
+}
+
+// ClaimGitUploadSessionFinalizeContext claims the finalize of an open
+// session until claimedUntil. readKey is the finalize_idempotency_key the
+// caller checked its key against; key is stored when the session has none
+// yet. It reports false when another finalize holds an unexpired claim, or
+// when the session closed or took a different key since it was read, so only
+// one finalize talks to GitHub at a time.
+func ClaimGitUploadSessionFinalizeContext(ctx context.Context, db *sqlx.DB, sessionID string, readKey sql.NullString, key string, now time.Time, claimedUntil time.Time) (bool, error) {
+	if db == nil {
+		return true, nil
+	}
+	result, err := db.ExecContext(ctx, `
+		UPDATE config_schema.git_upload_session
+		SET finalize_claimed_until = $3,
+			finalize_idempotency_key = COALESCE(finalize_idempotency_key, NULLIF($4, '')),
+			updated_at = $2
+		WHERE id = $1
+			AND status = ANY($5)
+			AND (finalize_claimed_until IS NULL OR finalize_claimed_until < $2)
+			AND finalize_idempotency_key IS NOT DISTINCT FROM $6
+	`, sessionID, now, claimedUntil, key, pq.Array(gitUploadSessionOpenStatuses), readKey)
+	if err != nil {
+		return false, fmt.Errorf("claim git upload session finalize: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("count claimed git upload sessions: %w", err)
+	}
+	return affected > 0, nil
+}
+
+// ReleaseGitUploadSessionFinalizeContext drops the finalize claim of
+// sessionID, so a retry does not wait for it to expire.
+func ReleaseGitUploadSessionFinalizeContext(ctx context.Context, db *sqlx.DB, sessionID string) error {
+	if db == nil {
+		return nil
+	}
+	if _, err := db.ExecContext(ctx, `
+		UPDATE config_schema.git_upload_session
+		SET finalize_claimed_until = NULL
+		WHERE id = $1
+	`, sessionID); err != nil {
+		return fmt.Errorf("release git upload session finalize: %w", err)
+	}
+	return nil
+}
+
+// RecordGitUploadSessionFinalizeProgressContext writes the finalize step
+// columns of session and stops it from expiring.
+func RecordGitUploadSessionFinalizeProgressContext(ctx context.Context, db *sqlx.DB, session GitUploadSession) error {
+	if db == nil {
+		return nil
+	}
+	if _, err := db.ExecContext(ctx, `
+		UPDATE config_schema.git_upload_session
+		SET finalize_step = $2,
+			finalize_parent_sha = $3,
+			finalize_tree_sha = $4,
+			commit_sha = $5,
+			gitattributes_added = $6,
+			pull_request_url = $7,
+			updated_at = $8,
+			expires_at = NULL
+		WHERE id = $1
+	`, session.ID, session.FinalizeStep, session.ParentSHA, session.TreeSHA, session.CommitSHA, session.AttributesAdded, session.PullRequestURL, session.UpdatedAt); err != nil {
+		return fmt.Errorf("record git upload session finalize progress: %w", err)
+	}
+	return nil
+}
+
+// RecordGitUploadSessionErrorContext stores why the last finalize of
+// sessionID stopped.
+func RecordGitUploadSessionErrorContext(ctx context.Context, db *sqlx.DB, sessionID string, lastError string, updatedAt time.Time) error {
+	if db == nil {
+		return nil
+	}
+	if _, err := db.ExecContext(ctx, `
+		UPDATE config_schema.git_upload_session
+		SET last_error = $2, updated_at = $3
+		WHERE id = $1
+	`, sessionID, lastError, updatedAt); err != nil {
+		return fmt.Errorf("record git upload session error: %w", err)
+	}
+	return nil
+}
+
+// FinishGitUploadSessionFinalizeContext marks session finalized with the
+// commit and pull request finalize produced, and drops its finalize claim.
+func FinishGitUploadSessionFinalizeContext(ctx context.Context, db *sqlx.DB, session GitUploadSession) error {
+	if db == nil {
+		return nil
+	}
+	if _, err := db.ExecContext(ctx, `
+		UPDATE config_schema.git_upload_session
+		SET status = $2,
+			pr_title = $3,
+			pr_body = $4,
+			commit_sha = $5,
+			pull_request_url = $6,
+			pull_request_number = $7,
+			pull_request_state = $8,
+			gitattributes_added = $9,
+			last_error = NULL,
+			updated_at = $10,
+			expires_at = NULL,
+			finalize_claimed_until = NULL
+		WHERE id = $1
+	`, session.ID, session.Status, session.PRTitle, session.PRBody, session.CommitSHA, session.PullRequestURL, session.PRNumber, session.PRState, session.AttributesAdded, session.UpdatedAt); err != nil {
+		return fmt.Errorf("finish git upload session finalize: %w", err)
+	}
+	return nil
+}
+
+// UpdateGitUploadSessionPullRequestContext writes only the pull request
+// columns of session. checkedAt is the pull_request_checked_at the caller
+// read; the write is skipped and false reported when another poll or webhook
+// recorded the pull request since, so a slow writer cannot overwrite newer
+// state or any column it does not own.
+func UpdateGitUploadSessionPullRequestContext(ctx context.Context, db *sqlx.DB, session GitUploadSession, checkedAt sql.NullTime) (bool, error) {
+	if db == nil {
+		return true, nil
+	}
+	result, err := db.ExecContext(ctx, `
+		UPDATE config_schema.git_upload_session
+		SET pull_request_url = $2,
+			pull_request_number = $3,
+			pull_request_state = $4,
+			pull_request_head_sha = $5,
+			pull_request_mergeable = $6,
+			pull_request_review_decision = $7,
+			pull_request_checks = $8,
+			pull_request_comments = $9,
+			pull_request_merged_at = $10,
+			pull_request_merge_commit_sha = $11,
+			pull_request_checked_at = $12,
+			updated_at = $13
+		WHERE id = $1 AND pull_request_checked_at IS NOT DISTINCT FROM $14
+	`, session.ID, session.PullRequestURL, session.PRNumber, session.PRState, session.PRHeadSHA, session.PRMergeable, session.PRReviewDecision, session.PRChecks, session.PRComments, session.PRMergedAt, session.PRMergeCommitSHA, session.PRCheckedAt, session.UpdatedAt, checkedAt)
+	if err != nil {
+		return false, fmt.Errorf("update git upload session pull request: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("count updated git upload sessions: %w", err)
+	}
+	return affected > 0, nil
+}
+
 func ReplaceGitUploadSessionFiles(db *sqlx.DB, sessionID string, files []GitUploadSessionFile) error {
 	if db == nil {
 		return nil
@@ -74,9 +298,9 @@ func ReplaceGitUploadSessionFiles(db *sqlx.DB, sessionID string, files []GitUplo
 	for _, file := range files {
 		if _, err := tx.NamedExec(`
 			INSERT INTO config_schema.git_upload_session_file (
-				session_id, file_name, target_path, size, checksum, drs_object_id, status, error
+				session_id, file_name, target_path, size, checksum, drs_object_id, status, error, operation, source_path, source_sha, source_mode, storage, conflict_policy, requested_path, object_created
 			) VALUES (
-				:session_id, :file_name, :target_path, :size, :checksum, :drs_object_id, :status, :error
+				:session_id, :file_name, :target_path, :size, :checksum, :drs_object_id, :status, :error, :operation, :source_path, :source_sha, :source_mode, :storage, :conflict_policy, :requested_path, :object_created
 			)
 		`, file); err != nil {
 			return fmt.Errorf("insert git upload session file: %w", err)
@@ -88,12 +312,163 @@ func ReplaceGitUploadSessionFiles(db *sqlx.DB, sessionID string, files []GitUplo
 	return nil
 }
 
+const gitUploadSessionFileUpsertSQL = `
+	INSERT INTO config_schema.git_upload_session_file (
+		session_id, file_name, target_path, size, checksum, drs_object_id, status, error, operation, source_path, source_sha, source_mode, storage, conflict_policy, requested_path, object_created
+	) VALUES (
+		:session_id, :file_name, :target_path, :size, :checksum, :drs_object_id, :status, :error, :operation, :source_path, :source_sha, :source_mode, :storage, :conflict_policy, :requested_path, :object_created
+	)
+	ON CONFLICT (session_id, target_path) DO UPDATE SET
+		file_name = EXCLUDED.file_name,
+		size = EXCLUDED.size,
+		checksum = EXCLUDED.checksum,
+		drs_object_id = EXCLUDED.drs_object_id,
+		status = EXCLUDED.status,
+		error = EXCLUDED.error,
+		operation = EXCLUDED.operation,
+		source_path = EXCLUDED.source_path,
+		source_sha = EXCLUDED.source_sha,
+		source_mode = EXCLUDED.source_mode,
+		storage = EXCLUDED.storage,
+		conflict_policy = EXCLUDED.conflict_policy,
+		requested_path = EXCLUDED.requested_path,
+		object_created = EXCLUDED.object_created
+`
+
+// UpsertGitUploadSessionFilesContext writes files, each keyed by its
+// session and target path, and leaves the other files of their sessions
+// alone. Large sessions use it to append manifest pages and to record
+// attachments without rewriting every row.
+func UpsertGitUploadSessionFilesContext(ctx context.Context, db *sqlx.DB, files []GitUploadSessionFile) error {
+	if db == nil || len(files) == 0 {
+		return nil
+	}
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin git upload session file transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+	for _, file := range files {
+		if _, err := tx.NamedExecContext(ctx, gitUploadSessionFileUpsertSQL, file); err != nil {
+			return fmt.Errorf("upsert git upload session file: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit git upload session file transaction: %w", err)
+	}
+	return nil
+}
+
+// MoveGitUploadSessionFilesContext writes files of sessionID after conflict
+// resolution changed their target paths. moved maps each old target path to
+// its new one; the rows at the old paths are dropped and the inline content
+// stored for them moves along.
+func MoveGitUploadSessionFilesContext(ctx context.Context, db *sqlx.DB, sessionID string, moved map[string]string, files []GitUploadSessionFile) error {
+	if db == nil {
+		return nil
+	}
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin git upload session file transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+	if len(moved) > 0 {
+		oldPaths := make([]string, 0, len(moved))
+		for oldPath := range moved {
+			oldPaths = append(oldPaths, oldPath)
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM config_schema.git_upload_session_file WHERE session_id = $1 AND target_path = ANY($2)`, sessionID, pq.Array(oldPaths)); err != nil {
+			return fmt.Errorf("delete moved git upload session files: %w", err)
+		}
+		contents := []struct {
+			TargetPath string `db:"target_path"`
+			Content    []byte `db:"content"`
+		}{}
+		if err := tx.SelectContext(ctx, &contents, `DELETE FROM config_schema.git_upload_session_content WHERE session_id = $1 AND target_path = ANY($2) RETURNING target_path, content`, sessionID, pq.Array(oldPaths)); err != nil {
+			return fmt.Errorf("delete moved git upload session contents: %w", err)
+		}
+		for _, content := range contents {
+			if _, err := tx.ExecContext(ctx, `
+				INSERT INTO config_schema.git_upload_session_content (session_id, target_path, content, created_at)
+				VALUES ($1, $2, $3, NOW())
+				ON CONFLICT (session_id, target_path) DO UPDATE SET
+					content = EXCLUDED.content,
+					created_at = EXCLUDED.created_at
+			`, sessionID, moved[content.TargetPath], content.Content); err != nil {
+				return fmt.Errorf("move git upload session content: %w", err)
+			}
+		}
+	}
+	for _, file := range files {
+		if _, err := tx.NamedExecContext(ctx, gitUploadSessionFileUpsertSQL, file); err != nil {
+			return fmt.Errorf("upsert git upload session file: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit git upload session file transaction: %w", err)
+	}
+	return nil
+}
+
+const gitUploadSessionFileSelectSQL = `SELECT session_id, file_name, target_path, size, checksum, drs_object_id, status, error, operation, source_path, source_sha, source_mode, storage, conflict_policy, requested_path, object_created FROM config_schema.git_upload_session_file WHERE session_id = $1 ORDER BY target_path`
+
+// AppendGitUploadSessionFilesContext appends a manifest page to sessionID
+// while holding its row lock, so concurrent pages are applied one after the
+// other. apply runs under the lock with the session and files as stored; it
+// returns the page to insert after setting the session's manifest_complete,
+// pr_title, status, updated_at and expires_at, or an error that aborts the
+// append and is returned as is. It returns the session and all its files.
+func AppendGitUploadSessionFilesContext(ctx context.Context, db *sqlx.DB, sessionID string, apply func(session *GitUploadSession, files []GitUploadSessionFile) ([]GitUploadSessionFile, error)) (*GitUploadSession, []GitUploadSessionFile, error) {
+	if db == nil {
+		return nil, nil, nil
+	}
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("begin git upload session manifest transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+	var session GitUploadSession
+	if err := tx.GetContext(ctx, &session, gitUploadSessionSelectSQL()+` WHERE id = $1 FOR UPDATE`, sessionID); err != nil {
+		return nil, nil, fmt.Errorf("lock git upload session: %w", err)
+	}
+	files := []GitUploadSessionFile{}
+	if err := tx.SelectContext(ctx, &files, gitUploadSessionFileSelectSQL, sessionID); err != nil {
+		return nil, nil, fmt.Errorf("list git upload session files: %w", err)
+	}
+	page, err := apply(&session, files)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, file := range page {
+		if _, err := tx.NamedExecContext(ctx, gitUploadSessionFileUpsertSQL, file); err != nil {
+			return nil, nil, fmt.Errorf("insert git upload session file: %w", err)
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE config_schema.git_upload_session
+		SET manifest_complete = $2, pr_title = $3, status = $4, updated_at = $5, expires_at = $6
+		WHERE id = $1
+	`, session.ID, session.ManifestComplete, session.PRTitle, session.Status, session.UpdatedAt, session.ExpiresAt); err != nil {
+		return nil, nil, fmt.Errorf("update git upload session manifest: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, nil, fmt.Errorf("commit git upload session manifest transaction: %w", err)
+	}
+	return &session, append(files, page...), nil
+}
+
 func ListGitUploadSessionFiles(db *sqlx.DB, sessionID string) ([]GitUploadSessionFile, error) {
 	if db == nil {
 		return []GitUploadSessionFile{}, nil
 	}
 	files := []GitUploadSessionFile{}
-	if err := db.Select(&files, `SELECT session_id, file_name, target_path, size, checksum, drs_object_id, status, error FROM config_schema.git_upload_session_file WHERE session_id = $1 ORDER BY target_path`, sessionID); err != nil {
+	if err := db.Select(&files, gitUploadSessionFileSelectSQL, sessionID); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return []GitUploadSessionFile{}, nil
 		}
@@ -101,3 +476,210 @@ func ListGitUploadSessionFiles(db *sqlx.DB, sessionID string) ([]GitUploadSessio
 	}
 	return files, nil
 }
+
+// GitUploadDRSObjectIDByChecksumContext returns the DRS object an upload
+// session of projectID attached for a file with checksum, or "" when none did.
+func GitUploadDRSObjectIDByChecksumContext(ctx context.Context, db *sqlx.DB, projectID string, checksum string) (string, error) {
+	if db == nil {
+		return "", nil
+	}
+	var objectID string
+	if err := db.GetContext(ctx, &objectID, `
+		SELECT file.drs_object_id
+		FROM config_schema.git_upload_session_file file
+		JOIN config_schema.git_upload_session session ON session.id = file.session_id
+		WHERE session.project_id = $1 AND file.checksum = $2 AND file.drs_object_id IS NOT NULL AND file.drs_object_id <> ''
+		ORDER BY session.updated_at DESC
+		LIMIT 1
+	`, projectID, strings.ToLower(strings.TrimSpace(checksum))); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", nil
+		}
+		return "", fmt.Errorf("get git upload DRS object by checksum: %w", err)
+	}
+	return objectID, nil
+}
+
+// GitUploadSessionFilter selects upload sessions by project or by the user
+// who created them. Empty fields match everything.
+type GitUploadSessionFilter struct {
+	ProjectID string
+	UserID    string
+	Statuses  []string
+	Limit     int
+}
+
+// ListGitUploadSessionsContext returns the sessions matching filter, newest
+// first.
+func ListGitUploadSessionsContext(ctx context.Context, db *sqlx.DB, filter GitUploadSessionFilter) ([]GitUploadSession, error) {
+	if db == nil {
+		return []GitUploadSession{}, nil
+	}
+	query := gitUploadSessionSelectSQL() + ` WHERE TRUE`
+	args := []any{}
+	if filter.ProjectID != "" {
+		args = append(args, filter.ProjectID)
+		query += fmt.Sprintf(" AND project_id = $%d", len(args))
+	}
+	if filter.UserID != "" {
+		args = append(args, filter.UserID)
+		query += fmt.Sprintf(" AND created_by_user_id = $%d", len(args))
+	}
+	if len(filter.Statuses) > 0 {
+		args = append(args, pq.Array(filter.Statuses))
+		query += fmt.Sprintf(" AND status = ANY($%d)", len(args))
+	}
+	query += " ORDER BY created_at DESC, id"
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+	sessions := []GitUploadSession{}
+	if err := db.SelectContext(ctx, &sessions, query, args...); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return []GitUploadSession{}, nil
+		}
+		return nil, fmt.Errorf("list git upload sessions: %w", err)
+	}
+	return sessions, nil
+}
+
+// ListGitUploadSessionsAwaitingMergeContext returns finalized sessions whose
+// pull request is still open, or has not been looked at yet, oldest check
+// first.
+func ListGitUploadSessionsAwaitingMergeContext(ctx context.Context, db *sqlx.DB, limit int) ([]GitUploadSession, error) {
+	if db == nil {
+		return []GitUploadSession{}, nil
+	}
+	sessions := []GitUploadSession{}
+	if err := db.SelectContext(ctx, &sessions, gitUploadSessionSelectSQL()+`
+		WHERE status = 'finalized' AND pull_request_url IS NOT NULL AND (pull_request_state IS NULL OR pull_request_state = 'open')
+		ORDER BY pull_request_checked_at NULLS FIRST, created_at
+		LIMIT $1
+	`, limit); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return []GitUploadSession{}, nil
+		}
+		return nil, fmt.Errorf("list git upload sessions awaiting merge: %w", err)
+	}
+	return sessions, nil
+}
+
+// ExpireGitUploadSessionsContext marks sessions that are still waiting for
+// uploads or finalize and whose expires_at has passed as expired.
+func ExpireGitUploadSessionsContext(ctx context.Context, db *sqlx.DB, now time.Time) (int64, error) {
+	if db == nil {
+		return 0, nil
+	}
+	result, err := db.ExecContext(ctx, `
+		UPDATE config_schema.git_upload_session
+		SET status = 'expired',
+			last_error = 'upload session expired before it was finalized',
+			updated_at = $1
+		WHERE status IN ('pending_upload', 'ready_for_pr') AND expires_at IS NOT NULL AND expires_at <= $1
+	`, now)
+	if err != nil {
+		return 0, fmt.Errorf("expire git upload sessions: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("count expired git upload sessions: %w", err)
+	}
+	return affected, nil
+}
+
+// GitUploadDRSObjectInUseContext reports whether an upload session other than
+// sessionID that was not cancelled or expired still references objectID.
+func GitUploadDRSObjectInUseContext(ctx context.Context, db *sqlx.DB, objectID string, sessionID string) (bool, error) {
+	if db == nil {
+		return false, nil
+	}
+	var inUse bool
+	if err := db.GetContext(ctx, &inUse, `
+		SELECT EXISTS (
+			SELECT 1
+			FROM config_schema.git_upload_session_file file
+			JOIN config_schema.git_upload_session session ON session.id = file.session_id
+			WHERE file.drs_object_id = $1 AND session.id <> $2 AND session.status NOT IN ('cancelled', 'expired')
+		)
+	`, objectID, sessionID); err != nil {
+		return false, fmt.Errorf("check git upload DRS object references: %w", err)
+	}
+	return inUse, nil
+}
+
+// PutGitUploadSessionContentContext stores the bytes of an inline file of
+// sessionID, replacing any earlier upload of targetPath.
+func PutGitUploadSessionContentContext(ctx context.Context, db *sqlx.DB, sessionID string, targetPath string, content []byte) error {
+	if db == nil {
+		return nil
+	}
+	if _, err := db.ExecContext(ctx, `
+		INSERT INTO config_schema.git_upload_session_content (session_id, target_path, content, created_at)
+		VALUES ($1, $2, $3, NOW())
+		ON CONFLICT (session_id, target_path) DO UPDATE SET
+			content = EXCLUDED.content,
+			created_at = EXCLUDED.created_at
+	`, sessionID, targetPath, content); err != nil {
+		return fmt.Errorf("put git upload session content: %w", err)
+	}
+	return nil
+}
+
+// ListGitUploadSessionContentsContext returns the stored inline file bytes
+// of sessionID by target path.
+func ListGitUploadSessionContentsContext(ctx context.Context, db *sqlx.DB, sessionID string) (map[string][]byte, error) {
+	contents := map[string][]byte{}
+	if db == nil {
+		return contents, nil
+	}
+	rows := []struct {
+		TargetPath string `db:"target_path"`
+		Content    []byte `db:"content"`
+	}{}
+	if err := db.SelectContext(ctx, &rows, `SELECT target_path, content FROM config_schema.git_upload_session_content WHERE session_id = $1`, sessionID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return contents, nil
+		}
+		return nil, fmt.Errorf("list git upload session contents: %w", err)
+	}
+	for _, row := range rows {
+		contents[row.TargetPath] = row.Content
+	}
+	return contents, nil
+}
+
+// DeleteGitUploadSessionContentsContext drops the inline file bytes of
+// sessionID.
+func DeleteGitUploadSessionContentsContext(ctx context.Context, db *sqlx.DB, sessionID string) error {
+	if db == nil {
+		return nil
+	}
+	if _, err := db.ExecContext(ctx, `DELETE FROM config_schema.git_upload_session_content WHERE session_id = $1`, sessionID); err != nil {
+		return fmt.Errorf("delete git upload session contents: %w", err)
+	}
+	return nil
+}
+
+// PruneGitUploadSessionContentsContext drops the inline file bytes of
+// sessions that were finalized, cancelled or expired, or no longer exist.
+func PruneGitUploadSessionContentsContext(ctx context.Context, db *sqlx.DB) (int64, error) {
+	if db == nil {
+		return 0, nil
+	}
+	result, err := db.ExecContext(ctx, `
+		DELETE FROM config_schema.git_upload_session_content content
+		WHERE NOT EXISTS (
+			SELECT 1 FROM config_schema.git_upload_session session
+			WHERE session.id = content.session_id AND session.status IN ('pending_upload', 'ready_for_pr')
+		)
+	`)
+	if err != nil {
+		return 0, fmt.Errorf("prune git upload session contents: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("count pruned git upload session contents: %w", err)
+	}
+	return affected, nil
+}
@@ -0,0 +1,149 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	GitWebhookDeliveryProcessing = "processing"
+	GitWebhookDeliveryProcessed  = "processed"
+	GitWebhookDeliveryFailed     = "failed"
+)
+
+// ClaimGitWebhookDeliveryContext records a delivery as processing and reports
+// whether this call claimed it. A delivery that was already processed, or is
+// being processed, is not claimed again; a failed one is, so GitHub
+// redeliveries retry it. So is one still processing that was claimed before
+// staleBefore, which a process that stopped mid-delivery left behind.
+func ClaimGitWebhookDeliveryContext(ctx context.Context, db *sqlx.DB, delivery GitWebhookDelivery, staleBefore time.Time) (bool, error) {
+	if db == nil {
+		return true, nil
+	}
+	result, err := db.ExecContext(ctx, `
+		INSERT INTO config_schema.git_webhook_delivery (
+			delivery_id, event, action, status, error, received_at, processed_at
+		) VALUES (
+			$1, $2, $3, $4, NULL, $5, NULL
+		)
+		ON CONFLICT (delivery_id) DO UPDATE SET
+			status = EXCLUDED.status,
+			error = NULL,
+			received_at = EXCLUDED.received_at,
+			processed_at = NULL
+		WHERE config_schema.git_webhook_delivery.status = 'failed'
+			OR (config_schema.git_webhook_delivery.status = 'processing' AND config_schema.git_webhook_delivery.received_at < $6)
+	`, delivery.DeliveryID, delivery.Event, delivery.Action, GitWebhookDeliveryProcessing, delivery.ReceivedAt, staleBefore)
+	if err != nil {
+		return false, fmt.Errorf("claim git webhook delivery: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("claim git webhook delivery: %w", err)
+	}
+	return affected > 0, nil
+}
+
+// FinishGitWebhookDeliveryContext records the outcome of a claimed delivery.
+func FinishGitWebhookDeliveryContext(ctx context.Context, db *sqlx.DB, deliveryID string, status string, deliveryErr string) error {
+	if db == nil {
+		return nil
+	}
+	_, err := db.ExecContext(ctx, `
+		UPDATE config_schema.git_webhook_delivery
+		SET status = $2, error = $3, processed_at = NOW()
+		WHERE delivery_id = $1
+	`, deliveryID, status, sql.NullString{String: deliveryErr, Valid: deliveryErr != ""})
+	if err != nil {
+		return fmt.Errorf("finish git webhook delivery: %w", err)
+	}
+	return nil
+}
+
+// ListGitProjectStatesByRepositoryContext returns the projects backed by
+// host/owner/repo, compared case-insensitively as GitHub does.
+func ListGitProjectStatesByRepositoryContext(ctx context.Context, db *sqlx.DB, repoHost string, repoOwner string, repoName string) ([]GitProjectState, error) {
+	if db == nil {
+		return []GitProjectState{}, nil
+	}
+	states := []GitProjectState{}
+	if err := db.SelectContext(ctx, &states, `
+		SELECT project_id, repo_host, repo_owner, repo_name, installation_id, installation_target_type, installation_target, mirror_path, sync_state, default_branch, last_refreshed_at, last_error
+		FROM config_schema.git_project_state
+		WHERE lower(repo_host) = lower($1) AND lower(repo_owner) = lower($2) AND lower(repo_name) = lower($3)
+		ORDER BY project_id
+	`, repoHost, repoOwner, repoName); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return []GitProjectState{}, nil
+		}
+		return nil, fmt.Errorf("list git project states by repository: %w", err)
+	}
+	return states, nil
+}
+
+// ListGitProjectStatesByOwnerOrInstallationContext returns the projects whose
+// repository belongs to owner or that are bound to installationID.
+func ListGitProjectStatesByOwnerOrInstallationContext(ctx context.Context, db *sqlx.DB, repoOwner string, installationID int64) ([]GitProjectState, error) {
+	if db == nil {
+		return []GitProjectState{}, nil
+	}
+	states := []GitProjectState{}
+	if err := db.SelectContext(ctx, &states, `
+		SELECT project_id, repo_host, repo_owner, repo_name, installation_id, installation_target_type, installation_target, mirror_path, sync_state, default_branch, last_refreshed_at, last_error
+		FROM config_schema.git_project_state
+		WHERE lower(repo_owner) = lower($1) OR installation_id = $2
+		ORDER BY project_id
+	`, repoOwner, installationID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return []GitProjectState{}, nil
+		}
+		return nil, fmt.Errorf("list git project states by owner: %w", err)
+	}
+	return states, nil
+}
+
+// ListGitOrganizationStatesByInstallationContext returns the organizations
+// bound to installationID or whose installation target is target.
+func ListGitOrganizationStatesByInstallationContext(ctx context.Context, db *sqlx.DB, installationID int64, target string) ([]GitOrganizationState, error) {
+	if db == nil {
+		return []GitOrganizationState{}, nil
+	}
+	states := []GitOrganizationState{}
+	if err := db.SelectContext(ctx, &states, `
+		SELECT organization, installed, installation_id, installation_target_type, installation_target, html_url, repository_selection, configured_at, last_seen_at, updated_at, last_error
+		FROM config_schema.git_organization_state
+		WHERE installation_id = $1 OR lower(installation_target) = lower($2)
+		ORDER BY organization
+	`, installationID, target); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return []GitOrganizationState{}, nil
+		}
+		return nil, fmt.Errorf("list git organization states by installation: %w", err)
+	}
+	return states, nil
+}
+
+// ListGitUploadSessionsByBranchContext returns the upload sessions that
+// pushed branchName to host/owner/repo for a pull request. Direct-commit
+// sessions name the branch they updated and are left out.
+func ListGitUploadSessionsByBranchContext(ctx context.Context, db *sqlx.DB, repoHost string, repoOwner string, repoName string, branchName string) ([]GitUploadSession, error) {
+	if db == nil {
+		return []GitUploadSession{}, nil
+	}
+	sessions := []GitUploadSession{}
+	if err := db.SelectContext(ctx, &sessions, gitUploadSessionSelectSQL()+`
+		WHERE lower(repo_host) = lower($1) AND lower(repo_owner) = lower($2) AND lower(repo_name) = lower($3) AND branch_name = $4 AND commit_mode <> 'direct'
+		ORDER BY created_at
+	`, repoHost, repoOwner, repoName, branchName); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return []GitUploadSession{}, nil
+		}
+		return nil, fmt.Errorf("list git upload sessions by branch: %w", err)
+	}
+	return sessions, nil
+}
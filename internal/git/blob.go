@@ -0,0 +1,147 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// ErrGitByteRangeUnsatisfiable is returned by ParseGitByteRange for a range
+// that lies outside the blob.
+var ErrGitByteRangeUnsatisfiable = errors.New("requested range not satisfiable")
+
+// GitBlob is a file at a ref of a local mirror, ready to be streamed.
+type GitBlob struct {
+	Path        string
+	Name        string
+	Hash        string
+	Size        int64
+	ContentType string
+	file        *object.File
+}
+
+// OpenGitBlob looks up path in the tree of hash and detects its content type
+// from the extension, falling back to sniffing the first bytes.
+func OpenGitBlob(repo *gogit.Repository, ref string, hash plumbing.Hash, path string) (*GitBlob, error) {
+	normalizedPath := strings.Trim(strings.TrimSpace(path), "/")
+	if normalizedPath == "" {
+		return nil, fmt.Errorf("file path is required")
+	}
+	tree, err := commitTree(repo, ref, hash)
+	if err != nil {
+		return nil, err
+	}
+	file, err := tree.File(normalizedPath)
+	if err != nil {
+		return nil, fmt.Errorf("load git file %s: %w", normalizedPath, err)
+	}
+	blob := &GitBlob{
+		Path: normalizedPath,
+		Name: filepath.Base(normalizedPath),
+		Hash: file.Hash.String(),
+		Size: file.Size,
+		file: file,
+	}
+	blob.ContentType = mime.TypeByExtension(filepath.Ext(normalizedPath))
+	if blob.ContentType == "" {
+		reader, err := file.Reader()
+		if err != nil {
+			return nil, fmt.Errorf("open git file %s: %w", normalizedPath, err)
+		}
+		head, err := io.ReadAll(io.LimitReader(reader, 512))
+		_ = reader.Close()
+		if err != nil {
+			return nil, fmt.Errorf("read git file %s: %w", normalizedPath, err)
+		}
+		blob.ContentType = http.DetectContentType(head)
+	}
+	return blob, nil
+}
+
+// LFSPointer returns the LFS pointer the blob holds, or nil when it holds
+// ordinary content.
+func (blob *GitBlob) LFSPointer() *GitLFSPointerInfo {
+	return readGitLFSPointer(blob.file)
+}
+
+// ETag is the strong entity tag of the blob, derived from its hash.
+func (blob *GitBlob) ETag() string {
+	return `"` + blob.Hash + `"`
+}
+
+// Reader returns length bytes of the blob starting at offset start.
+func (blob *GitBlob) Reader(start int64, length int64) (io.ReadCloser, error) {
+	reader, err := blob.file.Reader()
+	if err != nil {
+		return nil, fmt.Errorf("open git file %s: %w", blob.Path, err)
+	}
+	if start > 0 {
+		if _, err := io.CopyN(io.Discard, reader, start); err != nil {
+			_ = reader.Close()
+			return nil, fmt.Errorf("seek git file %s: %w", blob.Path, err)
+		}
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(reader, length), reader}, nil
+}
+
+// ParseGitByteRange interprets a Range header against a blob of size bytes.
+// It reports partial=false when the whole blob should be sent, which is also
+// the answer for headers it does not support, such as multiple ranges.
+func ParseGitByteRange(header string, size int64) (start int64, length int64, partial bool, err error) {
+	header = strings.TrimSpace(header)
+	spec, ok := strings.CutPrefix(header, "bytes=")
+	if !ok || strings.Contains(spec, ",") {
+		return 0, size, false, nil
+	}
+	first, last, ok := strings.Cut(strings.TrimSpace(spec), "-")
+	if !ok {
+		return 0, size, false, nil
+	}
+	first, last = strings.TrimSpace(first), strings.TrimSpace(last)
+	switch {
+	case first == "" && last == "":
+		return 0, size, false, nil
+	case first == "":
+		suffix, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || suffix < 0 {
+			return 0, size, false, nil
+		}
+		if suffix == 0 || size == 0 {
+			return 0, 0, false, ErrGitByteRangeUnsatisfiable
+		}
+		if suffix > size {
+			suffix = size
+		}
+		return size - suffix, suffix, true, nil
+	}
+	start, err = strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 {
+		return 0, size, false, nil
+	}
+	if start >= size {
+		return 0, 0, false, ErrGitByteRangeUnsatisfiable
+	}
+	end := size - 1
+	if last != "" {
+		end, err = strconv.ParseInt(last, 10, 64)
+		if err != nil || end < start {
+			return 0, size, false, nil
+		}
+		if end >= size {
+			end = size - 1
+		}
+	}
+	return start, end - start + 1, true, nil
+}
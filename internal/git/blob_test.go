@@ -0,0 +1,83 @@
+package git
+
+import (
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	gogit "github.com/go-git/go-git/v5"
+)
+
+func TestParseGitByteRange(t *testing.T) {
+	cases := []struct {
+		header  string
+		start   int64
+		length  int64
+		partial bool
+		err     error
+	}{
+		{header: "", start: 0, length: 100},
+		{header: "bytes=0-9", start: 0, length: 10, partial: true},
+		{header: "bytes=90-", start: 90, length: 10, partial: true},
+		{header: "bytes=95-200", start: 95, length: 5, partial: true},
+		{header: "bytes=-20", start: 80, length: 20, partial: true},
+		{header: "bytes=-500", start: 0, length: 100, partial: true},
+		{header: "bytes=0-1,5-6", start: 0, length: 100},
+		{header: "items=0-1", start: 0, length: 100},
+		{header: "bytes=9-3", start: 0, length: 100},
+		{header: "bytes=100-", err: ErrGitByteRangeUnsatisfiable},
+		{header: "bytes=-0", err: ErrGitByteRangeUnsatisfiable},
+	}
+	for _, testCase := range cases {
+		start, length, partial, err := ParseGitByteRange(testCase.header, 100)
+		if !errors.Is(err, testCase.err) {
+			t.Fatalf("%q: expected error %v, got %v", testCase.header, testCase.err, err)
+		}
+		if err != nil {
+			continue
+		}
+		if start != testCase.start || length != testCase.length || partial != testCase.partial {
+			t.Fatalf("%q: expected %d+%d partial=%t, got %d+%d partial=%t", testCase.header, testCase.start, testCase.length, testCase.partial, start, length, partial)
+		}
+	}
+}
+
+func TestOpenGitBlobDetectsContentTypeAndReadsRanges(t *testing.T) {
+	root := t.TempDir()
+	repo, err := gogit.PlainInit(root, false)
+	if err != nil {
+		t.Fatalf("init repo: %v", err)
+	}
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	commitTestFile(t, repo, root, "data/table.csv", "a,b\n1,2\n", "alice", start)
+	head := commitTestFile(t, repo, root, "data/NOTES", "plain notes\n", "alice", start.Add(time.Minute))
+
+	csv, err := OpenGitBlob(repo, "master", head, "/data/table.csv")
+	if err != nil {
+		t.Fatalf("open csv: %v", err)
+	}
+	if csv.ContentType != "text/csv; charset=utf-8" || csv.Size != 8 || csv.ETag() != `"`+csv.Hash+`"` {
+		t.Fatalf("unexpected csv blob: %+v", csv)
+	}
+	reader, err := csv.Reader(4, 3)
+	if err != nil {
+		t.Fatalf("read csv range: %v", err)
+	}
+	content, err := io.ReadAll(reader)
+	_ = reader.Close()
+	if err != nil || string(content) != "1,2" {
+		t.Fatalf("expected range content %q, got %q (%v)", "1,2", content, err)
+	}
+
+	notes, err := OpenGitBlob(repo, "master", head, "data/NOTES")
+	if err != nil {
+		t.Fatalf("open notes: %v", err)
+	}
+	if notes.ContentType != "text/plain; charset=utf-8" {
+		t.Fatalf("expected sniffed text content type, got %q", notes.ContentType)
+	}
+	if _, err := OpenGitBlob(repo, "master", head, "data/missing.csv"); err == nil {
+		t.Fatal("expected a missing file to fail")
+	}
+}
@@ -0,0 +1,170 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+const (
+	GitChangeAdded    = "added"
+	GitChangeModified = "modified"
+	GitChangeDeleted  = "deleted"
+	GitChangeRenamed  = "renamed"
+)
+
+const (
+	// gitLFSPointerMaxSize bounds the blobs read when looking for LFS
+	// pointers; real pointer files are well under this.
+	gitLFSPointerMaxSize = 1024
+	// gitCompareMaxLineStatBytes is the largest blob line stats are computed
+	// for; larger files are reported without them.
+	gitCompareMaxLineStatBytes = 8 << 20
+)
+
+// BuildGitCompareResponse summarizes the changes between the trees of
+// baseHash and headHash. LFS pointers are compared by object rather than by
+// line, and their sizes are added up in the totals.
+func BuildGitCompareResponse(ctx context.Context, projectID string, baseRef string, baseHash plumbing.Hash, headRef string, headHash plumbing.Hash, repo *gogit.Repository) (*GitProjectCompareResponse, error) {
+	baseTree, err := commitTree(repo, baseRef, baseHash)
+	if err != nil {
+		return nil, err
+	}
+	headTree, err := commitTree(repo, headRef, headHash)
+	if err != nil {
+		return nil, err
+	}
+	changes, err := object.DiffTreeWithOptions(ctx, baseTree, headTree, object.DefaultDiffTreeOptions)
+	if err != nil {
+		return nil, fmt.Errorf("diff %s..%s: %w", baseRef, headRef, err)
+	}
+	response := &GitProjectCompareResponse{
+		ProjectID: projectID,
+		BaseRef:   baseRef,
+		BaseSHA:   baseHash.String(),
+		HeadRef:   headRef,
+		HeadSHA:   headHash.String(),
+		Files:     make([]GitCompareFileChange, 0, len(changes)),
+	}
+	for _, change := range changes {
+		fileChange, err := buildGitCompareFileChange(ctx, change)
+		if err != nil {
+			return nil, err
+		}
+		response.Files = append(response.Files, fileChange)
+		response.Totals.Additions += fileChange.Additions
+		response.Totals.Deletions += fileChange.Deletions
+		if fileChange.LFS != nil && fileChange.LFS.OldOID != fileChange.LFS.NewOID {
+			response.Totals.LFSBytesAdded += fileChange.LFS.NewSize
+			response.Totals.LFSBytesRemoved += fileChange.LFS.OldSize
+		}
+	}
+	sort.Slice(response.Files, func(i, j int) bool {
+		return response.Files[i].Path < response.Files[j].Path
+	})
+	response.Totals.FilesChanged = len(response.Files)
+	return response, nil
+}
+
+// ResolveGitCompareRef resolves ref like ResolveGitReference but without the
+// fallback to HEAD, so a misspelled ref is an error rather than a silent
+// comparison against the default branch.
+func ResolveGitCompareRef(repo *gogit.Repository, ref string) (string, plumbing.Hash, error) {
+	resolved, hash, err := ResolveGitReference(repo, ref, "")
+	if err != nil {
+		return "", plumbing.ZeroHash, err
+	}
+	if resolved == "HEAD" && ref != "HEAD" {
+		return "", plumbing.ZeroHash, fmt.Errorf("could not resolve git ref %q", ref)
+	}
+	return resolved, hash, nil
+}
+
+func commitTree(repo *gogit.Repository, ref string, hash plumbing.Hash) (*object.Tree, error) {
+	commit, err := repo.CommitObject(hash)
+	if err != nil {
+		return nil, fmt.Errorf("load commit for ref %s: %w", ref, err)
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("load git tree for ref %s: %w", ref, err)
+	}
+	return tree, nil
+}
+
+func buildGitCompareFileChange(ctx context.Context, change *object.Change) (GitCompareFileChange, error) {
+	from, to, err := change.Files()
+	if err != nil {
+		return GitCompareFileChange{}, fmt.Errorf("load files of change %s: %w", change, err)
+	}
+	fileChange := GitCompareFileChange{Path: change.To.Name}
+	switch {
+	case from == nil:
+		fileChange.ChangeType = GitChangeAdded
+	case to == nil:
+		fileChange.ChangeType = GitChangeDeleted
+		fileChange.Path = change.From.Name
+	case change.From.Name != change.To.Name:
+		fileChange.ChangeType = GitChangeRenamed
+		fileChange.PreviousPath = change.From.Name
+	default:
+		fileChange.ChangeType = GitChangeModified
+	}
+
+	oldPointer := readGitLFSPointer(from)
+	newPointer := readGitLFSPointer(to)
+	if oldPointer != nil || newPointer != nil {
+		fileChange.LFS = &GitLFSChange{}
+		if oldPointer != nil {
+			fileChange.LFS.OldOID = oldPointer.OID
+			fileChange.LFS.OldSize = oldPointer.Size
+		}
+		if newPointer != nil {
+			fileChange.LFS.NewOID = newPointer.OID
+			fileChange.LFS.NewSize = newPointer.Size
+		}
+		return fileChange, nil
+	}
+
+	if (from != nil && from.Size > gitCompareMaxLineStatBytes) || (to != nil && to.Size > gitCompareMaxLineStatBytes) {
+		fileChange.LineStatsOmitted = true
+		return fileChange, nil
+	}
+	patch, err := change.PatchContext(ctx)
+	if err != nil {
+		return GitCompareFileChange{}, fmt.Errorf("diff %s: %w", fileChange.Path, err)
+	}
+	for _, filePatch := range patch.FilePatches() {
+		if filePatch.IsBinary() {
+			fileChange.Binary = true
+		}
+	}
+	for _, stat := range patch.Stats() {
+		fileChange.Additions += stat.Addition
+		fileChange.Deletions += stat.Deletion
+	}
+	return fileChange, nil
+}
+
+// readGitLFSPointer returns the LFS pointer stored in file, or nil when file
+// is absent or is not a pointer.
+func readGitLFSPointer(file *object.File) *GitLFSPointerInfo {
+	if file == nil || file.Size > gitLFSPointerMaxSize {
+		return nil
+	}
+	reader, err := file.Reader()
+	if err != nil {
+		return nil
+	}
+	defer reader.Close()
+	content, err := io.ReadAll(io.LimitReader(reader, gitLFSPointerMaxSize))
+	if err != nil {
+		return nil
+	}
+	return ParseGitLFSPointer(content)
+}
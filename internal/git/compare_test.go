@@ -0,0 +1,77 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	gogit "github.com/go-git/go-git/v5"
+)
+
+func lfsPointerContent(oid string, size int64) string {
+	return fmt.Sprintf("version https://git-lfs.github.com/spec/v1\noid sha256:%s\nsize %d\n", oid, size)
+}
+
+func TestBuildGitCompareResponseSummarizesTextAndLFSChanges(t *testing.T) {
+	root := t.TempDir()
+	repo, err := gogit.PlainInit(root, false)
+	if err != nil {
+		t.Fatalf("init repo: %v", err)
+	}
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	oldOID := strings.Repeat("a", 64)
+	newOID := strings.Repeat("b", 64)
+	commitTestFile(t, repo, root, "notes.txt", "one\ntwo\nthree\n", "alice", start)
+	commitTestFile(t, repo, root, "data/big.bam", lfsPointerContent(oldOID, 1000), "alice", start.Add(time.Minute))
+	commitTestFile(t, repo, root, "data/gone.bam", lfsPointerContent(strings.Repeat("c", 64), 300), "alice", start.Add(2*time.Minute))
+	base := commitTestFile(t, repo, root, "docs/readme.md", "# readme\nsome long enough text for rename detection\n", "alice", start.Add(3*time.Minute))
+
+	commitTestFile(t, repo, root, "notes.txt", "one\n2\nthree\nfour\n", "bob", start.Add(4*time.Minute))
+	commitTestFile(t, repo, root, "data/big.bam", lfsPointerContent(newOID, 4000), "bob", start.Add(5*time.Minute))
+	worktree, err := repo.Worktree()
+	if err != nil {
+		t.Fatalf("load worktree: %v", err)
+	}
+	if _, err := worktree.Remove("data/gone.bam"); err != nil {
+		t.Fatalf("remove file: %v", err)
+	}
+	if err := os.Rename(filepath.Join(root, "docs/readme.md"), filepath.Join(root, "README.md")); err != nil {
+		t.Fatalf("rename file: %v", err)
+	}
+	if _, err := worktree.Remove("docs/readme.md"); err != nil {
+		t.Fatalf("stage rename source: %v", err)
+	}
+	head := commitTestFile(t, repo, root, "README.md", "# readme\nsome long enough text for rename detection\n", "bob", start.Add(6*time.Minute))
+
+	response, err := BuildGitCompareResponse(context.Background(), "org/project", "base", base, "head", head, repo)
+	if err != nil {
+		t.Fatalf("compare: %v", err)
+	}
+	changes := map[string]GitCompareFileChange{}
+	for _, change := range response.Files {
+		changes[change.Path] = change
+	}
+	if len(changes) != 4 {
+		t.Fatalf("expected 4 changed files, got %+v", response.Files)
+	}
+	if notes := changes["notes.txt"]; notes.ChangeType != GitChangeModified || notes.Additions != 2 || notes.Deletions != 1 {
+		t.Fatalf("unexpected notes.txt change: %+v", notes)
+	}
+	big := changes["data/big.bam"]
+	if big.LFS == nil || big.LFS.OldOID != oldOID || big.LFS.NewOID != newOID || big.LFS.NewSize != 4000 || big.Additions != 0 {
+		t.Fatalf("unexpected LFS change: %+v", big)
+	}
+	if gone := changes["data/gone.bam"]; gone.ChangeType != GitChangeDeleted || gone.LFS == nil || gone.LFS.OldSize != 300 {
+		t.Fatalf("unexpected deleted LFS change: %+v", gone)
+	}
+	if renamed := changes["README.md"]; renamed.ChangeType != GitChangeRenamed || renamed.PreviousPath != "docs/readme.md" {
+		t.Fatalf("unexpected rename: %+v", renamed)
+	}
+	if response.Totals.LFSBytesAdded != 4000 || response.Totals.LFSBytesRemoved != 1300 || response.Totals.FilesChanged != 4 {
+		t.Fatalf("unexpected totals: %+v", response.Totals)
+	}
+}
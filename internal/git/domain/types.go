@@ -54,6 +54,22 @@ type StorageConfig struct {
 	ProjectSubPath      string
 }
 
+// DRSAccessURL is a signed URL for the bytes of a DRS object, with any headers
+// the storage provider requires on the request.
+type DRSAccessURL struct {
+	URL     string
+	Headers map[string]string
+}
+
+// DRSObjectRecord is the index record of a DRS object: its size, sha256
+// checksum and the authz resource paths that govern access to it.
+type DRSObjectRecord struct {
+	ID     string
+	Size   int64
+	SHA256 string
+	Authz  []string
+}
+
 type HTTPStatusError struct {
 	StatusCode int
 	Code       string
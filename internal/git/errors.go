@@ -14,6 +14,7 @@ const (
 	ErrorKindNotFound     ErrorKind = "not_found"
 	ErrorKindDatabase     ErrorKind = "database"
 	ErrorKindUnauthorized ErrorKind = "unauthorized"
+	ErrorKindConflict     ErrorKind = "conflict"
 )
 
 type Error struct {
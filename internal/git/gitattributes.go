@@ -0,0 +1,257 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+const (
+	GitAttributesPath = ".gitattributes"
+
+	gitAttributesLFSAttributes = "filter=lfs diff=lfs merge=lfs -text"
+)
+
+// GitAttributesSource is the root .gitattributes of the commit an upload is
+// based on.
+type GitAttributesSource struct {
+	CommitSHA string
+	Content   string
+	// Policy tells which extensions can never be committed inline. Without
+	// it every extension is treated as one an inline file may use.
+	Policy *GitUploadPolicy
+	// regular indexes the files of the commit outside LFS. It is nil when
+	// the tree was not read, and then only exact paths are added.
+	regular *gitRegularFiles
+}
+
+// gitRegularFiles records the extensions and directories of the files a
+// commit keeps as regular blobs, which a new LFS pattern must not match.
+type gitRegularFiles struct {
+	extensions map[string]struct{}
+	dirs       map[string]struct{}
+}
+
+func newGitRegularFiles() *gitRegularFiles {
+	return &gitRegularFiles{extensions: map[string]struct{}{}, dirs: map[string]struct{}{}}
+}
+
+func (regular *gitRegularFiles) add(target string) {
+	if ext := gitAttributesExt(target); ext != "" {
+		regular.extensions[ext] = struct{}{}
+	}
+	for dir := path.Dir(target); dir != "."; dir = path.Dir(dir) {
+		regular.dirs[dir] = struct{}{}
+	}
+}
+
+// gitAttributesRule is one pattern line and whether it sets filter=lfs
+// (true) or unsets or overrides it (false).
+type gitAttributesRule struct {
+	pattern string
+	lfs     bool
+}
+
+// ReadGitAttributes returns the root .gitattributes of hash in a mirror,
+// with empty content when the commit has none, and indexes the files it
+// leaves outside LFS.
+func ReadGitAttributes(repo *gogit.Repository, hash plumbing.Hash) (*GitAttributesSource, error) {
+	commit, err := repo.CommitObject(hash)
+	if err != nil {
+		return nil, fmt.Errorf("load commit: %w", err)
+	}
+	source := &GitAttributesSource{CommitSHA: hash.String()}
+	content, err := readGitAttributesContent(commit)
+	if err != nil {
+		return nil, err
+	}
+	source.Content = content
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("load tree: %w", err)
+	}
+	rules := parseGitAttributes(content)
+	regular := newGitRegularFiles()
+	err = tree.Files().ForEach(func(file *object.File) error {
+		if !gitAttributesTracksLFS(rules, file.Name) {
+			regular.add(file.Name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list tree files: %w", err)
+	}
+	source.regular = regular
+	return source, nil
+}
+
+func readGitAttributesContent(commit *object.Commit) (string, error) {
+	file, err := commit.File(GitAttributesPath)
+	if errors.Is(err, object.ErrFileNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("load %s: %w", GitAttributesPath, err)
+	}
+	reader, err := file.Reader()
+	if err != nil {
+		return "", fmt.Errorf("open %s: %w", GitAttributesPath, err)
+	}
+	defer reader.Close()
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return "", fmt.Errorf("read %s: %w", GitAttributesPath, err)
+	}
+	return string(content), nil
+}
+
+// PlanGitAttributesLFS checks that the content of source routes each of
+// paths through the LFS filter. For every path it does not, it appends the
+// widest pattern that still leaves inline and the regular files of source
+// alone: *.ext for an extension that can never be inline and that no
+// regular file uses, /dir/** for a directory with no regular file, or the
+// anchored path itself. It returns the updated content and the patterns
+// added, in order; content is unchanged when nothing was added.
+func PlanGitAttributesLFS(source *GitAttributesSource, paths []string, inline []string) (string, []string) {
+	content := source.Content
+	rules := parseGitAttributes(content)
+	kept := newGitRegularFiles()
+	for _, target := range inline {
+		kept.add(strings.Trim(target, "/"))
+	}
+	sorted := append([]string(nil), paths...)
+	sort.Strings(sorted)
+	added := []string{}
+	for _, target := range sorted {
+		target = strings.Trim(target, "/")
+		if target == "" || gitAttributesTracksLFS(rules, target) {
+			continue
+		}
+		pattern := source.patternFor(target, kept)
+		rules = append(rules, gitAttributesRule{pattern: pattern, lfs: true})
+		added = append(added, pattern)
+	}
+	if len(added) == 0 {
+		return content, added
+	}
+	var builder strings.Builder
+	builder.WriteString(content)
+	if content != "" && !strings.HasSuffix(content, "\n") {
+		builder.WriteString("\n")
+	}
+	for _, pattern := range added {
+		builder.WriteString(pattern + " " + gitAttributesLFSAttributes + "\n")
+	}
+	return builder.String(), added
+}
+
+func (source *GitAttributesSource) patternFor(target string, inline *gitRegularFiles) string {
+	if source.regular == nil {
+		return "/" + escapeGitAttributesPattern(target)
+	}
+	ext := gitAttributesExt(target)
+	_, regularExt := source.regular.extensions[ext]
+	_, inlineExt := inline.extensions[ext]
+	if ext != "" && !regularExt && !inlineExt && source.Policy.lfsOnlyExtension(ext) {
+		return "*" + ext
+	}
+	dir := path.Dir(target)
+	_, regularDir := source.regular.dirs[dir]
+	_, inlineDir := inline.dirs[dir]
+	if dir != "." && !regularDir && !inlineDir {
+		return "/" + escapeGitAttributesPattern(dir) + "/**"
+	}
+	return "/" + escapeGitAttributesPattern(target)
+}
+
+// gitAttributesExt is the extension a *.ext pattern for target would use,
+// or "" when it has none that can be written as one.
+func gitAttributesExt(target string) string {
+	base := path.Base(target)
+	ext := path.Ext(base)
+	if ext == "" || ext == base || strings.ContainsAny(ext, " \t[*?") {
+		return ""
+	}
+	return ext
+}
+
+// escapeGitAttributesPattern protects the characters a pattern line cannot
+// hold literally.
+func escapeGitAttributesPattern(value string) string {
+	replacer := strings.NewReplacer(" ", "[[:space:]]", "\t", "[[:space:]]", "[", "\\[", "*", "\\*", "?", "\\?")
+	return replacer.Replace(value)
+}
+
+func parseGitAttributes(content string) []gitAttributesRule {
+	rules := []gitAttributesRule{}
+	for _, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") || strings.HasPrefix(fields[0], "[attr]") {
+			continue
+		}
+		for _, attribute := range fields[1:] {
+			switch {
+			case attribute == "filter=lfs":
+				rules = append(rules, gitAttributesRule{pattern: fields[0], lfs: true})
+			case attribute == "-filter" || attribute == "!filter" || strings.HasPrefix(attribute, "filter="):
+				rules = append(rules, gitAttributesRule{pattern: fields[0], lfs: false})
+			}
+		}
+	}
+	return rules
+}
+
+// gitAttributesTracksLFS applies rules in order; as in git, the last
+// matching line decides.
+func gitAttributesTracksLFS(rules []gitAttributesRule, target string) bool {
+	tracked := false
+	for _, rule := range rules {
+		if gitAttributesMatch(rule.pattern, target) {
+			tracked = rule.lfs
+		}
+	}
+	return tracked
+}
+
+// gitAttributesMatch follows gitignore pattern rules without negation: a
+// pattern with no slash matches the file name at any depth, and one with a
+// slash is anchored at the repository root, where ** spans directories.
+func gitAttributesMatch(pattern string, target string) bool {
+	pattern = strings.ReplaceAll(pattern, "[[:space:]]", "[ \t]")
+	if !strings.Contains(strings.TrimSuffix(pattern, "/"), "/") {
+		matched, _ := path.Match(pattern, path.Base(target))
+		return matched
+	}
+	return gitAttributesMatchSegments(strings.Split(strings.TrimPrefix(pattern, "/"), "/"), strings.Split(target, "/"))
+}
+
+func gitAttributesMatchSegments(pattern []string, target []string) bool {
+	if len(pattern) == 0 {
+		return len(target) == 0
+	}
+	if pattern[0] == "**" {
+		if len(pattern) == 1 {
+			return len(target) > 0
+		}
+		for skip := 0; skip <= len(target); skip++ {
+			if gitAttributesMatchSegments(pattern[1:], target[skip:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(target) == 0 {
+		return false
+	}
+	if matched, _ := path.Match(pattern[0], target[0]); !matched {
+		return false
+	}
+	return gitAttributesMatchSegments(pattern[1:], target[1:])
+}
@@ -0,0 +1,107 @@
+package git
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	gogit "github.com/go-git/go-git/v5"
+)
+
+func TestGitAttributesTracksLFS(t *testing.T) {
+	rules := parseGitAttributes(strings.Join([]string{
+		"# data files",
+		"*.bam filter=lfs diff=lfs merge=lfs -text",
+		"raw/** filter=lfs diff=lfs merge=lfs -text",
+		"/top.dat filter=lfs -text",
+		"docs/*.bam -filter",
+		"**/images/*.png filter=lfs",
+		"notes[[:space:]]dir/** filter=lfs",
+		"*.txt text eol=lf",
+	}, "\n"))
+	cases := map[string]bool{
+		"sample.bam":                true,
+		"data/deep/sample.bam":      true,
+		"docs/sample.bam":           false,
+		"raw/run1/reads.fq":         true,
+		"rawdata/reads.fq":          false,
+		"top.dat":                   true,
+		"nested/top.dat":            false,
+		"site/images/logo.png":      true,
+		"images/logo.png":           true,
+		"site/images/deep/logo.png": false,
+		"notes dir/a.txt":           true,
+		"README.txt":                false,
+	}
+	for target, want := range cases {
+		if got := gitAttributesTracksLFS(rules, target); got != want {
+			t.Fatalf("gitAttributesTracksLFS(%q) = %v, want %v", target, got, want)
+		}
+	}
+}
+
+func TestPlanGitAttributesLFSAddsMissingPatterns(t *testing.T) {
+	content := "*.bam filter=lfs diff=lfs merge=lfs -text"
+	regular := newGitRegularFiles()
+	for _, target := range []string{"README.md", "docs/notes.csv", "old data/keep/README"} {
+		regular.add(target)
+	}
+	policy := DefaultGitUploadPolicy()
+	source := &GitAttributesSource{Content: content, Policy: &policy, regular: regular}
+	paths := []string{"data/a.bam", "data/b.vcf", "data/c.vcf", "bin/reads", "reads", "old data/README", "tables/t.csv", "mixed/m.csv"}
+	updated, added := PlanGitAttributesLFS(source, paths, []string{"mixed/inline.tsv"})
+	if strings.Join(added, ",") != "/bin/**,*.vcf,/mixed/m.csv,/old[[:space:]]data/README,/reads,/tables/**" {
+		t.Fatalf("unexpected patterns %v", added)
+	}
+	want := content + "\n" +
+		"/bin/** filter=lfs diff=lfs merge=lfs -text\n" +
+		"*.vcf filter=lfs diff=lfs merge=lfs -text\n" +
+		"/mixed/m.csv filter=lfs diff=lfs merge=lfs -text\n" +
+		"/old[[:space:]]data/README filter=lfs diff=lfs merge=lfs -text\n" +
+		"/reads filter=lfs diff=lfs merge=lfs -text\n" +
+		"/tables/** filter=lfs diff=lfs merge=lfs -text\n"
+	if updated != want {
+		t.Fatalf("unexpected .gitattributes:\n%s", updated)
+	}
+	rules := parseGitAttributes(updated)
+	for _, target := range paths {
+		if !gitAttributesTracksLFS(rules, target) {
+			t.Fatalf("expected %s to be tracked after the update", target)
+		}
+	}
+	for _, target := range []string{"README.md", "docs/notes.csv", "old data/keep/README", "mixed/inline.tsv"} {
+		if gitAttributesTracksLFS(rules, target) {
+			t.Fatalf("expected %s to stay a regular file after the update", target)
+		}
+	}
+	source.Content = updated
+	if again, added := PlanGitAttributesLFS(source, []string{"data/d.vcf"}, nil); again != updated || len(added) != 0 {
+		t.Fatalf("expected covered paths to leave .gitattributes alone, got %v", added)
+	}
+	if updated, _ := PlanGitAttributesLFS(&GitAttributesSource{}, []string{"data/a.bam"}, nil); updated != "/data/a.bam filter=lfs diff=lfs merge=lfs -text\n" {
+		t.Fatalf("expected an unread tree to get exact paths, got %q", updated)
+	}
+}
+
+func TestReadGitAttributesFromMirror(t *testing.T) {
+	root := t.TempDir()
+	repo, err := gogit.PlainInit(root, false)
+	if err != nil {
+		t.Fatalf("init repo: %v", err)
+	}
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	first := commitTestFile(t, repo, root, "README.md", "hello", "alice", start)
+	second := commitTestFile(t, repo, root, GitAttributesPath, "*.bam filter=lfs\n", "alice", start.Add(time.Hour))
+
+	source, err := ReadGitAttributes(repo, first)
+	if err != nil || source.CommitSHA != first.String() || source.Content != "" {
+		t.Fatalf("expected no .gitattributes at the first commit, got %+v (%v)", source, err)
+	}
+	source, err = ReadGitAttributes(repo, second)
+	if err != nil || source.CommitSHA != second.String() || source.Content != "*.bam filter=lfs\n" {
+		t.Fatalf("unexpected .gitattributes %+v (%v)", source, err)
+	}
+	if _, ok := source.regular.extensions[".md"]; !ok {
+		t.Fatalf("expected README.md to be indexed as a regular file, got %+v", source.regular)
+	}
+}
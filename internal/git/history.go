@@ -0,0 +1,185 @@
+package git
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+)
+
+const (
+	DefaultGitCommitPageSize = 50
+	MaxGitCommitPageSize     = 200
+)
+
+// GitCommitQuery filters and pages a commit history listing.
+type GitCommitQuery struct {
+	Path   string
+	Since  *time.Time
+	Until  *time.Time
+	Author string
+	Cursor string
+	Limit  int
+}
+
+// gitCommitCursor pins a listing to the commit it started from so later pages
+// stay consistent when the ref moves in between.
+type gitCommitCursor struct {
+	head   plumbing.Hash
+	offset int
+}
+
+func (cursor gitCommitCursor) encode() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(cursor.head.String() + ":" + strconv.Itoa(cursor.offset)))
+}
+
+func parseGitCommitCursor(value string) (gitCommitCursor, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return gitCommitCursor{}, fmt.Errorf("decode cursor: %w", err)
+	}
+	head, offset, ok := strings.Cut(string(decoded), ":")
+	if !ok || !plumbing.IsHash(head) {
+		return gitCommitCursor{}, errors.New("malformed cursor")
+	}
+	parsedOffset, err := strconv.Atoi(offset)
+	if err != nil || parsedOffset < 0 {
+		return gitCommitCursor{}, errors.New("malformed cursor offset")
+	}
+	return gitCommitCursor{head: plumbing.NewHash(head), offset: parsedOffset}, nil
+}
+
+// BuildGitCommitsResponse lists the commits reachable from hash, newest first,
+// that match query.
+func BuildGitCommitsResponse(projectID string, ref string, repo *gogit.Repository, hash plumbing.Hash, query GitCommitQuery) (*GitProjectCommitsResponse, error) {
+	limit := query.Limit
+	if limit <= 0 {
+		limit = DefaultGitCommitPageSize
+	}
+	if limit > MaxGitCommitPageSize {
+		limit = MaxGitCommitPageSize
+	}
+	cursor := gitCommitCursor{head: hash}
+	if strings.TrimSpace(query.Cursor) != "" {
+		parsed, err := parseGitCommitCursor(strings.TrimSpace(query.Cursor))
+		if err != nil {
+			return nil, WrapError(ErrorKindValidation, http.StatusBadRequest, "invalid commit cursor", err, map[string]any{"cursor": query.Cursor})
+		}
+		cursor = parsed
+	}
+	normalizedPath := strings.Trim(strings.TrimSpace(query.Path), "/")
+	options := &gogit.LogOptions{
+		From:  cursor.head,
+		Order: gogit.LogOrderCommitterTime,
+		Since: query.Since,
+		Until: query.Until,
+	}
+	if normalizedPath != "" {
+		options.PathFilter = gitPathFilter(normalizedPath)
+	}
+	iter, err := repo.Log(options)
+	if err != nil {
+		return nil, fmt.Errorf("read git log for ref %s: %w", ref, err)
+	}
+	defer iter.Close()
+
+	author := strings.ToLower(strings.TrimSpace(query.Author))
+	commits := make([]GitCommit, 0, limit)
+	matched := 0
+	hasMore := false
+	err = iter.ForEach(func(commit *object.Commit) error {
+		if author != "" && !strings.Contains(strings.ToLower(commit.Author.Name), author) && !strings.Contains(strings.ToLower(commit.Author.Email), author) {
+			return nil
+		}
+		matched++
+		if matched <= cursor.offset {
+			return nil
+		}
+		if len(commits) == limit {
+			hasMore = true
+			return storer.ErrStop
+		}
+		gitCommit, err := buildGitCommit(commit)
+		if err != nil {
+			return err
+		}
+		commits = append(commits, gitCommit)
+		return nil
+	})
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("walk git log for ref %s: %w", ref, err)
+	}
+	response := &GitProjectCommitsResponse{ProjectID: projectID, Ref: ref, Path: normalizedPath, Commits: commits}
+	if hasMore {
+		response.NextCursor = gitCommitCursor{head: cursor.head, offset: cursor.offset + len(commits)}.encode()
+	}
+	return response, nil
+}
+
+func buildGitCommit(commit *object.Commit) (GitCommit, error) {
+	parents := make([]string, 0, len(commit.ParentHashes))
+	for _, parent := range commit.ParentHashes {
+		parents = append(parents, parent.String())
+	}
+	changedPaths, err := gitCommitChangedPaths(commit)
+	if err != nil {
+		return GitCommit{}, err
+	}
+	return GitCommit{
+		SHA:          commit.Hash.String(),
+		Parents:      parents,
+		Author:       GitCommitIdentity{Name: commit.Author.Name, Email: commit.Author.Email, When: commit.Author.When.UTC()},
+		Committer:    GitCommitIdentity{Name: commit.Committer.Name, Email: commit.Committer.Email, When: commit.Committer.When.UTC()},
+		Message:      commit.Message,
+		ChangedPaths: changedPaths,
+	}, nil
+}
+
+// gitCommitChangedPaths lists the paths commit changed relative to its first
+// parent, or every path for a root commit.
+func gitCommitChangedPaths(commit *object.Commit) ([]string, error) {
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("load tree of commit %s: %w", commit.Hash, err)
+	}
+	var parentTree *object.Tree
+	if commit.NumParents() > 0 {
+		parent, err := commit.Parent(0)
+		if err != nil {
+			return nil, fmt.Errorf("load parent of commit %s: %w", commit.Hash, err)
+		}
+		if parentTree, err = parent.Tree(); err != nil {
+			return nil, fmt.Errorf("load tree of commit %s: %w", parent.Hash, err)
+		}
+	}
+	changes, err := object.DiffTree(parentTree, tree)
+	if err != nil {
+		return nil, fmt.Errorf("diff commit %s: %w", commit.Hash, err)
+	}
+	seen := make(map[string]struct{}, len(changes))
+	paths := make([]string, 0, len(changes))
+	for _, change := range changes {
+		for _, name := range []string{change.From.Name, change.To.Name} {
+			if name == "" {
+				continue
+			}
+			if _, ok := seen[name]; ok {
+				continue
+			}
+			seen[name] = struct{}{}
+			paths = append(paths, name)
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
@@ -0,0 +1,103 @@
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+func commitTestFile(t *testing.T, repo *gogit.Repository, root string, path string, content string, author string, when time.Time) plumbing.Hash {
+	t.Helper()
+	fullPath := filepath.Join(root, path)
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0o755); err != nil {
+		t.Fatalf("create dir for %s: %v", path, err)
+	}
+	if err := os.WriteFile(fullPath, []byte(content), 0o644); err != nil {
+		t.Fatalf("write %s: %v", path, err)
+	}
+	worktree, err := repo.Worktree()
+	if err != nil {
+		t.Fatalf("load worktree: %v", err)
+	}
+	if _, err := worktree.Add(path); err != nil {
+		t.Fatalf("add %s: %v", path, err)
+	}
+	signature := &object.Signature{Name: author, Email: author + "@example.org", When: when}
+	hash, err := worktree.Commit("update "+path, &gogit.CommitOptions{Author: signature, Committer: signature})
+	if err != nil {
+		t.Fatalf("commit %s: %v", path, err)
+	}
+	return hash
+}
+
+func TestBuildGitCommitsResponseFiltersAndPages(t *testing.T) {
+	root := t.TempDir()
+	repo, err := gogit.PlainInit(root, false)
+	if err != nil {
+		t.Fatalf("init repo: %v", err)
+	}
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	first := commitTestFile(t, repo, root, "README.md", "hello", "alice", start)
+	commitTestFile(t, repo, root, "data/a.csv", "a", "bob", start.Add(time.Hour))
+	commitTestFile(t, repo, root, "data/b.csv", "b", "alice", start.Add(2*time.Hour))
+	head := commitTestFile(t, repo, root, "data/a.csv", "a2", "bob", start.Add(3*time.Hour))
+
+	all, err := BuildGitCommitsResponse("org/project", "master", repo, head, GitCommitQuery{})
+	if err != nil {
+		t.Fatalf("list commits: %v", err)
+	}
+	if len(all.Commits) != 4 || all.NextCursor != "" {
+		t.Fatalf("expected 4 commits on one page, got %d (cursor %q)", len(all.Commits), all.NextCursor)
+	}
+	if all.Commits[0].SHA != head.String() || all.Commits[3].SHA != first.String() {
+		t.Fatalf("expected newest first, got %s ... %s", all.Commits[0].SHA, all.Commits[3].SHA)
+	}
+	if len(all.Commits[3].Parents) != 0 || len(all.Commits[0].Parents) != 1 {
+		t.Fatalf("unexpected parents: %+v / %+v", all.Commits[0].Parents, all.Commits[3].Parents)
+	}
+	if got := all.Commits[3].ChangedPaths; len(got) != 1 || got[0] != "README.md" {
+		t.Fatalf("expected root commit to change README.md, got %v", got)
+	}
+
+	byPath, err := BuildGitCommitsResponse("org/project", "master", repo, head, GitCommitQuery{Path: "data/a.csv"})
+	if err != nil {
+		t.Fatalf("list commits by path: %v", err)
+	}
+	if len(byPath.Commits) != 2 || byPath.Commits[0].Author.Name != "bob" {
+		t.Fatalf("expected two bob commits for data/a.csv, got %+v", byPath.Commits)
+	}
+
+	since := start.Add(90 * time.Minute)
+	byAuthor, err := BuildGitCommitsResponse("org/project", "master", repo, head, GitCommitQuery{Author: "ALICE", Since: &since})
+	if err != nil {
+		t.Fatalf("list commits by author: %v", err)
+	}
+	if len(byAuthor.Commits) != 1 || byAuthor.Commits[0].ChangedPaths[0] != "data/b.csv" {
+		t.Fatalf("expected alice's data/b.csv commit, got %+v", byAuthor.Commits)
+	}
+
+	page, err := BuildGitCommitsResponse("org/project", "master", repo, head, GitCommitQuery{Limit: 3})
+	if err != nil {
+		t.Fatalf("list first page: %v", err)
+	}
+	if len(page.Commits) != 3 || page.NextCursor == "" {
+		t.Fatalf("expected a full first page with a cursor, got %d (cursor %q)", len(page.Commits), page.NextCursor)
+	}
+	commitTestFile(t, repo, root, "data/c.csv", "c", "carol", start.Add(4*time.Hour))
+	next, err := BuildGitCommitsResponse("org/project", "master", repo, head, GitCommitQuery{Limit: 3, Cursor: page.NextCursor})
+	if err != nil {
+		t.Fatalf("list second page: %v", err)
+	}
+	if len(next.Commits) != 1 || next.Commits[0].SHA != first.String() || next.NextCursor != "" {
+		t.Fatalf("expected the root commit on the last page, got %+v", next.Commits)
+	}
+
+	if _, err := BuildGitCommitsResponse("org/project", "master", repo, head, GitCommitQuery{Cursor: "not-a-cursor"}); err == nil {
+		t.Fatal("expected an invalid cursor to be rejected")
+	}
+}
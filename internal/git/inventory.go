@@ -0,0 +1,214 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"sync"
+
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+const (
+	GitLFSStoragePresent = "present"
+	GitLFSStorageMissing = "missing"
+)
+
+const (
+	// lfsInventoryCacheSize bounds how many commits keep an inventory in
+	// memory.
+	lfsInventoryCacheSize = 64
+	// lfsVerifyWorkers bounds concurrent syfon lookups while verifying.
+	lfsVerifyWorkers = 8
+)
+
+// lfsInventoryCache keeps the inventories of recently requested commits. A
+// commit's tree never changes, so entries never go stale; the oldest is
+// evicted when the cache is full.
+type lfsInventoryCache struct {
+	mu      sync.Mutex
+	limit   int
+	entries map[string]*GitLFSInventoryResponse
+	order   []string
+}
+
+func newLFSInventoryCache(limit int) *lfsInventoryCache {
+	return &lfsInventoryCache{limit: limit, entries: map[string]*GitLFSInventoryResponse{}}
+}
+
+func (cache *lfsInventoryCache) get(key string) *GitLFSInventoryResponse {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	return cache.entries[key]
+}
+
+func (cache *lfsInventoryCache) put(key string, inventory *GitLFSInventoryResponse) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if _, ok := cache.entries[key]; ok {
+		return
+	}
+	if len(cache.order) >= cache.limit {
+		delete(cache.entries, cache.order[0])
+		cache.order = cache.order[1:]
+	}
+	cache.entries[key] = inventory
+	cache.order = append(cache.order, key)
+}
+
+// LFSInventory lists the LFS pointers in the tree of hash, reusing the
+// inventory of an earlier request for the same commit of mirrorPath.
+func (service *GitService) LFSInventory(mirrorPath string, projectID string, ref string, repo *gogit.Repository, hash plumbing.Hash) (*GitLFSInventoryResponse, error) {
+	key := mirrorPath + "@" + hash.String()
+	inventory := service.inventory.get(key)
+	if inventory == nil {
+		built, err := BuildGitLFSInventory(repo, ref, hash)
+		if err != nil {
+			return nil, err
+		}
+		service.inventory.put(key, built)
+		inventory = built
+	}
+	response := *inventory
+	response.ProjectID = projectID
+	response.Ref = ref
+	return &response, nil
+}
+
+// BuildGitLFSInventory walks the full tree of hash and collects every LFS
+// pointer with totals, duplicated objects and per-directory rollups.
+func BuildGitLFSInventory(repo *gogit.Repository, ref string, hash plumbing.Hash) (*GitLFSInventoryResponse, error) {
+	tree, err := commitTree(repo, ref, hash)
+	if err != nil {
+		return nil, err
+	}
+	inventory := &GitLFSInventoryResponse{
+		Ref:         ref,
+		CommitSHA:   hash.String(),
+		Objects:     []GitLFSInventoryEntry{},
+		Duplicates:  []GitLFSDuplicate{},
+		Directories: []GitLFSDirectoryRollup{},
+	}
+	files := tree.Files()
+	defer files.Close()
+	err = files.ForEach(func(file *object.File) error {
+		if !file.Mode.IsFile() {
+			return nil
+		}
+		if pointer := readGitLFSPointer(file); pointer != nil {
+			inventory.Objects = append(inventory.Objects, GitLFSInventoryEntry{Path: file.Name, OID: pointer.OID, Size: pointer.Size})
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("walk git tree for ref %s: %w", ref, err)
+	}
+	sort.Slice(inventory.Objects, func(i, j int) bool {
+		return inventory.Objects[i].Path < inventory.Objects[j].Path
+	})
+
+	byOID := map[string]*GitLFSDuplicate{}
+	directories := map[string]*GitLFSDirectoryRollup{}
+	for _, entry := range inventory.Objects {
+		inventory.Totals.Pointers++
+		inventory.Totals.Bytes += entry.Size
+		if existing, ok := byOID[entry.OID]; ok {
+			existing.Paths = append(existing.Paths, entry.Path)
+		} else {
+			byOID[entry.OID] = &GitLFSDuplicate{OID: entry.OID, Size: entry.Size, Paths: []string{entry.Path}}
+			inventory.Totals.UniqueObjects++
+			inventory.Totals.UniqueBytes += entry.Size
+		}
+		for dir := path.Dir(entry.Path); dir != "."; dir = path.Dir(dir) {
+			rollup, ok := directories[dir]
+			if !ok {
+				rollup = &GitLFSDirectoryRollup{Path: dir}
+				directories[dir] = rollup
+			}
+			rollup.Pointers++
+			rollup.Bytes += entry.Size
+		}
+	}
+	for _, duplicate := range byOID {
+		if len(duplicate.Paths) > 1 {
+			inventory.Duplicates = append(inventory.Duplicates, *duplicate)
+		}
+	}
+	sort.Slice(inventory.Duplicates, func(i, j int) bool {
+		return inventory.Duplicates[i].OID < inventory.Duplicates[j].OID
+	})
+	for _, rollup := range directories {
+		inventory.Directories = append(inventory.Directories, *rollup)
+	}
+	sort.Slice(inventory.Directories, func(i, j int) bool {
+		return inventory.Directories[i].Path < inventory.Directories[j].Path
+	})
+	return inventory, nil
+}
+
+// VerifyLFSInventory returns a copy of inventory with each pointer marked
+// present or missing depending on whether its object is registered in
+// storage.
+func (service *LFSDownloadService) VerifyLFSInventory(ctx context.Context, authorizationHeader string, projectID string, inventory *GitLFSInventoryResponse) (*GitLFSInventoryResponse, error) {
+	oids := []string{}
+	seen := map[string]bool{}
+	for _, entry := range inventory.Objects {
+		if !seen[entry.OID] {
+			seen[entry.OID] = true
+			oids = append(oids, entry.OID)
+		}
+	}
+	present := make(map[string]bool, len(oids))
+	var (
+		mu       sync.Mutex
+		firstErr error
+		wait     sync.WaitGroup
+	)
+	work := make(chan string)
+	for range lfsVerifyWorkers {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			for oid := range work {
+				registered, err := service.objectRegistered(ctx, authorizationHeader, projectID, oid)
+				mu.Lock()
+				if err != nil && firstErr == nil {
+					firstErr = err
+				}
+				present[oid] = registered
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, oid := range oids {
+		work <- oid
+	}
+	close(work)
+	wait.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	verified := *inventory
+	verified.Verified = true
+	verified.Totals.MissingObjects = 0
+	verified.Objects = make([]GitLFSInventoryEntry, len(inventory.Objects))
+	for index, entry := range inventory.Objects {
+		entry.StorageStatus = GitLFSStoragePresent
+		if !present[entry.OID] {
+			entry.StorageStatus = GitLFSStorageMissing
+		}
+		verified.Objects[index] = entry
+	}
+	for _, oid := range oids {
+		if !present[oid] {
+			verified.Totals.MissingObjects++
+		}
+	}
+	return &verified, nil
+}
@@ -0,0 +1,78 @@
+package git
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	gogit "github.com/go-git/go-git/v5"
+)
+
+func TestBuildGitLFSInventoryTotalsDuplicatesAndDirectories(t *testing.T) {
+	root := t.TempDir()
+	repo, err := gogit.PlainInit(root, false)
+	if err != nil {
+		t.Fatalf("init repo: %v", err)
+	}
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	shared := strings.Repeat("a", 64)
+	commitTestFile(t, repo, root, "README.md", "# readme\n", "alice", start)
+	commitTestFile(t, repo, root, "data/raw/sample.bam", lfsPointerContent(shared, 1000), "alice", start.Add(time.Minute))
+	commitTestFile(t, repo, root, "data/copy.bam", lfsPointerContent(shared, 1000), "alice", start.Add(2*time.Minute))
+	head := commitTestFile(t, repo, root, "other.vcf", lfsPointerContent(strings.Repeat("b", 64), 200), "alice", start.Add(3*time.Minute))
+
+	inventory, err := BuildGitLFSInventory(repo, "main", head)
+	if err != nil {
+		t.Fatalf("build inventory: %v", err)
+	}
+	if inventory.CommitSHA != head.String() || len(inventory.Objects) != 3 {
+		t.Fatalf("unexpected inventory: %+v", inventory)
+	}
+	if inventory.Objects[0].Path != "data/copy.bam" || inventory.Objects[2].Path != "other.vcf" {
+		t.Fatalf("expected objects sorted by path, got %+v", inventory.Objects)
+	}
+	expectedTotals := GitLFSInventoryTotals{Pointers: 3, Bytes: 2200, UniqueObjects: 2, UniqueBytes: 1200}
+	if inventory.Totals != expectedTotals {
+		t.Fatalf("unexpected totals: %+v", inventory.Totals)
+	}
+	if len(inventory.Duplicates) != 1 || inventory.Duplicates[0].OID != shared || len(inventory.Duplicates[0].Paths) != 2 {
+		t.Fatalf("unexpected duplicates: %+v", inventory.Duplicates)
+	}
+	expectedDirectories := []GitLFSDirectoryRollup{
+		{Path: "data", Pointers: 2, Bytes: 2000},
+		{Path: "data/raw", Pointers: 1, Bytes: 1000},
+	}
+	if len(inventory.Directories) != len(expectedDirectories) {
+		t.Fatalf("unexpected directories: %+v", inventory.Directories)
+	}
+	for index, expected := range expectedDirectories {
+		if inventory.Directories[index] != expected {
+			t.Fatalf("directory %d: expected %+v, got %+v", index, expected, inventory.Directories[index])
+		}
+	}
+}
+
+func TestGitServiceLFSInventoryCachesByCommit(t *testing.T) {
+	root := t.TempDir()
+	repo, err := gogit.PlainInit(root, false)
+	if err != nil {
+		t.Fatalf("init repo: %v", err)
+	}
+	head := commitTestFile(t, repo, root, "data/sample.bam", lfsPointerContent(strings.Repeat("a", 64), 10), "alice", time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	service := &GitService{inventory: newLFSInventoryCache(1)}
+
+	first, err := service.LFSInventory(root, "org/project", "main", repo, head)
+	if err != nil {
+		t.Fatalf("first inventory: %v", err)
+	}
+	second, err := service.LFSInventory(root, "org/project", "v1", nil, head)
+	if err != nil {
+		t.Fatalf("cached inventory: %v", err)
+	}
+	if second.Ref != "v1" || second.ProjectID != "org/project" || second.Totals != first.Totals {
+		t.Fatalf("expected cached inventory relabelled for the request, got %+v", second)
+	}
+	if first.Ref != "main" {
+		t.Fatalf("expected first response to keep its ref, got %q", first.Ref)
+	}
+}
@@ -0,0 +1,438 @@
+package git
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	geckodb "github.com/calypr/gecko/internal/db"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/uc-cdis/arborist/arborist"
+)
+
+const (
+	GitRefreshJobQueued    = "queued"
+	GitRefreshJobRunning   = "running"
+	GitRefreshJobSucceeded = "succeeded"
+	GitRefreshJobFailed    = "failed"
+)
+
+const (
+	GitRefreshPhaseQueued        = "queued"
+	GitRefreshPhaseTokenExchange = "token_exchange"
+	GitRefreshPhaseMetadata      = "metadata"
+	GitRefreshPhaseClone         = "clone"
+	GitRefreshPhaseFetch         = "fetch"
+	GitRefreshPhasePull          = "pull"
+	GitRefreshPhaseIndex         = "index"
+	GitRefreshPhaseDone          = "done"
+)
+
+const (
+	refreshJobTimeout       = 30 * time.Minute
+	refreshJobPersistPeriod = 500 * time.Millisecond
+	refreshJobPruneInterval = time.Hour
+)
+
+// DefaultRefreshJobRetention is how long finished refresh jobs are kept
+// unless WithRetention says otherwise.
+const DefaultRefreshJobRetention = 30 * 24 * time.Hour
+
+// gitProgressPattern matches the sideband progress lines git servers emit,
+// e.g. "Receiving objects:  42% (420/1000), 1.20 MiB | 2.00 MiB/s".
+var gitProgressPattern = regexp.MustCompile(`^([A-Za-z ]+):\s+(\d+)% \((\d+)/(\d+)\)`)
+
+// RefreshObserver receives the phase changes of a mirror refresh. Its Write
+// method receives go-git's sideband progress output.
+type RefreshObserver interface {
+	io.Writer
+	SetPhase(phase string)
+}
+
+func observePhase(observer RefreshObserver, phase string) {
+	if observer != nil {
+		observer.SetPhase(phase)
+	}
+}
+
+func observerProgress(observer RefreshObserver) io.Writer {
+	if observer == nil {
+		return nil
+	}
+	return observer
+}
+
+// RefreshJobRequest describes a refresh to run in the background.
+type RefreshJobRequest struct {
+	ProjectID           string
+	Organization        string
+	Project             string
+	Identity            GitRepositoryIdentity
+	State               *geckodb.GitProjectState
+	AuthorizationHeader string
+	RequestedBy         string
+}
+
+// refreshJobTriggeredBy is the requested_by of jobs queued by Trigger.
+const refreshJobTriggeredBy = "webhook"
+
+// RefreshJobService runs project refreshes in the background and records
+// their phase and progress in git_refresh_job so clients can poll them.
+type RefreshJobService struct {
+	db            *sqlx.DB
+	service       *GitService
+	logger        arborist.Logger
+	now           func() time.Time
+	authorization AuthorizationSource
+	retention     time.Duration
+
+	mu      sync.Mutex
+	active  map[string]*refreshJobRun
+	rootCtx context.Context
+	cancel  context.CancelFunc
+	running sync.WaitGroup
+}
+
+func NewRefreshJobService(db *sqlx.DB, service *GitService, logger arborist.Logger) *RefreshJobService {
+	rootCtx, cancel := context.WithCancel(context.Background())
+	return &RefreshJobService{
+		db:        db,
+		service:   service,
+		logger:    logger,
+		now:       time.Now,
+		retention: DefaultRefreshJobRetention,
+		active:    map[string]*refreshJobRun{},
+		rootCtx:   rootCtx,
+		cancel:    cancel,
+	}
+}
+
+// WithRetention sets how long finished jobs are kept before Start's pruning
+// deletes them. Zero keeps them forever.
+func (jobs *RefreshJobService) WithRetention(retention time.Duration) *RefreshJobService {
+	jobs.retention = retention
+	return jobs
+}
+
+// Start prunes finished jobs older than the retention immediately, then once
+// every hour until ctx is done or Stop is called. It does nothing when
+// retention is disabled.
+func (jobs *RefreshJobService) Start(ctx context.Context) {
+	if jobs.retention <= 0 {
+		return
+	}
+	jobs.running.Add(1)
+	go jobs.pruneLoop(ctx)
+}
+
+// Prune deletes the jobs that finished more than the retention before now.
+func (jobs *RefreshJobService) Prune(ctx context.Context, now time.Time) (int64, error) {
+	if jobs.retention <= 0 {
+		return 0, nil
+	}
+	return geckodb.DeleteFinishedGitRefreshJobsContext(ctx, jobs.db, now.UTC().Add(-jobs.retention))
+}
+
+func (jobs *RefreshJobService) pruneLoop(ctx context.Context) {
+	defer jobs.running.Done()
+	ticker := time.NewTicker(refreshJobPruneInterval)
+	defer ticker.Stop()
+	for {
+		if pruned, err := jobs.Prune(jobs.rootCtx, jobs.now()); err != nil {
+			if jobs.rootCtx.Err() == nil {
+				jobs.logger.Warning("could not delete finished git refresh jobs: %s", err)
+			}
+		} else if pruned > 0 {
+			jobs.logger.Info("deleted %d finished git refresh jobs", pruned)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-jobs.rootCtx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// WithAuthorization sets the source of the Fence authorization header used by
+// refreshes queued through Trigger. Without it Trigger queues nothing.
+func (jobs *RefreshJobService) WithAuthorization(source AuthorizationSource) *RefreshJobService {
+	jobs.authorization = source
+	return jobs
+}
+
+// Trigger queues a refresh of projectID outside of a user request,
+// authenticating with the configured authorization source. It reports false
+// when no source is configured or the project is not connected to a GitHub
+// installation.
+func (jobs *RefreshJobService) Trigger(ctx context.Context, projectID string) (bool, error) {
+	if jobs.authorization == nil {
+		return false, nil
+	}
+	state, err := geckodb.GitProjectStateByProjectIDContext(ctx, jobs.db, projectID)
+	if err != nil {
+		return false, err
+	}
+	if state == nil || !syncable(*state) {
+		return false, nil
+	}
+	organization, project, ok := strings.Cut(projectID, "/")
+	if !ok {
+		return false, nil
+	}
+	if _, err := jobs.Submit(ctx, RefreshJobRequest{
+		ProjectID:    projectID,
+		Organization: organization,
+		Project:      project,
+		Identity:     GitRepositoryIdentity{Host: state.RepoHost, Owner: state.RepoOwner, Repo: state.RepoName},
+		State:        state,
+		RequestedBy:  refreshJobTriggeredBy,
+	}); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Submit queues a refresh of request.ProjectID and returns its job. When the
+// project already has a queued or running job, that job is returned instead
+// of starting another.
+func (jobs *RefreshJobService) Submit(ctx context.Context, request RefreshJobRequest) (*geckodb.GitRefreshJob, error) {
+	jobs.mu.Lock()
+	defer jobs.mu.Unlock()
+	if run, ok := jobs.active[request.ProjectID]; ok {
+		job := run.snapshot()
+		return &job, nil
+	}
+	if jobs.rootCtx.Err() != nil {
+		return nil, NewError(ErrorKindConflict, http.StatusServiceUnavailable, "gecko is shutting down; refresh not started", map[string]any{"project_id": request.ProjectID})
+	}
+	existing, err := geckodb.ActiveGitRefreshJobByProjectContext(ctx, jobs.db, request.ProjectID)
+	if err != nil {
+		return nil, WrapError(ErrorKindDatabase, http.StatusInternalServerError, "failed to read refresh jobs", err, map[string]any{"project_id": request.ProjectID})
+	}
+	if existing != nil {
+		return existing, nil
+	}
+	now := jobs.now().UTC()
+	job := geckodb.GitRefreshJob{
+		ID:          uuid.NewString(),
+		ProjectID:   request.ProjectID,
+		Status:      GitRefreshJobQueued,
+		Phase:       GitRefreshPhaseQueued,
+		RequestedBy: sql.NullString{String: request.RequestedBy, Valid: request.RequestedBy != ""},
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := geckodb.UpsertGitRefreshJobContext(ctx, jobs.db, job); err != nil {
+		return nil, WrapError(ErrorKindDatabase, http.StatusInternalServerError, "failed to record refresh job", err, map[string]any{"project_id": request.ProjectID})
+	}
+	run := &refreshJobRun{jobs: jobs, job: job}
+	jobs.active[request.ProjectID] = run
+	jobs.running.Add(1)
+	go jobs.run(run, request)
+	return &job, nil
+}
+
+// Get returns the job with id, preferring the in-memory state of a running
+// job over its last persisted row. It returns nil when no such job exists.
+func (jobs *RefreshJobService) Get(ctx context.Context, id string) (*geckodb.GitRefreshJob, error) {
+	jobs.mu.Lock()
+	for _, run := range jobs.active {
+		if job := run.snapshot(); job.ID == id {
+			jobs.mu.Unlock()
+			return &job, nil
+		}
+	}
+	jobs.mu.Unlock()
+	job, err := geckodb.GitRefreshJobByIDContext(ctx, jobs.db, id)
+	if err != nil {
+		return nil, WrapError(ErrorKindDatabase, http.StatusInternalServerError, "failed to read refresh job", err, map[string]any{"job_id": id})
+	}
+	return job, nil
+}
+
+// Stop cancels running jobs and waits for them to record their outcome.
+func (jobs *RefreshJobService) Stop() {
+	jobs.cancel()
+	jobs.running.Wait()
+}
+
+func (jobs *RefreshJobService) run(run *refreshJobRun, request RefreshJobRequest) {
+	defer jobs.running.Done()
+	defer func() {
+		jobs.mu.Lock()
+		delete(jobs.active, request.ProjectID)
+		jobs.mu.Unlock()
+	}()
+	ctx, cancel := context.WithTimeout(jobs.rootCtx, refreshJobTimeout)
+	defer cancel()
+
+	run.start()
+	run.SetPhase(GitRefreshPhaseTokenExchange)
+	authorizationHeader := request.AuthorizationHeader
+	if authorizationHeader == "" && jobs.authorization != nil {
+		header, err := jobs.authorization(ctx)
+		if err != nil {
+			run.finish(ctx, fmt.Errorf("authorize background refresh: %w", err))
+			return
+		}
+		authorizationHeader = header
+	}
+	accessToken, err := jobs.service.RequestInstallationToken(ctx, authorizationHeader, request.Organization, request.Project, request.Identity, "read")
+	if err != nil {
+		run.finish(ctx, fmt.Errorf("exchange GitHub token with Fence: %w", err))
+		return
+	}
+	_, _, err = jobs.service.SyncProjectWithObserver(ctx, jobs.db, request.ProjectID, request.Identity, request.State, accessToken, run)
+	run.finish(ctx, err)
+}
+
+// refreshJobRun is the RefreshObserver of one running job. Phase changes are
+// persisted immediately; progress lines at most every refreshJobPersistPeriod.
+type refreshJobRun struct {
+	jobs *RefreshJobService
+
+	mu          sync.Mutex
+	job         geckodb.GitRefreshJob
+	partial     []byte
+	lastPersist time.Time
+}
+
+func (run *refreshJobRun) snapshot() geckodb.GitRefreshJob {
+	run.mu.Lock()
+	defer run.mu.Unlock()
+	return run.job
+}
+
+func (run *refreshJobRun) start() {
+	run.mu.Lock()
+	now := run.jobs.now().UTC()
+	run.job.Status = GitRefreshJobRunning
+	run.job.StartedAt = sql.NullTime{Time: now, Valid: true}
+	run.mu.Unlock()
+}
+
+func (run *refreshJobRun) SetPhase(phase string) {
+	run.mu.Lock()
+	if run.job.Phase == phase {
+		run.mu.Unlock()
+		return
+	}
+	run.job.Phase = phase
+	run.job.Stage = sql.NullString{}
+	run.job.ObjectsDone = 0
+	run.job.ObjectsTotal = 0
+	run.job.Percent = 0
+	run.mu.Unlock()
+	run.persist(run.jobs.rootCtx, true)
+}
+
+func (run *refreshJobRun) Write(p []byte) (int, error) {
+	run.mu.Lock()
+	run.partial = append(run.partial, p...)
+	for {
+		end := strings.IndexAny(string(run.partial), "\r\n")
+		if end < 0 {
+			break
+		}
+		line := strings.TrimSpace(string(run.partial[:end]))
+		run.partial = run.partial[end+1:]
+		if line != "" {
+			applyGitProgressLine(&run.job, line)
+		}
+	}
+	run.mu.Unlock()
+	run.persist(run.jobs.rootCtx, false)
+	return len(p), nil
+}
+
+func (run *refreshJobRun) finish(ctx context.Context, err error) {
+	run.mu.Lock()
+	now := run.jobs.now().UTC()
+	run.job.FinishedAt = sql.NullTime{Time: now, Valid: true}
+	if err != nil {
+		run.job.Status = GitRefreshJobFailed
+		run.job.Error = sql.NullString{String: err.Error(), Valid: true}
+	} else {
+		run.job.Status = GitRefreshJobSucceeded
+		run.job.Phase = GitRefreshPhaseDone
+		run.job.Percent = 100
+	}
+	jobID, projectID := run.job.ID, run.job.ProjectID
+	run.mu.Unlock()
+	if err != nil {
+		run.jobs.logger.Warning("git refresh job %s for %s failed: %s", jobID, projectID, err)
+	}
+	run.persist(context.WithoutCancel(ctx), true)
+}
+
+func (run *refreshJobRun) persist(ctx context.Context, force bool) {
+	run.mu.Lock()
+	now := run.jobs.now()
+	if !force && now.Sub(run.lastPersist) < refreshJobPersistPeriod {
+		run.mu.Unlock()
+		return
+	}
+	run.lastPersist = now
+	run.job.UpdatedAt = now.UTC()
+	job := run.job
+	run.mu.Unlock()
+	if err := geckodb.UpsertGitRefreshJobContext(ctx, run.jobs.db, job); err != nil {
+		run.jobs.logger.Warning("failed to persist git refresh job %s: %s", job.ID, err)
+	}
+}
+
+// applyGitProgressLine records one line of sideband output on job. Lines that
+// report object counts update the stage and counters; anything else is kept as
+// the latest message.
+func applyGitProgressLine(job *geckodb.GitRefreshJob, line string) {
+	match := gitProgressPattern.FindStringSubmatch(line)
+	if match == nil {
+		job.Message = sql.NullString{String: line, Valid: true}
+		return
+	}
+	percent, _ := strconv.Atoi(match[2])
+	done, _ := strconv.ParseInt(match[3], 10, 64)
+	total, _ := strconv.ParseInt(match[4], 10, 64)
+	job.Stage = sql.NullString{String: strings.TrimSpace(match[1]), Valid: true}
+	job.Percent = percent
+	job.ObjectsDone = done
+	job.ObjectsTotal = total
+	job.Message = sql.NullString{String: line, Valid: true}
+}
+
+func BuildGitRefreshJobResponse(job geckodb.GitRefreshJob) GitRefreshJobResponse {
+	response := GitRefreshJobResponse{
+		JobID:     job.ID,
+		ProjectID: job.ProjectID,
+		Status:    job.Status,
+		Phase:     job.Phase,
+		Progress: GitRefreshJobProgress{
+			Stage:        job.Stage.String,
+			ObjectsDone:  job.ObjectsDone,
+			ObjectsTotal: job.ObjectsTotal,
+			Percent:      job.Percent,
+			Message:      job.Message.String,
+		},
+		Error:       job.Error.String,
+		RequestedBy: job.RequestedBy.String,
+		CreatedAt:   job.CreatedAt,
+		UpdatedAt:   job.UpdatedAt,
+	}
+	if job.StartedAt.Valid {
+		response.StartedAt = &job.StartedAt.Time
+	}
+	if job.FinishedAt.Valid {
+		response.FinishedAt = &job.FinishedAt.Time
+	}
+	return response
+}
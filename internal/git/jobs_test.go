@@ -0,0 +1,87 @@
+package git
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	geckodb "github.com/calypr/gecko/internal/db"
+	"github.com/jmoiron/sqlx"
+)
+
+func TestRefreshJobRunParsesSidebandProgress(t *testing.T) {
+	jobs := NewRefreshJobService(nil, nil, nil)
+	defer jobs.Stop()
+	run := &refreshJobRun{jobs: jobs, job: geckodb.GitRefreshJob{ID: "job", ProjectID: "org/project", Phase: GitRefreshPhaseQueued}}
+
+	run.SetPhase(GitRefreshPhaseClone)
+	chunks := []string{
+		"Enumerating objects: 1000, done.\n",
+		"Receiving objects:  41% (410/1000)\rReceiving obj",
+		"ects:  42% (420/1000), 1.20 MiB | 2.00 MiB/s\r",
+	}
+	for _, chunk := range chunks {
+		if _, err := run.Write([]byte(chunk)); err != nil {
+			t.Fatalf("write progress: %v", err)
+		}
+	}
+	job := run.snapshot()
+	if job.Phase != GitRefreshPhaseClone {
+		t.Fatalf("expected clone phase, got %q", job.Phase)
+	}
+	if job.Stage.String != "Receiving objects" || job.Percent != 42 || job.ObjectsDone != 420 || job.ObjectsTotal != 1000 {
+		t.Fatalf("unexpected progress: %+v", job)
+	}
+
+	run.Write([]byte("Resolving deltas: 100% (7/7), done.\n"))
+	run.SetPhase(GitRefreshPhasePull)
+	job = run.snapshot()
+	if job.Phase != GitRefreshPhasePull || job.Stage.Valid || job.ObjectsDone != 0 || job.Percent != 0 {
+		t.Fatalf("expected progress to reset on phase change, got %+v", job)
+	}
+}
+
+func TestBuildGitRefreshJobResponseReportsCompletion(t *testing.T) {
+	run := &refreshJobRun{jobs: NewRefreshJobService(nil, nil, nil), job: geckodb.GitRefreshJob{ID: "job", ProjectID: "org/project"}}
+	run.start()
+	run.finish(run.jobs.rootCtx, nil)
+	response := BuildGitRefreshJobResponse(run.snapshot())
+	if response.Status != GitRefreshJobSucceeded || response.Phase != GitRefreshPhaseDone || response.StartedAt == nil || response.FinishedAt == nil {
+		t.Fatalf("unexpected response: %+v", response)
+	}
+}
+
+func TestRefreshJobTriggerNeedsAuthorization(t *testing.T) {
+	jobs := NewRefreshJobService(nil, nil, nil)
+	defer jobs.Stop()
+	queued, err := jobs.Trigger(context.Background(), "org/project")
+	if err != nil || queued {
+		t.Fatalf("expected no refresh without an authorization source, got %v, %v", queued, err)
+	}
+}
+
+func TestRefreshJobPruneDeletesJobsPastRetention(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("create sqlmock: %v", err)
+	}
+	defer db.Close()
+	jobs := NewRefreshJobService(sqlx.NewDb(db, "sqlmock"), nil, nil).WithRetention(7 * 24 * time.Hour)
+	defer jobs.Stop()
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	mock.ExpectExec(`DELETE FROM config_schema\.git_refresh_job\s+WHERE status IN \('succeeded', 'failed'\)`).
+		WithArgs(time.Date(2026, 3, 3, 12, 0, 0, 0, time.UTC)).
+		WillReturnResult(sqlmock.NewResult(0, 4))
+
+	pruned, err := jobs.Prune(context.Background(), now)
+	if err != nil {
+		t.Fatalf("prune: %v", err)
+	}
+	if pruned != 4 {
+		t.Fatalf("expected 4 pruned jobs, got %d", pruned)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,413 @@
+package git
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+)
+
+// gitLastModifiedCheckpointInterval is how many first-parent commits are
+// replayed between persisted indexes, so branches that fork from a long
+// history find an indexed ancestor close to their fork point.
+const gitLastModifiedCheckpointInterval = 256
+
+// gitLastModifiedCacheSize bounds how many decoded indexes stay in memory.
+const gitLastModifiedCacheSize = 32
+
+// gitLastModifiedIndexes keeps the indexes tree listings read most recently.
+// An index describes one commit, so entries never go stale.
+var gitLastModifiedIndexes = newGitLastModifiedCache(gitLastModifiedCacheSize)
+
+// gitLastModifiedEntry is the commit that last changed a path.
+type gitLastModifiedEntry struct {
+	Commit string    `json:"c"`
+	When   time.Time `json:"t"`
+}
+
+// gitLastModifiedIndex maps every file and directory of a commit's tree to
+// the commit that last changed it.
+type gitLastModifiedIndex struct {
+	Commit string                          `json:"commit"`
+	Paths  map[string]gitLastModifiedEntry `json:"paths"`
+}
+
+// gitLastModifiedCache keeps decoded indexes keyed by their file. Cached
+// indexes are shared between requests and must not be modified.
+type gitLastModifiedCache struct {
+	mu      sync.Mutex
+	limit   int
+	entries map[string]*gitLastModifiedIndex
+	order   []string
+}
+
+func newGitLastModifiedCache(limit int) *gitLastModifiedCache {
+	return &gitLastModifiedCache{limit: limit, entries: map[string]*gitLastModifiedIndex{}}
+}
+
+func (cache *gitLastModifiedCache) get(key string) *gitLastModifiedIndex {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	return cache.entries[key]
+}
+
+func (cache *gitLastModifiedCache) put(key string, index *gitLastModifiedIndex) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if _, ok := cache.entries[key]; ok {
+		return
+	}
+	if len(cache.order) >= cache.limit {
+		delete(cache.entries, cache.order[0])
+		cache.order = cache.order[1:]
+	}
+	cache.entries[key] = index
+	cache.order = append(cache.order, key)
+}
+
+// cachedGitLastModifiedIndex returns the persisted index of hash, or nil when
+// it has not been built yet. It never builds one; refreshes and
+// GitService.IndexLastModifiedInBackground do.
+func cachedGitLastModifiedIndex(repo *gogit.Repository, hash plumbing.Hash) (*gitLastModifiedIndex, error) {
+	dir, ok := gitLastModifiedIndexDir(repo)
+	if !ok {
+		return nil, nil
+	}
+	key := gitLastModifiedIndexPath(dir, hash)
+	if index := gitLastModifiedIndexes.get(key); index != nil {
+		return index, nil
+	}
+	index, err := readGitLastModifiedIndex(dir, hash)
+	if err != nil || index == nil {
+		return nil, err
+	}
+	gitLastModifiedIndexes.put(key, index)
+	return index, nil
+}
+
+// gitLastModifiedIndexExists reports whether hash has a persisted index.
+func gitLastModifiedIndexExists(dir string, hash plumbing.Hash) bool {
+	if gitLastModifiedIndexes.get(gitLastModifiedIndexPath(dir, hash)) != nil {
+		return true
+	}
+	_, err := os.Stat(gitLastModifiedIndexPath(dir, hash))
+	return err == nil
+}
+
+// lastModifiedBuilds tracks the indexes being built in the background so a
+// burst of listings of one commit starts a single build.
+type lastModifiedBuilds struct {
+	mu      sync.Mutex
+	running map[string]bool
+}
+
+func newLastModifiedBuilds() *lastModifiedBuilds {
+	return &lastModifiedBuilds{running: map[string]bool{}}
+}
+
+func (builds *lastModifiedBuilds) start(key string) bool {
+	builds.mu.Lock()
+	defer builds.mu.Unlock()
+	if builds.running[key] {
+		return false
+	}
+	builds.running[key] = true
+	return true
+}
+
+func (builds *lastModifiedBuilds) finish(key string) {
+	builds.mu.Lock()
+	defer builds.mu.Unlock()
+	delete(builds.running, key)
+}
+
+// IndexLastModifiedInBackground builds the last-modified index of hash in the
+// mirror at mirrorPath when it has none, without waiting for the build.
+// Listings of commits no refresh indexed, such as older commits, get their
+// dates once it finishes.
+func (service *GitService) IndexLastModifiedInBackground(mirrorPath string, repo *gogit.Repository, hash plumbing.Hash) {
+	dir, ok := gitLastModifiedIndexDir(repo)
+	if !ok || gitLastModifiedIndexExists(dir, hash) {
+		return
+	}
+	key := gitLastModifiedIndexPath(dir, hash)
+	if !service.indexing.start(key) {
+		return
+	}
+	go func() {
+		defer service.indexing.finish(key)
+		defer service.HoldMirror(mirrorPath)()
+		mirror, err := OpenRepository(mirrorPath)
+		if err == nil {
+			_, err = loadGitLastModifiedIndex(mirror, dir, hash)
+		}
+		if err != nil {
+			service.logWarning("failed to build last-modified index of %s in %s: %s", hash, mirrorPath, err)
+		}
+	}()
+}
+
+// IndexGitLastModified builds the last-modified index of every branch and
+// tag tip of repo that does not have one yet. Each index is computed from
+// the nearest indexed first-parent ancestor, so after a refresh only the new
+// commits are replayed.
+func IndexGitLastModified(repo *gogit.Repository) error {
+	dir, ok := gitLastModifiedIndexDir(repo)
+	if !ok {
+		return nil
+	}
+	iter, err := repo.References()
+	if err != nil {
+		return fmt.Errorf("list git refs: %w", err)
+	}
+	tips := map[plumbing.Hash]struct{}{}
+	err = iter.ForEach(func(reference *plumbing.Reference) error {
+		name := reference.Name()
+		if !name.IsBranch() && !name.IsRemote() && !name.IsTag() {
+			return nil
+		}
+		hash, err := repo.ResolveRevision(plumbing.Revision(name.String()))
+		if err != nil {
+			return nil
+		}
+		if _, err := repo.CommitObject(*hash); err == nil {
+			tips[*hash] = struct{}{}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("iterate git refs: %w", err)
+	}
+	for hash := range tips {
+		if _, err := loadGitLastModifiedIndex(repo, dir, hash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// gitLastModifiedIndexDir is where the indexes of repo are persisted, inside
+// its git directory. Repositories not stored on disk have none.
+func gitLastModifiedIndexDir(repo *gogit.Repository) (string, bool) {
+	storage, ok := repo.Storer.(*filesystem.Storage)
+	if !ok {
+		return "", false
+	}
+	return filepath.Join(storage.Filesystem().Root(), "gecko", "last-modified"), true
+}
+
+// loadGitLastModifiedIndex returns the index of hash, building and persisting
+// it when it is missing. With an empty dir nothing is read or written.
+func loadGitLastModifiedIndex(repo *gogit.Repository, dir string, hash plumbing.Hash) (*gitLastModifiedIndex, error) {
+	if dir != "" {
+		index, err := readGitLastModifiedIndex(dir, hash)
+		if err != nil || index != nil {
+			return index, err
+		}
+	}
+	return buildGitLastModifiedIndex(repo, dir, hash)
+}
+
+func buildGitLastModifiedIndex(repo *gogit.Repository, dir string, hash plumbing.Hash) (*gitLastModifiedIndex, error) {
+	// Walk the first-parent chain back to an indexed commit or the root.
+	var base *gitLastModifiedIndex
+	chain := []*object.Commit{}
+	for current := hash; ; {
+		if dir != "" && current != hash {
+			index, err := readGitLastModifiedIndex(dir, current)
+			if err != nil {
+				return nil, err
+			}
+			if index != nil {
+				base = index
+				break
+			}
+		}
+		commit, err := repo.CommitObject(current)
+		if err != nil {
+			return nil, fmt.Errorf("load commit %s: %w", current, err)
+		}
+		chain = append(chain, commit)
+		if commit.NumParents() == 0 {
+			break
+		}
+		current = commit.ParentHashes[0]
+	}
+	if base == nil {
+		base = &gitLastModifiedIndex{Paths: map[string]gitLastModifiedEntry{}}
+	}
+
+	index := base
+	for position := len(chain) - 1; position >= 0; position-- {
+		commit := chain[position]
+		if err := applyGitLastModifiedCommit(repo, dir, index, commit); err != nil {
+			return nil, err
+		}
+		index.Commit = commit.Hash.String()
+		replayed := len(chain) - position
+		if dir != "" && (position == 0 || replayed%gitLastModifiedCheckpointInterval == 0) {
+			if err := writeGitLastModifiedIndex(dir, index); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return index, nil
+}
+
+// applyGitLastModifiedCommit advances index, which describes the first parent
+// of commit, to describe commit itself. A path a merge brought in unchanged
+// from another parent keeps the commit that changed it on that side.
+func applyGitLastModifiedCommit(repo *gogit.Repository, dir string, index *gitLastModifiedIndex, commit *object.Commit) error {
+	tree, err := commit.Tree()
+	if err != nil {
+		return fmt.Errorf("load tree of commit %s: %w", commit.Hash, err)
+	}
+	var parentTree *object.Tree
+	otherParents := []*object.Commit{}
+	for position, parentHash := range commit.ParentHashes {
+		parent, err := repo.CommitObject(parentHash)
+		if err != nil {
+			return fmt.Errorf("load parent of commit %s: %w", commit.Hash, err)
+		}
+		if position > 0 {
+			otherParents = append(otherParents, parent)
+			continue
+		}
+		if parentTree, err = parent.Tree(); err != nil {
+			return fmt.Errorf("load tree of commit %s: %w", parent.Hash, err)
+		}
+	}
+	changes, err := object.DiffTree(parentTree, tree)
+	if err != nil {
+		return fmt.Errorf("diff commit %s: %w", commit.Hash, err)
+	}
+	own := gitLastModifiedEntry{Commit: commit.Hash.String(), When: commit.Committer.When.UTC()}
+	sideIndexes := map[plumbing.Hash]*gitLastModifiedIndex{}
+	for _, change := range changes {
+		if change.To.Name == "" {
+			delete(index.Paths, change.From.Name)
+			touchGitLastModifiedDirs(index, change.From.Name, own)
+			continue
+		}
+		entry := own
+		if len(otherParents) > 0 {
+			merged, err := mergedGitLastModifiedEntry(repo, dir, otherParents, sideIndexes, change.To.Name, change.To.TreeEntry.Hash)
+			if err != nil {
+				return err
+			}
+			if merged != nil {
+				entry = *merged
+			}
+		}
+		index.Paths[change.To.Name] = entry
+		touchGitLastModifiedDirs(index, change.To.Name, entry)
+	}
+	return nil
+}
+
+// mergedGitLastModifiedEntry finds the commit that last changed filePath on
+// the side of a merge whose content the merge kept, or nil when the content
+// is new in the merge itself. It reads the index of that side, building it
+// from its nearest indexed ancestor when it is missing, and keeps it in
+// sideIndexes for the other paths of the merge.
+func mergedGitLastModifiedEntry(repo *gogit.Repository, dir string, parents []*object.Commit, sideIndexes map[plumbing.Hash]*gitLastModifiedIndex, filePath string, blob plumbing.Hash) (*gitLastModifiedEntry, error) {
+	for _, parent := range parents {
+		tree, err := parent.Tree()
+		if err != nil {
+			return nil, fmt.Errorf("load tree of commit %s: %w", parent.Hash, err)
+		}
+		entry, err := tree.FindEntry(filePath)
+		if err != nil || entry.Hash != blob {
+			continue
+		}
+		index := sideIndexes[parent.Hash]
+		if index == nil {
+			if index, err = loadGitLastModifiedIndex(repo, dir, parent.Hash); err != nil {
+				return nil, err
+			}
+			sideIndexes[parent.Hash] = index
+		}
+		if merged, ok := index.Paths[filePath]; ok {
+			return &merged, nil
+		}
+	}
+	return nil, nil
+}
+
+// touchGitLastModifiedDirs records entry on every directory above filePath
+// unless the directory already has a later change.
+func touchGitLastModifiedDirs(index *gitLastModifiedIndex, filePath string, entry gitLastModifiedEntry) {
+	for dir := path.Dir(filePath); dir != "."; dir = path.Dir(dir) {
+		if existing, ok := index.Paths[dir]; ok && existing.When.After(entry.When) {
+			continue
+		}
+		index.Paths[dir] = entry
+	}
+}
+
+func gitLastModifiedIndexPath(dir string, hash plumbing.Hash) string {
+	return filepath.Join(dir, hash.String()+".json.gz")
+}
+
+func readGitLastModifiedIndex(dir string, hash plumbing.Hash) (*gitLastModifiedIndex, error) {
+	file, err := os.Open(gitLastModifiedIndexPath(dir, hash))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open last-modified index of %s: %w", hash, err)
+	}
+	defer file.Close()
+	reader, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, fmt.Errorf("read last-modified index of %s: %w", hash, err)
+	}
+	defer reader.Close()
+	var index gitLastModifiedIndex
+	if err := json.NewDecoder(reader).Decode(&index); err != nil {
+		return nil, fmt.Errorf("decode last-modified index of %s: %w", hash, err)
+	}
+	if index.Paths == nil {
+		index.Paths = map[string]gitLastModifiedEntry{}
+	}
+	return &index, nil
+}
+
+// writeGitLastModifiedIndex persists index through a temporary file so
+// readers never see a partial index.
+func writeGitLastModifiedIndex(dir string, index *gitLastModifiedIndex) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("create last-modified index dir: %w", err)
+	}
+	temp, err := os.CreateTemp(dir, "index-*.tmp")
+	if err != nil {
+		return fmt.Errorf("create last-modified index of %s: %w", index.Commit, err)
+	}
+	defer os.Remove(temp.Name())
+	writer := gzip.NewWriter(temp)
+	if err := json.NewEncoder(writer).Encode(index); err != nil {
+		_ = temp.Close()
+		return fmt.Errorf("encode last-modified index of %s: %w", index.Commit, err)
+	}
+	if err := writer.Close(); err != nil {
+		_ = temp.Close()
+		return fmt.Errorf("write last-modified index of %s: %w", index.Commit, err)
+	}
+	if err := temp.Close(); err != nil {
+		return fmt.Errorf("write last-modified index of %s: %w", index.Commit, err)
+	}
+	if err := os.Rename(temp.Name(), gitLastModifiedIndexPath(dir, plumbing.NewHash(index.Commit))); err != nil {
+		return fmt.Errorf("store last-modified index of %s: %w", index.Commit, err)
+	}
+	return nil
+}
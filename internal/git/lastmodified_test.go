@@ -0,0 +1,149 @@
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+func TestBuildGitTreeResponseReadsIncrementalLastModifiedIndex(t *testing.T) {
+	root := t.TempDir()
+	repo, err := gogit.PlainInit(root, false)
+	if err != nil {
+		t.Fatalf("init repo: %v", err)
+	}
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	readme := commitTestFile(t, repo, root, "README.md", "hello", "alice", start)
+	first := commitTestFile(t, repo, root, "data/a.txt", "a", "alice", start.Add(time.Minute))
+	if err := IndexGitLastModified(repo); err != nil {
+		t.Fatalf("index: %v", err)
+	}
+	indexDir, _ := gitLastModifiedIndexDir(repo)
+	if _, err := os.Stat(gitLastModifiedIndexPath(indexDir, first)); err != nil {
+		t.Fatalf("expected persisted index for %s: %v", first, err)
+	}
+
+	second := commitTestFile(t, repo, root, "data/nested/b.txt", "b", "bob", start.Add(2*time.Minute))
+	if err := IndexGitLastModified(repo); err != nil {
+		t.Fatalf("index after update: %v", err)
+	}
+	index, err := readGitLastModifiedIndex(indexDir, second)
+	if err != nil || index == nil {
+		t.Fatalf("expected persisted index for %s, got %v", second, err)
+	}
+
+	response, err := BuildGitTreeResponse("org/project", "master", "", repo, second)
+	if err != nil {
+		t.Fatalf("build tree: %v", err)
+	}
+	entries := map[string]GitTreeEntry{}
+	for _, entry := range response.Entries {
+		entries[entry.Path] = entry
+	}
+	assertLastModified(t, entries["README.md"], readme, start)
+	assertLastModified(t, entries["data"], second, start.Add(2*time.Minute))
+
+	response, err = BuildGitTreeResponse("org/project", "master", "data", repo, second)
+	if err != nil {
+		t.Fatalf("build nested tree: %v", err)
+	}
+	entries = map[string]GitTreeEntry{}
+	for _, entry := range response.Entries {
+		entries[entry.Path] = entry
+	}
+	assertLastModified(t, entries["data/a.txt"], first, start.Add(time.Minute))
+	assertLastModified(t, entries["data/nested"], second, start.Add(2*time.Minute))
+}
+
+func TestGitLastModifiedIndexKeepsMergedSideCommits(t *testing.T) {
+	root := t.TempDir()
+	repo, err := gogit.PlainInit(root, false)
+	if err != nil {
+		t.Fatalf("init repo: %v", err)
+	}
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	base := commitTestFile(t, repo, root, "README.md", "hello", "alice", start)
+	side := commitTestFile(t, repo, root, "side.txt", "side", "bob", start.Add(time.Minute))
+	worktree, err := repo.Worktree()
+	if err != nil {
+		t.Fatalf("load worktree: %v", err)
+	}
+	if err := worktree.Reset(&gogit.ResetOptions{Commit: base, Mode: gogit.HardReset}); err != nil {
+		t.Fatalf("reset to base: %v", err)
+	}
+	main := commitTestFile(t, repo, root, "main.txt", "main", "alice", start.Add(2*time.Minute))
+	if err := os.WriteFile(filepath.Join(root, "side.txt"), []byte("side"), 0o644); err != nil {
+		t.Fatalf("write merged file: %v", err)
+	}
+	if _, err := worktree.Add("side.txt"); err != nil {
+		t.Fatalf("add merged file: %v", err)
+	}
+	signature := &object.Signature{Name: "alice", Email: "alice@example.org", When: start.Add(3 * time.Minute)}
+	merge, err := worktree.Commit("merge side", &gogit.CommitOptions{Author: signature, Committer: signature, Parents: []plumbing.Hash{main, side}})
+	if err != nil {
+		t.Fatalf("commit merge: %v", err)
+	}
+
+	index, err := loadGitLastModifiedIndex(repo, "", merge)
+	if err != nil {
+		t.Fatalf("build index: %v", err)
+	}
+	if entry := index.Paths["side.txt"]; entry.Commit != side.String() {
+		t.Fatalf("expected side.txt attributed to %s, got %+v", side, entry)
+	}
+	if entry := index.Paths["main.txt"]; entry.Commit != main.String() {
+		t.Fatalf("expected main.txt attributed to %s, got %+v", main, entry)
+	}
+	if entry := index.Paths["README.md"]; entry.Commit != base.String() {
+		t.Fatalf("expected README.md attributed to %s, got %+v", base, entry)
+	}
+}
+
+func TestGitTreeListingsOnlyBuildLastModifiedIndexesInBackground(t *testing.T) {
+	root := t.TempDir()
+	repo, err := gogit.PlainInit(root, false)
+	if err != nil {
+		t.Fatalf("init repo: %v", err)
+	}
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	head := commitTestFile(t, repo, root, "README.md", "hello", "alice", start)
+
+	response, err := BuildGitTreeResponse("org/project", "master", "", repo, head)
+	if err != nil {
+		t.Fatalf("build tree: %v", err)
+	}
+	if len(response.Entries) != 1 || response.Entries[0].LastModifiedAt != nil {
+		t.Fatalf("expected a listing without dates before the index is built, got %+v", response.Entries)
+	}
+	indexDir, _ := gitLastModifiedIndexDir(repo)
+	if gitLastModifiedIndexExists(indexDir, head) {
+		t.Fatal("expected the listing not to build the index")
+	}
+
+	service := NewGitService(GitServiceConfig{DataDir: t.TempDir()})
+	service.IndexLastModifiedInBackground(root, repo, head)
+	deadline := time.Now().Add(5 * time.Second)
+	for !gitLastModifiedIndexExists(indexDir, head) {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the background build to persist the index")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	response, err = BuildGitTreeResponse("org/project", "master", "", repo, head)
+	if err != nil {
+		t.Fatalf("build tree: %v", err)
+	}
+	assertLastModified(t, response.Entries[0], head, start)
+}
+
+func assertLastModified(t *testing.T, entry GitTreeEntry, commit plumbing.Hash, when time.Time) {
+	t.Helper()
+	if entry.LastCommitSHA != commit.String() || entry.LastModifiedAt == nil || !entry.LastModifiedAt.Equal(when) {
+		t.Fatalf("expected %s last modified by %s at %s, got %+v", entry.Path, commit, when, entry)
+	}
+}
@@ -0,0 +1,126 @@
+package git
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	geckodb "github.com/calypr/gecko/internal/db"
+	"github.com/calypr/gecko/internal/git/domain"
+	"github.com/calypr/gecko/internal/integrations/syfon"
+	"github.com/jmoiron/sqlx"
+)
+
+// DRSAccessURL is an alias for domain.DRSAccessURL.
+type DRSAccessURL = domain.DRSAccessURL
+
+// LFSDownloadService resolves LFS pointers in a project's repository to
+// signed URLs for the data they stand for.
+type LFSDownloadService struct {
+	db      *sqlx.DB
+	storage *syfon.Manager
+	client  *http.Client
+}
+
+// lfsDataHeaderTimeout bounds how long a storage backend may take to start
+// answering a data request. The body of a large object may stream for longer.
+const lfsDataHeaderTimeout = 30 * time.Second
+
+func NewLFSDownloadService(db *sqlx.DB, storage *syfon.Manager) *LFSDownloadService {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = lfsDataHeaderTimeout
+	return &LFSDownloadService{db: db, storage: storage, client: &http.Client{Transport: transport}}
+}
+
+// Configured reports whether service can resolve DRS objects, which needs
+// SYFON_DATA_API_BASE_URL.
+func (service *LFSDownloadService) Configured() bool {
+	return service != nil && service.storage.Configured()
+}
+
+// WithHTTPClient sets the client FetchData requests storage with.
+func (service *LFSDownloadService) WithHTTPClient(client *http.Client) *LFSDownloadService {
+	service.client = client
+	return service
+}
+
+// FetchData requests the data behind access from storage, forwarding
+// rangeHeader when it is set. The caller closes the response body.
+func (service *LFSDownloadService) FetchData(ctx context.Context, access *DRSAccessURL, rangeHeader string) (*http.Response, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, access.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	for headerName, value := range access.Headers {
+		request.Header.Set(headerName, value)
+	}
+	if rangeHeader != "" {
+		request.Header.Set("Range", rangeHeader)
+	}
+	return service.client.Do(request)
+}
+
+// ResolveDownload finds the DRS object behind pointer, preferring the object
+// an upload session of projectID recorded for its OID over a syfon checksum
+// lookup, and returns a signed access URL for it. Syfon checks the caller's
+// access to the object with authorizationHeader.
+func (service *LFSDownloadService) ResolveDownload(ctx context.Context, authorizationHeader string, projectID string, pointer *GitLFSPointerInfo) (*DRSAccessURL, error) {
+	details := map[string]any{"project_id": projectID, "oid": pointer.OID}
+	objectID, err := service.lookupObjectID(ctx, authorizationHeader, projectID, pointer.OID)
+	if err != nil {
+		return nil, err
+	}
+	if objectID == "" {
+		return nil, NewError(ErrorKindNotFound, http.StatusNotFound, "no DRS object is registered for this LFS object", details)
+	}
+	details["drs_object_id"] = objectID
+	access, err := service.storage.SignedAccessURL(ctx, authorizationHeader, objectID)
+	if err != nil {
+		return nil, WrapError(ErrorKindIntegration, http.StatusBadGateway, "failed to get a signed URL for LFS object", err, details)
+	}
+	if access == nil {
+		return nil, NewError(ErrorKindNotFound, http.StatusNotFound, "DRS object for this LFS object was not found", details)
+	}
+	return access, nil
+}
+
+// objectRegistered reports whether storage knows an object for oid.
+func (service *LFSDownloadService) objectRegistered(ctx context.Context, authorizationHeader string, projectID string, oid string) (bool, error) {
+	objectID, err := service.lookupObjectID(ctx, authorizationHeader, projectID, oid)
+	if err != nil {
+		return false, err
+	}
+	return objectID != "", nil
+}
+
+func (service *LFSDownloadService) lookupObjectID(ctx context.Context, authorizationHeader string, projectID string, oid string) (string, error) {
+	details := map[string]any{"project_id": projectID, "oid": oid}
+	objectID, err := geckodb.GitUploadDRSObjectIDByChecksumContext(ctx, service.db, projectID, oid)
+	if err != nil {
+		return "", WrapError(ErrorKindDatabase, http.StatusInternalServerError, "failed to look up LFS object", err, details)
+	}
+	if objectID != "" {
+		return objectID, nil
+	}
+	objectID, err = service.storage.LookupObjectIDByChecksum(ctx, authorizationHeader, oid)
+	if err != nil {
+		return "", WrapError(ErrorKindIntegration, http.StatusBadGateway, "failed to look up LFS object in syfon", err, details)
+	}
+	return objectID, nil
+}
+
+// GitLFSDataURL is the Gecko route that downloads the data behind the LFS
+// pointer at path.
+func GitLFSDataURL(projectID string, ref string, path string) string {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for index, segment := range segments {
+		segments[index] = url.PathEscape(segment)
+	}
+	dataURL := "/git/projects/" + projectID + "/download/" + strings.Join(segments, "/")
+	if ref != "" {
+		dataURL += "?ref=" + url.QueryEscape(ref)
+	}
+	return dataURL
+}
@@ -0,0 +1,44 @@
+package git
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLFSDownloadFetchDataForwardsHeadersAndTimesOut(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.URL.Path == "/slow" {
+			<-release
+		}
+		if request.Header.Get("Authorization") != "Bearer signed" || request.Header.Get("Range") != "bytes=0-3" {
+			writer.WriteHeader(http.StatusForbidden)
+			return
+		}
+		writer.WriteHeader(http.StatusPartialContent)
+		_, _ = writer.Write([]byte("data"))
+	}))
+	defer server.Close()
+	defer close(release)
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = 50 * time.Millisecond
+	service := NewLFSDownloadService(nil, nil).WithHTTPClient(&http.Client{Transport: transport})
+	headers := map[string]string{"Authorization": "Bearer signed"}
+
+	response, err := service.FetchData(context.Background(), &DRSAccessURL{URL: server.URL + "/object", Headers: headers}, "bytes=0-3")
+	if err != nil {
+		t.Fatalf("fetch data: %v", err)
+	}
+	_ = response.Body.Close()
+	if response.StatusCode != http.StatusPartialContent {
+		t.Fatalf("expected the signed headers and range to be forwarded, got status %d", response.StatusCode)
+	}
+
+	if _, err := service.FetchData(context.Background(), &DRSAccessURL{URL: server.URL + "/slow", Headers: headers}, ""); err == nil {
+		t.Fatal("expected a storage backend that never answers to time out")
+	}
+}
@@ -0,0 +1,386 @@
+package git
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	geckodb "github.com/calypr/gecko/internal/db"
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/jmoiron/sqlx"
+)
+
+// gitMirrorAccessResolution is how often the access time of one mirror is
+// written; requests in between only touch memory.
+const gitMirrorAccessResolution = time.Minute
+
+// GitMirrorUsage is the disk usage of one mirror under the git data
+// directory. Path is relative to the data directory.
+type GitMirrorUsage struct {
+	Path       string     `json:"path"`
+	ProjectIDs []string   `json:"project_ids"`
+	SizeBytes  int64      `json:"size_bytes"`
+	Present    bool       `json:"present"`
+	Orphaned   bool       `json:"orphaned"`
+	AccessedAt *time.Time `json:"accessed_at,omitempty"`
+	RepackedAt *time.Time `json:"repacked_at,omitempty"`
+	EvictedAt  *time.Time `json:"evicted_at,omitempty"`
+}
+
+// GitMirrorUsageResponse reports the mirrors under the git data directory,
+// largest first, with their total size and the quota they are held to.
+type GitMirrorUsageResponse struct {
+	TotalBytes int64            `json:"total_bytes"`
+	QuotaBytes int64            `json:"quota_bytes,omitempty"`
+	Mirrors    []GitMirrorUsage `json:"mirrors"`
+}
+
+// gitMirror is a mirror directory joined with the projects that use it and
+// its recorded usage. A mirror the quota evicted is listed without being
+// present until a request clones it again.
+type gitMirror struct {
+	path       string
+	projectIDs []string
+	present    bool
+	modTime    time.Time
+	usage      geckodb.GitMirrorUsage
+}
+
+func (mirror gitMirror) orphaned() bool {
+	return mirror.present && len(mirror.projectIDs) == 0
+}
+
+// mirrorAccessTracker remembers when each mirror's access time was last
+// written so busy mirrors are not written on every request.
+type mirrorAccessTracker struct {
+	mu       sync.Mutex
+	recorded map[string]time.Time
+}
+
+func newMirrorAccessTracker() *mirrorAccessTracker {
+	return &mirrorAccessTracker{recorded: map[string]time.Time{}}
+}
+
+// due reports whether an access of mirrorPath at now should be written, and
+// if so remembers it as written.
+func (tracker *mirrorAccessTracker) due(mirrorPath string, now time.Time) bool {
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+	if last, ok := tracker.recorded[mirrorPath]; ok && now.Sub(last) < gitMirrorAccessResolution {
+		return false
+	}
+	tracker.recorded[mirrorPath] = now
+	return true
+}
+
+// RecordMirrorAccess notes that a request read the mirror at mirrorPath, so
+// the quota evicts the mirrors read least recently first.
+func (service *GitService) RecordMirrorAccess(ctx context.Context, db *sqlx.DB, mirrorPath string, now time.Time) error {
+	if service == nil || service.access == nil || strings.TrimSpace(mirrorPath) == "" {
+		return nil
+	}
+	mirrorPath = filepath.Clean(mirrorPath)
+	if !service.access.due(mirrorPath, now) {
+		return nil
+	}
+	return geckodb.RecordGitMirrorAccessContext(ctx, db, mirrorPath, now.UTC())
+}
+
+// MirrorUsage measures every mirror under the data directory and reports it
+// with the projects that use it and its recorded maintenance.
+func (service *GitService) MirrorUsage(ctx context.Context, db *sqlx.DB) (*GitMirrorUsageResponse, error) {
+	mirrors, err := service.loadGitMirrors(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	response := &GitMirrorUsageResponse{QuotaBytes: service.config.MirrorQuota, Mirrors: make([]GitMirrorUsage, 0, len(mirrors))}
+	for _, mirror := range mirrors {
+		relativePath, err := filepath.Rel(service.config.DataDir, mirror.path)
+		if err != nil {
+			relativePath = mirror.path
+		}
+		response.TotalBytes += mirror.usage.SizeBytes
+		response.Mirrors = append(response.Mirrors, GitMirrorUsage{
+			Path:       filepath.ToSlash(relativePath),
+			ProjectIDs: mirror.projectIDs,
+			SizeBytes:  mirror.usage.SizeBytes,
+			Present:    mirror.present,
+			Orphaned:   mirror.orphaned(),
+			AccessedAt: nullTimePointer(mirror.usage.AccessedAt),
+			RepackedAt: nullTimePointer(mirror.usage.RepackedAt),
+			EvictedAt:  nullTimePointer(mirror.usage.EvictedAt),
+		})
+	}
+	sort.SliceStable(response.Mirrors, func(a int, b int) bool {
+		return response.Mirrors[a].SizeBytes > response.Mirrors[b].SizeBytes
+	})
+	return response, nil
+}
+
+// loadGitMirrors joins the mirror directories under the data directory with
+// the projects whose state points at them and their recorded usage, and
+// measures the ones on disk. Mirrors are sorted by path.
+func (service *GitService) loadGitMirrors(ctx context.Context, db *sqlx.DB) ([]gitMirror, error) {
+	states := map[string]geckodb.GitProjectState{}
+	if db != nil {
+		var err error
+		states, err = geckodb.ListGitProjectStates(db)
+		if err != nil {
+			return nil, WrapError(ErrorKindDatabase, http.StatusInternalServerError, "failed to list git project states", err, nil)
+		}
+	}
+	usages, err := geckodb.ListGitMirrorUsageContext(ctx, db)
+	if err != nil {
+		return nil, WrapError(ErrorKindDatabase, http.StatusInternalServerError, "failed to list git mirror usage", err, nil)
+	}
+	dirs, err := scanGitMirrorDirs(service.config.DataDir)
+	if err != nil {
+		return nil, err
+	}
+	byPath := make(map[string]*gitMirror, len(dirs))
+	for path, modTime := range dirs {
+		byPath[path] = &gitMirror{path: path, present: true, modTime: modTime}
+	}
+	for _, state := range states {
+		if strings.TrimSpace(state.MirrorPath) == "" {
+			continue
+		}
+		path := filepath.Clean(state.MirrorPath)
+		mirror, ok := byPath[path]
+		if !ok {
+			if !usages[path].EvictedAt.Valid {
+				continue
+			}
+			mirror = &gitMirror{path: path}
+			byPath[path] = mirror
+		}
+		mirror.projectIDs = append(mirror.projectIDs, state.ProjectID)
+	}
+	mirrors := make([]gitMirror, 0, len(byPath))
+	for path, mirror := range byPath {
+		usage, ok := usages[path]
+		if !ok {
+			usage = geckodb.GitMirrorUsage{MirrorPath: path}
+		}
+		mirror.usage = usage
+		if mirror.present {
+			size, err := gitMirrorSize(path)
+			if err != nil {
+				return nil, err
+			}
+			mirror.usage.SizeBytes = size
+		}
+		sort.Strings(mirror.projectIDs)
+		mirrors = append(mirrors, *mirror)
+	}
+	sort.Slice(mirrors, func(a int, b int) bool {
+		return mirrors[a].path < mirrors[b].path
+	})
+	return mirrors, nil
+}
+
+// mirrorHolds is a read/write lock per mirror path. Readers share the read
+// side while they read a mirror; maintenance takes the write side to repack
+// or remove it. Writers never wait, so a reader that already holds a mirror
+// may hold it again without deadlocking.
+type mirrorHolds struct {
+	mu    sync.Mutex
+	holds map[string]*mirrorHold
+}
+
+type mirrorHold struct {
+	lock sync.RWMutex
+	refs int
+}
+
+func newMirrorHolds() *mirrorHolds {
+	return &mirrorHolds{holds: map[string]*mirrorHold{}}
+}
+
+func (holds *mirrorHolds) acquire(mirrorPath string) *mirrorHold {
+	holds.mu.Lock()
+	defer holds.mu.Unlock()
+	hold, ok := holds.holds[mirrorPath]
+	if !ok {
+		hold = &mirrorHold{}
+		holds.holds[mirrorPath] = hold
+	}
+	hold.refs++
+	return hold
+}
+
+func (holds *mirrorHolds) release(mirrorPath string, hold *mirrorHold) {
+	holds.mu.Lock()
+	defer holds.mu.Unlock()
+	hold.refs--
+	if hold.refs == 0 {
+		delete(holds.holds, mirrorPath)
+	}
+}
+
+// read takes the read side of mirrorPath and returns its release.
+func (holds *mirrorHolds) read(mirrorPath string) func() {
+	hold := holds.acquire(mirrorPath)
+	hold.lock.RLock()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			hold.lock.RUnlock()
+			holds.release(mirrorPath, hold)
+		})
+	}
+}
+
+// tryWrite takes the write side of mirrorPath if no reader holds it, and
+// reports false without waiting otherwise.
+func (holds *mirrorHolds) tryWrite(mirrorPath string) (func(), bool) {
+	hold := holds.acquire(mirrorPath)
+	if !hold.lock.TryLock() {
+		holds.release(mirrorPath, hold)
+		return nil, false
+	}
+	return func() {
+		hold.lock.Unlock()
+		holds.release(mirrorPath, hold)
+	}, true
+}
+
+// HoldMirror keeps maintenance from repacking or evicting the mirror at
+// mirrorPath until the returned release is called. Requests hold the mirror
+// they read for as long as they read it.
+func (service *GitService) HoldMirror(mirrorPath string) func() {
+	if service == nil || service.holds == nil || strings.TrimSpace(mirrorPath) == "" {
+		return func() {}
+	}
+	return service.holds.read(filepath.Clean(mirrorPath))
+}
+
+// lockMirror takes the write side of mirror and claims its projects in the
+// sync tracker, so no request reads it and none of its projects refreshes
+// while it is repacked or removed. It claims nothing and reports false when
+// the mirror is being read or one of its projects is already refreshing.
+func (service *GitService) lockMirror(mirror *gitMirror) (func(), bool) {
+	unhold, ok := service.holds.tryWrite(mirror.path)
+	if !ok {
+		return nil, false
+	}
+	claimed := make([]string, 0, len(mirror.projectIDs))
+	unlock := func() {
+		for _, projectID := range claimed {
+			service.syncs.end(projectID)
+		}
+		unhold()
+	}
+	for _, projectID := range mirror.projectIDs {
+		if !service.syncs.begin(projectID) {
+			unlock()
+			return nil, false
+		}
+		claimed = append(claimed, projectID)
+	}
+	return unlock, true
+}
+
+// scanGitMirrorDirs finds the mirror directories under dataDir, which sit at
+// <host>/<owner>/<repo>.git, along with what a clone that did not finish
+// left next to them. It maps each path to its modification time.
+func scanGitMirrorDirs(dataDir string) (map[string]time.Time, error) {
+	dirs := map[string]time.Time{}
+	if strings.TrimSpace(dataDir) == "" {
+		return dirs, nil
+	}
+	matches, err := filepath.Glob(filepath.Join(dataDir, "*", "*", "*"))
+	if err != nil {
+		return nil, fmt.Errorf("scan git mirrors: %w", err)
+	}
+	for _, path := range matches {
+		name := filepath.Base(path)
+		if !strings.HasSuffix(name, ".git") && !strings.HasSuffix(name, ".git.partial") && !strings.HasSuffix(name, ".git.previous") {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil || !info.IsDir() || !isGitRepositoryDir(path) {
+			continue
+		}
+		dirs[filepath.Clean(path)] = info.ModTime()
+	}
+	return dirs, nil
+}
+
+// isGitRepositoryDir reports whether path holds a bare repository or a
+// repository with a working tree.
+func isGitRepositoryDir(path string) bool {
+	for _, head := range []string{filepath.Join(path, "HEAD"), filepath.Join(path, ".git", "HEAD")} {
+		if info, err := os.Stat(head); err == nil && info.Mode().IsRegular() {
+			return true
+		}
+	}
+	return false
+}
+
+// gitMirrorSize is the total size of the files under path.
+func gitMirrorSize(path string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(path, func(_ string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		size += info.Size()
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("measure git mirror %s: %w", path, err)
+	}
+	return size, nil
+}
+
+// RepackGitMirror packs every object the refs of the mirror at mirrorPath
+// reach into a single pack. It drops the pack each fetch added and the
+// objects no ref reaches any more, such as commits of force-pushed or
+// deleted branches.
+func RepackGitMirror(mirrorPath string) error {
+	repo, err := OpenRepository(mirrorPath)
+	if err != nil {
+		return err
+	}
+	if err := repo.Prune(gogit.PruneOptions{Handler: repo.DeleteObject}); err != nil && !errors.Is(err, gogit.ErrLooseObjectsNotSupported) {
+		return fmt.Errorf("prune git mirror: %w", err)
+	}
+	if RepositoryIsEmpty(repo) {
+		return nil
+	}
+	if err := repo.RepackObjects(&gogit.RepackConfig{}); err != nil {
+		return fmt.Errorf("repack git mirror: %w", err)
+	}
+	return nil
+}
+
+func nullTimePointer(value sql.NullTime) *time.Time {
+	if !value.Valid {
+		return nil
+	}
+	at := value.Time
+	return &at
+}
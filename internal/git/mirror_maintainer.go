@@ -0,0 +1,267 @@
+package git
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	geckodb "github.com/calypr/gecko/internal/db"
+	"github.com/jmoiron/sqlx"
+	"github.com/uc-cdis/arborist/arborist"
+)
+
+type MirrorMaintainerConfig struct {
+	// Interval between maintenance passes over the git data directory.
+	Interval time.Duration
+	// RepackInterval is how long a mirror goes between repacks.
+	RepackInterval time.Duration
+	// IdleAfter is how long a mirror must go unread before the quota may
+	// evict it.
+	IdleAfter time.Duration
+	// OrphanGrace is how long a directory no project points at is kept, so
+	// a mirror cloned for a project that is still being set up survives.
+	OrphanGrace time.Duration
+}
+
+// MirrorMaintainer periodically removes mirror directories no project uses,
+// repacks the others, and evicts the least recently read mirrors while the
+// mirrors use more than GitServiceConfig.MirrorQuota. Requests clone an
+// evicted mirror again when they need it.
+type MirrorMaintainer struct {
+	config  MirrorMaintainerConfig
+	service *GitService
+	db      *sqlx.DB
+	logger  arborist.Logger
+
+	mu      sync.Mutex
+	cancel  context.CancelFunc
+	running sync.WaitGroup
+}
+
+// GitMirrorMaintenanceResult counts what a maintenance pass did.
+type GitMirrorMaintenanceResult struct {
+	Removed    int
+	Repacked   int
+	Evicted    int
+	TotalBytes int64
+}
+
+func NewMirrorMaintainer(service *GitService, db *sqlx.DB, logger arborist.Logger, config MirrorMaintainerConfig) *MirrorMaintainer {
+	if config.Interval <= 0 {
+		config.Interval = time.Hour
+	}
+	if config.RepackInterval <= 0 {
+		config.RepackInterval = 24 * time.Hour
+	}
+	if config.IdleAfter <= 0 {
+		config.IdleAfter = 24 * time.Hour
+	}
+	if config.OrphanGrace <= 0 {
+		config.OrphanGrace = 24 * time.Hour
+	}
+	return &MirrorMaintainer{config: config, service: service, db: db, logger: logger}
+}
+
+// Start runs a pass immediately, then one every Interval until Stop is
+// called.
+func (maintainer *MirrorMaintainer) Start(ctx context.Context) {
+	maintainer.mu.Lock()
+	defer maintainer.mu.Unlock()
+	if maintainer.cancel != nil {
+		return
+	}
+	var runCtx context.Context
+	runCtx, maintainer.cancel = context.WithCancel(ctx)
+	maintainer.running.Add(1)
+	go maintainer.loop(runCtx)
+	maintainer.logger.Info("git mirror maintenance started: interval %s, quota %d bytes", maintainer.config.Interval, maintainer.service.config.MirrorQuota)
+}
+
+// Stop ends the maintenance loop and waits for a running pass to finish.
+func (maintainer *MirrorMaintainer) Stop() {
+	maintainer.mu.Lock()
+	cancel := maintainer.cancel
+	maintainer.cancel = nil
+	maintainer.mu.Unlock()
+	if cancel == nil {
+		return
+	}
+	cancel()
+	maintainer.running.Wait()
+	maintainer.logger.Info("git mirror maintenance stopped")
+}
+
+func (maintainer *MirrorMaintainer) loop(ctx context.Context) {
+	defer maintainer.running.Done()
+	ticker := time.NewTicker(maintainer.config.Interval)
+	defer ticker.Stop()
+	for {
+		if result, err := maintainer.Maintain(ctx, time.Now()); err != nil {
+			if ctx.Err() == nil {
+				maintainer.logger.Warning("git mirror maintenance failed: %s", err)
+			}
+		} else if result.Removed > 0 || result.Repacked > 0 || result.Evicted > 0 {
+			maintainer.logger.Info("git mirror maintenance removed %d orphaned mirrors, repacked %d and evicted %d; mirrors use %d bytes", result.Removed, result.Repacked, result.Evicted, result.TotalBytes)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Maintain runs one pass at now. Orphaned directories older than
+// OrphanGrace are removed first, then mirrors not repacked within
+// RepackInterval are repacked, and finally, while the mirrors are over the
+// quota, mirrors unread for IdleAfter are evicted, least recently read
+// first. Mirrors a request is reading or whose project is refreshing are
+// left for the next pass.
+func (maintainer *MirrorMaintainer) Maintain(ctx context.Context, now time.Time) (GitMirrorMaintenanceResult, error) {
+	result := GitMirrorMaintenanceResult{}
+	mirrors, err := maintainer.service.loadGitMirrors(ctx, maintainer.db)
+	if err != nil {
+		return result, err
+	}
+	kept := make([]*gitMirror, 0, len(mirrors))
+	for index := range mirrors {
+		mirror := &mirrors[index]
+		if ctx.Err() != nil {
+			return result, ctx.Err()
+		}
+		if mirror.orphaned() {
+			if now.Sub(mirror.modTime) < maintainer.config.OrphanGrace {
+				result.TotalBytes += mirror.usage.SizeBytes
+				continue
+			}
+			unlock, ok := maintainer.service.lockMirror(mirror)
+			if !ok {
+				result.TotalBytes += mirror.usage.SizeBytes
+				continue
+			}
+			err := os.RemoveAll(mirror.path)
+			unlock()
+			if err != nil {
+				return result, fmt.Errorf("remove orphaned git mirror %s: %w", mirror.path, err)
+			}
+			if err := geckodb.DeleteGitMirrorUsageContext(ctx, maintainer.db, mirror.path); err != nil {
+				return result, err
+			}
+			result.Removed++
+			continue
+		}
+		if mirror.present && (!mirror.usage.RepackedAt.Valid || now.Sub(mirror.usage.RepackedAt.Time) >= maintainer.config.RepackInterval) {
+			repacked, err := maintainer.repack(mirror, now)
+			if err != nil {
+				maintainer.logger.Warning("failed to repack git mirror %s: %s", mirror.path, err)
+			} else if repacked {
+				result.Repacked++
+			}
+		}
+		if mirror.present {
+			mirror.usage.MeasuredAt = sql.NullTime{Time: now.UTC(), Valid: true}
+			mirror.usage.EvictedAt = sql.NullTime{}
+			if err := geckodb.UpsertGitMirrorUsageContext(ctx, maintainer.db, mirror.usage); err != nil {
+				return result, err
+			}
+		}
+		result.TotalBytes += mirror.usage.SizeBytes
+		kept = append(kept, mirror)
+	}
+	quota := maintainer.service.config.MirrorQuota
+	if quota <= 0 || result.TotalBytes <= quota {
+		return result, nil
+	}
+	for _, mirror := range gitMirrorEvictionCandidates(kept, now, maintainer.config.IdleAfter) {
+		if result.TotalBytes <= quota || ctx.Err() != nil {
+			break
+		}
+		size := mirror.usage.SizeBytes
+		evicted, err := maintainer.evict(ctx, mirror, now)
+		if err != nil {
+			return result, err
+		}
+		if evicted {
+			result.Evicted++
+			result.TotalBytes -= size
+		}
+	}
+	if result.TotalBytes > quota {
+		maintainer.logger.Warning("git mirrors use %d bytes, over the %d byte quota, but no other mirror has been idle for %s", result.TotalBytes, quota, maintainer.config.IdleAfter)
+	}
+	return result, nil
+}
+
+// repack repacks mirror unless a request is reading it or one of its
+// projects is refreshing, and records the time and the new size.
+func (maintainer *MirrorMaintainer) repack(mirror *gitMirror, now time.Time) (bool, error) {
+	unlock, ok := maintainer.service.lockMirror(mirror)
+	if !ok {
+		return false, nil
+	}
+	defer unlock()
+	if err := RepackGitMirror(mirror.path); err != nil {
+		return false, err
+	}
+	size, err := gitMirrorSize(mirror.path)
+	if err != nil {
+		return false, err
+	}
+	mirror.usage.SizeBytes = size
+	mirror.usage.RepackedAt = sql.NullTime{Time: now.UTC(), Valid: true}
+	return true, nil
+}
+
+// evict removes mirror unless a request is reading it or one of its
+// projects is refreshing, and records the eviction so background refreshes leave it alone until a
+// request clones it again.
+func (maintainer *MirrorMaintainer) evict(ctx context.Context, mirror *gitMirror, now time.Time) (bool, error) {
+	unlock, ok := maintainer.service.lockMirror(mirror)
+	if !ok {
+		return false, nil
+	}
+	defer unlock()
+	if err := os.RemoveAll(mirror.path); err != nil {
+		return false, fmt.Errorf("evict git mirror %s: %w", mirror.path, err)
+	}
+	mirror.present = false
+	mirror.usage.SizeBytes = 0
+	mirror.usage.EvictedAt = sql.NullTime{Time: now.UTC(), Valid: true}
+	if err := geckodb.UpsertGitMirrorUsageContext(ctx, maintainer.db, mirror.usage); err != nil {
+		return true, err
+	}
+	return true, nil
+}
+
+// gitMirrorEvictionCandidates returns the mirrors on disk that went unread
+// for idleAfter, least recently read first. Mirrors never read since access
+// tracking began go first.
+func gitMirrorEvictionCandidates(mirrors []*gitMirror, now time.Time, idleAfter time.Duration) []*gitMirror {
+	candidates := make([]*gitMirror, 0, len(mirrors))
+	for _, mirror := range mirrors {
+		if mirror.present && (!mirror.usage.AccessedAt.Valid || now.Sub(mirror.usage.AccessedAt.Time) >= idleAfter) {
+			candidates = append(candidates, mirror)
+		}
+	}
+	sort.SliceStable(candidates, func(a int, b int) bool {
+		return candidates[a].usage.AccessedAt.Time.Before(candidates[b].usage.AccessedAt.Time)
+	})
+	return candidates
+}
+
+// evictedMirror reports whether the mirror of state was evicted and no
+// request has cloned it again since.
+func evictedMirror(usages map[string]geckodb.GitMirrorUsage, state geckodb.GitProjectState) bool {
+	usage, ok := usages[filepath.Clean(state.MirrorPath)]
+	if !ok || !usage.EvictedAt.Valid {
+		return false
+	}
+	_, err := os.Stat(state.MirrorPath)
+	return errors.Is(err, os.ErrNotExist)
+}
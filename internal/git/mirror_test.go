@@ -0,0 +1,227 @@
+package git
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	geckodb "github.com/calypr/gecko/internal/db"
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+func TestSyncRepositoryMirrorKeepsBareMirrorAcrossForcePush(t *testing.T) {
+	tempDir := t.TempDir()
+	sourcePath := filepath.Join(tempDir, "source")
+	repo, err := gogit.PlainInit(sourcePath, false)
+	if err != nil {
+		t.Fatalf("init source repo: %v", err)
+	}
+	first := commitTestFile(t, repo, sourcePath, "README.md", "first", "alice", time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	commitTestFile(t, repo, sourcePath, "README.md", "second", "alice", time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC))
+
+	mirrorPath := filepath.Join(tempDir, "mirror.git")
+	if err := SyncRepositoryMirror(context.Background(), sourcePath, mirrorPath, nil); err != nil {
+		t.Fatalf("sync mirror: %v", err)
+	}
+	mirrorRepo, err := OpenRepository(mirrorPath)
+	if err != nil {
+		t.Fatalf("open mirror: %v", err)
+	}
+	if _, err := mirrorRepo.Worktree(); !errors.Is(err, gogit.ErrIsBareRepository) {
+		t.Fatalf("expected a bare mirror, got %v", err)
+	}
+
+	worktree, err := repo.Worktree()
+	if err != nil {
+		t.Fatalf("load worktree: %v", err)
+	}
+	if err := worktree.Reset(&gogit.ResetOptions{Commit: first, Mode: gogit.HardReset}); err != nil {
+		t.Fatalf("reset source branch: %v", err)
+	}
+	rewritten := commitTestFile(t, repo, sourcePath, "README.md", "rewritten", "bob", time.Date(2026, 1, 3, 0, 0, 0, 0, time.UTC))
+	if err := SyncRepositoryMirror(context.Background(), sourcePath, mirrorPath, nil); err != nil {
+		t.Fatalf("sync force-pushed branch: %v", err)
+	}
+	mirrorRepo, err = OpenRepository(mirrorPath)
+	if err != nil {
+		t.Fatalf("open mirror: %v", err)
+	}
+	branch, err := mirrorRepo.Reference(plumbing.NewBranchReferenceName("master"), true)
+	if err != nil {
+		t.Fatalf("read mirrored branch: %v", err)
+	}
+	if branch.Hash() != rewritten {
+		t.Fatalf("expected the mirror to follow the force push to %s, got %s", rewritten, branch.Hash())
+	}
+
+	legacyPath := filepath.Join(tempDir, "legacy.git")
+	if _, err := gogit.PlainClone(legacyPath, false, &gogit.CloneOptions{URL: sourcePath}); err != nil {
+		t.Fatalf("clone legacy mirror: %v", err)
+	}
+	if err := SyncRepositoryMirror(context.Background(), sourcePath, legacyPath, nil); err != nil {
+		t.Fatalf("sync legacy mirror: %v", err)
+	}
+	legacyRepo, err := OpenRepository(legacyPath)
+	if err != nil {
+		t.Fatalf("open converted mirror: %v", err)
+	}
+	if _, err := legacyRepo.Worktree(); !errors.Is(err, gogit.ErrIsBareRepository) {
+		t.Fatalf("expected the legacy mirror to be cloned again as bare, got %v", err)
+	}
+	for _, leftover := range []string{legacyPath + ".partial", legacyPath + ".previous", filepath.Join(legacyPath, "README.md")} {
+		if _, err := os.Stat(leftover); !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("expected %s to be gone, got %v", leftover, err)
+		}
+	}
+}
+
+func TestMirrorMaintainerRemovesOrphansAndRepacks(t *testing.T) {
+	tempDir := t.TempDir()
+	sourcePath := filepath.Join(tempDir, "source")
+	repo, err := gogit.PlainInit(sourcePath, false)
+	if err != nil {
+		t.Fatalf("init source repo: %v", err)
+	}
+	commitTestFile(t, repo, sourcePath, "README.md", "first", "alice", time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	dataDir := filepath.Join(tempDir, "data")
+	service := NewGitService(GitServiceConfig{DataDir: dataDir})
+	stalePath := service.MirrorPathForIdentity(GitRepositoryIdentity{Host: "github.com", Owner: "org-a", Repo: "stale"})
+	freshPath := service.MirrorPathForIdentity(GitRepositoryIdentity{Host: "github.com", Owner: "org-a", Repo: "fresh"})
+	for _, mirrorPath := range []string{stalePath, freshPath} {
+		if err := SyncRepositoryMirror(context.Background(), sourcePath, mirrorPath, nil); err != nil {
+			t.Fatalf("sync mirror: %v", err)
+		}
+	}
+	if err := os.MkdirAll(filepath.Join(dataDir, "thumbnails", "org-a", "proj-a"), 0o755); err != nil {
+		t.Fatalf("create thumbnail dir: %v", err)
+	}
+	dirs, err := scanGitMirrorDirs(dataDir)
+	if err != nil {
+		t.Fatalf("scan mirrors: %v", err)
+	}
+	if len(dirs) != 2 {
+		t.Fatalf("expected the two mirrors, got %v", dirs)
+	}
+
+	now := time.Now()
+	old := now.Add(-48 * time.Hour)
+	if err := os.Chtimes(stalePath, old, old); err != nil {
+		t.Fatalf("age stale mirror: %v", err)
+	}
+	maintainer := NewMirrorMaintainer(service, nil, nil, MirrorMaintainerConfig{})
+	result, err := maintainer.Maintain(context.Background(), now)
+	if err != nil {
+		t.Fatalf("maintain: %v", err)
+	}
+	if result.Removed != 1 || result.TotalBytes == 0 {
+		t.Fatalf("expected the stale orphan to be removed and the fresh one kept, got %+v", result)
+	}
+	if _, err := os.Stat(stalePath); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected %s to be removed, got %v", stalePath, err)
+	}
+	if _, err := os.Stat(freshPath); err != nil {
+		t.Fatalf("expected %s to survive its grace period: %v", freshPath, err)
+	}
+
+	commitTestFile(t, repo, sourcePath, "README.md", "second", "alice", time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC))
+	if err := SyncRepositoryMirror(context.Background(), sourcePath, freshPath, nil); err != nil {
+		t.Fatalf("sync update: %v", err)
+	}
+	if err := RepackGitMirror(freshPath); err != nil {
+		t.Fatalf("repack mirror: %v", err)
+	}
+	packs, err := filepath.Glob(filepath.Join(freshPath, "objects", "pack", "*.pack"))
+	if err != nil {
+		t.Fatalf("list packs: %v", err)
+	}
+	if len(packs) != 1 {
+		t.Fatalf("expected a single pack after repacking, got %v", packs)
+	}
+	mirrorRepo, err := OpenRepository(freshPath)
+	if err != nil {
+		t.Fatalf("open repacked mirror: %v", err)
+	}
+	if _, _, err := ResolveGitReference(mirrorRepo, "master", ""); err != nil {
+		t.Fatalf("resolve branch after repack: %v", err)
+	}
+}
+
+func TestMirrorMaintainerSkipsHeldMirrors(t *testing.T) {
+	tempDir := t.TempDir()
+	sourcePath := filepath.Join(tempDir, "source")
+	repo, err := gogit.PlainInit(sourcePath, false)
+	if err != nil {
+		t.Fatalf("init source repo: %v", err)
+	}
+	commitTestFile(t, repo, sourcePath, "README.md", "first", "alice", time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	service := NewGitService(GitServiceConfig{DataDir: filepath.Join(tempDir, "data")})
+	mirrorPath := service.MirrorPathForIdentity(GitRepositoryIdentity{Host: "github.com", Owner: "org-a", Repo: "proj-a"})
+	if err := SyncRepositoryMirror(context.Background(), sourcePath, mirrorPath, nil); err != nil {
+		t.Fatalf("sync mirror: %v", err)
+	}
+	maintainer := NewMirrorMaintainer(service, nil, nil, MirrorMaintainerConfig{})
+	mirror := &gitMirror{path: mirrorPath, projectIDs: []string{"org-a/proj-a"}, present: true}
+	now := time.Now()
+
+	release := service.HoldMirror(mirrorPath)
+	outer := service.HoldMirror(mirrorPath)
+	release()
+	if repacked, err := maintainer.repack(mirror, now); err != nil || repacked {
+		t.Fatalf("expected a held mirror not to be repacked, got %v, %v", repacked, err)
+	}
+	if evicted, err := maintainer.evict(context.Background(), mirror, now); err != nil || evicted {
+		t.Fatalf("expected a held mirror not to be evicted, got %v, %v", evicted, err)
+	}
+	if _, err := os.Stat(mirrorPath); err != nil {
+		t.Fatalf("expected the held mirror to survive: %v", err)
+	}
+	outer()
+	if len(service.holds.holds) != 0 {
+		t.Fatalf("expected released holds to be dropped, got %v", service.holds.holds)
+	}
+
+	if repacked, err := maintainer.repack(mirror, now); err != nil || !repacked {
+		t.Fatalf("expected the released mirror to be repacked, got %v, %v", repacked, err)
+	}
+	if evicted, err := maintainer.evict(context.Background(), mirror, now); err != nil || !evicted {
+		t.Fatalf("expected the released mirror to be evicted, got %v, %v", evicted, err)
+	}
+	if _, err := os.Stat(mirrorPath); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected %s to be evicted, got %v", mirrorPath, err)
+	}
+}
+
+func TestGitMirrorEvictionCandidatesOrdersIdleMirrors(t *testing.T) {
+	now := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	accessed := func(path string, at time.Time) *gitMirror {
+		return &gitMirror{path: path, present: true, usage: geckodb.GitMirrorUsage{MirrorPath: path, AccessedAt: sql.NullTime{Time: at, Valid: true}}}
+	}
+	mirrors := []*gitMirror{
+		accessed("recent", now.Add(-time.Hour)),
+		accessed("week", now.Add(-7*24*time.Hour)),
+		{path: "never", present: true},
+		accessed("month", now.Add(-30*24*time.Hour)),
+		{path: "evicted", usage: geckodb.GitMirrorUsage{EvictedAt: sql.NullTime{Time: now, Valid: true}}},
+	}
+	candidates := gitMirrorEvictionCandidates(mirrors, now, 24*time.Hour)
+	got := make([]string, 0, len(candidates))
+	for _, candidate := range candidates {
+		got = append(got, candidate.path)
+	}
+	want := []string{"never", "month", "week"}
+	if len(got) != len(want) {
+		t.Fatalf("expected candidates %v, got %v", want, got)
+	}
+	for index := range want {
+		if got[index] != want[index] {
+			t.Fatalf("expected candidates %v, got %v", want, got)
+		}
+	}
+}
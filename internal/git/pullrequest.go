@@ -0,0 +1,237 @@
+package git
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	geckodb "github.com/calypr/gecko/internal/db"
+	"github.com/google/go-github/v87/github"
+)
+
+const (
+	GitPullRequestMergeable   = "mergeable"
+	GitPullRequestConflicting = "conflicting"
+
+	GitReviewApproved         = "approved"
+	GitReviewChangesRequested = "changes_requested"
+	GitReviewRequired         = "review_required"
+
+	GitChecksSuccess = "success"
+	GitChecksFailure = "failure"
+	GitChecksPending = "pending"
+)
+
+var gitPullRequestURLPattern = regexp.MustCompile(`/pull/(\d+)/?$`)
+
+// ParseGitPullRequestNumber returns the number at the end of a pull request
+// html_url, or 0.
+func ParseGitPullRequestNumber(htmlURL string) int64 {
+	match := gitPullRequestURLPattern.FindStringSubmatch(strings.TrimSpace(htmlURL))
+	if len(match) != 2 {
+		return 0
+	}
+	number, err := strconv.ParseInt(match[1], 10, 64)
+	if err != nil {
+		return 0
+	}
+	return number
+}
+
+// GitUploadPullRequestPending reports whether the pull request of a
+// finalized session may still change state.
+func GitUploadPullRequestPending(session geckodb.GitUploadSession) bool {
+	if session.Status != GitUploadSessionFinalized || !session.PullRequestURL.Valid {
+		return false
+	}
+	return !session.PRState.Valid || session.PRState.String == GitPullRequestOpen
+}
+
+func buildGitUploadPullRequestStatus(session geckodb.GitUploadSession) *GitUploadPullRequestStatus {
+	status := &GitUploadPullRequestStatus{
+		Number:         session.PRNumber.Int64,
+		URL:            session.PullRequestURL.String,
+		State:          session.PRState.String,
+		HeadSHA:        session.PRHeadSHA.String,
+		Mergeable:      session.PRMergeable.String,
+		ReviewDecision: session.PRReviewDecision.String,
+		Checks:         session.PRChecks.String,
+		MergeCommitSHA: session.PRMergeCommitSHA.String,
+	}
+	if session.PRComments.Valid {
+		comments := session.PRComments.Int64
+		status.Comments = &comments
+	}
+	if session.PRMergedAt.Valid {
+		mergedAt := session.PRMergedAt.Time
+		status.MergedAt = &mergedAt
+	}
+	if session.PRCheckedAt.Valid {
+		checkedAt := session.PRCheckedAt.Time
+		status.CheckedAt = &checkedAt
+	}
+	return status
+}
+
+// PollUploadPullRequest reads the pull request of session from GitHub with a
+// read installation token and records its state, mergeability, review
+// decision and checks on session. It reports whether the pull request was
+// merged since it was last seen. The caller persists the pull request
+// columns of session.
+func (service *GitService) PollUploadPullRequest(ctx context.Context, authorizationHeader string, session *geckodb.GitUploadSession) (bool, error) {
+	number := session.PRNumber.Int64
+	if !session.PRNumber.Valid || number == 0 {
+		number = ParseGitPullRequestNumber(session.PullRequestURL.String)
+	}
+	if number == 0 {
+		return false, nil
+	}
+	identity := GitRepositoryIdentity{Host: session.RepoHost, Owner: session.RepoOwner, Repo: session.RepoName}
+	accessToken, err := service.RequestInstallationToken(ctx, authorizationHeader, session.Organization, session.Project, identity, "read")
+	if err != nil {
+		return false, err
+	}
+	client, err := service.githubClient(accessToken)
+	if err != nil {
+		return false, err
+	}
+	pullRequest, response, err := client.PullRequests.Get(ctx, identity.Owner, identity.Repo, int(number))
+	if err != nil {
+		return false, githubWriteStatusError("failed to load GitHub pull request", response, err)
+	}
+	merged := applyGitHubPullRequest(session, pullRequest, time.Now().UTC())
+
+	// Reviews and checks need extra permissions some installations lack, so
+	// their previous values are kept when they cannot be read.
+	if reviews, _, err := client.PullRequests.ListReviews(ctx, identity.Owner, identity.Repo, int(number), &github.ListOptions{PerPage: 100}); err == nil {
+		decision := gitReviewDecision(reviews, len(pullRequest.RequestedReviewers)+len(pullRequest.RequestedTeams))
+		session.PRReviewDecision = sql.NullString{String: decision, Valid: decision != ""}
+	}
+	if headSHA := pullRequest.GetHead().GetSHA(); headSHA != "" {
+		runs, _, runsErr := client.Checks.ListCheckRunsForRef(ctx, identity.Owner, identity.Repo, headSHA, &github.ListCheckRunsOptions{ListOptions: github.ListOptions{PerPage: 100}})
+		combined, _, combinedErr := client.Repositories.GetCombinedStatus(ctx, identity.Owner, identity.Repo, headSHA, nil)
+		if runsErr == nil || combinedErr == nil {
+			var checkRuns []*github.CheckRun
+			if runsErr == nil {
+				checkRuns = runs.CheckRuns
+			}
+			if combinedErr != nil {
+				combined = nil
+			}
+			checks := gitChecksStatus(checkRuns, combined)
+			session.PRChecks = sql.NullString{String: checks, Valid: checks != ""}
+		}
+	}
+	return merged, nil
+}
+
+// applyGitHubPullRequest records pullRequest on session. It reports whether
+// the session just moved to merged.
+func applyGitHubPullRequest(session *geckodb.GitUploadSession, pullRequest *github.PullRequest, now time.Time) bool {
+	wasMerged := session.PRState.Valid && session.PRState.String == GitPullRequestMerged
+	state := pullRequest.GetState()
+	if pullRequest.GetMerged() || pullRequest.MergedAt != nil {
+		state = GitPullRequestMerged
+	}
+	if number := pullRequest.GetNumber(); number != 0 {
+		session.PRNumber = sql.NullInt64{Int64: int64(number), Valid: true}
+	}
+	session.PRState = sql.NullString{String: state, Valid: state != ""}
+	if htmlURL := pullRequest.GetHTMLURL(); htmlURL != "" {
+		session.PullRequestURL = sql.NullString{String: htmlURL, Valid: true}
+	}
+	if headSHA := pullRequest.GetHead().GetSHA(); headSHA != "" {
+		session.PRHeadSHA = sql.NullString{String: headSHA, Valid: true}
+	}
+	// GitHub computes mergeability in the background and reports null until
+	// it is known.
+	switch {
+	case state != GitPullRequestOpen:
+		session.PRMergeable = sql.NullString{}
+	case pullRequest.Mergeable != nil && pullRequest.GetMergeable():
+		session.PRMergeable = sql.NullString{String: GitPullRequestMergeable, Valid: true}
+	case pullRequest.Mergeable != nil:
+		session.PRMergeable = sql.NullString{String: GitPullRequestConflicting, Valid: true}
+	}
+	if pullRequest.Comments != nil || pullRequest.ReviewComments != nil {
+		session.PRComments = sql.NullInt64{Int64: int64(pullRequest.GetComments() + pullRequest.GetReviewComments()), Valid: true}
+	}
+	if pullRequest.MergedAt != nil {
+		session.PRMergedAt = sql.NullTime{Time: pullRequest.GetMergedAt().UTC(), Valid: true}
+	}
+	if state == GitPullRequestMerged && pullRequest.GetMergeCommitSHA() != "" {
+		session.PRMergeCommitSHA = sql.NullString{String: pullRequest.GetMergeCommitSHA(), Valid: true}
+	}
+	session.PRCheckedAt = sql.NullTime{Time: now, Valid: true}
+	session.UpdatedAt = now
+	return !wasMerged && state == GitPullRequestMerged
+}
+
+// gitReviewDecision summarizes reviews the way GitHub does: each reviewer's
+// latest approving or blocking review counts, and a requested change wins
+// over approvals. With no such review it is review_required while reviewers
+// are still requested.
+func gitReviewDecision(reviews []*github.PullRequestReview, requested int) string {
+	latest := map[string]string{}
+	for _, review := range reviews {
+		reviewer := review.GetUser().GetLogin()
+		switch strings.ToUpper(review.GetState()) {
+		case "APPROVED":
+			latest[reviewer] = GitReviewApproved
+		case "CHANGES_REQUESTED":
+			latest[reviewer] = GitReviewChangesRequested
+		case "DISMISSED":
+			delete(latest, reviewer)
+		}
+	}
+	decision := ""
+	for _, state := range latest {
+		if state == GitReviewChangesRequested {
+			return GitReviewChangesRequested
+		}
+		decision = GitReviewApproved
+	}
+	if decision == "" && requested > 0 {
+		return GitReviewRequired
+	}
+	return decision
+}
+
+// gitChecksStatus folds check runs and commit statuses into one status: any
+// failure fails, anything unfinished is pending, and it is empty when the
+// commit has no checks at all.
+func gitChecksStatus(runs []*github.CheckRun, combined *github.CombinedStatus) string {
+	total, pending := 0, false
+	for _, run := range runs {
+		total++
+		if run.GetStatus() != "completed" {
+			pending = true
+			continue
+		}
+		switch run.GetConclusion() {
+		case "success", "neutral", "skipped":
+		default:
+			return GitChecksFailure
+		}
+	}
+	if combined != nil && combined.GetTotalCount() > 0 {
+		total++
+		switch combined.GetState() {
+		case "failure", "error":
+			return GitChecksFailure
+		case "pending":
+			pending = true
+		}
+	}
+	switch {
+	case total == 0:
+		return ""
+	case pending:
+		return GitChecksPending
+	default:
+		return GitChecksSuccess
+	}
+}
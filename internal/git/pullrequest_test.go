@@ -0,0 +1,122 @@
+package git
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	geckodb "github.com/calypr/gecko/internal/db"
+	"github.com/google/go-github/v87/github"
+)
+
+func TestParseGitPullRequestNumber(t *testing.T) {
+	cases := map[string]int64{
+		"https://github.com/calypr-data/portal-data/pull/42":  42,
+		"https://github.com/calypr-data/portal-data/pull/42/": 42,
+		"https://github.com/calypr-data/portal-data/issues/7": 0,
+		"": 0,
+	}
+	for url, want := range cases {
+		if got := ParseGitPullRequestNumber(url); got != want {
+			t.Fatalf("ParseGitPullRequestNumber(%q) = %d, want %d", url, got, want)
+		}
+	}
+}
+
+func TestGitReviewDecision(t *testing.T) {
+	review := func(login, state string) *github.PullRequestReview {
+		return &github.PullRequestReview{User: &github.User{Login: github.Ptr(login)}, State: github.Ptr(state)}
+	}
+	if got := gitReviewDecision(nil, 0); got != "" {
+		t.Fatalf("expected no decision without reviews, got %q", got)
+	}
+	if got := gitReviewDecision(nil, 1); got != GitReviewRequired {
+		t.Fatalf("expected review_required with a requested reviewer, got %q", got)
+	}
+	if got := gitReviewDecision([]*github.PullRequestReview{review("ana", "COMMENTED"), review("ana", "APPROVED")}, 0); got != GitReviewApproved {
+		t.Fatalf("expected approved, got %q", got)
+	}
+	if got := gitReviewDecision([]*github.PullRequestReview{review("ana", "APPROVED"), review("bo", "CHANGES_REQUESTED")}, 0); got != GitReviewChangesRequested {
+		t.Fatalf("expected a requested change to win, got %q", got)
+	}
+	if got := gitReviewDecision([]*github.PullRequestReview{review("bo", "CHANGES_REQUESTED"), review("bo", "APPROVED")}, 0); got != GitReviewApproved {
+		t.Fatalf("expected the latest review per reviewer to count, got %q", got)
+	}
+	if got := gitReviewDecision([]*github.PullRequestReview{review("bo", "CHANGES_REQUESTED"), review("bo", "DISMISSED")}, 1); got != GitReviewRequired {
+		t.Fatalf("expected a dismissed review to be dropped, got %q", got)
+	}
+}
+
+func TestGitChecksStatus(t *testing.T) {
+	run := func(status, conclusion string) *github.CheckRun {
+		return &github.CheckRun{Status: github.Ptr(status), Conclusion: github.Ptr(conclusion)}
+	}
+	combined := func(state string) *github.CombinedStatus {
+		return &github.CombinedStatus{State: github.Ptr(state), TotalCount: github.Ptr(1)}
+	}
+	if got := gitChecksStatus(nil, &github.CombinedStatus{State: github.Ptr("pending"), TotalCount: github.Ptr(0)}); got != "" {
+		t.Fatalf("expected no status without checks, got %q", got)
+	}
+	if got := gitChecksStatus([]*github.CheckRun{run("completed", "success"), run("completed", "skipped")}, combined("success")); got != GitChecksSuccess {
+		t.Fatalf("expected success, got %q", got)
+	}
+	if got := gitChecksStatus([]*github.CheckRun{run("in_progress", ""), run("completed", "success")}, nil); got != GitChecksPending {
+		t.Fatalf("expected pending, got %q", got)
+	}
+	if got := gitChecksStatus([]*github.CheckRun{run("in_progress", ""), run("completed", "failure")}, nil); got != GitChecksFailure {
+		t.Fatalf("expected a failed run to fail, got %q", got)
+	}
+	if got := gitChecksStatus([]*github.CheckRun{run("completed", "success")}, combined("error")); got != GitChecksFailure {
+		t.Fatalf("expected a failed status to fail, got %q", got)
+	}
+}
+
+func TestApplyGitHubPullRequestReportsMerge(t *testing.T) {
+	now := time.Date(2026, 3, 3, 16, 30, 0, 0, time.UTC)
+	session := geckodb.GitUploadSession{
+		Status:         GitUploadSessionFinalized,
+		PullRequestURL: sql.NullString{String: "https://github.com/calypr-data/portal-data/pull/42", Valid: true},
+		PRState:        sql.NullString{String: GitPullRequestOpen, Valid: true},
+	}
+	open := &github.PullRequest{
+		Number:    github.Ptr(42),
+		State:     github.Ptr("open"),
+		Mergeable: github.Ptr(false),
+		Comments:  github.Ptr(2),
+		Head:      &github.PullRequestBranch{SHA: github.Ptr("c3a1d0f2")},
+	}
+	if applyGitHubPullRequest(&session, open, now) {
+		t.Fatal("expected an open pull request not to report a merge")
+	}
+	if session.PRNumber.Int64 != 42 || session.PRMergeable.String != GitPullRequestConflicting || session.PRComments.Int64 != 2 || session.PRHeadSHA.String != "c3a1d0f2" || !session.PRCheckedAt.Time.Equal(now) {
+		t.Fatalf("unexpected open pull request state: %+v", session)
+	}
+	if !GitUploadPullRequestPending(session) {
+		t.Fatal("expected an open pull request to stay pending")
+	}
+
+	mergedAt := github.Timestamp{Time: now.Add(-time.Minute)}
+	merged := &github.PullRequest{
+		Number:         github.Ptr(42),
+		State:          github.Ptr("closed"),
+		Merged:         github.Ptr(true),
+		MergedAt:       &mergedAt,
+		MergeCommitSHA: github.Ptr("9f1c4b7a"),
+	}
+	if !applyGitHubPullRequest(&session, merged, now) {
+		t.Fatal("expected the merge to be reported")
+	}
+	if session.PRState.String != GitPullRequestMerged || session.PRMergeable.Valid || session.PRMergeCommitSHA.String != "9f1c4b7a" || !session.PRMergedAt.Time.Equal(mergedAt.Time) {
+		t.Fatalf("unexpected merged pull request state: %+v", session)
+	}
+	if applyGitHubPullRequest(&session, merged, now) {
+		t.Fatal("expected a repeated merge not to be reported again")
+	}
+	if GitUploadPullRequestPending(session) {
+		t.Fatal("expected a merged pull request to stop being polled")
+	}
+	status := BuildGitUploadSessionResponse(session, nil).PullRequest
+	if status == nil || status.Number != 42 || status.State != GitPullRequestMerged || status.MergedAt == nil || status.Comments == nil || *status.Comments != 2 {
+		t.Fatalf("unexpected pull request response: %+v", status)
+	}
+}
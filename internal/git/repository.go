@@ -4,12 +4,13 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
-	"time"
 
 	gogit "github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/config"
@@ -20,49 +21,162 @@ import (
 
 var gitLFSPointerOIDPattern = regexp.MustCompile(`^oid sha256:([a-fA-F0-9]{64})$`)
 
+// gitMirrorFetchRefSpecs map the branches and tags of the remote onto the
+// same names in a bare mirror. They are forced, so force-pushed branches are
+// followed, and fetches prune branches and tags the remote deleted.
+var gitMirrorFetchRefSpecs = []config.RefSpec{
+	"+refs/heads/*:refs/heads/*",
+	"+refs/tags/*:refs/tags/*",
+}
+
 func SyncRepositoryMirror(ctx context.Context, remoteURL string, mirrorPath string, auth *githttp.BasicAuth) error {
+	return SyncRepositoryMirrorWithObserver(ctx, remoteURL, mirrorPath, auth, nil)
+}
+
+// SyncRepositoryMirrorWithObserver is SyncRepositoryMirror that reports each
+// phase and the remote's progress output to observer, which may be nil.
+//
+// Mirrors are bare repositories. A missing mirror, and a mirror an earlier
+// version cloned with a working tree, is cloned again into a temporary
+// directory that replaces it once the fetch succeeds.
+func SyncRepositoryMirrorWithObserver(ctx context.Context, remoteURL string, mirrorPath string, auth *githttp.BasicAuth, observer RefreshObserver) error {
+	progress := observerProgress(observer)
 	if err := os.MkdirAll(filepath.Dir(mirrorPath), 0o755); err != nil {
 		return fmt.Errorf("create repository parent dir: %w", err)
 	}
-	if _, err := os.Stat(mirrorPath); errors.Is(err, os.ErrNotExist) {
-		_, err = gogit.PlainCloneContext(ctx, mirrorPath, false, &gogit.CloneOptions{URL: remoteURL, Auth: auth, Tags: gogit.AllTags})
-		if err != nil {
-			if isEmptyRemoteRepositoryError(err) {
-				repo, initErr := gogit.PlainInit(mirrorPath, false)
-				if initErr != nil {
-					return fmt.Errorf("initialize empty repository: %w", initErr)
-				}
-				if _, remoteErr := repo.CreateRemote(&config.RemoteConfig{
-					Name: gogit.DefaultRemoteName,
-					URLs: []string{remoteURL},
-				}); remoteErr != nil && !strings.Contains(strings.ToLower(remoteErr.Error()), "remote already exists") {
-					return fmt.Errorf("create remote for empty repository: %w", remoteErr)
-				}
-				return nil
+	repo, err := gogit.PlainOpen(mirrorPath)
+	if err != nil && !errors.Is(err, gogit.ErrRepositoryNotExists) {
+		return fmt.Errorf("open repository: %w", err)
+	}
+	if err == nil {
+		if _, worktreeErr := repo.Worktree(); errors.Is(worktreeErr, gogit.ErrIsBareRepository) {
+			observePhase(observer, GitRefreshPhaseFetch)
+			if err := configureMirrorRemote(repo, remoteURL); err != nil {
+				return err
 			}
-			return fmt.Errorf("clone repository: %w", err)
+			if err := fetchMirror(ctx, repo, auth, progress); err != nil {
+				return fmt.Errorf("fetch repository: %w", err)
+			}
+			return nil
 		}
-		return nil
 	}
-	repo, err := gogit.PlainOpen(mirrorPath)
+	observePhase(observer, GitRefreshPhaseClone)
+	if err := cloneMirror(ctx, remoteURL, mirrorPath, auth, progress); err != nil {
+		return fmt.Errorf("clone repository: %w", err)
+	}
+	return nil
+}
+
+// cloneMirror fetches remoteURL into a new bare repository next to
+// mirrorPath and then moves it into place, so readers never see a partial
+// mirror.
+func cloneMirror(ctx context.Context, remoteURL string, mirrorPath string, auth *githttp.BasicAuth, progress io.Writer) error {
+	partialPath := mirrorPath + ".partial"
+	if err := os.RemoveAll(partialPath); err != nil {
+		return fmt.Errorf("remove partial clone: %w", err)
+	}
+	repo, err := gogit.PlainInit(partialPath, true)
 	if err != nil {
-		return fmt.Errorf("open repository: %w", err)
+		return fmt.Errorf("initialize bare repository: %w", err)
+	}
+	if err := configureMirrorRemote(repo, remoteURL); err != nil {
+		_ = os.RemoveAll(partialPath)
+		return err
+	}
+	if err := fetchMirror(ctx, repo, auth, progress); err != nil {
+		_ = os.RemoveAll(partialPath)
+		return err
+	}
+	previousPath := mirrorPath + ".previous"
+	if err := os.RemoveAll(previousPath); err != nil {
+		return fmt.Errorf("remove previous mirror: %w", err)
+	}
+	if err := os.Rename(mirrorPath, previousPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("move previous mirror aside: %w", err)
+	}
+	if err := os.Rename(partialPath, mirrorPath); err != nil {
+		return fmt.Errorf("move clone into place: %w", err)
 	}
-	worktree, err := repo.Worktree()
+	return os.RemoveAll(previousPath)
+}
+
+// configureMirrorRemote points the origin remote of repo at remoteURL with
+// the mirror refspecs. Remote-tracking branches left by an older refspec are
+// removed, since fetches no longer update them.
+func configureMirrorRemote(repo *gogit.Repository, remoteURL string) error {
+	cfg, err := repo.Config()
 	if err != nil {
-		err = repo.FetchContext(ctx, &gogit.FetchOptions{RemoteName: gogit.DefaultRemoteName, Auth: auth, Force: true, Prune: true, Tags: gogit.AllTags})
-		if err != nil && !errors.Is(err, gogit.NoErrAlreadyUpToDate) {
-			return fmt.Errorf("fetch existing bare repository: %w", err)
+		return fmt.Errorf("read repository config: %w", err)
+	}
+	remote, ok := cfg.Remotes[gogit.DefaultRemoteName]
+	if ok && slices.Equal(remote.URLs, []string{remoteURL}) && slices.Equal(remote.Fetch, gitMirrorFetchRefSpecs) {
+		return nil
+	}
+	cfg.Remotes[gogit.DefaultRemoteName] = &config.RemoteConfig{
+		Name:  gogit.DefaultRemoteName,
+		URLs:  []string{remoteURL},
+		Fetch: gitMirrorFetchRefSpecs,
+	}
+	if err := repo.SetConfig(cfg); err != nil {
+		return fmt.Errorf("configure mirror remote: %w", err)
+	}
+	iter, err := repo.References()
+	if err != nil {
+		return fmt.Errorf("list repository refs: %w", err)
+	}
+	stale := []plumbing.ReferenceName{}
+	_ = iter.ForEach(func(reference *plumbing.Reference) error {
+		if reference.Name().IsRemote() {
+			stale = append(stale, reference.Name())
+		}
+		return nil
+	})
+	for _, name := range stale {
+		if err := repo.Storer.RemoveReference(name); err != nil {
+			return fmt.Errorf("remove remote-tracking ref %s: %w", name, err)
 		}
+	}
+	return nil
+}
+
+// fetchMirror updates every branch and tag of repo from its origin remote.
+// An empty remote leaves the mirror empty.
+func fetchMirror(ctx context.Context, repo *gogit.Repository, auth *githttp.BasicAuth, progress io.Writer) error {
+	err := repo.FetchContext(ctx, &gogit.FetchOptions{
+		RemoteName: gogit.DefaultRemoteName,
+		RefSpecs:   gitMirrorFetchRefSpecs,
+		Auth:       auth,
+		Force:      true,
+		Prune:      true,
+		Tags:       gogit.NoTags,
+		Progress:   progress,
+	})
+	if err != nil && !errors.Is(err, gogit.NoErrAlreadyUpToDate) && !isEmptyRemoteRepositoryError(err) {
+		return err
+	}
+	return nil
+}
+
+// SetMirrorHead points HEAD of the mirror at mirrorPath to branch, the
+// remote's default branch, when the mirror has that branch.
+func SetMirrorHead(mirrorPath string, branch string) error {
+	if strings.TrimSpace(branch) == "" {
 		return nil
 	}
-	err = repo.FetchContext(ctx, &gogit.FetchOptions{RemoteName: gogit.DefaultRemoteName, Auth: auth, Force: true, Prune: true, Tags: gogit.AllTags})
-	if err != nil && !errors.Is(err, gogit.NoErrAlreadyUpToDate) {
-		return fmt.Errorf("fetch repository: %w", err)
+	repo, err := OpenRepository(mirrorPath)
+	if err != nil {
+		return err
+	}
+	target := plumbing.NewBranchReferenceName(branch)
+	if _, err := repo.Reference(target, false); err != nil {
+		return nil
+	}
+	head, err := repo.Storer.Reference(plumbing.HEAD)
+	if err == nil && head.Type() == plumbing.SymbolicReference && head.Target() == target {
+		return nil
 	}
-	err = worktree.PullContext(ctx, &gogit.PullOptions{RemoteName: gogit.DefaultRemoteName, Auth: auth, Force: true})
-	if err != nil && !errors.Is(err, gogit.NoErrAlreadyUpToDate) {
-		return fmt.Errorf("pull repository: %w", err)
+	if err := repo.Storer.SetReference(plumbing.NewSymbolicReference(plumbing.HEAD, target)); err != nil {
+		return fmt.Errorf("set mirror HEAD: %w", err)
 	}
 	return nil
 }
@@ -141,31 +255,12 @@ func OpenRepository(path string) (*gogit.Repository, error) {
 	return repo, nil
 }
 
-func lookupGitPathLastModified(repo *gogit.Repository, from plumbing.Hash, path string) (*time.Time, error) {
-	normalizedPath := strings.Trim(strings.TrimSpace(path), "/")
-	if normalizedPath == "" {
-		return nil, nil
-	}
-
-	iter, err := repo.Log(&gogit.LogOptions{
-		From:  from,
-		Order: gogit.LogOrderCommitterTime,
-		PathFilter: func(candidate string) bool {
-			trimmed := strings.Trim(strings.TrimSpace(candidate), "/")
-			return trimmed == normalizedPath || strings.HasPrefix(trimmed, normalizedPath+"/")
-		},
-	})
-	if err != nil {
-		return nil, err
-	}
-	defer iter.Close()
-
-	commit, err := iter.Next()
-	if err != nil {
-		return nil, err
+// gitPathFilter matches path itself and everything below it.
+func gitPathFilter(path string) func(string) bool {
+	return func(candidate string) bool {
+		trimmed := strings.Trim(strings.TrimSpace(candidate), "/")
+		return trimmed == path || strings.HasPrefix(trimmed, path+"/")
 	}
-	lastModifiedAt := commit.Committer.When.UTC()
-	return &lastModifiedAt, nil
 }
 
 func ParseGitLFSPointer(content []byte) *GitLFSPointerInfo {
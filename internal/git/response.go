@@ -11,7 +11,6 @@ import (
 
 	gogit "github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/plumbing"
-	"github.com/go-git/go-git/v5/plumbing/filemode"
 	"github.com/google/go-github/v87/github"
 	servermw "github.com/calypr/gecko/internal/server/middleware"
 )
@@ -32,32 +31,16 @@ func BuildGitTreeResponse(projectID string, ref string, path string, repo *gogit
 			return nil, fmt.Errorf("load git tree path %s: %w", normalizedPath, err)
 		}
 	}
+	// Last-modified dates are best effort; a listing without them is still
+	// useful. A missing index is built in the background, not here.
+	lastModified, _ := cachedGitLastModifiedIndex(repo, hash)
 	entries := make([]GitTreeEntry, 0, len(tree.Entries))
 	for _, entry := range tree.Entries {
 		entryPath := entry.Name
 		if normalizedPath != "" {
 			entryPath = normalizedPath + "/" + entry.Name
 		}
-		gitEntry := GitTreeEntry{Name: entry.Name, Path: entryPath, Hash: entry.Hash.String()}
-		if entry.Mode == filemode.Dir {
-			gitEntry.Type = "tree"
-		} else {
-			gitEntry.Type = "blob"
-			if file, err := tree.File(entry.Name); err == nil {
-				gitEntry.Size = file.Size
-				if reader, err := file.Reader(); err == nil {
-					contentBytes, readErr := io.ReadAll(io.LimitReader(reader, 2048))
-					_ = reader.Close()
-					if readErr == nil {
-						gitEntry.LFSPointer = ParseGitLFSPointer(contentBytes)
-					}
-				}
-			}
-		}
-		if lastModifiedAt, err := lookupGitPathLastModified(repo, hash, entryPath); err == nil && lastModifiedAt != nil {
-			gitEntry.LastModifiedAt = lastModifiedAt
-		}
-		entries = append(entries, gitEntry)
+		entries = append(entries, buildGitTreeEntry(projectID, ref, entryPath, tree, entry, lastModified))
 	}
 	sort.Slice(entries, func(i, j int) bool {
 		if entries[i].Type != entries[j].Type {
@@ -151,7 +134,7 @@ func BuildGitFileResponse(projectID string, ref string, path string, repo *gogit
 	if len(contentBytes) > inlineLimit {
 		contentBytes = contentBytes[:inlineLimit]
 	}
-	return &GitProjectFileResponse{
+	response := &GitProjectFileResponse{
 		ProjectID:  projectID,
 		Ref:        ref,
 		Path:       normalizedPath,
@@ -159,7 +142,11 @@ func BuildGitFileResponse(projectID string, ref string, path string, repo *gogit
 		Hash:       file.Hash.String(),
 		Size:       file.Size,
 		LFSPointer: ParseGitLFSPointer(contentBytes),
-	}, nil
+	}
+	if response.LFSPointer != nil {
+		response.DataURL = GitLFSDataURL(projectID, ref, normalizedPath)
+	}
+	return response, nil
 }
 
 func BuildGitHubFileResponse(projectID string, ref string, path string, metadata *github.RepositoryContent, contentBytes []byte) *GitProjectFileResponse {
@@ -181,7 +168,7 @@ func BuildGitHubFileResponse(projectID string, ref string, path string, metadata
 		htmlURL = metadata.GetHTMLURL()
 		downloadURL = metadata.GetDownloadURL()
 	}
-	return &GitProjectFileResponse{
+	response := &GitProjectFileResponse{
 		ProjectID:   projectID,
 		Ref:         ref,
 		Path:        strings.Trim(strings.TrimSpace(path), "/"),
@@ -192,6 +179,10 @@ func BuildGitHubFileResponse(projectID string, ref string, path string, metadata
 		DownloadURL: downloadURL,
 		LFSPointer:  ParseGitLFSPointer(contentBytes),
 	}
+	if response.LFSPointer != nil {
+		response.DataURL = GitLFSDataURL(projectID, ref, response.Path)
+	}
+	return response
 }
 
 func (service *GitService) GetGitHubFileMetadata(ctx context.Context, authorizationHeader string, organization string, project string, identity GitRepositoryIdentity, ref string, path string) (*github.RepositoryContent, []byte, error) {
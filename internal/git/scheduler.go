@@ -0,0 +1,385 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"sync"
+	"time"
+
+	geckodb "github.com/calypr/gecko/internal/db"
+	"github.com/jmoiron/sqlx"
+	"github.com/uc-cdis/arborist/arborist"
+)
+
+// AuthorizationSource supplies the authorization header background work uses
+// when it asks Fence for installation tokens.
+type AuthorizationSource func(ctx context.Context) (string, error)
+
+// maxPolledPullRequests bounds how many upload pull requests one pass polls;
+// the least recently checked go first.
+const maxPolledPullRequests = 100
+
+type SyncSchedulerConfig struct {
+	// Interval between passes over git_project_state.
+	Interval time.Duration
+	// Workers bounds how many mirrors refresh at once.
+	Workers int
+	// Jitter is the upper bound of the random delay before each refresh.
+	Jitter time.Duration
+	// BaseBackoff is the delay after a project's first failure; it doubles
+	// with each consecutive failure up to MaxBackoff.
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	// Timeout bounds a single project refresh.
+	Timeout       time.Duration
+	Authorization AuthorizationSource
+}
+
+// SyncScheduler periodically refreshes the mirror of every connected project.
+type SyncScheduler struct {
+	config  SyncSchedulerConfig
+	service *GitService
+	db      *sqlx.DB
+	logger  arborist.Logger
+
+	mu       sync.Mutex
+	failures map[string]syncFailure
+	queued   map[string]bool
+	queue    chan geckodb.GitProjectState
+	runCtx   context.Context
+	cancel   context.CancelFunc
+	running  sync.WaitGroup
+}
+
+type syncFailure struct {
+	count      int
+	retryAfter time.Time
+}
+
+func NewSyncScheduler(service *GitService, db *sqlx.DB, logger arborist.Logger, config SyncSchedulerConfig) *SyncScheduler {
+	if config.Interval <= 0 {
+		config.Interval = 15 * time.Minute
+	}
+	if config.Workers <= 0 {
+		config.Workers = 4
+	}
+	if config.BaseBackoff <= 0 {
+		config.BaseBackoff = config.Interval
+	}
+	if config.MaxBackoff < config.BaseBackoff {
+		config.MaxBackoff = 24 * time.Hour
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 10 * time.Minute
+	}
+	return &SyncScheduler{
+		config:   config,
+		service:  service,
+		db:       db,
+		logger:   logger,
+		failures: map[string]syncFailure{},
+		queued:   map[string]bool{},
+	}
+}
+
+// Start resets syncs a previous process left in the updating state, starts
+// the workers and runs a pass immediately, then one every Interval until Stop
+// is called.
+func (scheduler *SyncScheduler) Start(ctx context.Context) {
+	scheduler.mu.Lock()
+	defer scheduler.mu.Unlock()
+	if scheduler.cancel != nil {
+		return
+	}
+	if reset, err := geckodb.ResetInterruptedGitProjectSyncsContext(ctx, scheduler.db, scheduler.service.syncs.snapshot()); err != nil {
+		scheduler.logger.Warning("failed to reset interrupted git syncs: %s", err)
+	} else if reset > 0 {
+		scheduler.logger.Info("reset %d git syncs interrupted by a previous shutdown", reset)
+	}
+	scheduler.runCtx, scheduler.cancel = context.WithCancel(ctx)
+	scheduler.queue = make(chan geckodb.GitProjectState)
+	for range scheduler.config.Workers {
+		scheduler.running.Add(1)
+		go scheduler.work(scheduler.runCtx)
+	}
+	scheduler.running.Add(1)
+	go scheduler.loop(scheduler.runCtx)
+	scheduler.logger.Info("git sync scheduler started: interval %s, %d workers", scheduler.config.Interval, scheduler.config.Workers)
+}
+
+// Stop cancels in-flight refreshes and waits for the workers to exit.
+func (scheduler *SyncScheduler) Stop() {
+	scheduler.mu.Lock()
+	cancel := scheduler.cancel
+	scheduler.cancel = nil
+	scheduler.mu.Unlock()
+	if cancel == nil {
+		return
+	}
+	cancel()
+	scheduler.running.Wait()
+	scheduler.logger.Info("git sync scheduler stopped")
+}
+
+// Trigger queues an immediate refresh of projectID, skipping any backoff left
+// from earlier failures. It reports false when the scheduler is not running or
+// the project is not connected to a GitHub installation.
+func (scheduler *SyncScheduler) Trigger(ctx context.Context, projectID string) (bool, error) {
+	scheduler.mu.Lock()
+	running := scheduler.cancel != nil
+	scheduler.mu.Unlock()
+	if !running {
+		return false, nil
+	}
+	state, err := geckodb.GitProjectStateByProjectIDContext(ctx, scheduler.db, projectID)
+	if err != nil {
+		return false, err
+	}
+	if state == nil || !syncable(*state) {
+		return false, nil
+	}
+	// Stop clears cancel under mu before it waits, so checking it and
+	// counting the enqueue under mu keeps a trigger from starting after
+	// Stop's wait.
+	scheduler.mu.Lock()
+	if scheduler.cancel == nil {
+		scheduler.mu.Unlock()
+		return false, nil
+	}
+	runCtx := scheduler.runCtx
+	delete(scheduler.failures, projectID)
+	scheduler.running.Add(1)
+	scheduler.mu.Unlock()
+	go func() {
+		defer scheduler.running.Done()
+		scheduler.enqueue(runCtx, *state)
+	}()
+	return true, nil
+}
+
+func (scheduler *SyncScheduler) loop(ctx context.Context) {
+	defer scheduler.running.Done()
+	ticker := time.NewTicker(scheduler.config.Interval)
+	defer ticker.Stop()
+	for {
+		scheduler.pollPullRequests(ctx)
+		scheduler.runPass(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (scheduler *SyncScheduler) work(ctx context.Context) {
+	defer scheduler.running.Done()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case state := <-scheduler.queue:
+			scheduler.mu.Lock()
+			delete(scheduler.queued, state.ProjectID)
+			scheduler.mu.Unlock()
+			scheduler.syncOne(ctx, state)
+		}
+	}
+}
+
+// runPass queues every due project whose mirror has not been evicted,
+// blocking while all workers are busy.
+func (scheduler *SyncScheduler) runPass(ctx context.Context) {
+	states, err := geckodb.ListGitProjectStates(scheduler.db)
+	if err != nil {
+		scheduler.logger.Warning("git sync scheduler could not list projects: %s", err)
+		return
+	}
+	usages, err := geckodb.ListGitMirrorUsageContext(ctx, scheduler.db)
+	if err != nil {
+		scheduler.logger.Warning("git sync scheduler could not list mirror usage: %s", err)
+		usages = map[string]geckodb.GitMirrorUsage{}
+	}
+	now := time.Now()
+	for _, state := range states {
+		// Evicted mirrors are cloned again by the next request that reads
+		// them rather than in the background.
+		if !scheduler.due(state, now) || evictedMirror(usages, state) {
+			continue
+		}
+		if !scheduler.enqueue(ctx, state) {
+			return
+		}
+	}
+}
+
+// pollPullRequests refreshes the pull request state of finalized upload
+// sessions still waiting on review and queues a mirror refresh for the
+// project of each one that has merged. Webhooks normally record these
+// changes first; polling covers missed deliveries.
+func (scheduler *SyncScheduler) pollPullRequests(ctx context.Context) {
+	if scheduler.config.Authorization == nil {
+		return
+	}
+	sessions, err := geckodb.ListGitUploadSessionsAwaitingMergeContext(ctx, scheduler.db, maxPolledPullRequests)
+	if err != nil {
+		scheduler.logger.Warning("git sync scheduler could not list open upload pull requests: %s", err)
+		return
+	}
+	for _, session := range sessions {
+		if ctx.Err() != nil {
+			return
+		}
+		pollCtx, cancel := context.WithTimeout(ctx, time.Minute)
+		merged, err := scheduler.pollPullRequest(pollCtx, &session)
+		cancel()
+		if err != nil {
+			if ctx.Err() == nil {
+				scheduler.logger.Warning("failed to poll pull request of upload session %s: %s", session.ID, err)
+			}
+			continue
+		}
+		if !merged {
+			continue
+		}
+		if _, err := scheduler.Trigger(ctx, session.ProjectID); err != nil {
+			scheduler.logger.Warning("failed to queue refresh of %s after its upload pull request merged: %s", session.ProjectID, err)
+		}
+	}
+}
+
+func (scheduler *SyncScheduler) pollPullRequest(ctx context.Context, session *geckodb.GitUploadSession) (bool, error) {
+	authorizationHeader, err := scheduler.config.Authorization(ctx)
+	if err != nil {
+		return false, err
+	}
+	checkedAt := session.PRCheckedAt
+	merged, err := scheduler.service.PollUploadPullRequest(ctx, authorizationHeader, session)
+	if err != nil {
+		return false, err
+	}
+	// A webhook that recorded the pull request meanwhile wins, and handled
+	// any merge itself.
+	updated, err := geckodb.UpdateGitUploadSessionPullRequestContext(ctx, scheduler.db, *session, checkedAt)
+	if err != nil {
+		return false, err
+	}
+	return merged && updated, nil
+}
+
+// enqueue hands state to a worker unless it is already queued. It returns
+// false once ctx is done.
+func (scheduler *SyncScheduler) enqueue(ctx context.Context, state geckodb.GitProjectState) bool {
+	scheduler.mu.Lock()
+	if scheduler.queued[state.ProjectID] {
+		scheduler.mu.Unlock()
+		return true
+	}
+	scheduler.queued[state.ProjectID] = true
+	scheduler.mu.Unlock()
+	select {
+	case scheduler.queue <- state:
+		return true
+	case <-ctx.Done():
+		scheduler.mu.Lock()
+		delete(scheduler.queued, state.ProjectID)
+		scheduler.mu.Unlock()
+		return false
+	}
+}
+
+func syncable(state geckodb.GitProjectState) bool {
+	return state.InstallationID.Valid && state.RepoOwner != "" && state.RepoName != ""
+}
+
+// due reports whether state belongs to a connected project that is neither
+// refreshing nor backing off after a failure.
+func (scheduler *SyncScheduler) due(state geckodb.GitProjectState, now time.Time) bool {
+	if !syncable(state) {
+		return false
+	}
+	if scheduler.service.SyncInFlight(state.ProjectID) {
+		return false
+	}
+	scheduler.mu.Lock()
+	defer scheduler.mu.Unlock()
+	failure, failed := scheduler.failures[state.ProjectID]
+	return !failed || !now.Before(failure.retryAfter)
+}
+
+func (scheduler *SyncScheduler) syncOne(ctx context.Context, state geckodb.GitProjectState) {
+	if scheduler.config.Jitter > 0 {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(rand.N(scheduler.config.Jitter)):
+		}
+	}
+	refreshCtx, cancel := context.WithTimeout(ctx, scheduler.config.Timeout)
+	defer cancel()
+	if err := scheduler.refresh(refreshCtx, state); err != nil {
+		if ctx.Err() != nil {
+			return
+		}
+		var appErr *Error
+		if errors.As(err, &appErr) && appErr.Kind == ErrorKindConflict {
+			// Another refresh of this project is already running.
+			return
+		}
+		failure := scheduler.recordFailure(state.ProjectID, time.Now())
+		scheduler.logger.Warning("background refresh of %s failed (attempt %d, retry after %s): %s", state.ProjectID, failure.count, failure.retryAfter.Format(time.RFC3339), err)
+		return
+	}
+	scheduler.mu.Lock()
+	delete(scheduler.failures, state.ProjectID)
+	scheduler.mu.Unlock()
+}
+
+func (scheduler *SyncScheduler) refresh(ctx context.Context, state geckodb.GitProjectState) error {
+	organization, project, ok := strings.Cut(state.ProjectID, "/")
+	if !ok {
+		return fmt.Errorf("project id %q is not organization/project", state.ProjectID)
+	}
+	if scheduler.config.Authorization == nil {
+		return fmt.Errorf("no authorization source is configured for background refreshes")
+	}
+	authorizationHeader, err := scheduler.config.Authorization(ctx)
+	if err != nil {
+		return err
+	}
+	identity := GitRepositoryIdentity{Host: state.RepoHost, Owner: state.RepoOwner, Repo: state.RepoName}
+	accessToken, err := scheduler.service.RequestInstallationToken(ctx, authorizationHeader, organization, project, identity, "read")
+	if err != nil {
+		return err
+	}
+	_, _, err = scheduler.service.SyncProject(ctx, scheduler.db, state.ProjectID, identity, &state, accessToken)
+	return err
+}
+
+func (scheduler *SyncScheduler) recordFailure(projectID string, now time.Time) syncFailure {
+	scheduler.mu.Lock()
+	defer scheduler.mu.Unlock()
+	failure := scheduler.failures[projectID]
+	failure.count++
+	failure.retryAfter = now.Add(syncBackoff(failure.count, scheduler.config.BaseBackoff, scheduler.config.MaxBackoff))
+	scheduler.failures[projectID] = failure
+	return failure
+}
+
+// syncBackoff is base doubled for each failure after the first, capped at max.
+func syncBackoff(failures int, base time.Duration, max time.Duration) time.Duration {
+	backoff := base
+	for i := 1; i < failures; i++ {
+		if backoff >= max/2 {
+			return max
+		}
+		backoff *= 2
+	}
+	if backoff > max {
+		return max
+	}
+	return backoff
+}
@@ -0,0 +1,77 @@
+package git
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	geckodb "github.com/calypr/gecko/internal/db"
+	"github.com/jmoiron/sqlx"
+)
+
+func TestSyncBackoffDoublesUpToMax(t *testing.T) {
+	base := time.Minute
+	max := 10 * time.Minute
+	expected := []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 8 * time.Minute, max, max}
+	for index, want := range expected {
+		if got := syncBackoff(index+1, base, max); got != want {
+			t.Fatalf("failure %d: expected %s, got %s", index+1, want, got)
+		}
+	}
+}
+
+func TestSyncSchedulerSkipsInFlightAndBackingOffProjects(t *testing.T) {
+	service := NewGitService(GitServiceConfig{DataDir: t.TempDir()})
+	scheduler := NewSyncScheduler(service, nil, nil, SyncSchedulerConfig{Interval: time.Minute})
+	connected := geckodb.GitProjectState{ProjectID: "org/project", RepoOwner: "org", RepoName: "repo", InstallationID: sql.NullInt64{Int64: 1, Valid: true}}
+	now := time.Now()
+
+	if !scheduler.due(connected, now) {
+		t.Fatal("expected connected project to be due")
+	}
+	disconnected := connected
+	disconnected.InstallationID = sql.NullInt64{}
+	if scheduler.due(disconnected, now) {
+		t.Fatal("expected project without an installation to be skipped")
+	}
+
+	service.syncs.begin(connected.ProjectID)
+	if scheduler.due(connected, now) {
+		t.Fatal("expected in-flight project to be skipped")
+	}
+	service.syncs.end(connected.ProjectID)
+
+	failure := scheduler.recordFailure(connected.ProjectID, now)
+	if scheduler.due(connected, now) {
+		t.Fatal("expected failed project to back off")
+	}
+	if !scheduler.due(connected, failure.retryAfter) {
+		t.Fatal("expected project to be due once its backoff elapses")
+	}
+}
+
+func TestSyncProjectWritesOnlySyncColumns(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("create sqlmock: %v", err)
+	}
+	defer db.Close()
+	service := NewGitService(GitServiceConfig{DataDir: t.TempDir()})
+	state := &geckodb.GitProjectState{ProjectID: "org/project", RepoHost: "github.com", RepoOwner: "org", RepoName: "repo", SyncState: GitSyncReady}
+	mock.ExpectExec(`UPDATE config_schema\.git_project_state\s+SET sync_state = \$2, last_error = \$3`).
+		WithArgs("org/project", GitSyncUpdating, nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE config_schema\.git_project_state\s+SET sync_state = \$2, last_error = \$3`).
+		WithArgs("org/project", GitSyncError, "github client is not initialized").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	identity := GitRepositoryIdentity{Host: "github.com", Owner: "org", Repo: "repo"}
+	if _, _, err := service.SyncProject(context.Background(), sqlx.NewDb(db, "sqlmock"), "org/project", identity, state, "token"); err == nil {
+		t.Fatal("expected the refresh to fail without a github client")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -50,6 +50,11 @@ func (service *GitService) FetchRepositoryMetadata(ctx context.Context, accessTo
 }
 
 func (service *GitService) RefreshProject(ctx context.Context, projectID string, identity GitRepositoryIdentity, state *geckodb.GitProjectState, accessToken string) (*GitProjectRefreshResponse, *geckodb.GitProjectState, error) {
+	return service.refreshProject(ctx, projectID, identity, state, accessToken, nil)
+}
+
+func (service *GitService) refreshProject(ctx context.Context, projectID string, identity GitRepositoryIdentity, state *geckodb.GitProjectState, accessToken string, observer RefreshObserver) (*GitProjectRefreshResponse, *geckodb.GitProjectState, error) {
+	observePhase(observer, GitRefreshPhaseMetadata)
 	repoMetadata, err := service.FetchRepositoryMetadata(ctx, accessToken, identity)
 	if err != nil {
 		return nil, state, err
@@ -61,9 +66,20 @@ func (service *GitService) RefreshProject(ctx context.Context, projectID string,
 		state.MirrorPath = service.MirrorPathForIdentity(identity)
 	}
 	cloneURL := fmt.Sprintf("https://%s/%s/%s.git", identity.Host, identity.Owner, identity.Repo)
-	if err := SyncRepositoryMirror(ctx, cloneURL, state.MirrorPath, &githttp.BasicAuth{Username: "x-access-token", Password: accessToken}); err != nil {
+	if err := SyncRepositoryMirrorWithObserver(ctx, cloneURL, state.MirrorPath, &githttp.BasicAuth{Username: "x-access-token", Password: accessToken}, observer); err != nil {
 		return nil, state, err
 	}
+	// HEAD only backs requests that name no ref and whose project has no
+	// default branch, so a mirror that keeps its old HEAD still serves.
+	_ = SetMirrorHead(state.MirrorPath, repoMetadata.DefaultBranch)
+	observePhase(observer, GitRefreshPhaseIndex)
+	if repo, err := OpenRepository(state.MirrorPath); err == nil {
+		// A listing without its index still serves, only without dates, so
+		// a failure here does not fail the refresh.
+		if err := IndexGitLastModified(repo); err != nil {
+			service.logWarning("failed to build last-modified indexes of %s: %s", projectID, err)
+		}
+	}
 	updated := *state
 	updated.InstallationTarget = sql.NullString{String: identity.Owner, Valid: identity.Owner != ""}
 	updated.InstallationTargetType = sql.NullString{String: "Organization", Valid: identity.Owner != ""}
@@ -95,6 +111,9 @@ func (service *GitService) StatusFromState(projectID string, organization string
 			response.OrganizationRepositorySelection = orgState.RepositorySelection.String
 		}
 	}
+	if service.SyncInFlight(projectID) {
+		response.SyncState = GitSyncUpdating
+	}
 	if state == nil {
 		return response
 	}
@@ -111,7 +130,7 @@ func (service *GitService) StatusFromState(projectID string, organization string
 	if state.InstallationTargetType.Valid {
 		response.InstallationTargetType = state.InstallationTargetType.String
 	}
-	if state.SyncState != "" {
+	if state.SyncState != "" && response.SyncState != GitSyncUpdating {
 		response.SyncState = state.SyncState
 	}
 	if state.DefaultBranch.Valid {
@@ -253,4 +253,8 @@ func TestBuildGitResponsesDetectLFSPointers(t *testing.T) {
 	if fileResponse.LFSPointer.OID != treePointer.OID {
 		t.Fatalf("expected matching lfs oid, got %q and %q", fileResponse.LFSPointer.OID, treePointer.OID)
 	}
+	expectedDataURL := "/git/projects/org-a/proj-a/download/data/tcga.tumor.ensembl.tsv?ref=" + refName
+	if treeResponse.Entries[0].DataURL != expectedDataURL || fileResponse.DataURL != expectedDataURL {
+		t.Fatalf("expected data url %q, got %q and %q", expectedDataURL, treeResponse.Entries[0].DataURL, fileResponse.DataURL)
+	}
 }
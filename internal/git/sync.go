@@ -0,0 +1,109 @@
+package git
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"sync"
+
+	geckodb "github.com/calypr/gecko/internal/db"
+	"github.com/jmoiron/sqlx"
+)
+
+// syncTracker records which projects have a mirror refresh running in this
+// process so concurrent refreshes of one mirror never overlap.
+type syncTracker struct {
+	mu       sync.Mutex
+	inFlight map[string]bool
+}
+
+func newSyncTracker() *syncTracker {
+	return &syncTracker{inFlight: map[string]bool{}}
+}
+
+func (tracker *syncTracker) begin(projectID string) bool {
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+	if tracker.inFlight[projectID] {
+		return false
+	}
+	tracker.inFlight[projectID] = true
+	return true
+}
+
+func (tracker *syncTracker) end(projectID string) {
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+	delete(tracker.inFlight, projectID)
+}
+
+func (tracker *syncTracker) running(projectID string) bool {
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+	return tracker.inFlight[projectID]
+}
+
+func (tracker *syncTracker) snapshot() []string {
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+	projectIDs := make([]string, 0, len(tracker.inFlight))
+	for projectID := range tracker.inFlight {
+		projectIDs = append(projectIDs, projectID)
+	}
+	return projectIDs
+}
+
+// SyncInFlight reports whether a refresh of projectID is running in this
+// process.
+func (service *GitService) SyncInFlight(projectID string) bool {
+	if service == nil || service.syncs == nil {
+		return false
+	}
+	return service.syncs.running(projectID)
+}
+
+// SyncProject refreshes the mirror of projectID and persists every sync state
+// transition: updating while the refresh runs, then ready or error with
+// last_error. It fails with a conflict when a refresh of the same project is
+// already running.
+func (service *GitService) SyncProject(ctx context.Context, db *sqlx.DB, projectID string, identity GitRepositoryIdentity, state *geckodb.GitProjectState, accessToken string) (*GitProjectRefreshResponse, *geckodb.GitProjectState, error) {
+	return service.SyncProjectWithObserver(ctx, db, projectID, identity, state, accessToken, nil)
+}
+
+// SyncProjectWithObserver is SyncProject that reports refresh phases and
+// progress to observer, which may be nil.
+func (service *GitService) SyncProjectWithObserver(ctx context.Context, db *sqlx.DB, projectID string, identity GitRepositoryIdentity, state *geckodb.GitProjectState, accessToken string, observer RefreshObserver) (*GitProjectRefreshResponse, *geckodb.GitProjectState, error) {
+	if !service.syncs.begin(projectID) {
+		return nil, state, NewError(ErrorKindConflict, http.StatusConflict, fmt.Sprintf("a refresh of %s is already in progress", projectID), map[string]any{"project_id": projectID})
+	}
+	defer service.syncs.end(projectID)
+
+	if state == nil {
+		state = &geckodb.GitProjectState{ProjectID: projectID, RepoHost: identity.Host, RepoOwner: identity.Owner, RepoName: identity.Repo, MirrorPath: service.MirrorPathForIdentity(identity), SyncState: GitSyncNeverSynced}
+	}
+	state.SyncState = GitSyncUpdating
+	state.LastError = sql.NullString{}
+	// Only the sync columns are written from here on, so installation or
+	// repository changes made while the refresh runs are kept. A project
+	// refreshed for the first time gets its whole row.
+	exists, err := geckodb.UpdateGitProjectSyncStateContext(ctx, db, projectID, state.SyncState, state.LastError)
+	if err == nil && !exists {
+		err = geckodb.UpsertGitProjectStateContext(ctx, db, *state)
+	}
+	if err != nil {
+		return nil, state, WrapError(ErrorKindDatabase, http.StatusInternalServerError, fmt.Sprintf("failed to persist updating git state: %s", err), err, map[string]any{"project_id": projectID})
+	}
+	refreshResponse, updatedState, err := service.refreshProject(ctx, projectID, identity, state, accessToken, observer)
+	if err != nil {
+		state.SyncState = GitSyncError
+		state.LastError = sql.NullString{String: err.Error(), Valid: true}
+		// The refresh context may already be done; record the failure regardless.
+		_, _ = geckodb.UpdateGitProjectSyncStateContext(context.WithoutCancel(ctx), db, projectID, state.SyncState, state.LastError)
+		return nil, state, err
+	}
+	if err := geckodb.RecordGitProjectSyncContext(ctx, db, *updatedState); err != nil {
+		return nil, updatedState, WrapError(ErrorKindDatabase, http.StatusInternalServerError, fmt.Sprintf("failed to persist updated git state: %s", err), err, map[string]any{"project_id": projectID})
+	}
+	return refreshResponse, updatedState, nil
+}
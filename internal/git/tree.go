@@ -0,0 +1,348 @@
+package git
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+const (
+	GitTreeEntryBlob = "blob"
+	GitTreeEntryTree = "tree"
+	// GitTreeEntryLFS selects blobs that are LFS pointers; entries still
+	// report the blob type.
+	GitTreeEntryLFS = "lfs"
+)
+
+const (
+	DefaultGitTreePageSize = 1000
+	MaxGitTreePageSize     = 5000
+)
+
+// errGitTreePageFull stops a tree walk once a page has been filled.
+var errGitTreePageFull = errors.New("tree page is full")
+
+// gitTreeCursor pins a tree listing to the commit it started from and
+// records the path of the last entry it returned, so the next page resumes
+// the walk right after it instead of walking and filtering the skipped
+// entries again.
+type gitTreeCursor struct {
+	head  plumbing.Hash
+	after string
+}
+
+func (cursor gitTreeCursor) encode() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(cursor.head.String() + ":" + cursor.after))
+}
+
+func parseGitTreeCursor(value string) (gitTreeCursor, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return gitTreeCursor{}, fmt.Errorf("decode cursor: %w", err)
+	}
+	head, after, ok := strings.Cut(string(decoded), ":")
+	if !ok || !plumbing.IsHash(head) || after == "" {
+		return gitTreeCursor{}, errors.New("malformed cursor")
+	}
+	return gitTreeCursor{head: plumbing.NewHash(head), after: after}, nil
+}
+
+// GitTreeQuery filters and pages a tree listing. Patterns use / separated
+// globs where ** matches any number of directories; a pattern without a /
+// matches the entry name at any depth. An excluded directory is not
+// descended into.
+type GitTreeQuery struct {
+	Recursive bool
+	Include   []string
+	Exclude   []string
+	MaxDepth  int
+	Types     []string
+	Cursor    string
+	Limit     int
+}
+
+// BuildGitTreeListing lists the tree at path in the commit hash filtered by
+// query, one directory level or, with query.Recursive, depth first. Children
+// come in the same order as BuildGitTreeResponse: directories first, then by
+// case-insensitive name.
+func BuildGitTreeListing(projectID string, ref string, treePath string, repo *gogit.Repository, hash plumbing.Hash, query GitTreeQuery) (*GitProjectTreeResponse, error) {
+	limit := query.Limit
+	if limit <= 0 {
+		limit = DefaultGitTreePageSize
+	}
+	if limit > MaxGitTreePageSize {
+		limit = MaxGitTreePageSize
+	}
+	maxDepth := query.MaxDepth
+	if !query.Recursive {
+		maxDepth = 1
+	}
+	for _, pattern := range append(append([]string{}, query.Include...), query.Exclude...) {
+		if err := validateGitGlob(pattern); err != nil {
+			return nil, WrapError(ErrorKindValidation, http.StatusBadRequest, fmt.Sprintf("invalid path pattern %q", pattern), err, map[string]any{"pattern": pattern})
+		}
+	}
+	types := map[string]bool{}
+	for _, entryType := range query.Types {
+		switch entryType {
+		case GitTreeEntryBlob, GitTreeEntryTree, GitTreeEntryLFS:
+			types[entryType] = true
+		default:
+			return nil, NewError(ErrorKindValidation, http.StatusBadRequest, fmt.Sprintf("unknown entry type %q", entryType), map[string]any{"type": entryType, "allowed": []string{GitTreeEntryBlob, GitTreeEntryTree, GitTreeEntryLFS}})
+		}
+	}
+	cursor := gitTreeCursor{head: hash}
+	if strings.TrimSpace(query.Cursor) != "" {
+		parsed, err := parseGitTreeCursor(strings.TrimSpace(query.Cursor))
+		if err != nil {
+			return nil, WrapError(ErrorKindValidation, http.StatusBadRequest, "invalid tree cursor", err, map[string]any{"cursor": query.Cursor})
+		}
+		cursor = parsed
+	}
+
+	tree, err := commitTree(repo, ref, cursor.head)
+	if err != nil {
+		return nil, err
+	}
+	normalizedPath := strings.Trim(strings.TrimSpace(treePath), "/")
+	if normalizedPath != "" {
+		tree, err = tree.Tree(normalizedPath)
+		if err != nil {
+			return nil, fmt.Errorf("load git tree path %s: %w", normalizedPath, err)
+		}
+	}
+	var resume []string
+	if cursor.after != "" {
+		relative := cursor.after
+		if normalizedPath != "" {
+			var ok bool
+			if relative, ok = strings.CutPrefix(cursor.after, normalizedPath+"/"); !ok {
+				return nil, NewError(ErrorKindValidation, http.StatusBadRequest, "tree cursor belongs to another path", map[string]any{"cursor": query.Cursor, "path": normalizedPath})
+			}
+		}
+		resume = strings.Split(relative, "/")
+	}
+	lastModified, _ := cachedGitLastModifiedIndex(repo, cursor.head)
+
+	walk := gitTreeWalk{
+		projectID:    projectID,
+		ref:          ref,
+		query:        query,
+		types:        types,
+		maxDepth:     maxDepth,
+		limit:        limit,
+		lastModified: lastModified,
+		entries:      make([]GitTreeEntry, 0),
+	}
+	err = walk.visit(tree, normalizedPath, 1, resume)
+	if errors.Is(err, errGitTreeCursorNotFound) {
+		return nil, WrapError(ErrorKindValidation, http.StatusBadRequest, "invalid tree cursor", err, map[string]any{"cursor": query.Cursor})
+	}
+	if err != nil && !errors.Is(err, errGitTreePageFull) {
+		return nil, err
+	}
+	response := &GitProjectTreeResponse{ProjectID: projectID, Ref: ref, Path: normalizedPath, Entries: walk.entries}
+	if walk.hasMore {
+		response.NextCursor = gitTreeCursor{head: cursor.head, after: walk.entries[len(walk.entries)-1].Path}.encode()
+	}
+	return response, nil
+}
+
+// errGitTreeCursorNotFound reports a cursor naming a path the pinned tree
+// does not have.
+var errGitTreeCursorNotFound = errors.New("cursor path is not in the tree")
+
+// gitTreeWalk collects one page of a filtered tree listing.
+type gitTreeWalk struct {
+	projectID    string
+	ref          string
+	query        GitTreeQuery
+	types        map[string]bool
+	maxDepth     int
+	limit        int
+	lastModified *gitLastModifiedIndex
+	hasMore      bool
+	entries      []GitTreeEntry
+}
+
+// visit lists the children of tree, which sits at prefix. resume holds the
+// segments below prefix of the entry the previous page ended with; the
+// children up to it are skipped without being read.
+func (walk *gitTreeWalk) visit(tree *object.Tree, prefix string, depth int, resume []string) error {
+	children := append([]object.TreeEntry{}, tree.Entries...)
+	sort.SliceStable(children, func(i, j int) bool {
+		iDir, jDir := children[i].Mode == filemode.Dir, children[j].Mode == filemode.Dir
+		if iDir != jDir {
+			return iDir
+		}
+		iName, jName := strings.ToLower(children[i].Name), strings.ToLower(children[j].Name)
+		if iName != jName {
+			return iName < jName
+		}
+		return children[i].Name < children[j].Name
+	})
+	for position := 0; position < len(children); position++ {
+		child := children[position]
+		entryPath := child.Name
+		if prefix != "" {
+			entryPath = prefix + "/" + child.Name
+		}
+		var below []string
+		if len(resume) > 0 {
+			// The children before the resume point were listed already.
+			found := false
+			for ; position < len(children); position++ {
+				if children[position].Name == resume[0] {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return errGitTreeCursorNotFound
+			}
+			child = children[position]
+			entryPath = child.Name
+			if prefix != "" {
+				entryPath = prefix + "/" + child.Name
+			}
+			below, resume = resume[1:], nil
+			if len(below) > 0 && child.Mode != filemode.Dir {
+				return errGitTreeCursorNotFound
+			}
+		} else {
+			if matchAnyGitGlob(walk.query.Exclude, entryPath) {
+				continue
+			}
+			if entry, ok := walk.selected(tree, child, entryPath); ok {
+				if len(walk.entries) == walk.limit {
+					walk.hasMore = true
+					return errGitTreePageFull
+				}
+				if entry == nil {
+					built := buildGitTreeEntry(walk.projectID, walk.ref, entryPath, tree, child, walk.lastModified)
+					entry = &built
+				}
+				walk.entries = append(walk.entries, *entry)
+			}
+		}
+		if child.Mode != filemode.Dir || (walk.maxDepth > 0 && depth >= walk.maxDepth) {
+			continue
+		}
+		subtree, err := tree.Tree(child.Name)
+		if err != nil {
+			return fmt.Errorf("load git tree path %s: %w", entryPath, err)
+		}
+		if err := walk.visit(subtree, entryPath, depth+1, below); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// selected reports whether child passes the include patterns and type
+// filters. Blobs are only read when the lfs type has to be told apart; the
+// entry built while reading one is returned so it is not read again.
+func (walk *gitTreeWalk) selected(tree *object.Tree, child object.TreeEntry, entryPath string) (*GitTreeEntry, bool) {
+	if len(walk.query.Include) > 0 && !matchAnyGitGlob(walk.query.Include, entryPath) {
+		return nil, false
+	}
+	switch {
+	case len(walk.types) == 0:
+		return nil, true
+	case child.Mode == filemode.Dir:
+		return nil, walk.types[GitTreeEntryTree]
+	case walk.types[GitTreeEntryBlob]:
+		return nil, true
+	case !walk.types[GitTreeEntryLFS]:
+		return nil, false
+	}
+	entry := buildGitTreeEntry(walk.projectID, walk.ref, entryPath, tree, child, walk.lastModified)
+	return &entry, entry.LFSPointer != nil
+}
+
+// buildGitTreeEntry describes child of tree, which sits at entryPath.
+func buildGitTreeEntry(projectID string, ref string, entryPath string, tree *object.Tree, child object.TreeEntry, lastModified *gitLastModifiedIndex) GitTreeEntry {
+	gitEntry := GitTreeEntry{Name: child.Name, Path: entryPath, Hash: child.Hash.String()}
+	if child.Mode == filemode.Dir {
+		gitEntry.Type = GitTreeEntryTree
+	} else {
+		gitEntry.Type = GitTreeEntryBlob
+		if file, err := tree.File(child.Name); err == nil {
+			gitEntry.Size = file.Size
+			gitEntry.LFSPointer = readGitLFSPointer(file)
+			if gitEntry.LFSPointer != nil {
+				gitEntry.DataURL = GitLFSDataURL(projectID, ref, entryPath)
+			}
+		}
+	}
+	if lastModified != nil {
+		if changed, ok := lastModified.Paths[entryPath]; ok {
+			lastModifiedAt := changed.When
+			gitEntry.LastModifiedAt = &lastModifiedAt
+			gitEntry.LastCommitSHA = changed.Commit
+		}
+	}
+	return gitEntry
+}
+
+func validateGitGlob(pattern string) error {
+	if strings.TrimSpace(pattern) == "" {
+		return errors.New("pattern is empty")
+	}
+	for _, segment := range strings.Split(strings.Trim(pattern, "/"), "/") {
+		if _, err := path.Match(segment, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func matchAnyGitGlob(patterns []string, entryPath string) bool {
+	for _, pattern := range patterns {
+		if matchGitGlob(pattern, entryPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchGitGlob reports whether entryPath matches pattern. A pattern without
+// a / is matched against the last path segment only.
+func matchGitGlob(pattern string, entryPath string) bool {
+	pattern = strings.Trim(strings.TrimSpace(pattern), "/")
+	if !strings.Contains(pattern, "/") {
+		matched, _ := path.Match(pattern, path.Base(entryPath))
+		return matched
+	}
+	return matchGitGlobSegments(strings.Split(pattern, "/"), strings.Split(entryPath, "/"))
+}
+
+func matchGitGlobSegments(pattern []string, segments []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for skipped := 0; skipped <= len(segments); skipped++ {
+				if matchGitGlobSegments(pattern[1:], segments[skipped:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(segments) == 0 {
+			return false
+		}
+		if matched, _ := path.Match(pattern[0], segments[0]); !matched {
+			return false
+		}
+		pattern, segments = pattern[1:], segments[1:]
+	}
+	return len(segments) == 0
+}
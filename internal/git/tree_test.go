@@ -0,0 +1,136 @@
+package git
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	gogit "github.com/go-git/go-git/v5"
+)
+
+func TestBuildGitTreeListingFiltersAndPages(t *testing.T) {
+	root := t.TempDir()
+	repo, err := gogit.PlainInit(root, false)
+	if err != nil {
+		t.Fatalf("init repo: %v", err)
+	}
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	commitTestFile(t, repo, root, "README.md", "hello", "alice", start)
+	commitTestFile(t, repo, root, "data/a.vcf.gz", lfsPointerContent(strings.Repeat("a", 64), 100), "alice", start.Add(time.Minute))
+	commitTestFile(t, repo, root, "data/nested/b.vcf.gz", lfsPointerContent(strings.Repeat("b", 64), 200), "alice", start.Add(2*time.Minute))
+	commitTestFile(t, repo, root, "data/nested/notes.txt", "notes", "alice", start.Add(3*time.Minute))
+	head := commitTestFile(t, repo, root, "scratch/c.vcf.gz", "not a pointer", "alice", start.Add(4*time.Minute))
+
+	paths := func(response *GitProjectTreeResponse) []string {
+		result := []string{}
+		for _, entry := range response.Entries {
+			result = append(result, entry.Path)
+		}
+		return result
+	}
+
+	all, err := BuildGitTreeListing("org/project", "master", "", repo, head, GitTreeQuery{Recursive: true})
+	if err != nil {
+		t.Fatalf("recursive listing: %v", err)
+	}
+	expected := "data,data/nested,data/nested/b.vcf.gz,data/nested/notes.txt,data/a.vcf.gz,scratch,scratch/c.vcf.gz,README.md"
+	if got := strings.Join(paths(all), ","); got != expected {
+		t.Fatalf("expected %s, got %s", expected, got)
+	}
+
+	vcfs, err := BuildGitTreeListing("org/project", "master", "", repo, head, GitTreeQuery{Recursive: true, Include: []string{"**/*.vcf.gz"}, Exclude: []string{"scratch"}})
+	if err != nil {
+		t.Fatalf("filtered listing: %v", err)
+	}
+	if got := strings.Join(paths(vcfs), ","); got != "data/nested/b.vcf.gz,data/a.vcf.gz" {
+		t.Fatalf("unexpected filtered listing: %s", got)
+	}
+	if vcfs.Entries[0].LFSPointer == nil || vcfs.Entries[0].DataURL == "" {
+		t.Fatalf("expected LFS pointer details, got %+v", vcfs.Entries[0])
+	}
+
+	lfs, err := BuildGitTreeListing("org/project", "master", "", repo, head, GitTreeQuery{Recursive: true, Types: []string{GitTreeEntryLFS}})
+	if err != nil {
+		t.Fatalf("lfs listing: %v", err)
+	}
+	if got := strings.Join(paths(lfs), ","); got != "data/nested/b.vcf.gz,data/a.vcf.gz" {
+		t.Fatalf("unexpected lfs listing: %s", got)
+	}
+
+	shallow, err := BuildGitTreeListing("org/project", "master", "data", repo, head, GitTreeQuery{Recursive: true, MaxDepth: 1, Types: []string{GitTreeEntryTree}})
+	if err != nil {
+		t.Fatalf("depth limited listing: %v", err)
+	}
+	if got := strings.Join(paths(shallow), ","); got != "data/nested" {
+		t.Fatalf("unexpected depth limited listing: %s", got)
+	}
+
+	first, err := BuildGitTreeListing("org/project", "master", "", repo, head, GitTreeQuery{Recursive: true, Limit: 5})
+	if err != nil {
+		t.Fatalf("first page: %v", err)
+	}
+	if len(first.Entries) != 5 || first.NextCursor == "" {
+		t.Fatalf("expected a full first page with a cursor, got %+v", first)
+	}
+	commitTestFile(t, repo, root, "data/later.vcf.gz", "added after the first page", "bob", start.Add(5*time.Minute))
+	second, err := BuildGitTreeListing("org/project", "master", "", repo, head, GitTreeQuery{Recursive: true, Limit: 5, Cursor: first.NextCursor})
+	if err != nil {
+		t.Fatalf("second page: %v", err)
+	}
+	if got := strings.Join(append(paths(first), paths(second)...), ","); got != expected || second.NextCursor != "" {
+		t.Fatalf("expected pages to cover %s, got %s (next %q)", expected, got, second.NextCursor)
+	}
+
+	lfsPages := []string{}
+	cursor := ""
+	for page := 0; page < 3; page++ {
+		response, err := BuildGitTreeListing("org/project", "master", "", repo, head, GitTreeQuery{Recursive: true, Types: []string{GitTreeEntryLFS}, Limit: 1, Cursor: cursor})
+		if err != nil {
+			t.Fatalf("lfs page %d: %v", page, err)
+		}
+		lfsPages = append(lfsPages, paths(response)...)
+		if cursor = response.NextCursor; cursor == "" {
+			break
+		}
+	}
+	if got := strings.Join(lfsPages, ","); got != "data/nested/b.vcf.gz,data/a.vcf.gz" || cursor != "" {
+		t.Fatalf("expected lfs pages to resume after the last path, got %s (next %q)", got, cursor)
+	}
+
+	stale := gitTreeCursor{head: head, after: "data/missing.txt"}.encode()
+	_, err = BuildGitTreeListing("org/project", "master", "", repo, head, GitTreeQuery{Recursive: true, Cursor: stale})
+	var cursorErr *Error
+	if !errors.As(err, &cursorErr) || cursorErr.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected a cursor naming a missing path to be rejected, got %v", err)
+	}
+
+	_, err = BuildGitTreeListing("org/project", "master", "", repo, head, GitTreeQuery{Types: []string{"symlink"}})
+	var appErr *Error
+	if !errors.As(err, &appErr) || appErr.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected validation error for unknown type, got %v", err)
+	}
+}
+
+func TestMatchGitGlob(t *testing.T) {
+	cases := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"**/*.vcf.gz", "a.vcf.gz", true},
+		{"**/*.vcf.gz", "data/nested/a.vcf.gz", true},
+		{"*.vcf.gz", "data/a.vcf.gz", true},
+		{"data/*.bam", "data/a.bam", true},
+		{"data/*.bam", "data/nested/a.bam", false},
+		{"data/**", "data/nested/a.bam", true},
+		{"data/**/a.bam", "data/a.bam", true},
+		{"raw/**/*.bam", "data/raw/a.bam", false},
+	}
+	for _, tc := range cases {
+		if got := matchGitGlob(tc.pattern, tc.path); got != tc.want {
+			t.Errorf("matchGitGlob(%q, %q) = %v, want %v", tc.pattern, tc.path, got, tc.want)
+		}
+	}
+}
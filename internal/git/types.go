@@ -12,6 +12,7 @@ import (
 	"github.com/calypr/gecko/internal/integrations/fence"
 	gitapi "github.com/calypr/gecko/internal/integrations/github"
 	"github.com/jmoiron/sqlx"
+	"github.com/uc-cdis/arborist/arborist"
 )
 
 const (
@@ -31,6 +32,9 @@ type GitServiceConfig struct {
 	HTTPClient    *http.Client
 	FenceClient   *fence.Client
 	GitHubClient  *gitapi.Client
+	// MirrorQuota caps the bytes the mirrors under DataDir may use. Mirror
+	// maintenance evicts idle mirrors beyond it; zero means no cap.
+	MirrorQuota int64
 }
 
 type GitService struct {
@@ -38,6 +42,12 @@ type GitService struct {
 	client    *http.Client
 	fenceAPI  *fence.Client
 	githubAPI *gitapi.Client
+	syncs     *syncTracker
+	inventory *lfsInventoryCache
+	access    *mirrorAccessTracker
+	holds     *mirrorHolds
+	indexing  *lastModifiedBuilds
+	logger    arborist.Logger
 }
 
 // GitRepositoryIdentity is an alias for domain.GitRepositoryIdentity.
@@ -225,14 +235,17 @@ type GitTreeEntry struct {
 	Hash           string             `json:"hash"`
 	Size           int64              `json:"size,omitempty"`
 	LastModifiedAt *time.Time         `json:"last_modified_at,omitempty"`
+	LastCommitSHA  string             `json:"last_commit_sha,omitempty"`
 	LFSPointer     *GitLFSPointerInfo `json:"lfs_pointer,omitempty"`
+	DataURL        string             `json:"data_url,omitempty"`
 }
 
 type GitProjectTreeResponse struct {
-	ProjectID string         `json:"project_id"`
-	Ref       string         `json:"ref"`
-	Path      string         `json:"path"`
-	Entries   []GitTreeEntry `json:"entries"`
+	ProjectID  string         `json:"project_id"`
+	Ref        string         `json:"ref"`
+	Path       string         `json:"path"`
+	Entries    []GitTreeEntry `json:"entries"`
+	NextCursor string         `json:"next_cursor,omitempty"`
 }
 
 type GitProjectFileResponse struct {
@@ -245,6 +258,104 @@ type GitProjectFileResponse struct {
 	HTMLURL     string             `json:"html_url,omitempty"`
 	DownloadURL string             `json:"download_url,omitempty"`
 	LFSPointer  *GitLFSPointerInfo `json:"lfs_pointer,omitempty"`
+	DataURL     string             `json:"data_url,omitempty"`
+}
+
+type GitCommitIdentity struct {
+	Name  string    `json:"name"`
+	Email string    `json:"email"`
+	When  time.Time `json:"when"`
+}
+
+type GitCommit struct {
+	SHA          string            `json:"sha"`
+	Parents      []string          `json:"parents"`
+	Author       GitCommitIdentity `json:"author"`
+	Committer    GitCommitIdentity `json:"committer"`
+	Message      string            `json:"message"`
+	ChangedPaths []string          `json:"changed_paths"`
+}
+
+type GitProjectCommitsResponse struct {
+	ProjectID  string      `json:"project_id"`
+	Ref        string      `json:"ref"`
+	Path       string      `json:"path,omitempty"`
+	Commits    []GitCommit `json:"commits"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+}
+
+type GitLFSChange struct {
+	OldOID  string `json:"old_oid,omitempty"`
+	OldSize int64  `json:"old_size,omitempty"`
+	NewOID  string `json:"new_oid,omitempty"`
+	NewSize int64  `json:"new_size,omitempty"`
+}
+
+type GitCompareFileChange struct {
+	Path             string        `json:"path"`
+	PreviousPath     string        `json:"previous_path,omitempty"`
+	ChangeType       string        `json:"change_type"`
+	Additions        int           `json:"additions"`
+	Deletions        int           `json:"deletions"`
+	Binary           bool          `json:"binary,omitempty"`
+	LineStatsOmitted bool          `json:"line_stats_omitted,omitempty"`
+	LFS              *GitLFSChange `json:"lfs,omitempty"`
+}
+
+type GitCompareTotals struct {
+	FilesChanged    int   `json:"files_changed"`
+	Additions       int   `json:"additions"`
+	Deletions       int   `json:"deletions"`
+	LFSBytesAdded   int64 `json:"lfs_bytes_added"`
+	LFSBytesRemoved int64 `json:"lfs_bytes_removed"`
+}
+
+type GitProjectCompareResponse struct {
+	ProjectID string                 `json:"project_id"`
+	BaseRef   string                 `json:"base_ref"`
+	BaseSHA   string                 `json:"base_sha"`
+	HeadRef   string                 `json:"head_ref"`
+	HeadSHA   string                 `json:"head_sha"`
+	Files     []GitCompareFileChange `json:"files"`
+	Totals    GitCompareTotals       `json:"totals"`
+}
+
+type GitLFSInventoryEntry struct {
+	Path          string `json:"path"`
+	OID           string `json:"oid"`
+	Size          int64  `json:"size"`
+	StorageStatus string `json:"storage_status,omitempty"`
+}
+
+type GitLFSDuplicate struct {
+	OID   string   `json:"oid"`
+	Size  int64    `json:"size"`
+	Paths []string `json:"paths"`
+}
+
+type GitLFSDirectoryRollup struct {
+	Path     string `json:"path"`
+	Pointers int    `json:"pointers"`
+	Bytes    int64  `json:"bytes"`
+}
+
+type GitLFSInventoryTotals struct {
+	Pointers       int   `json:"pointers"`
+	Bytes          int64 `json:"bytes"`
+	UniqueObjects  int   `json:"unique_objects"`
+	UniqueBytes    int64 `json:"unique_bytes"`
+	MissingObjects int   `json:"missing_objects,omitempty"`
+}
+
+type GitLFSInventoryResponse struct {
+	ProjectID   string                  `json:"project_id"`
+	Ref         string                  `json:"ref"`
+	CommitSHA   string                  `json:"commit_sha"`
+	Objects     []GitLFSInventoryEntry  `json:"objects"`
+	Totals      GitLFSInventoryTotals   `json:"totals"`
+	Duplicates  []GitLFSDuplicate       `json:"duplicates"`
+	Directories []GitLFSDirectoryRollup `json:"directories"`
+	Verified    bool                    `json:"verified"`
 }
 
 type GitLFSPointerInfo struct {
@@ -253,15 +364,71 @@ type GitLFSPointerInfo struct {
 	Size    int64  `json:"size"`
 }
 
+// GitUploadSessionFileManifest is a file to add. Storage is lfs (the
+// default) or inline, in which case its bytes are uploaded to gecko and
+// committed as a regular blob.
 type GitUploadSessionFileManifest struct {
-	Name string `json:"name"`
-	Size int64  `json:"size"`
-}
-
+	Name    string `json:"name"`
+	Size    int64  `json:"size"`
+	Storage string `json:"storage,omitempty"`
+	// ConflictPolicy overrides the conflict policy of the session for this
+	// file.
+	ConflictPolicy string `json:"conflict_policy,omitempty"`
+}
+
+// GitUploadSessionOperation changes a path that exists on the base branch:
+// replace uploads a new version of Path, delete removes it and move renames
+// FromPath to Path.
+type GitUploadSessionOperation struct {
+	Operation string `json:"operation"`
+	Path      string `json:"path"`
+	FromPath  string `json:"from_path,omitempty"`
+	Size      int64  `json:"size,omitempty"`
+	Storage   string `json:"storage,omitempty"`
+}
+
+// GitUploadSessionCreateRequest opens a session. CommitMode direct commits
+// to Branch, or to BaseBranch when Branch is empty, instead of opening a
+// pull request.
 type GitUploadSessionCreateRequest struct {
 	BaseBranch   string                         `json:"base_branch"`
 	TargetSubdir string                         `json:"target_subdirectory"`
 	Files        []GitUploadSessionFileManifest `json:"files"`
+	Operations   []GitUploadSessionOperation    `json:"operations,omitempty"`
+	CommitMode   string                         `json:"commit_mode,omitempty"`
+	Branch       string                         `json:"branch,omitempty"`
+	// Partial sessions take more files and operations from manifest pages
+	// and cannot be finalized until the last page is appended.
+	Partial bool `json:"partial,omitempty"`
+	// ConflictPolicy decides what happens to added files whose target path
+	// exists on the base branch: fail (the default), skip, overwrite, rename
+	// or rename_subdirectory.
+	ConflictPolicy string `json:"conflict_policy,omitempty"`
+}
+
+// GitUploadSessionManifestRequest is a manifest page appended to a partial
+// session. Complete marks the last page.
+type GitUploadSessionManifestRequest struct {
+	Files      []GitUploadSessionFileManifest `json:"files"`
+	Operations []GitUploadSessionOperation    `json:"operations,omitempty"`
+	Complete   bool                           `json:"complete"`
+}
+
+// GitUploadSessionConflictChange changes how one conflicted file of a
+// session is resolved. NewTargetPath is a path from the repository root
+// the file asks for instead of its current one.
+type GitUploadSessionConflictChange struct {
+	TargetPath     string `json:"target_path"`
+	ConflictPolicy string `json:"conflict_policy,omitempty"`
+	NewTargetPath  string `json:"new_target_path,omitempty"`
+}
+
+// GitUploadSessionConflictsRequest changes the conflict policy of a session
+// or of some of its files, after which every conflicted file is evaluated
+// again against the mirror.
+type GitUploadSessionConflictsRequest struct {
+	ConflictPolicy string                           `json:"conflict_policy,omitempty"`
+	Files          []GitUploadSessionConflictChange `json:"files,omitempty"`
 }
 
 type GitUploadSessionFileAttachment struct {
@@ -270,6 +437,10 @@ type GitUploadSessionFileAttachment struct {
 	Checksum    string `json:"checksum"`
 	DRSObjectID string `json:"drs_object_id"`
 	Size        int64  `json:"size"`
+	// Created reports that the client registered the DRS object for this
+	// session. Only such objects are deleted when the session is released;
+	// an existing object attached without it is left alone.
+	Created bool `json:"created"`
 }
 
 type GitUploadSessionAttachFilesRequest struct {
@@ -284,12 +455,20 @@ type GitUploadSessionFinalizeRequest struct {
 type GitUploadSessionFileStatus struct {
 	FileName    string `json:"file_name"`
 	TargetPath  string `json:"target_path"`
+	Operation   string `json:"operation"`
+	SourcePath  string `json:"source_path,omitempty"`
+	Storage     string `json:"storage"`
 	Size        int64  `json:"size"`
 	Checksum    string `json:"checksum,omitempty"`
 	DRSObjectID string `json:"drs_object_id,omitempty"`
 	Status      string `json:"status"`
 	Error       string `json:"error,omitempty"`
 	Collision   bool   `json:"collision"`
+	// ConflictPolicy is the policy the file set for itself. RequestedPath is
+	// the target path it asked for when a conflict policy resolved its
+	// collision.
+	ConflictPolicy string `json:"conflict_policy,omitempty"`
+	RequestedPath  string `json:"requested_path,omitempty"`
 }
 
 type GitUploadSessionResponse struct {
@@ -298,13 +477,95 @@ type GitUploadSessionResponse struct {
 	BaseBranch     string                       `json:"base_branch"`
 	TargetSubdir   string                       `json:"target_subdirectory,omitempty"`
 	BranchName     string                       `json:"branch_name"`
+	CommitMode     string                       `json:"commit_mode"`
+	BaseSHA        string                       `json:"base_sha,omitempty"`
 	PRTitle        string                       `json:"pr_title"`
 	PRBody         string                       `json:"pr_body"`
 	Status         string                       `json:"status"`
 	PullRequestURL string                       `json:"pull_request_url,omitempty"`
+	PRNumber       int64                        `json:"pull_request_number,omitempty"`
+	PRState        string                       `json:"pull_request_state,omitempty"`
 	CommitSHA      string                       `json:"commit_sha,omitempty"`
+	FinalizeStep   string                       `json:"finalize_step,omitempty"`
+	ConflictPolicy string                       `json:"conflict_policy"`
+	LastError      string                       `json:"last_error,omitempty"`
+	CreatedBy      string                       `json:"created_by,omitempty"`
+	CreatedAt      time.Time                    `json:"created_at"`
+	UpdatedAt      time.Time                    `json:"updated_at"`
+	ExpiresAt      *time.Time                   `json:"expires_at,omitempty"`
+	PullRequest    *GitUploadPullRequestStatus  `json:"pull_request,omitempty"`
+	Attributes     []string                     `json:"gitattributes_added,omitempty"`
 	Files          []GitUploadSessionFileStatus `json:"files"`
 	HasConflicts   bool                         `json:"has_conflicts"`
+	Progress       GitUploadSessionProgress     `json:"progress"`
+}
+
+// GitUploadSessionProgress counts the files of a session and how many of
+// those that carry content have been attached.
+type GitUploadSessionProgress struct {
+	ManifestComplete bool  `json:"manifest_complete"`
+	Files            int   `json:"files"`
+	FilesCollided    int   `json:"files_collided"`
+	FilesToUpload    int   `json:"files_to_upload"`
+	FilesAttached    int   `json:"files_attached"`
+	BytesToUpload    int64 `json:"bytes_to_upload"`
+	BytesAttached    int64 `json:"bytes_attached"`
+}
+
+// GitUploadPullRequestStatus is the last known state of an upload session's
+// pull request, from webhooks or polling GitHub.
+type GitUploadPullRequestStatus struct {
+	Number         int64      `json:"number,omitempty"`
+	URL            string     `json:"url"`
+	State          string     `json:"state,omitempty"`
+	HeadSHA        string     `json:"head_sha,omitempty"`
+	Mergeable      string     `json:"mergeable,omitempty"`
+	ReviewDecision string     `json:"review_decision,omitempty"`
+	Checks         string     `json:"checks,omitempty"`
+	Comments       *int64     `json:"comments,omitempty"`
+	MergedAt       *time.Time `json:"merged_at,omitempty"`
+	MergeCommitSHA string     `json:"merge_commit_sha,omitempty"`
+	CheckedAt      *time.Time `json:"checked_at,omitempty"`
+}
+
+type GitUploadSessionListResponse struct {
+	Sessions []GitUploadSessionResponse `json:"sessions"`
+}
+
+// GitUploadReleasedObject is a DRS object a release either deleted or kept
+// because another upload session still references it.
+type GitUploadReleasedObject struct {
+	TargetPath  string `json:"target_path"`
+	DRSObjectID string `json:"drs_object_id"`
+	Released    bool   `json:"released"`
+	Reason      string `json:"reason,omitempty"`
+}
+
+type GitUploadSessionReleaseResponse struct {
+	SessionID string                    `json:"session_id"`
+	Objects   []GitUploadReleasedObject `json:"objects"`
+}
+
+type GitRefreshJobProgress struct {
+	Stage        string `json:"stage,omitempty"`
+	ObjectsDone  int64  `json:"objects_done"`
+	ObjectsTotal int64  `json:"objects_total"`
+	Percent      int    `json:"percent"`
+	Message      string `json:"message,omitempty"`
+}
+
+type GitRefreshJobResponse struct {
+	JobID       string                `json:"job_id"`
+	ProjectID   string                `json:"project_id"`
+	Status      string                `json:"status"`
+	Phase       string                `json:"phase"`
+	Progress    GitRefreshJobProgress `json:"progress"`
+	Error       string                `json:"error,omitempty"`
+	RequestedBy string                `json:"requested_by,omitempty"`
+	CreatedAt   time.Time             `json:"created_at"`
+	StartedAt   *time.Time            `json:"started_at,omitempty"`
+	FinishedAt  *time.Time            `json:"finished_at,omitempty"`
+	UpdatedAt   time.Time             `json:"updated_at"`
 }
 
 // GitHubRepositoryMetadata is an alias for domain.GitHubRepositoryMetadata.
@@ -328,6 +589,24 @@ func NewGitService(config GitServiceConfig) *GitService {
 		client:    client,
 		fenceAPI:  config.FenceClient,
 		githubAPI: config.GitHubClient,
+		syncs:     newSyncTracker(),
+		inventory: newLFSInventoryCache(lfsInventoryCacheSize),
+		access:    newMirrorAccessTracker(),
+		holds:     newMirrorHolds(),
+		indexing:  newLastModifiedBuilds(),
+	}
+}
+
+// WithLogger sets where the service reports failures of background work such
+// as building last-modified indexes.
+func (service *GitService) WithLogger(logger arborist.Logger) *GitService {
+	service.logger = logger
+	return service
+}
+
+func (service *GitService) logWarning(format string, args ...any) {
+	if service.logger != nil {
+		service.logger.Warning(format, args...)
 	}
 }
 
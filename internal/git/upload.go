@@ -2,14 +2,17 @@ package git
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
 	"net/http"
+	"path"
 	"strings"
 	"time"
 
 	geckodb "github.com/calypr/gecko/internal/db"
 	gogit "github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/google/go-github/v87/github"
 	"github.com/google/uuid"
 )
@@ -18,10 +21,28 @@ const (
 	GitUploadSessionPending   = "pending_upload"
 	GitUploadSessionReady     = "ready_for_pr"
 	GitUploadSessionFinalized = "finalized"
+	GitUploadSessionCancelled = "cancelled"
+	GitUploadSessionExpired   = "expired"
 
 	GitUploadFilePending   = "pending_upload"
 	GitUploadFileUploaded  = "uploaded"
+	GitUploadFileReady     = "ready"
 	GitUploadFileCollision = "collision"
+	// GitUploadFileReleased marks a file whose DRS object was deleted after
+	// its session was cancelled or expired.
+	GitUploadFileReleased = "released"
+	// GitUploadFileInvalid marks a file whose DRS object failed verification
+	// at finalize. Attaching the file again clears it.
+	GitUploadFileInvalid = "invalid"
+	// GitUploadFileSkipped marks an added file the skip conflict policy
+	// leaves out of the commit because its target path exists on the base
+	// branch.
+	GitUploadFileSkipped = "skipped"
+
+	GitUploadOperationAdd     = "add"
+	GitUploadOperationReplace = "replace"
+	GitUploadOperationDelete  = "delete"
+	GitUploadOperationMove    = "move"
 )
 
 func NormalizeGitUploadSubdirectory(value string) string {
@@ -59,6 +80,15 @@ func BuildDefaultUploadPRTitle(project string, fileCount int) string {
 	return fmt.Sprintf("Add %d LFS files to %s", fileCount, project)
 }
 
+// BuildDefaultChangePRTitle titles a session that replaces, moves or deletes
+// files rather than only adding them.
+func BuildDefaultChangePRTitle(project string, changeCount int) string {
+	if changeCount == 1 {
+		return fmt.Sprintf("Change 1 file in %s", project)
+	}
+	return fmt.Sprintf("Change %d files in %s", changeCount, project)
+}
+
 func BuildDefaultUploadPRBody(baseBranch string, subdirectory string) string {
 	if subdirectory == "" {
 		return fmt.Sprintf("Upload Git LFS-backed files into `%s`.", baseBranch)
@@ -79,22 +109,47 @@ func BuildGitUploadSessionResponse(session geckodb.GitUploadSession, files []gec
 		ProjectID:      session.ProjectID,
 		BaseBranch:     session.BaseBranch,
 		BranchName:     session.BranchName,
+		CommitMode:     GitUploadSessionCommitMode(session),
+		BaseSHA:        session.BaseSHA.String,
 		PRTitle:        session.PRTitle,
 		PRBody:         session.PRBody,
 		Status:         session.Status,
 		Files:          make([]GitUploadSessionFileStatus, 0, len(files)),
 		TargetSubdir:   session.TargetSubdir.String,
 		PullRequestURL: session.PullRequestURL.String,
+		PRNumber:       session.PRNumber.Int64,
+		PRState:        session.PRState.String,
 		CommitSHA:      session.CommitSHA.String,
+		FinalizeStep:   session.FinalizeStep.String,
+		ConflictPolicy: GitUploadSessionConflictPolicy(session),
+		LastError:      session.LastError.String,
+		CreatedBy:      session.CreatedByUserID.String,
+		CreatedAt:      session.CreatedAt,
+		UpdatedAt:      session.UpdatedAt,
+	}
+	if len(session.AttributesAdded) > 0 {
+		response.Attributes = append([]string(nil), session.AttributesAdded...)
+	}
+	if session.ExpiresAt.Valid {
+		expiresAt := session.ExpiresAt.Time
+		response.ExpiresAt = &expiresAt
+	}
+	if session.PullRequestURL.Valid {
+		response.PullRequest = buildGitUploadPullRequestStatus(session)
 	}
 	for _, file := range files {
 		status := GitUploadSessionFileStatus{
 			FileName:   file.FileName,
 			TargetPath: file.TargetPath,
+			Operation:  GitUploadFileOperation(file),
+			SourcePath: file.SourcePath.String,
+			Storage:    GitUploadFileStorage(file),
 			Size:       file.Size,
 			Status:     file.Status,
 			Collision:  file.Status == GitUploadFileCollision,
 		}
+		status.ConflictPolicy = file.ConflictPolicy.String
+		status.RequestedPath = file.RequestedPath.String
 		if file.Checksum.Valid {
 			status.Checksum = file.Checksum.String
 		}
@@ -109,9 +164,147 @@ func BuildGitUploadSessionResponse(session geckodb.GitUploadSession, files []gec
 		}
 		response.Files = append(response.Files, status)
 	}
+	response.Progress = BuildGitUploadSessionProgress(session, files)
 	return response
 }
 
+// GitUploadSessionOpen reports whether a session in status still accepts
+// uploads and can be finalized or cancelled.
+func GitUploadSessionOpen(status string) bool {
+	return status == GitUploadSessionPending || status == GitUploadSessionReady
+}
+
+// GitUploadSessionExpiry is when a session touched at now expires, or null
+// when ttl is zero and sessions never expire.
+func GitUploadSessionExpiry(now time.Time, ttl time.Duration) sql.NullTime {
+	if ttl <= 0 {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: now.Add(ttl), Valid: true}
+}
+
+// GitUploadFileOperation is the operation of file; rows written before
+// sessions supported operations are adds.
+func GitUploadFileOperation(file geckodb.GitUploadSessionFile) string {
+	if file.Operation == "" {
+		return GitUploadOperationAdd
+	}
+	return file.Operation
+}
+
+// GitUploadFileNeedsContent reports whether file carries new content that
+// has to be uploaded and attached before the session can be finalized.
+func GitUploadFileNeedsContent(file geckodb.GitUploadSessionFile) bool {
+	if file.Status == GitUploadFileSkipped {
+		return false
+	}
+	operation := GitUploadFileOperation(file)
+	return operation == GitUploadOperationAdd || operation == GitUploadOperationReplace
+}
+
+// GitUploadSessionStatusForFiles is ready_for_pr once no file collides or
+// failed verification and every file that carries content has been attached.
+func GitUploadSessionStatusForFiles(files []geckodb.GitUploadSessionFile) string {
+	for _, file := range files {
+		if file.Status == GitUploadFileCollision || file.Status == GitUploadFileInvalid {
+			return GitUploadSessionPending
+		}
+		if !GitUploadFileAttached(file) {
+			return GitUploadSessionPending
+		}
+	}
+	return GitUploadSessionReady
+}
+
+// PlanGitUploadOperations validates operations against the tree of hash and
+// turns them into session files. policy decides the storage of replacements.
+// claimed holds the paths earlier entries of the session already use and is
+// updated; an operation that reuses one, or that does not fit the base tree,
+// is recorded as a collision.
+func PlanGitUploadOperations(repo *gogit.Repository, hash plumbing.Hash, sessionID string, operations []GitUploadSessionOperation, policy GitUploadPolicy, claimed map[string]struct{}) ([]geckodb.GitUploadSessionFile, bool, error) {
+	tree, err := commitTree(repo, hash.String(), hash)
+	if err != nil {
+		return nil, false, err
+	}
+	files := make([]geckodb.GitUploadSessionFile, 0, len(operations))
+	hasConflicts := false
+	for index, operation := range operations {
+		kind := strings.ToLower(strings.TrimSpace(operation.Operation))
+		targetPath := strings.Trim(strings.TrimSpace(operation.Path), "/")
+		sourcePath := strings.Trim(strings.TrimSpace(operation.FromPath), "/")
+		details := map[string]any{"operation_index": index, "operation": operation.Operation, "path": operation.Path}
+		if targetPath == "" {
+			return nil, false, NewError(ErrorKindValidation, http.StatusBadRequest, "operation path is required", details)
+		}
+		file := geckodb.GitUploadSessionFile{
+			SessionID:  sessionID,
+			FileName:   path.Base(targetPath),
+			TargetPath: targetPath,
+			Operation:  kind,
+			Status:     GitUploadFileReady,
+			Storage:    GitUploadStorageLFS,
+		}
+		var conflict string
+		switch kind {
+		case GitUploadOperationReplace:
+			storage, err := policy.Storage(targetPath, operation.Size, operation.Storage)
+			if err != nil {
+				return nil, false, err
+			}
+			file.Size = operation.Size
+			file.Status = GitUploadFilePending
+			file.Storage = storage
+			if _, err := tree.File(targetPath); err != nil {
+				conflict = "target path does not exist as a file on base branch"
+			}
+		case GitUploadOperationDelete:
+			if _, err := tree.File(targetPath); err != nil {
+				conflict = "target path does not exist as a file on base branch"
+			}
+		case GitUploadOperationMove:
+			if sourcePath == "" {
+				return nil, false, NewError(ErrorKindValidation, http.StatusBadRequest, "move operations require from_path", details)
+			}
+			file.SourcePath = sql.NullString{String: sourcePath, Valid: true}
+			source, err := tree.FindEntry(sourcePath)
+			switch {
+			case err != nil || !source.Mode.IsFile():
+				conflict = "source path does not exist as a file on base branch"
+			case gitTreePathExists(tree, targetPath):
+				conflict = "target path already exists on base branch"
+			default:
+				file.SourceSHA = sql.NullString{String: source.Hash.String(), Valid: true}
+				file.SourceMode = sql.NullString{String: fmt.Sprintf("%06o", uint32(source.Mode)), Valid: true}
+				if blob, err := repo.BlobObject(source.Hash); err == nil {
+					file.Size = blob.Size
+				}
+			}
+			if _, ok := claimed[sourcePath]; ok && conflict == "" {
+				conflict = "source path is already changed in this upload session"
+			}
+			claimed[sourcePath] = struct{}{}
+		default:
+			return nil, false, NewError(ErrorKindValidation, http.StatusBadRequest, fmt.Sprintf("unknown upload operation %q", operation.Operation), details)
+		}
+		if _, ok := claimed[targetPath]; ok && conflict == "" {
+			conflict = "duplicate target path in upload batch"
+		}
+		claimed[targetPath] = struct{}{}
+		if conflict != "" {
+			file.Status = GitUploadFileCollision
+			file.Error = sql.NullString{String: conflict, Valid: true}
+			hasConflicts = true
+		}
+		files = append(files, file)
+	}
+	return files, hasConflicts, nil
+}
+
+func gitTreePathExists(tree *object.Tree, treePath string) bool {
+	_, err := tree.FindEntry(treePath)
+	return err == nil
+}
+
 func GitPathExistsInRef(repo *gogit.Repository, hash plumbing.Hash, path string) (bool, error) {
 	commit, err := repo.CommitObject(hash)
 	if err != nil {
@@ -146,6 +339,74 @@ func githubWriteStatusError(message string, response *github.Response, err error
 	}
 }
 
+// buildGitUploadTreeEntries turns session files into the tree entries of the
+// upload commit. LFS files become pointers and inline files regular blobs
+// holding their Content. Deleted and moved-away paths get entries without a
+// SHA, which removes them from the base tree.
+func buildGitUploadTreeEntries(files []geckodb.GitUploadSessionFile) ([]*github.TreeEntry, error) {
+	entries := make([]*github.TreeEntry, 0, len(files))
+	for _, file := range files {
+		switch GitUploadFileOperation(file) {
+		case GitUploadOperationDelete:
+			entries = append(entries, &github.TreeEntry{Path: github.Ptr(file.TargetPath), Mode: github.Ptr("100644"), Type: github.Ptr("blob")})
+		case GitUploadOperationMove:
+			if !file.SourceSHA.Valid || !file.SourcePath.Valid {
+				return nil, fmt.Errorf("missing source for move to %s", file.TargetPath)
+			}
+			mode := file.SourceMode.String
+			if mode == "" {
+				mode = "100644"
+			}
+			entries = append(entries,
+				&github.TreeEntry{Path: github.Ptr(file.TargetPath), Mode: github.Ptr(mode), Type: github.Ptr("blob"), SHA: github.Ptr(file.SourceSHA.String)},
+				&github.TreeEntry{Path: github.Ptr(file.SourcePath.String), Mode: github.Ptr(mode), Type: github.Ptr("blob")},
+			)
+		default:
+			if !file.Checksum.Valid {
+				return nil, fmt.Errorf("missing checksum for %s", file.TargetPath)
+			}
+			if GitUploadFileInline(file) {
+				if file.Content == nil {
+					return nil, fmt.Errorf("missing inline content for %s", file.TargetPath)
+				}
+				entries = append(entries, &github.TreeEntry{
+					Path:    github.Ptr(file.TargetPath),
+					Mode:    github.Ptr("100644"),
+					Type:    github.Ptr("blob"),
+					Content: github.Ptr(string(file.Content)),
+				})
+				continue
+			}
+			entries = append(entries, &github.TreeEntry{
+				Path:    github.Ptr(file.TargetPath),
+				Mode:    github.Ptr("100644"),
+				Type:    github.Ptr("blob"),
+				Content: github.Ptr(BuildLFSPointerContent(file.Checksum.String, file.Size)),
+			})
+		}
+	}
+	return entries, nil
+}
+
+// GitUploadPullRequest is the commit and pull request finalize created.
+type GitUploadPullRequest struct {
+	CommitSHA string
+	URL       string
+	// GitAttributesAdded lists the patterns appended to .gitattributes so
+	// every uploaded path is stored through Git LFS.
+	GitAttributesAdded []string
+}
+
+// CreateGitHubUploadPullRequest commits files on top of baseBranch in a new
+// branch and opens a pull request for it. When attributes is set, the root
+// .gitattributes is extended in the same commit to track every uploaded
+// path with filter=lfs. attributes is read from the mirror; if the mirror is
+// behind GitHub the file is read from GitHub instead.
+//
+// Finalize is resumable: progress holds the steps an earlier attempt
+// completed, which are skipped, and recorder persists each step as it
+// completes. A branch or pull request an interrupted attempt already created
+// is adopted rather than reported as a collision.
 func (service *GitService) CreateGitHubUploadPullRequest(
 	ctx context.Context,
 	authorizationHeader string,
@@ -157,63 +418,279 @@ func (service *GitService) CreateGitHubUploadPullRequest(
 	title string,
 	body string,
 	files []geckodb.GitUploadSessionFile,
-) (string, string, error) {
+	attributes *GitAttributesSource,
+	progress GitUploadFinalizeProgress,
+	recorder GitUploadFinalizeRecorder,
+) (*GitUploadPullRequest, error) {
+	if progress.Done(GitUploadFinalizePullRequest) {
+		return progress.PullRequest(), nil
+	}
 	accessToken, err := service.RequestInstallationToken(ctx, authorizationHeader, organization, project, identity, "write")
 	if err != nil {
-		return "", "", err
+		return nil, err
 	}
 	client, err := service.githubClient(accessToken)
 	if err != nil {
-		return "", "", err
+		return nil, err
 	}
-	baseRef, response, err := client.Git.GetRef(ctx, identity.Owner, identity.Repo, "refs/heads/"+baseBranch)
-	if err != nil {
-		return "", "", githubWriteStatusError("failed to load GitHub base branch ref", response, err)
+	if progress.ParentSHA == "" {
+		baseRef, response, err := client.Git.GetRef(ctx, identity.Owner, identity.Repo, "refs/heads/"+baseBranch)
+		if err != nil {
+			return nil, githubWriteStatusError("failed to load GitHub base branch ref", response, err)
+		}
+		progress.ParentSHA = baseRef.GetObject().GetSHA()
 	}
-	baseCommitSHA := baseRef.GetObject().GetSHA()
-	baseCommit, response, err := client.Git.GetCommit(ctx, identity.Owner, identity.Repo, baseCommitSHA)
-	if err != nil {
-		return "", "", githubWriteStatusError("failed to load GitHub base commit", response, err)
+	if err := commitGitHubUpload(ctx, client, identity, &progress, recorder, title, files, attributes); err != nil {
+		return nil, err
 	}
-	entries := make([]*github.TreeEntry, 0, len(files))
-	for _, file := range files {
-		if !file.Checksum.Valid {
-			return "", "", fmt.Errorf("missing checksum for %s", file.TargetPath)
-		}
-		entries = append(entries, &github.TreeEntry{
-			Path:    github.Ptr(file.TargetPath),
-			Mode:    github.Ptr("100644"),
-			Type:    github.Ptr("blob"),
-			Content: github.Ptr(BuildLFSPointerContent(file.Checksum.String, file.Size)),
-		})
+	if !progress.Done(GitUploadFinalizeBranch) {
+		if err := createGitHubUploadBranch(ctx, client, identity, branchName, progress.CommitSHA); err != nil {
+			return nil, err
+		}
+		progress.Step = GitUploadFinalizeBranch
+		if err := recordGitUploadFinalize(recorder, progress); err != nil {
+			return nil, err
+		}
 	}
-	tree, response, err := client.Git.CreateTree(ctx, identity.Owner, identity.Repo, baseCommit.GetTree().GetSHA(), entries)
+	pr, response, err := client.PullRequests.Create(ctx, identity.Owner, identity.Repo, &github.NewPullRequest{
+		Title: github.Ptr(title),
+		Body:  github.Ptr(body),
+		Base:  github.Ptr(baseBranch),
+		Head:  github.Ptr(branchName),
+	})
 	if err != nil {
-		return "", "", githubWriteStatusError("failed to create GitHub tree", response, err)
+		if response == nil || response.StatusCode != http.StatusUnprocessableEntity {
+			return nil, githubWriteStatusError("failed to create GitHub pull request", response, err)
+		}
+		// An earlier attempt may have opened the pull request before failing.
+		existing, listResponse, listErr := client.PullRequests.List(ctx, identity.Owner, identity.Repo, &github.PullRequestListOptions{
+			Head:  identity.Owner + ":" + branchName,
+			Base:  baseBranch,
+			State: "all",
+		})
+		if listErr != nil {
+			return nil, githubWriteStatusError("failed to list GitHub pull requests", listResponse, listErr)
+		}
+		if len(existing) == 0 {
+			return nil, githubWriteStatusError("failed to create GitHub pull request", response, err)
+		}
+		pr = existing[0]
 	}
-	commit, response, err := client.Git.CreateCommit(ctx, identity.Owner, identity.Repo, github.Commit{
-		Message: github.Ptr(title),
-		Tree:    &github.Tree{SHA: github.Ptr(tree.GetSHA())},
-		Parents: []*github.Commit{{SHA: github.Ptr(baseCommitSHA)}},
-	}, nil)
-	if err != nil {
-		return "", "", githubWriteStatusError("failed to create GitHub commit", response, err)
+	progress.Step = GitUploadFinalizePullRequest
+	progress.PullRequestURL = pr.GetHTMLURL()
+	if err := recordGitUploadFinalize(recorder, progress); err != nil {
+		return nil, err
+	}
+	return progress.PullRequest(), nil
+}
+
+// commitGitHubUpload runs the tree and commit steps of finalize on top of
+// progress.ParentSHA without moving any ref, skipping the steps progress
+// already records. When attributes is set, .gitattributes is extended in
+// the same commit and the patterns added are recorded with the tree.
+func commitGitHubUpload(ctx context.Context, client *github.Client, identity GitRepositoryIdentity, progress *GitUploadFinalizeProgress, recorder GitUploadFinalizeRecorder, title string, files []geckodb.GitUploadSessionFile, attributes *GitAttributesSource) error {
+	if !progress.Done(GitUploadFinalizeTree) {
+		files = gitUploadCommittedFiles(files)
+		if len(files) == 0 {
+			return NewError(ErrorKindConflict, http.StatusConflict, "upload session has no files to commit", nil)
+		}
+		baseCommit, response, err := client.Git.GetCommit(ctx, identity.Owner, identity.Repo, progress.ParentSHA)
+		if err != nil {
+			return githubWriteStatusError("failed to load GitHub base commit", response, err)
+		}
+		entries, err := buildGitUploadTreeEntries(files)
+		if err != nil {
+			return err
+		}
+		var added []string
+		if attributes != nil && gitUploadManagesAttributes(files) {
+			if attributes.CommitSHA != progress.ParentSHA {
+				policy := attributes.Policy
+				attributes, err = readGitHubAttributes(ctx, client, identity, progress.ParentSHA)
+				if err != nil {
+					return err
+				}
+				attributes.Policy = policy
+			}
+			var content string
+			content, added = PlanGitAttributesLFS(attributes, gitUploadContentPaths(files), gitUploadInlinePaths(files))
+			// The check runs on the planned file, since that is what the
+			// commit checks the inline files out with.
+			if inline := gitUploadInlineTrackedByLFS(content, files); len(inline) > 0 {
+				return NewError(ErrorKindConflict, http.StatusConflict, "inline upload files are tracked by Git LFS in .gitattributes", map[string]any{"paths": inline})
+			}
+			if len(added) > 0 {
+				entries = append(entries, &github.TreeEntry{Path: github.Ptr(GitAttributesPath), Mode: github.Ptr("100644"), Type: github.Ptr("blob"), Content: github.Ptr(content)})
+			}
+		}
+		treeSHA, err := createGitHubUploadTree(ctx, client, identity, baseCommit.GetTree().GetSHA(), entries, gitUploadTreeChunkSize)
+		if err != nil {
+			return err
+		}
+		progress.Step = GitUploadFinalizeTree
+		progress.TreeSHA = treeSHA
+		progress.AttributesAdded = added
+		if err := recordGitUploadFinalize(recorder, *progress); err != nil {
+			return err
+		}
+	}
+	if !progress.Done(GitUploadFinalizeCommit) {
+		commit, response, err := client.Git.CreateCommit(ctx, identity.Owner, identity.Repo, github.Commit{
+			Message: github.Ptr(title),
+			Tree:    &github.Tree{SHA: github.Ptr(progress.TreeSHA)},
+			Parents: []*github.Commit{{SHA: github.Ptr(progress.ParentSHA)}},
+		}, nil)
+		if err != nil {
+			return githubWriteStatusError("failed to create GitHub commit", response, err)
+		}
+		progress.Step = GitUploadFinalizeCommit
+		progress.CommitSHA = commit.GetSHA()
+		if err := recordGitUploadFinalize(recorder, *progress); err != nil {
+			return err
+		}
 	}
-	_, response, err = client.Git.CreateRef(ctx, identity.Owner, identity.Repo, github.CreateRef{
+	return nil
+}
+
+// createGitHubUploadBranch creates branchName at commitSHA. A branch that
+// already points at commitSHA was created by an earlier attempt and is kept;
+// one pointing anywhere else is a conflict.
+func createGitHubUploadBranch(ctx context.Context, client *github.Client, identity GitRepositoryIdentity, branchName string, commitSHA string) error {
+	_, response, err := client.Git.CreateRef(ctx, identity.Owner, identity.Repo, github.CreateRef{
 		Ref: "refs/heads/" + branchName,
-		SHA: commit.GetSHA(),
+		SHA: commitSHA,
 	})
+	if err == nil {
+		return nil
+	}
+	if response == nil || response.StatusCode != http.StatusUnprocessableEntity {
+		return githubWriteStatusError("failed to create GitHub branch", response, err)
+	}
+	ref, _, refErr := client.Git.GetRef(ctx, identity.Owner, identity.Repo, "refs/heads/"+branchName)
+	if refErr != nil {
+		return githubWriteStatusError("failed to create GitHub branch", response, err)
+	}
+	if head := ref.GetObject().GetSHA(); head != commitSHA {
+		return NewError(ErrorKindConflict, http.StatusConflict, fmt.Sprintf("branch %s already exists at %s", branchName, head), map[string]any{"branch": branchName, "head_sha": head, "commit_sha": commitSHA})
+	}
+	return nil
+}
+
+// gitUploadManagesAttributes reports whether gecko may rewrite
+// .gitattributes for files, which it leaves alone when the session itself
+// changes that file.
+func gitUploadManagesAttributes(files []geckodb.GitUploadSessionFile) bool {
+	for _, file := range files {
+		if file.TargetPath == GitAttributesPath || file.SourcePath.String == GitAttributesPath {
+			return false
+		}
+	}
+	return true
+}
+
+// gitUploadContentPaths lists the paths finalize writes LFS pointers to.
+func gitUploadContentPaths(files []geckodb.GitUploadSessionFile) []string {
+	paths := make([]string, 0, len(files))
+	for _, file := range files {
+		if GitUploadFileNeedsContent(file) && !GitUploadFileInline(file) {
+			paths = append(paths, file.TargetPath)
+		}
+	}
+	return paths
+}
+
+// gitUploadInlinePaths lists the paths finalize writes inline content to.
+func gitUploadInlinePaths(files []geckodb.GitUploadSessionFile) []string {
+	paths := []string{}
+	for _, file := range files {
+		if GitUploadFileInline(file) {
+			paths = append(paths, file.TargetPath)
+		}
+	}
+	return paths
+}
+
+// gitUploadInlineTrackedByLFS lists the inline files content routes through
+// the LFS filter, which would check a regular blob out as a broken pointer.
+func gitUploadInlineTrackedByLFS(content string, files []geckodb.GitUploadSessionFile) []string {
+	rules := parseGitAttributes(content)
+	paths := []string{}
+	for _, file := range files {
+		if GitUploadFileInline(file) && gitAttributesTracksLFS(rules, file.TargetPath) {
+			paths = append(paths, file.TargetPath)
+		}
+	}
+	return paths
+}
+
+func readGitHubAttributes(ctx context.Context, client *github.Client, identity GitRepositoryIdentity, commitSHA string) (*GitAttributesSource, error) {
+	source := &GitAttributesSource{CommitSHA: commitSHA}
+	file, _, response, err := client.Repositories.GetContents(ctx, identity.Owner, identity.Repo, GitAttributesPath, &github.RepositoryContentGetOptions{Ref: commitSHA})
+	if response != nil && response.StatusCode == http.StatusNotFound {
+		return source, nil
+	}
 	if err != nil {
-		return "", "", githubWriteStatusError("failed to create GitHub branch", response, err)
+		return nil, githubWriteStatusError("failed to load GitHub .gitattributes", response, err)
 	}
-	pr, response, err := client.PullRequests.Create(ctx, identity.Owner, identity.Repo, &github.NewPullRequest{
-		Title: github.Ptr(title),
-		Body:  github.Ptr(body),
-		Base:  github.Ptr(baseBranch),
-		Head:  github.Ptr(branchName),
-	})
+	if file == nil {
+		return source, nil
+	}
+	content, err := file.GetContent()
 	if err != nil {
-		return "", "", githubWriteStatusError("failed to create GitHub pull request", response, err)
+		return nil, fmt.Errorf("decode GitHub .gitattributes: %w", err)
+	}
+	source.Content = content
+	return source, nil
+}
+
+// ReleaseUploadSessionObjects deletes the DRS objects the files of a
+// cancelled or expired session created, which were never committed. Objects
+// the session imported or attached from before it are kept, as is an object
+// another live or finalized session also attached. Released files lose their
+// DRS object ID and move to the released status.
+func (service *LFSDownloadService) ReleaseUploadSessionObjects(ctx context.Context, authorizationHeader string, session geckodb.GitUploadSession, files []geckodb.GitUploadSessionFile) (*GitUploadSessionReleaseResponse, error) {
+	details := map[string]any{"project_id": session.ProjectID, "session_id": session.ID}
+	if session.Status != GitUploadSessionCancelled && session.Status != GitUploadSessionExpired {
+		details["status"] = session.Status
+		return nil, NewError(ErrorKindConflict, http.StatusConflict, "only cancelled or expired upload sessions can release their DRS objects", details)
+	}
+	response := &GitUploadSessionReleaseResponse{SessionID: session.ID, Objects: make([]GitUploadReleasedObject, 0)}
+	changed := false
+	for i := range files {
+		file := &files[i]
+		if !file.DRSObjectID.Valid || strings.TrimSpace(file.DRSObjectID.String) == "" {
+			continue
+		}
+		object := GitUploadReleasedObject{TargetPath: file.TargetPath, DRSObjectID: file.DRSObjectID.String}
+		if !file.ObjectCreated {
+			object.Reason = "the upload session did not create this object"
+			response.Objects = append(response.Objects, object)
+			continue
+		}
+		inUse, err := geckodb.GitUploadDRSObjectInUseContext(ctx, service.db, file.DRSObjectID.String, session.ID)
+		if err != nil {
+			return nil, WrapError(ErrorKindDatabase, http.StatusInternalServerError, "failed to check DRS object references", err, details)
+		}
+		if inUse {
+			object.Reason = "another upload session references this object"
+			response.Objects = append(response.Objects, object)
+			continue
+		}
+		if err := service.storage.DeleteObject(ctx, authorizationHeader, file.DRSObjectID.String); err != nil {
+			object.Reason = err.Error()
+			response.Objects = append(response.Objects, object)
+			continue
+		}
+		object.Released = true
+		response.Objects = append(response.Objects, object)
+		file.DRSObjectID = sql.NullString{}
+		file.Status = GitUploadFileReleased
+		changed = true
+	}
+	if changed {
+		if err := geckodb.ReplaceGitUploadSessionFiles(service.db, session.ID, files); err != nil {
+			return nil, WrapError(ErrorKindDatabase, http.StatusInternalServerError, "failed to record released DRS objects", err, details)
+		}
 	}
-	return commit.GetSHA(), pr.GetHTMLURL(), nil
+	return response, nil
 }
@@ -0,0 +1,309 @@
+package git
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	geckodb "github.com/calypr/gecko/internal/db"
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// Conflict policies decide what happens to an added file whose target path
+// exists on the base branch or is already used by the session.
+const (
+	// GitUploadConflictFail records a collision, which blocks finalize until
+	// it is resolved.
+	GitUploadConflictFail = "fail"
+	// GitUploadConflictSkip keeps the file on the base branch and leaves
+	// the added file out of the commit.
+	GitUploadConflictSkip = "skip"
+	// GitUploadConflictOverwrite commits the added file as a new version of
+	// the file on the base branch.
+	GitUploadConflictOverwrite = "overwrite"
+	// GitUploadConflictRename appends the first free "-N" suffix to the
+	// file name.
+	GitUploadConflictRename = "rename"
+	// GitUploadConflictRenameSubdirectory moves the file into a directory
+	// named after the creation time of the session.
+	GitUploadConflictRenameSubdirectory = "rename_subdirectory"
+
+	// gitUploadRenameLimit is the highest suffix rename tries.
+	gitUploadRenameLimit = 1000
+)
+
+// NormalizeGitUploadConflictPolicy validates a conflict policy. An empty
+// value stays empty so callers can fall back to the session policy.
+func NormalizeGitUploadConflictPolicy(value string) (string, error) {
+	policy := strings.ToLower(strings.TrimSpace(value))
+	switch policy {
+	case "", GitUploadConflictFail, GitUploadConflictSkip, GitUploadConflictOverwrite, GitUploadConflictRename, GitUploadConflictRenameSubdirectory:
+		return policy, nil
+	default:
+		return "", NewError(ErrorKindValidation, http.StatusBadRequest, fmt.Sprintf("unknown conflict policy %q", value), map[string]any{"conflict_policy": value})
+	}
+}
+
+// GitUploadSessionConflictPolicy is the conflict policy of session; sessions
+// created before policies existed fail on conflicts.
+func GitUploadSessionConflictPolicy(session geckodb.GitUploadSession) string {
+	if session.ConflictPolicy == "" {
+		return GitUploadConflictFail
+	}
+	return session.ConflictPolicy
+}
+
+// GitUploadFileConflicted reports whether file collides, or had a collision
+// a conflict policy resolved, so its conflict can be evaluated again.
+func GitUploadFileConflicted(file geckodb.GitUploadSessionFile) bool {
+	return file.Status == GitUploadFileCollision || file.RequestedPath.Valid
+}
+
+// PlanGitUploadFiles turns manifest files into added session files under
+// subdirectory. A target path that exists in the tree of hash, or that
+// claimed already holds, is resolved with the conflict policy of the file
+// or, when it sets none, with conflictPolicy; stamp names the directory of
+// rename_subdirectory. claimed is updated.
+func PlanGitUploadFiles(repo *gogit.Repository, hash plumbing.Hash, sessionID string, subdirectory string, files []GitUploadSessionFileManifest, policy GitUploadPolicy, conflictPolicy string, stamp time.Time, claimed map[string]struct{}) ([]geckodb.GitUploadSessionFile, bool, error) {
+	tree, err := commitTree(repo, hash.String(), hash)
+	if err != nil {
+		return nil, false, err
+	}
+	sessionFiles := make([]geckodb.GitUploadSessionFile, 0, len(files))
+	hasConflicts := false
+	for _, manifest := range files {
+		fileName, err := NormalizeGitUploadFileName(manifest.Name)
+		if err != nil {
+			return nil, false, err
+		}
+		filePolicy, err := NormalizeGitUploadConflictPolicy(manifest.ConflictPolicy)
+		if err != nil {
+			return nil, false, err
+		}
+		targetPath := strings.Trim(strings.TrimSpace(BuildGitUploadTargetPath(subdirectory, fileName)), "/")
+		storage, err := policy.Storage(targetPath, manifest.Size, manifest.Storage)
+		if err != nil {
+			return nil, false, err
+		}
+		file := geckodb.GitUploadSessionFile{
+			SessionID:      sessionID,
+			FileName:       fileName,
+			TargetPath:     targetPath,
+			Size:           manifest.Size,
+			Operation:      GitUploadOperationAdd,
+			Storage:        storage,
+			Status:         GitUploadFilePending,
+			ConflictPolicy: sql.NullString{String: filePolicy, Valid: filePolicy != ""},
+		}
+		if filePolicy == "" {
+			filePolicy = conflictPolicy
+		}
+		resolveGitUploadConflict(tree, &file, filePolicy, stamp, claimed)
+		if file.Status == GitUploadFileCollision {
+			hasConflicts = true
+		}
+		sessionFiles = append(sessionFiles, file)
+	}
+	return sessionFiles, hasConflicts, nil
+}
+
+// ReevaluateGitUploadConflicts plans the conflicted files of files again
+// against the tree of hash, in place. Each starts over from the target path
+// it asked for, with its own conflict policy or conflictPolicy, and the
+// paths of the other files count as claimed. It returns the re-evaluated
+// files and the target paths that moved, old path to new path.
+func ReevaluateGitUploadConflicts(repo *gogit.Repository, hash plumbing.Hash, files []geckodb.GitUploadSessionFile, conflictPolicy string, stamp time.Time) ([]geckodb.GitUploadSessionFile, map[string]string, error) {
+	tree, err := commitTree(repo, hash.String(), hash)
+	if err != nil {
+		return nil, nil, err
+	}
+	selected := []int{}
+	others := []geckodb.GitUploadSessionFile{}
+	for i := range files {
+		if GitUploadFileConflicted(files[i]) {
+			selected = append(selected, i)
+			continue
+		}
+		others = append(others, files[i])
+	}
+	// Files resolve in the order of the paths they asked for, so rename
+	// suffixes do not depend on where earlier evaluations put them.
+	sort.SliceStable(selected, func(a int, b int) bool {
+		return gitUploadRequestedPath(files[selected[a]]) < gitUploadRequestedPath(files[selected[b]])
+	})
+	claimed := GitUploadSessionPaths(others)
+	resolved := make([]geckodb.GitUploadSessionFile, 0, len(selected))
+	moved := map[string]string{}
+	for _, index := range selected {
+		file := &files[index]
+		previous := file.TargetPath
+		file.TargetPath = gitUploadRequestedPath(*file)
+		file.FileName = path.Base(file.TargetPath)
+		file.RequestedPath = sql.NullString{}
+		file.Operation = GitUploadOperationAdd
+		file.Error = sql.NullString{}
+		file.Status = GitUploadFilePending
+		if GitUploadFileAttached(*file) {
+			file.Status = GitUploadFileUploaded
+		}
+		filePolicy := conflictPolicy
+		if file.ConflictPolicy.Valid && file.ConflictPolicy.String != "" {
+			filePolicy = file.ConflictPolicy.String
+		}
+		_, taken := claimed[file.TargetPath]
+		resolveGitUploadConflict(tree, file, filePolicy, stamp, claimed)
+		if taken && file.Status == GitUploadFileCollision {
+			// Two files of a session cannot share a target path.
+			return nil, nil, NewError(ErrorKindConflict, http.StatusConflict, fmt.Sprintf("target path %s is already used in this upload session", file.TargetPath), map[string]any{"target_path": file.TargetPath, "previous_target_path": previous})
+		}
+		if file.TargetPath != previous {
+			moved[previous] = file.TargetPath
+		}
+		resolved = append(resolved, *file)
+	}
+	return resolved, moved, nil
+}
+
+// ApplyGitUploadConflictChanges sets the conflict policy and requested
+// target path of conflicted files before they are evaluated again.
+func ApplyGitUploadConflictChanges(files []geckodb.GitUploadSessionFile, changes []GitUploadSessionConflictChange) error {
+	byPath := make(map[string]*geckodb.GitUploadSessionFile, len(files))
+	for i := range files {
+		byPath[files[i].TargetPath] = &files[i]
+	}
+	for index, change := range changes {
+		targetPath := strings.Trim(strings.TrimSpace(change.TargetPath), "/")
+		details := map[string]any{"change_index": index, "target_path": change.TargetPath}
+		file, ok := byPath[targetPath]
+		if !ok {
+			return NewError(ErrorKindValidation, http.StatusBadRequest, fmt.Sprintf("upload session does not contain target path %s", targetPath), details)
+		}
+		if !GitUploadFileConflicted(*file) {
+			return NewError(ErrorKindValidation, http.StatusBadRequest, fmt.Sprintf("target path %s has no conflict to resolve", targetPath), details)
+		}
+		policy, err := NormalizeGitUploadConflictPolicy(change.ConflictPolicy)
+		if err != nil {
+			return err
+		}
+		if policy != "" {
+			file.ConflictPolicy = sql.NullString{String: policy, Valid: true}
+		}
+		if strings.TrimSpace(change.NewTargetPath) == "" {
+			continue
+		}
+		requested := cleanGitUploadPath(change.NewTargetPath)
+		if requested == "" {
+			details["new_target_path"] = change.NewTargetPath
+			return NewError(ErrorKindValidation, http.StatusBadRequest, "new_target_path must be a clean relative path", details)
+		}
+		file.RequestedPath = sql.NullString{String: requested, Valid: true}
+	}
+	return nil
+}
+
+// resolveGitUploadConflict gives file, an added file, its final target path
+// under policy, claiming the paths it uses. A free target path is kept.
+func resolveGitUploadConflict(tree *object.Tree, file *geckodb.GitUploadSessionFile, policy string, stamp time.Time, claimed map[string]struct{}) {
+	requested := file.TargetPath
+	_, taken := claimed[requested]
+	exists := gitTreePathExists(tree, requested)
+	if !taken && !exists {
+		claimed[requested] = struct{}{}
+		return
+	}
+	conflict := "target path already exists on base branch"
+	if taken {
+		conflict = "duplicate target path in upload batch"
+	}
+	switch policy {
+	case GitUploadConflictSkip:
+		if !taken {
+			claimed[requested] = struct{}{}
+			file.RequestedPath = sql.NullString{String: requested, Valid: true}
+			file.Status = GitUploadFileSkipped
+			file.Error = sql.NullString{String: "target path already exists on base branch and is kept", Valid: true}
+			return
+		}
+	case GitUploadConflictOverwrite:
+		if !taken {
+			if _, err := tree.File(requested); err == nil {
+				claimed[requested] = struct{}{}
+				file.RequestedPath = sql.NullString{String: requested, Valid: true}
+				file.Operation = GitUploadOperationReplace
+				return
+			}
+			conflict = "target path is a directory on base branch"
+		}
+	case GitUploadConflictRename, GitUploadConflictRenameSubdirectory:
+		if renamed := gitUploadRenamedPath(tree, requested, policy, stamp, claimed); renamed != "" {
+			claimed[renamed] = struct{}{}
+			file.RequestedPath = sql.NullString{String: requested, Valid: true}
+			file.TargetPath = renamed
+			file.FileName = path.Base(renamed)
+			return
+		}
+		conflict = "no free target path to rename to"
+	}
+	// A renamed file leaves the path it asked for to later entries of the
+	// session; every other file holds it.
+	claimed[requested] = struct{}{}
+	file.Status = GitUploadFileCollision
+	file.Error = sql.NullString{String: conflict, Valid: true}
+}
+
+// gitUploadRenamedPath is the first free path policy renames requested to,
+// or empty when there is none. rename turns data/sample.vcf.gz into
+// data/sample-1.vcf.gz, then data/sample-2.vcf.gz; rename_subdirectory
+// turns it into data/20260301T120000Z/sample.vcf.gz.
+func gitUploadRenamedPath(tree *object.Tree, requested string, policy string, stamp time.Time, claimed map[string]struct{}) string {
+	free := func(candidate string) bool {
+		_, taken := claimed[candidate]
+		return !taken && !gitTreePathExists(tree, candidate)
+	}
+	directory, name := path.Split(requested)
+	if policy == GitUploadConflictRenameSubdirectory {
+		candidate := directory + stamp.UTC().Format("20060102T150405Z") + "/" + name
+		if free(candidate) {
+			return candidate
+		}
+		return ""
+	}
+	stem, extension := name, ""
+	if dot := strings.Index(name[1:], "."); dot >= 0 {
+		stem, extension = name[:dot+1], name[dot+1:]
+	}
+	for suffix := 1; suffix <= gitUploadRenameLimit; suffix++ {
+		candidate := fmt.Sprintf("%s%s-%d%s", directory, stem, suffix, extension)
+		if free(candidate) {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// gitUploadCommittedFiles drops the skipped files of a session, which
+// finalize leaves out of the commit.
+func gitUploadCommittedFiles(files []geckodb.GitUploadSessionFile) []geckodb.GitUploadSessionFile {
+	committed := make([]geckodb.GitUploadSessionFile, 0, len(files))
+	for _, file := range files {
+		if file.Status != GitUploadFileSkipped {
+			committed = append(committed, file)
+		}
+	}
+	return committed
+}
+
+// gitUploadRequestedPath is the target path file asked for before a
+// conflict policy moved it.
+func gitUploadRequestedPath(file geckodb.GitUploadSessionFile) string {
+	if file.RequestedPath.Valid && file.RequestedPath.String != "" {
+		return file.RequestedPath.String
+	}
+	return file.TargetPath
+}
@@ -0,0 +1,132 @@
+package git
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	geckodb "github.com/calypr/gecko/internal/db"
+	gogit "github.com/go-git/go-git/v5"
+)
+
+func TestPlanGitUploadFilesAppliesConflictPolicies(t *testing.T) {
+	root := t.TempDir()
+	repo, err := gogit.PlainInit(root, false)
+	if err != nil {
+		t.Fatalf("init repo: %v", err)
+	}
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	commitTestFile(t, repo, root, "data/sample.vcf.gz", "v1", "alice", start)
+	commitTestFile(t, repo, root, "data/sample-1.vcf.gz", "v1", "alice", start.Add(time.Minute))
+	commitTestFile(t, repo, root, "data/keep.txt", "keep", "alice", start.Add(2*time.Minute))
+	commitTestFile(t, repo, root, "data/old.bam", lfsPointerContent(strings.Repeat("a", 64), 10), "alice", start.Add(3*time.Minute))
+	head := commitTestFile(t, repo, root, "data/dir/nested.txt", "nested", "alice", start.Add(4*time.Minute))
+	stamp := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	files, hasConflicts, err := PlanGitUploadFiles(repo, head, "session-1", "data", []GitUploadSessionFileManifest{
+		{Name: "sample.vcf.gz", Size: 10},
+		{Name: "keep.txt", Size: 4, ConflictPolicy: "skip"},
+		{Name: "old.bam", Size: 20, ConflictPolicy: "overwrite"},
+		{Name: "dir", Size: 1, ConflictPolicy: "overwrite"},
+		{Name: "new.txt", Size: 3},
+	}, DefaultGitUploadPolicy(), GitUploadConflictRename, stamp, map[string]struct{}{})
+	if err != nil {
+		t.Fatalf("plan files: %v", err)
+	}
+	if !hasConflicts || len(files) != 5 {
+		t.Fatalf("expected 5 files with conflicts, got %d (%v)", len(files), hasConflicts)
+	}
+	if files[0].TargetPath != "data/sample-2.vcf.gz" || files[0].FileName != "sample-2.vcf.gz" || files[0].RequestedPath.String != "data/sample.vcf.gz" || files[0].Status != GitUploadFilePending {
+		t.Fatalf("expected the first free suffix, got %+v", files[0])
+	}
+	if files[1].Status != GitUploadFileSkipped || files[1].TargetPath != "data/keep.txt" || GitUploadFileNeedsContent(files[1]) || files[1].ConflictPolicy.String != GitUploadConflictSkip {
+		t.Fatalf("expected keep.txt to be skipped, got %+v", files[1])
+	}
+	if files[2].Operation != GitUploadOperationReplace || files[2].Status != GitUploadFilePending || !GitUploadFileConflicted(files[2]) {
+		t.Fatalf("expected old.bam to become a new version, got %+v", files[2])
+	}
+	if files[3].Status != GitUploadFileCollision || files[3].Error.String != "target path is a directory on base branch" {
+		t.Fatalf("expected a directory to stay a collision, got %+v", files[3])
+	}
+	if files[4].TargetPath != "data/new.txt" || files[4].RequestedPath.Valid || GitUploadFileConflicted(files[4]) {
+		t.Fatalf("expected a free path to be kept, got %+v", files[4])
+	}
+	if committed := gitUploadCommittedFiles(files); len(committed) != 4 {
+		t.Fatalf("expected skipped files to stay out of the commit, got %+v", committed)
+	}
+
+	files = append(files, geckodb.GitUploadSessionFile{SessionID: "session-1", FileName: "sample.vcf.gz", TargetPath: "data/sample.vcf.gz", Size: 5, Operation: GitUploadOperationAdd, Status: GitUploadFileCollision, ConflictPolicy: sql.NullString{String: GitUploadConflictRenameSubdirectory, Valid: true}})
+	if err := ApplyGitUploadConflictChanges(files, []GitUploadSessionConflictChange{
+		{TargetPath: "data/dir", NewTargetPath: "data/dir.txt"},
+		{TargetPath: "/data/keep.txt", ConflictPolicy: "OVERWRITE"},
+	}); err != nil {
+		t.Fatalf("apply changes: %v", err)
+	}
+	resolved, moved, err := ReevaluateGitUploadConflicts(repo, head, files, GitUploadConflictFail, stamp)
+	if err != nil {
+		t.Fatalf("reevaluate: %v", err)
+	}
+	if len(resolved) != 5 {
+		t.Fatalf("expected every conflicted file to be evaluated again, got %+v", resolved)
+	}
+	if files[0].TargetPath != "data/sample.vcf.gz" || files[0].Status != GitUploadFileCollision || files[0].RequestedPath.Valid {
+		t.Fatalf("expected the session policy to bring back the collision, got %+v", files[0])
+	}
+	if files[1].Operation != GitUploadOperationReplace || files[1].Status != GitUploadFilePending {
+		t.Fatalf("expected keep.txt to be overwritten, got %+v", files[1])
+	}
+	if files[3].TargetPath != "data/dir.txt" || files[3].Status != GitUploadFilePending || files[3].FileName != "dir.txt" {
+		t.Fatalf("expected dir to move to its new path, got %+v", files[3])
+	}
+	if files[5].TargetPath != "data/20260301T120000Z/sample.vcf.gz" {
+		t.Fatalf("expected a timestamped subdirectory, got %+v", files[5])
+	}
+	if len(moved) != 3 || moved["data/sample-2.vcf.gz"] != "data/sample.vcf.gz" || moved["data/dir"] != "data/dir.txt" || moved["data/sample.vcf.gz"] != "data/20260301T120000Z/sample.vcf.gz" {
+		t.Fatalf("unexpected moves %v", moved)
+	}
+}
+
+func TestApplyGitUploadConflictChangesValidates(t *testing.T) {
+	files := []geckodb.GitUploadSessionFile{
+		{TargetPath: "data/a.bam", Operation: GitUploadOperationAdd, Status: GitUploadFileCollision},
+		{TargetPath: "data/b.bam", Operation: GitUploadOperationAdd, Status: GitUploadFilePending},
+	}
+	var appErr *Error
+	for name, change := range map[string]GitUploadSessionConflictChange{
+		"missing":       {TargetPath: "data/c.bam"},
+		"no conflict":   {TargetPath: "data/b.bam", ConflictPolicy: "skip"},
+		"policy":        {TargetPath: "data/a.bam", ConflictPolicy: "merge"},
+		"escaping path": {TargetPath: "data/a.bam", NewTargetPath: "../a.bam"},
+		"unclean path":  {TargetPath: "data/a.bam", NewTargetPath: "data//a.bam"},
+	} {
+		if err := ApplyGitUploadConflictChanges(files, []GitUploadSessionConflictChange{change}); !errors.As(err, &appErr) || appErr.StatusCode != http.StatusBadRequest {
+			t.Fatalf("%s: expected a validation error, got %v", name, err)
+		}
+	}
+	if policy := GitUploadSessionConflictPolicy(geckodb.GitUploadSession{}); policy != GitUploadConflictFail {
+		t.Fatalf("expected sessions without a policy to fail, got %s", policy)
+	}
+}
+
+func TestReevaluateGitUploadConflictsRejectsSharedTargets(t *testing.T) {
+	root := t.TempDir()
+	repo, err := gogit.PlainInit(root, false)
+	if err != nil {
+		t.Fatalf("init repo: %v", err)
+	}
+	head := commitTestFile(t, repo, root, "data/a.bam", "a", "alice", time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	files := []geckodb.GitUploadSessionFile{
+		{TargetPath: "data/a.bam", Operation: GitUploadOperationAdd, Status: GitUploadFileCollision},
+		{TargetPath: "data/b.bam", Operation: GitUploadOperationAdd, Status: GitUploadFilePending},
+	}
+	if err := ApplyGitUploadConflictChanges(files, []GitUploadSessionConflictChange{{TargetPath: "data/a.bam", NewTargetPath: "data/b.bam"}}); err != nil {
+		t.Fatalf("apply changes: %v", err)
+	}
+	var appErr *Error
+	if _, _, err := ReevaluateGitUploadConflicts(repo, head, files, GitUploadConflictFail, time.Now()); !errors.As(err, &appErr) || appErr.StatusCode != http.StatusConflict {
+		t.Fatalf("expected a shared target path to conflict, got %v", err)
+	}
+}
@@ -0,0 +1,140 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	geckodb "github.com/calypr/gecko/internal/db"
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/google/go-github/v87/github"
+)
+
+const (
+	// GitUploadCommitPullRequest sessions commit to a new branch and open a
+	// pull request for it.
+	GitUploadCommitPullRequest = "pull_request"
+	// GitUploadCommitDirect sessions fast-forward an existing branch to the
+	// upload commit.
+	GitUploadCommitDirect = "direct"
+
+	// GitUploadDirectCommitPermission is the arborist method a caller needs
+	// on the project resource path to create a direct-commit session.
+	GitUploadDirectCommitPermission = "direct-commit"
+)
+
+// GitUploadCommit is the commit a direct-commit finalize pushed.
+type GitUploadCommit struct {
+	CommitSHA          string
+	Branch             string
+	GitAttributesAdded []string
+}
+
+// NormalizeGitUploadCommitMode validates the commit mode of a session
+// create request; empty means a pull request.
+func NormalizeGitUploadCommitMode(value string) (string, error) {
+	switch mode := strings.ToLower(strings.TrimSpace(value)); mode {
+	case "", GitUploadCommitPullRequest:
+		return GitUploadCommitPullRequest, nil
+	case GitUploadCommitDirect:
+		return GitUploadCommitDirect, nil
+	default:
+		return "", NewError(ErrorKindValidation, http.StatusBadRequest, fmt.Sprintf("unknown upload commit mode %q", value), map[string]any{"commit_mode": value})
+	}
+}
+
+// GitUploadSessionCommitMode is the commit mode of session; sessions created
+// before direct commits existed open pull requests.
+func GitUploadSessionCommitMode(session geckodb.GitUploadSession) string {
+	if session.CommitMode == "" {
+		return GitUploadCommitPullRequest
+	}
+	return session.CommitMode
+}
+
+// GitBranchExists reports whether the mirror holds branch as a local or
+// remote-tracking branch.
+func GitBranchExists(repo *gogit.Repository, branch string) bool {
+	for _, candidate := range []string{"refs/heads/" + branch, "refs/remotes/origin/" + branch} {
+		if _, err := repo.Reference(plumbing.ReferenceName(candidate), true); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// CommitGitHubUploadDirect commits files on top of the head of branch and
+// moves branch to the new commit. baseSHA is the head of branch the session
+// was planned against; the commit fails with a conflict when branch no
+// longer points there. The ref update is then a compare-and-swap against
+// that head: the commit's only parent is the head, so GitHub rejects the
+// fast-forward once anything else lands on branch. Like
+// CreateGitHubUploadPullRequest it resumes from progress and records every
+// step with recorder; a branch an earlier attempt already moved to the
+// recorded commit counts as updated.
+func (service *GitService) CommitGitHubUploadDirect(
+	ctx context.Context,
+	authorizationHeader string,
+	organization string,
+	project string,
+	identity GitRepositoryIdentity,
+	baseSHA string,
+	branch string,
+	title string,
+	files []geckodb.GitUploadSessionFile,
+	attributes *GitAttributesSource,
+	progress GitUploadFinalizeProgress,
+	recorder GitUploadFinalizeRecorder,
+) (*GitUploadCommit, error) {
+	details := map[string]any{"branch": branch, "base_sha": baseSHA}
+	if progress.Done(GitUploadFinalizeBranch) {
+		return &GitUploadCommit{CommitSHA: progress.CommitSHA, Branch: branch, GitAttributesAdded: progress.AttributesAdded}, nil
+	}
+	if strings.TrimSpace(baseSHA) == "" {
+		return nil, NewError(ErrorKindConflict, http.StatusConflict, "upload session has no base commit to fast-forward from; create a new session", details)
+	}
+	accessToken, err := service.RequestInstallationToken(ctx, authorizationHeader, organization, project, identity, "write")
+	if err != nil {
+		return nil, err
+	}
+	client, err := service.githubClient(accessToken)
+	if err != nil {
+		return nil, err
+	}
+	branchRef, response, err := client.Git.GetRef(ctx, identity.Owner, identity.Repo, "refs/heads/"+branch)
+	if err != nil {
+		if response != nil && response.StatusCode == http.StatusNotFound {
+			return nil, NewError(ErrorKindConflict, http.StatusConflict, fmt.Sprintf("branch %s does not exist on GitHub", branch), details)
+		}
+		return nil, githubWriteStatusError("failed to load GitHub branch ref", response, err)
+	}
+	head := branchRef.GetObject().GetSHA()
+	if !progress.Done(GitUploadFinalizeCommit) || head != progress.CommitSHA {
+		if head != baseSHA {
+			details["head_sha"] = head
+			return nil, NewError(ErrorKindConflict, http.StatusConflict, fmt.Sprintf("branch %s moved from %s to %s since the upload session was created; create a new session", branch, baseSHA, head), details)
+		}
+		progress.ParentSHA = head
+		if err := commitGitHubUpload(ctx, client, identity, &progress, recorder, title, files, attributes); err != nil {
+			return nil, err
+		}
+		_, response, err = client.Git.UpdateRef(ctx, identity.Owner, identity.Repo, "refs/heads/"+branch, github.UpdateRef{
+			SHA:   progress.CommitSHA,
+			Force: github.Ptr(false),
+		})
+		if err != nil {
+			if response != nil && response.StatusCode == http.StatusUnprocessableEntity {
+				details["commit_sha"] = progress.CommitSHA
+				return nil, WrapError(ErrorKindConflict, http.StatusConflict, fmt.Sprintf("branch %s cannot be fast-forwarded to the upload commit; it moved from %s", branch, head), err, details)
+			}
+			return nil, githubWriteStatusError("failed to update GitHub branch", response, err)
+		}
+	}
+	progress.Step = GitUploadFinalizeBranch
+	if err := recordGitUploadFinalize(recorder, progress); err != nil {
+		return nil, err
+	}
+	return &GitUploadCommit{CommitSHA: progress.CommitSHA, Branch: branch, GitAttributesAdded: progress.AttributesAdded}, nil
+}
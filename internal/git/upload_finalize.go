@@ -0,0 +1,117 @@
+package git
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+
+	geckodb "github.com/calypr/gecko/internal/db"
+)
+
+// Finalize steps, in the order they run. A session records the last one it
+// completed.
+const (
+	GitUploadFinalizeTree        = "tree"
+	GitUploadFinalizeCommit      = "commit"
+	GitUploadFinalizeBranch      = "branch"
+	GitUploadFinalizePullRequest = "pull_request"
+
+	maxGitUploadIdempotencyKeyLength = 255
+)
+
+var gitUploadFinalizeStepOrder = map[string]int{
+	GitUploadFinalizeTree:        1,
+	GitUploadFinalizeCommit:      2,
+	GitUploadFinalizeBranch:      3,
+	GitUploadFinalizePullRequest: 4,
+}
+
+// GitUploadFinalizeProgress is what finalize has done on GitHub so far.
+// ParentSHA is the commit the upload commit is built on, TreeSHA and
+// CommitSHA the objects created from it. For direct commits the branch step
+// moves the branch and there is no pull request step.
+type GitUploadFinalizeProgress struct {
+	Step            string
+	ParentSHA       string
+	TreeSHA         string
+	CommitSHA       string
+	AttributesAdded []string
+	PullRequestURL  string
+}
+
+// GitUploadFinalizeRecorder persists finalize progress after every step, so
+// a finalize that fails midway can be retried from where it stopped.
+type GitUploadFinalizeRecorder interface {
+	RecordFinalizeProgress(progress GitUploadFinalizeProgress) error
+}
+
+func recordGitUploadFinalize(recorder GitUploadFinalizeRecorder, progress GitUploadFinalizeProgress) error {
+	if recorder == nil {
+		return nil
+	}
+	if err := recorder.RecordFinalizeProgress(progress); err != nil {
+		return WrapError(ErrorKindDatabase, http.StatusInternalServerError, fmt.Sprintf("failed to record upload finalize %s step", progress.Step), err, nil)
+	}
+	return nil
+}
+
+// Done reports whether step has completed.
+func (progress GitUploadFinalizeProgress) Done(step string) bool {
+	return gitUploadFinalizeStepOrder[progress.Step] >= gitUploadFinalizeStepOrder[step]
+}
+
+// PullRequest is the result of a finalize whose steps have all completed.
+func (progress GitUploadFinalizeProgress) PullRequest() *GitUploadPullRequest {
+	return &GitUploadPullRequest{
+		CommitSHA:          progress.CommitSHA,
+		URL:                progress.PullRequestURL,
+		GitAttributesAdded: progress.AttributesAdded,
+	}
+}
+
+// GitUploadSessionFinalizeProgress is the finalize progress recorded on
+// session.
+func GitUploadSessionFinalizeProgress(session geckodb.GitUploadSession) GitUploadFinalizeProgress {
+	if !session.FinalizeStep.Valid {
+		return GitUploadFinalizeProgress{}
+	}
+	return GitUploadFinalizeProgress{
+		Step:            session.FinalizeStep.String,
+		ParentSHA:       session.ParentSHA.String,
+		TreeSHA:         session.TreeSHA.String,
+		CommitSHA:       session.CommitSHA.String,
+		AttributesAdded: append([]string(nil), session.AttributesAdded...),
+		PullRequestURL:  session.PullRequestURL.String,
+	}
+}
+
+// ApplyGitUploadFinalizeProgress records progress on session.
+func ApplyGitUploadFinalizeProgress(session *geckodb.GitUploadSession, progress GitUploadFinalizeProgress) {
+	session.FinalizeStep = nullableString(progress.Step)
+	session.ParentSHA = nullableString(progress.ParentSHA)
+	session.TreeSHA = nullableString(progress.TreeSHA)
+	session.CommitSHA = nullableString(progress.CommitSHA)
+	session.AttributesAdded = progress.AttributesAdded
+	session.PullRequestURL = nullableString(progress.PullRequestURL)
+}
+
+func nullableString(value string) sql.NullString {
+	return sql.NullString{String: value, Valid: value != ""}
+}
+
+// CheckGitUploadIdempotencyKey validates the Idempotency-Key of a finalize
+// request against the key an earlier finalize of session recorded. A
+// session keeps the first key it was finalized with; a different key is a
+// conflict so two clients cannot unknowingly finalize the same session.
+func CheckGitUploadIdempotencyKey(session geckodb.GitUploadSession, key string) (string, error) {
+	key = strings.TrimSpace(key)
+	details := map[string]any{"project_id": session.ProjectID, "session_id": session.ID}
+	if len(key) > maxGitUploadIdempotencyKeyLength {
+		return "", NewError(ErrorKindValidation, http.StatusBadRequest, fmt.Sprintf("Idempotency-Key is longer than %d characters", maxGitUploadIdempotencyKeyLength), details)
+	}
+	if key != "" && session.IdempotencyKey.Valid && session.IdempotencyKey.String != key {
+		return "", NewError(ErrorKindConflict, http.StatusConflict, "upload session was finalized with a different Idempotency-Key", details)
+	}
+	return key, nil
+}
@@ -0,0 +1,55 @@
+package git
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	geckodb "github.com/calypr/gecko/internal/db"
+)
+
+func TestGitUploadFinalizeProgressRoundTrip(t *testing.T) {
+	progress := GitUploadFinalizeProgress{Step: GitUploadFinalizeCommit, ParentSHA: "base", TreeSHA: "tree", CommitSHA: "commit", AttributesAdded: []string{"*.bam filter=lfs diff=lfs merge=lfs -text"}}
+	if !progress.Done(GitUploadFinalizeTree) || !progress.Done(GitUploadFinalizeCommit) || progress.Done(GitUploadFinalizeBranch) {
+		t.Fatalf("unexpected completed steps for %+v", progress)
+	}
+	if (GitUploadFinalizeProgress{}).Done(GitUploadFinalizeTree) {
+		t.Fatal("expected no step to be done before finalize starts")
+	}
+
+	var session geckodb.GitUploadSession
+	ApplyGitUploadFinalizeProgress(&session, progress)
+	if session.PullRequestURL.Valid || !session.TreeSHA.Valid {
+		t.Fatalf("unexpected session fields %+v", session)
+	}
+	restored := GitUploadSessionFinalizeProgress(session)
+	if restored.Step != progress.Step || restored.ParentSHA != "base" || restored.TreeSHA != "tree" || restored.CommitSHA != "commit" || len(restored.AttributesAdded) != 1 {
+		t.Fatalf("unexpected restored progress %+v", restored)
+	}
+	if (GitUploadSessionFinalizeProgress(geckodb.GitUploadSession{CommitSHA: sql.NullString{String: "legacy", Valid: true}})).CommitSHA != "" {
+		t.Fatal("expected a session without a finalize step to start from scratch")
+	}
+}
+
+func TestCheckGitUploadIdempotencyKey(t *testing.T) {
+	session := geckodb.GitUploadSession{ID: "session-1"}
+	if key, err := CheckGitUploadIdempotencyKey(session, " retry-1 "); err != nil || key != "retry-1" {
+		t.Fatalf("expected the key to be accepted, got %q (%v)", key, err)
+	}
+	var appErr *Error
+	if _, err := CheckGitUploadIdempotencyKey(session, strings.Repeat("k", 256)); !errors.As(err, &appErr) || appErr.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected an overlong key to be rejected, got %v", err)
+	}
+	session.IdempotencyKey = sql.NullString{String: "retry-1", Valid: true}
+	if _, err := CheckGitUploadIdempotencyKey(session, "retry-1"); err != nil {
+		t.Fatalf("expected the recorded key to be accepted, got %v", err)
+	}
+	if _, err := CheckGitUploadIdempotencyKey(session, ""); err != nil {
+		t.Fatalf("expected a finalize without a key to be accepted, got %v", err)
+	}
+	if _, err := CheckGitUploadIdempotencyKey(session, "retry-2"); !errors.As(err, &appErr) || appErr.StatusCode != http.StatusConflict {
+		t.Fatalf("expected a different key to conflict, got %v", err)
+	}
+}
@@ -0,0 +1,289 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	geckodb "github.com/calypr/gecko/internal/db"
+	"github.com/calypr/gecko/internal/integrations/syfon"
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// gitUploadImportColumns maps the header names a bulk import manifest may
+// use to the column they fill.
+var gitUploadImportColumns = map[string]string{
+	"path":          "path",
+	"target_path":   "path",
+	"drs_id":        "drs_id",
+	"drs_object_id": "drs_id",
+	"object_id":     "drs_id",
+	"checksum":      "checksum",
+	"sha256":        "checksum",
+	"size":          "size",
+}
+
+// GitUploadImportRow is a row of a bulk import manifest: an existing DRS
+// object to commit as an LFS pointer at TargetPath. Size is -1 when the row
+// leaves it out.
+type GitUploadImportRow struct {
+	Line        int
+	TargetPath  string
+	DRSObjectID string
+	Checksum    string
+	Size        int64
+}
+
+// GitUploadImportRowError says why a row of a bulk import manifest was
+// rejected.
+type GitUploadImportRowError struct {
+	Line       int    `json:"line"`
+	TargetPath string `json:"target_path,omitempty"`
+	Error      string `json:"error"`
+}
+
+// GitUploadImportDelimiter is the field separator of a bulk import
+// manifest: a tab for text/tab-separated-values, a comma for text/csv, and
+// otherwise a tab when the header line has one.
+func GitUploadImportDelimiter(contentType string, content []byte) rune {
+	contentType = strings.ToLower(contentType)
+	switch {
+	case strings.Contains(contentType, "tab-separated-values"):
+		return '\t'
+	case strings.Contains(contentType, "csv"):
+		return ','
+	}
+	header, _, _ := bytes.Cut(content, []byte("\n"))
+	if bytes.ContainsRune(header, '\t') {
+		return '\t'
+	}
+	return ','
+}
+
+// ParseGitUploadImportManifest reads a CSV or TSV bulk import manifest. The
+// header names the columns: path (or target_path), drs_id (or
+// drs_object_id) and checksum (or sha256) plus size. Each row needs a path
+// and either a DRS ID or a checksum with its size. Rows that do not parse
+// are returned as row errors; a manifest without the required columns is a
+// validation error.
+func ParseGitUploadImportManifest(content []byte, delimiter rune) ([]GitUploadImportRow, []GitUploadImportRowError, error) {
+	reader := csv.NewReader(bytes.NewReader(content))
+	reader.Comma = delimiter
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	// Leading space is trimmed from each field below; the reader would
+	// otherwise fold the empty fields of a TSV row into the next one.
+	reader.TrimLeadingSpace = delimiter != '\t'
+	reader.LazyQuotes = delimiter == '\t'
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, nil, NewError(ErrorKindValidation, http.StatusBadRequest, "import manifest is empty", nil)
+	}
+	if err != nil {
+		return nil, nil, WrapError(ErrorKindValidation, http.StatusBadRequest, "failed to read import manifest header", err, nil)
+	}
+	columns := map[string]int{}
+	for index, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		if column, ok := gitUploadImportColumns[name]; ok {
+			if _, seen := columns[column]; !seen {
+				columns[column] = index
+			}
+		}
+	}
+	_, hasDRS := columns["drs_id"]
+	_, hasChecksum := columns["checksum"]
+	if _, ok := columns["path"]; !ok || (!hasDRS && !hasChecksum) {
+		return nil, nil, NewError(ErrorKindValidation, http.StatusBadRequest, "import manifest needs a path column and a drs_id or checksum column", map[string]any{"header": header})
+	}
+	rows := []GitUploadImportRow{}
+	rowErrors := []GitUploadImportRowError{}
+	firstLines := map[string]int{}
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				rowErrors = append(rowErrors, GitUploadImportRowError{Line: parseErr.StartLine, Error: parseErr.Err.Error()})
+				continue
+			}
+			return nil, nil, WrapError(ErrorKindValidation, http.StatusBadRequest, "failed to read import manifest", err, nil)
+		}
+		line, _ := reader.FieldPos(0)
+		field := func(column string) string {
+			index, ok := columns[column]
+			if !ok || index >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[index])
+		}
+		if strings.TrimSpace(strings.Join(record, "")) == "" {
+			continue
+		}
+		row := GitUploadImportRow{Line: line, DRSObjectID: field("drs_id"), Checksum: strings.ToLower(field("checksum")), Size: -1}
+		rowError := func(message string) {
+			rowErrors = append(rowErrors, GitUploadImportRowError{Line: line, TargetPath: field("path"), Error: message})
+		}
+		row.TargetPath = cleanGitUploadPath(field("path"))
+		if row.TargetPath == "" {
+			rowError("path must be a clean relative path")
+			continue
+		}
+		if row.DRSObjectID == "" && row.Checksum == "" {
+			rowError("a drs_id or a checksum is required")
+			continue
+		}
+		if row.Checksum != "" {
+			if decoded, err := hex.DecodeString(row.Checksum); err != nil || len(decoded) != 32 {
+				rowError("checksum must be a sha256 hex digest")
+				continue
+			}
+		}
+		if value := field("size"); value != "" {
+			size, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || size < 0 {
+				rowError(fmt.Sprintf("size %q is not a byte count", value))
+				continue
+			}
+			row.Size = size
+		}
+		if row.DRSObjectID == "" && row.Size < 0 {
+			rowError("size is required with a checksum")
+			continue
+		}
+		if first, ok := firstLines[row.TargetPath]; ok {
+			rowError(fmt.Sprintf("duplicate path; first listed on line %d", first))
+			continue
+		}
+		firstLines[row.TargetPath] = line
+		rows = append(rows, row)
+	}
+	return rows, rowErrors, nil
+}
+
+// ResolveUploadImportRows finds the DRS object behind each row of a bulk
+// import of organization/project: by its ID, or by its checksum, preferring
+// an object an upload session of the project recorded. The object must
+// exist, be authorized under the project and match the checksum and size the
+// row lists. Rows that pass are returned with the ID, checksum and size of
+// their object; the others are returned as row errors, including rows syfon
+// answered with an error. Only failures that would hit every row, such as
+// rejected credentials or an unreachable syfon, abort the import.
+func (service *LFSDownloadService) ResolveUploadImportRows(ctx context.Context, authorizationHeader string, organization string, project string, rows []GitUploadImportRow) ([]GitUploadImportRow, []GitUploadImportRowError, error) {
+	projectID := organization + "/" + project
+	resourcePath := ProgramProjectResourcePath(organization, project)
+	resolved := make([]GitUploadImportRow, 0, len(rows))
+	rowErrors := []GitUploadImportRowError{}
+	for _, row := range rows {
+		rowError := func(message string) {
+			rowErrors = append(rowErrors, GitUploadImportRowError{Line: row.Line, TargetPath: row.TargetPath, Error: message})
+		}
+		objectID := row.DRSObjectID
+		if objectID == "" {
+			var err error
+			objectID, err = service.lookupObjectID(ctx, authorizationHeader, projectID, row.Checksum)
+			if err != nil {
+				if !gitUploadImportRowFailure(err) {
+					return nil, nil, err
+				}
+				rowError(fmt.Sprintf("failed to look up sha256 %s in syfon: %s", row.Checksum, err))
+				continue
+			}
+			if objectID == "" {
+				rowError(fmt.Sprintf("no DRS object has sha256 %s", row.Checksum))
+				continue
+			}
+		}
+		record, err := service.storage.ObjectRecord(ctx, authorizationHeader, objectID)
+		if err != nil && gitUploadImportRowFailure(err) {
+			rowError(fmt.Sprintf("failed to resolve DRS object %s: %s", objectID, err))
+			continue
+		}
+		if err != nil {
+			return nil, nil, WrapError(ErrorKindIntegration, http.StatusBadGateway, "failed to resolve DRS object", err, map[string]any{"project_id": projectID, "line": row.Line, "drs_object_id": objectID})
+		}
+		switch {
+		case record == nil:
+			rowError(fmt.Sprintf("DRS object %s does not exist or is not visible to the caller", objectID))
+		case record.SHA256 == "":
+			rowError(fmt.Sprintf("DRS object %s has no sha256 checksum", objectID))
+		case row.Checksum != "" && !strings.EqualFold(record.SHA256, row.Checksum):
+			rowError(fmt.Sprintf("DRS object %s has sha256 %s, but the row lists %s", objectID, record.SHA256, row.Checksum))
+		case row.Size >= 0 && record.Size != row.Size:
+			rowError(fmt.Sprintf("DRS object %s is %d bytes, but the row lists %d", objectID, record.Size, row.Size))
+		case !gitUploadAuthzCovers(record.Authz, resourcePath):
+			rowError(fmt.Sprintf("DRS object %s is not authorized under %s", objectID, resourcePath))
+		default:
+			row.DRSObjectID = objectID
+			row.Checksum = record.SHA256
+			row.Size = record.Size
+			resolved = append(resolved, row)
+		}
+	}
+	return resolved, rowErrors, nil
+}
+
+// gitUploadImportRowFailure reports whether err from a syfon lookup
+// concerns only the row it was made for: syfon answered about that object
+// with an error. Rejected credentials and requests that never got an answer
+// would fail every row, so they abort the import instead.
+func gitUploadImportRowFailure(err error) bool {
+	var responseErr *syfon.ResponseError
+	if !errors.As(err, &responseErr) {
+		return false
+	}
+	return responseErr.StatusCode != http.StatusUnauthorized && responseErr.StatusCode != http.StatusForbidden
+}
+
+// PlanGitUploadImport turns resolved import rows into session files whose
+// DRS objects are already attached. Target paths are checked against the
+// tree of hash like the files of a manifest, and taken ones are resolved
+// with conflictPolicy.
+func PlanGitUploadImport(repo *gogit.Repository, hash plumbing.Hash, sessionID string, rows []GitUploadImportRow, conflictPolicy string, stamp time.Time) ([]geckodb.GitUploadSessionFile, error) {
+	tree, err := commitTree(repo, hash.String(), hash)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]geckodb.GitUploadSessionFile, 0, len(rows))
+	claimed := make(map[string]struct{}, len(rows))
+	for _, row := range rows {
+		file := geckodb.GitUploadSessionFile{
+			SessionID:   sessionID,
+			FileName:    path.Base(row.TargetPath),
+			TargetPath:  row.TargetPath,
+			Size:        row.Size,
+			Checksum:    sql.NullString{String: row.Checksum, Valid: true},
+			DRSObjectID: sql.NullString{String: row.DRSObjectID, Valid: true},
+			Operation:   GitUploadOperationAdd,
+			Storage:     GitUploadStorageLFS,
+			Status:      GitUploadFileUploaded,
+		}
+		resolveGitUploadConflict(tree, &file, conflictPolicy, stamp, claimed)
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// cleanGitUploadPath normalizes a target path from the repository root, or
+// returns "" when it is empty or not a clean relative path.
+func cleanGitUploadPath(value string) string {
+	cleaned := strings.Trim(strings.TrimSpace(value), "/")
+	if cleaned == "" || path.Clean(cleaned) != cleaned || cleaned == "." || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return ""
+	}
+	return cleaned
+}
@@ -0,0 +1,185 @@
+package git
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	geckodb "github.com/calypr/gecko/internal/db"
+	"github.com/calypr/gecko/internal/integrations/syfon"
+	gogit "github.com/go-git/go-git/v5"
+)
+
+func TestParseGitUploadImportManifestReportsRowErrors(t *testing.T) {
+	checksum := strings.Repeat("a", 64)
+	content := "\ufeffPath\tDRS_ID\tsha256\tsize\n" +
+		"data/a.bam\tdrs-a\t\t\n" +
+		"/data/b.bam/\t\t" + strings.ToUpper(checksum) + "\t10\n" +
+		"\n" +
+		"# exported from the 2025 ETL run\n" +
+		"../escape.bam\tdrs-c\t\t\n" +
+		"data/d.bam\t\t" + checksum + "\t\n" +
+		"data/e.bam\t\tnot-a-digest\t10\n" +
+		"data/f.bam\tdrs-f\t\t-1\n" +
+		"data/g.bam\t\t\t\n" +
+		"data/a.bam\tdrs-h\t\t\n"
+	if delimiter := GitUploadImportDelimiter("application/octet-stream", []byte(content)); delimiter != '\t' {
+		t.Fatalf("expected a tab delimiter from the header, got %q", delimiter)
+	}
+	if delimiter := GitUploadImportDelimiter("text/csv; charset=utf-8", []byte(content)); delimiter != ',' {
+		t.Fatalf("expected the content type to win, got %q", delimiter)
+	}
+
+	rows, rowErrors, err := ParseGitUploadImportManifest([]byte(content), '\t')
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if len(rows) != 2 || rows[0].TargetPath != "data/a.bam" || rows[0].DRSObjectID != "drs-a" || rows[0].Size != -1 {
+		t.Fatalf("unexpected rows %+v", rows)
+	}
+	if rows[1].TargetPath != "data/b.bam" || rows[1].Checksum != checksum || rows[1].Size != 10 || rows[1].Line != 3 {
+		t.Fatalf("unexpected checksum row %+v", rows[1])
+	}
+	want := map[int]string{
+		6:  "path must be a clean relative path",
+		7:  "size is required with a checksum",
+		8:  "checksum must be a sha256 hex digest",
+		9:  `size "-1" is not a byte count`,
+		10: "a drs_id or a checksum is required",
+		11: "duplicate path; first listed on line 2",
+	}
+	if len(rowErrors) != len(want) {
+		t.Fatalf("expected %d row errors, got %+v", len(want), rowErrors)
+	}
+	for _, rowError := range rowErrors {
+		if want[rowError.Line] != rowError.Error {
+			t.Fatalf("line %d: expected %q, got %q", rowError.Line, want[rowError.Line], rowError.Error)
+		}
+	}
+
+	var appErr *Error
+	if _, _, err := ParseGitUploadImportManifest([]byte("name,size\nx,1\n"), ','); !errors.As(err, &appErr) || appErr.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected a manifest without path and object columns to be rejected, got %v", err)
+	}
+	if _, _, err := ParseGitUploadImportManifest(nil, ','); !errors.As(err, &appErr) || appErr.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected an empty manifest to be rejected, got %v", err)
+	}
+}
+
+func TestPlanGitUploadImportAttachesObjects(t *testing.T) {
+	root := t.TempDir()
+	repo, err := gogit.PlainInit(root, false)
+	if err != nil {
+		t.Fatalf("init repo: %v", err)
+	}
+	head := commitTestFile(t, repo, root, "data/a.bam", lfsPointerContent(strings.Repeat("a", 64), 10), "alice", time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	rows := []GitUploadImportRow{
+		{Line: 2, TargetPath: "data/a.bam", DRSObjectID: "drs-a", Checksum: strings.Repeat("b", 64), Size: 12},
+		{Line: 3, TargetPath: "data/c.bam", DRSObjectID: "drs-c", Checksum: strings.Repeat("c", 64), Size: 30},
+	}
+
+	files, err := PlanGitUploadImport(repo, head, "session-1", rows, GitUploadConflictFail, time.Now())
+	if err != nil {
+		t.Fatalf("plan import: %v", err)
+	}
+	if files[0].Status != GitUploadFileCollision || files[0].Error.String != "target path already exists on base branch" {
+		t.Fatalf("expected an existing path to collide, got %+v", files[0])
+	}
+	if files[1].Status != GitUploadFileUploaded || !GitUploadFileAttached(files[1]) || files[1].FileName != "c.bam" || files[1].Storage != GitUploadStorageLFS {
+		t.Fatalf("expected an attached LFS file, got %+v", files[1])
+	}
+	if GitUploadSessionStatusForFiles(files[1:]) != GitUploadSessionReady {
+		t.Fatal("expected imported files to be ready to finalize")
+	}
+
+	files, err = PlanGitUploadImport(repo, head, "session-1", rows, GitUploadConflictOverwrite, time.Now())
+	if err != nil {
+		t.Fatalf("plan import: %v", err)
+	}
+	if files[0].Operation != GitUploadOperationReplace || files[0].Status != GitUploadFileUploaded {
+		t.Fatalf("expected overwrite to replace the pointer, got %+v", files[0])
+	}
+}
+
+func TestReleaseUploadSessionObjectsKeepsImportedObjects(t *testing.T) {
+	root := t.TempDir()
+	repo, err := gogit.PlainInit(root, false)
+	if err != nil {
+		t.Fatalf("init repo: %v", err)
+	}
+	head := commitTestFile(t, repo, root, "README.md", "demo", "alice", time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	rows := []GitUploadImportRow{
+		{Line: 2, TargetPath: "data/a.bam", DRSObjectID: "drs-a", Checksum: strings.Repeat("a", 64), Size: 10},
+		{Line: 3, TargetPath: "data/b.bam", DRSObjectID: "drs-b", Checksum: strings.Repeat("b", 64), Size: 20},
+	}
+	files, err := PlanGitUploadImport(repo, head, "session-1", rows, GitUploadConflictFail, time.Now())
+	if err != nil {
+		t.Fatalf("plan import: %v", err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected syfon request: %s %s", r.Method, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+	service := NewLFSDownloadService(nil, syfon.NewManager(server.URL, server.Client()))
+
+	released, err := service.ReleaseUploadSessionObjects(context.Background(), "Bearer user-token", geckodb.GitUploadSession{ID: "session-1", Status: GitUploadSessionCancelled}, files)
+	if err != nil {
+		t.Fatalf("release: %v", err)
+	}
+	if len(released.Objects) != 2 || released.Objects[0].Released || released.Objects[1].Released {
+		t.Fatalf("expected imported objects to be kept, got %+v", released)
+	}
+	if files[0].DRSObjectID.String != "drs-a" || files[1].Status != GitUploadFileUploaded {
+		t.Fatalf("expected imported files to keep their objects, got %+v", files)
+	}
+}
+
+func TestResolveUploadImportRowsKeepsSyfonErrorsPerRow(t *testing.T) {
+	oid := strings.Repeat("a", 64)
+	unauthorized := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if unauthorized {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch {
+		case r.URL.Path == "/index" && r.URL.Query().Get("hash") == "sha256:"+strings.Repeat("e", 64):
+			w.WriteHeader(http.StatusInternalServerError)
+		case r.URL.Path == "/index/drs-ok":
+			_ = json.NewEncoder(w).Encode(map[string]any{"did": "drs-ok", "size": 10, "hashes": map[string]string{"sha256": oid}, "authz": []string{"/programs/calypr/projects/demo"}})
+		case r.URL.Path == "/index/drs-broken":
+			_, _ = w.Write([]byte("not json"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	service := NewLFSDownloadService(nil, syfon.NewManager(server.URL, server.Client()))
+	rows := []GitUploadImportRow{
+		{Line: 2, TargetPath: "data/ok.bam", DRSObjectID: "drs-ok", Size: -1},
+		{Line: 3, TargetPath: "data/lookup.bam", Checksum: strings.Repeat("e", 64), Size: 10},
+		{Line: 4, TargetPath: "data/broken.bam", DRSObjectID: "drs-broken", Size: -1},
+	}
+
+	resolved, rowErrors, err := service.ResolveUploadImportRows(context.Background(), "Bearer user-token", "calypr", "demo", rows)
+	if err != nil {
+		t.Fatalf("expected per-object syfon errors to stay row errors, got %v", err)
+	}
+	if len(resolved) != 1 || resolved[0].DRSObjectID != "drs-ok" {
+		t.Fatalf("expected only the good row to resolve, got %+v", resolved)
+	}
+	if len(rowErrors) != 2 || rowErrors[0].Line != 3 || !strings.Contains(rowErrors[0].Error, "status 500") || rowErrors[1].Line != 4 {
+		t.Fatalf("unexpected row errors %+v", rowErrors)
+	}
+
+	unauthorized = true
+	if _, _, err := service.ResolveUploadImportRows(context.Background(), "Bearer user-token", "calypr", "demo", rows); err == nil {
+		t.Fatal("expected rejected credentials to abort the import")
+	}
+}
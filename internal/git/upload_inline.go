@@ -0,0 +1,146 @@
+package git
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	geckodb "github.com/calypr/gecko/internal/db"
+)
+
+const (
+	// GitUploadStorageLFS files are uploaded to DRS and committed as Git LFS
+	// pointers.
+	GitUploadStorageLFS = "lfs"
+	// GitUploadStorageInline files are uploaded to gecko and committed as
+	// regular blobs.
+	GitUploadStorageInline = "inline"
+
+	DefaultGitUploadInlineMaxBytes = 1 << 20
+)
+
+// DefaultGitUploadLFSPaths are the patterns that may never be committed
+// inline: sequence, alignment, variant and archive formats.
+var DefaultGitUploadLFSPaths = []string{
+	"*.bam", "*.bai", "*.cram", "*.crai", "*.sam",
+	"*.fastq", "*.fq", "*.fasta", "*.fa",
+	"*.vcf", "*.bcf", "*.bed", "*.bigwig", "*.bw",
+	"*.h5", "*.hdf5", "*.parquet",
+	"*.gz", "*.bgz", "*.bz2", "*.xz", "*.zip", "*.tar",
+}
+
+// GitUploadPolicy decides which session files may carry their content
+// inline. LFSPaths are .gitattributes patterns whose files must go through
+// Git LFS; every other file may be inline when it is text of at most
+// InlineMaxBytes. A zero InlineMaxBytes disables inline files.
+type GitUploadPolicy struct {
+	InlineMaxBytes int64
+	LFSPaths       []string
+}
+
+func DefaultGitUploadPolicy() GitUploadPolicy {
+	return GitUploadPolicy{
+		InlineMaxBytes: DefaultGitUploadInlineMaxBytes,
+		LFSPaths:       append([]string(nil), DefaultGitUploadLFSPaths...),
+	}
+}
+
+// RequiresLFS reports whether targetPath matches one of the LFS patterns.
+func (policy GitUploadPolicy) RequiresLFS(targetPath string) bool {
+	for _, pattern := range policy.LFSPaths {
+		pattern = strings.TrimSpace(pattern)
+		if pattern != "" && gitAttributesMatch(pattern, targetPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// lfsOnlyExtension reports whether no file ending in ext may ever be
+// committed inline under policy, so *.ext can safely be routed through LFS.
+// A nil policy allows nothing to be assumed.
+func (policy *GitUploadPolicy) lfsOnlyExtension(ext string) bool {
+	if policy == nil {
+		return false
+	}
+	if policy.InlineMaxBytes <= 0 {
+		return true
+	}
+	for _, pattern := range policy.LFSPaths {
+		if strings.TrimSpace(pattern) == "*"+ext {
+			return true
+		}
+	}
+	return false
+}
+
+// Storage resolves the storage a manifest entry asked for. An empty request
+// means Git LFS, so sessions created before inline files existed keep
+// working.
+func (policy GitUploadPolicy) Storage(targetPath string, size int64, requested string) (string, error) {
+	storage := strings.ToLower(strings.TrimSpace(requested))
+	details := map[string]any{"target_path": targetPath, "storage": requested}
+	switch storage {
+	case "", GitUploadStorageLFS:
+		return GitUploadStorageLFS, nil
+	case GitUploadStorageInline:
+	default:
+		return "", NewError(ErrorKindValidation, http.StatusBadRequest, fmt.Sprintf("unknown upload storage %q", requested), details)
+	}
+	if policy.InlineMaxBytes <= 0 {
+		return "", NewError(ErrorKindValidation, http.StatusBadRequest, "inline uploads are disabled", details)
+	}
+	if policy.RequiresLFS(targetPath) {
+		return "", NewError(ErrorKindValidation, http.StatusBadRequest, fmt.Sprintf("%s must be stored through Git LFS", targetPath), details)
+	}
+	if size > policy.InlineMaxBytes {
+		details["max_bytes"] = policy.InlineMaxBytes
+		return "", NewError(ErrorKindValidation, http.StatusBadRequest, fmt.Sprintf("inline file %s is larger than %d bytes", targetPath, policy.InlineMaxBytes), details)
+	}
+	return GitUploadStorageInline, nil
+}
+
+// CheckInlineContent validates content uploaded for an inline file and
+// returns its sha256 checksum.
+func (policy GitUploadPolicy) CheckInlineContent(targetPath string, content []byte) (string, error) {
+	details := map[string]any{"target_path": targetPath, "size": len(content)}
+	if int64(len(content)) > policy.InlineMaxBytes {
+		details["max_bytes"] = policy.InlineMaxBytes
+		return "", NewError(ErrorKindValidation, http.StatusRequestEntityTooLarge, fmt.Sprintf("inline file %s is larger than %d bytes", targetPath, policy.InlineMaxBytes), details)
+	}
+	if !utf8.Valid(content) || bytes.IndexByte(content, 0) >= 0 {
+		return "", NewError(ErrorKindValidation, http.StatusBadRequest, fmt.Sprintf("inline file %s is not UTF-8 text; upload it through Git LFS", targetPath), details)
+	}
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// GitUploadFileStorage is the storage of file; rows written before inline
+// files existed are LFS.
+func GitUploadFileStorage(file geckodb.GitUploadSessionFile) string {
+	if file.Storage == "" {
+		return GitUploadStorageLFS
+	}
+	return file.Storage
+}
+
+// GitUploadFileInline reports whether file carries inline content.
+func GitUploadFileInline(file geckodb.GitUploadSessionFile) bool {
+	return GitUploadFileNeedsContent(file) && GitUploadFileStorage(file) == GitUploadStorageInline
+}
+
+// GitUploadFileAttached reports whether the content of file has arrived: a
+// checksum and DRS object for LFS files, a checksum for inline ones.
+func GitUploadFileAttached(file geckodb.GitUploadSessionFile) bool {
+	if !GitUploadFileNeedsContent(file) {
+		return true
+	}
+	if GitUploadFileInline(file) {
+		return file.Checksum.Valid
+	}
+	return file.Checksum.Valid && file.DRSObjectID.Valid
+}
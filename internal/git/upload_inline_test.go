@@ -0,0 +1,97 @@
+package git
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	geckodb "github.com/calypr/gecko/internal/db"
+)
+
+func TestGitUploadPolicyStorage(t *testing.T) {
+	policy := GitUploadPolicy{InlineMaxBytes: 100, LFSPaths: []string{"*.bam", "raw/**"}}
+	cases := []struct {
+		path      string
+		size      int64
+		requested string
+		want      string
+		status    int
+	}{
+		{path: "data/sample.tsv", size: 10, requested: "", want: GitUploadStorageLFS},
+		{path: "data/sample.tsv", size: 10, requested: "LFS", want: GitUploadStorageLFS},
+		{path: "data/sample.tsv", size: 10, requested: "inline", want: GitUploadStorageInline},
+		{path: "data/sample.tsv", size: 101, requested: "inline", status: http.StatusBadRequest},
+		{path: "data/sample.bam", size: 10, requested: "inline", status: http.StatusBadRequest},
+		{path: "raw/notes.txt", size: 10, requested: "inline", status: http.StatusBadRequest},
+		{path: "data/sample.tsv", size: 10, requested: "s3", status: http.StatusBadRequest},
+	}
+	for _, tc := range cases {
+		got, err := policy.Storage(tc.path, tc.size, tc.requested)
+		if tc.status != 0 {
+			var appErr *Error
+			if !errors.As(err, &appErr) || appErr.StatusCode != tc.status {
+				t.Fatalf("Storage(%q, %d, %q): expected status %d, got %v", tc.path, tc.size, tc.requested, tc.status, err)
+			}
+			continue
+		}
+		if err != nil || got != tc.want {
+			t.Fatalf("Storage(%q, %d, %q) = %q, %v; want %q", tc.path, tc.size, tc.requested, got, err, tc.want)
+		}
+	}
+	if _, err := (GitUploadPolicy{}).Storage("README.md", 1, "inline"); err == nil {
+		t.Fatal("expected inline files to be rejected when the size cap is zero")
+	}
+}
+
+func TestGitUploadPolicyCheckInlineContent(t *testing.T) {
+	policy := GitUploadPolicy{InlineMaxBytes: 8}
+	checksum, err := policy.CheckInlineContent("a.tsv", []byte("id\tx\n"))
+	if err != nil || checksum != "756c017737a64ec6a8c4189ae427d25b1d3434e73f9914ff21bf79424ad04630" {
+		t.Fatalf("unexpected checksum %q (%v)", checksum, err)
+	}
+	var appErr *Error
+	if _, err := policy.CheckInlineContent("a.tsv", []byte("123456789")); !errors.As(err, &appErr) || appErr.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected oversized content to be rejected, got %v", err)
+	}
+	if _, err := policy.CheckInlineContent("a.bin", []byte{0x89, 'P', 'N', 'G', 0}); !errors.As(err, &appErr) || appErr.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected binary content to be rejected, got %v", err)
+	}
+}
+
+func TestBuildGitUploadTreeEntriesMixesInlineAndLFS(t *testing.T) {
+	checksum := strings.Repeat("b", 64)
+	files := []geckodb.GitUploadSessionFile{
+		{TargetPath: "data/reads.bam", Size: 20, Checksum: sql.NullString{String: checksum, Valid: true}, DRSObjectID: sql.NullString{String: "drs-1", Valid: true}},
+		{TargetPath: "data/samples.tsv", Size: 6, Storage: GitUploadStorageInline, Checksum: sql.NullString{String: checksum, Valid: true}, Content: []byte("id\tx\n")},
+	}
+	if GitUploadSessionStatusForFiles(files) != GitUploadSessionReady {
+		t.Fatal("expected an inline file with a checksum to count as attached")
+	}
+	entries, err := buildGitUploadTreeEntries(files)
+	if err != nil {
+		t.Fatalf("build tree entries: %v", err)
+	}
+	if entries[0].GetContent() != BuildLFSPointerContent(checksum, 20) {
+		t.Fatalf("expected an LFS pointer, got %q", entries[0].GetContent())
+	}
+	if entries[1].GetContent() != "id\tx\n" {
+		t.Fatalf("expected the inline content, got %q", entries[1].GetContent())
+	}
+	if paths := gitUploadContentPaths(files); strings.Join(paths, ",") != "data/reads.bam" {
+		t.Fatalf("expected only LFS files to need .gitattributes coverage, got %v", paths)
+	}
+	if tracked := gitUploadInlineTrackedByLFS("*.tsv filter=lfs diff=lfs merge=lfs -text\n", files); strings.Join(tracked, ",") != "data/samples.tsv" {
+		t.Fatalf("expected the inline file tracked by LFS to be reported, got %v", tracked)
+	}
+
+	files[1].Content = nil
+	if _, err := buildGitUploadTreeEntries(files); err == nil {
+		t.Fatal("expected an inline file without content to fail")
+	}
+	files[1].Checksum = sql.NullString{}
+	if GitUploadSessionStatusForFiles(files) != GitUploadSessionPending {
+		t.Fatal("expected an inline file without content to keep the session pending")
+	}
+}
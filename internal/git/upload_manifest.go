@@ -0,0 +1,81 @@
+package git
+
+import (
+	geckodb "github.com/calypr/gecko/internal/db"
+)
+
+// GitUploadSessionStatus is the status of session for files: pending_upload
+// while more manifest pages may follow, otherwise the status of its files.
+func GitUploadSessionStatus(session geckodb.GitUploadSession, files []geckodb.GitUploadSessionFile) string {
+	if !session.ManifestComplete {
+		return GitUploadSessionPending
+	}
+	return GitUploadSessionStatusForFiles(files)
+}
+
+// BuildDefaultGitUploadPRTitle is the default pull request title of a
+// session made of files, counted across every manifest page.
+func BuildDefaultGitUploadPRTitle(project string, files []geckodb.GitUploadSessionFile) string {
+	added := 0
+	for _, file := range files {
+		if GitUploadFileOperation(file) == GitUploadOperationAdd {
+			added++
+		}
+	}
+	if added < len(files) {
+		return BuildDefaultChangePRTitle(project, len(files))
+	}
+	return BuildDefaultUploadPRTitle(project, added)
+}
+
+// BuildGitUploadSessionProgress counts how much of the content of a session
+// has been attached.
+func BuildGitUploadSessionProgress(session geckodb.GitUploadSession, files []geckodb.GitUploadSessionFile) GitUploadSessionProgress {
+	progress := GitUploadSessionProgress{ManifestComplete: session.ManifestComplete, Files: len(files)}
+	for _, file := range files {
+		if file.Status == GitUploadFileCollision {
+			progress.FilesCollided++
+		}
+		if !GitUploadFileNeedsContent(file) {
+			continue
+		}
+		progress.FilesToUpload++
+		progress.BytesToUpload += file.Size
+		if GitUploadFileAttached(file) {
+			progress.FilesAttached++
+			progress.BytesAttached += file.Size
+		}
+	}
+	return progress
+}
+
+// GitUploadSessionPaths lists the paths the files of a session already
+// use, as targets or as the sources of moves. Planning a later manifest page
+// with them as claimed paths records reuses as collisions.
+func GitUploadSessionPaths(files []geckodb.GitUploadSessionFile) map[string]struct{} {
+	claimed := make(map[string]struct{}, len(files))
+	for _, file := range files {
+		claimed[file.TargetPath] = struct{}{}
+		if file.SourcePath.Valid && file.SourcePath.String != "" {
+			claimed[file.SourcePath.String] = struct{}{}
+		}
+	}
+	return claimed
+}
+
+// GitUploadManifestOverlaps lists the target paths of page that files
+// already hold. Such a page cannot be appended: its collision entries would
+// replace the files they collide with.
+func GitUploadManifestOverlaps(files []geckodb.GitUploadSessionFile, page []geckodb.GitUploadSessionFile) []string {
+	targets := make(map[string]struct{}, len(files))
+	for _, file := range files {
+		targets[file.TargetPath] = struct{}{}
+	}
+	overlaps := []string{}
+	for _, file := range page {
+		if _, ok := targets[file.TargetPath]; ok {
+			overlaps = append(overlaps, file.TargetPath)
+		}
+	}
+	return overlaps
+}
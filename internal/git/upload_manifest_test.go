@@ -0,0 +1,49 @@
+package git
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+
+	geckodb "github.com/calypr/gecko/internal/db"
+)
+
+func TestGitUploadSessionManifestPages(t *testing.T) {
+	checksum := strings.Repeat("c", 64)
+	files := []geckodb.GitUploadSessionFile{
+		{TargetPath: "data/a.bam", Size: 10, Checksum: sql.NullString{String: checksum, Valid: true}, DRSObjectID: sql.NullString{String: "drs-a", Valid: true}, Status: GitUploadFileUploaded},
+		{TargetPath: "data/b.bam", Size: 30, Status: GitUploadFilePending},
+		{TargetPath: "data/c.bam", Operation: GitUploadOperationMove, SourcePath: sql.NullString{String: "data/old.bam", Valid: true}, Status: GitUploadFileReady},
+	}
+	session := geckodb.GitUploadSession{ManifestComplete: false}
+	files[1].Checksum = sql.NullString{String: checksum, Valid: true}
+	files[1].DRSObjectID = sql.NullString{String: "drs-b", Valid: true}
+	if status := GitUploadSessionStatus(session, files); status != GitUploadSessionPending {
+		t.Fatalf("expected a partial manifest to stay pending, got %s", status)
+	}
+	session.ManifestComplete = true
+	if status := GitUploadSessionStatus(session, files); status != GitUploadSessionReady {
+		t.Fatalf("expected a complete manifest to follow its files, got %s", status)
+	}
+	files[1].DRSObjectID = sql.NullString{}
+
+	progress := BuildGitUploadSessionProgress(session, files)
+	if progress.Files != 3 || progress.FilesToUpload != 2 || progress.FilesAttached != 1 || progress.BytesToUpload != 40 || progress.BytesAttached != 10 || !progress.ManifestComplete {
+		t.Fatalf("unexpected progress %+v", progress)
+	}
+	if title := BuildDefaultGitUploadPRTitle("demo", files); title != "Change 3 files in demo" {
+		t.Fatalf("unexpected title %q", title)
+	}
+	if title := BuildDefaultGitUploadPRTitle("demo", files[:2]); title != "Add 2 LFS files to demo" {
+		t.Fatalf("unexpected title %q", title)
+	}
+
+	claimed := GitUploadSessionPaths(files)
+	if _, ok := claimed["data/old.bam"]; !ok {
+		t.Fatal("expected move sources to be claimed")
+	}
+	page := []geckodb.GitUploadSessionFile{{TargetPath: "data/b.bam"}, {TargetPath: "data/old.bam"}, {TargetPath: "data/d.bam"}}
+	if overlaps := GitUploadManifestOverlaps(files, page); strings.Join(overlaps, ",") != "data/b.bam" {
+		t.Fatalf("expected only reused targets to overlap, got %v", overlaps)
+	}
+}
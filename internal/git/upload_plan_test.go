@@ -0,0 +1,78 @@
+package git
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	gogit "github.com/go-git/go-git/v5"
+)
+
+func TestPlanGitUploadOperationsValidatesAgainstBaseTree(t *testing.T) {
+	root := t.TempDir()
+	repo, err := gogit.PlainInit(root, false)
+	if err != nil {
+		t.Fatalf("init repo: %v", err)
+	}
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	commitTestFile(t, repo, root, "data/old.bam", lfsPointerContent(strings.Repeat("a", 64), 10), "alice", start)
+	commitTestFile(t, repo, root, "data/keep.bam", "keep", "alice", start.Add(time.Minute))
+	head := commitTestFile(t, repo, root, "data/gone.txt", "gone", "alice", start.Add(2*time.Minute))
+
+	claimed := map[string]struct{}{"data/new.bam": {}}
+	files, hasConflicts, err := PlanGitUploadOperations(repo, head, "session-1", []GitUploadSessionOperation{
+		{Operation: "replace", Path: "data/old.bam", Size: 20},
+		{Operation: "delete", Path: "/data/gone.txt"},
+		{Operation: "move", FromPath: "data/keep.bam", Path: "archive/keep.bam"},
+		{Operation: "replace", Path: "data/missing.bam"},
+		{Operation: "move", FromPath: "data/old.bam", Path: "data/renamed.bam"},
+		{Operation: "delete", Path: "data/new.bam"},
+	}, DefaultGitUploadPolicy(), claimed)
+	if err != nil {
+		t.Fatalf("plan operations: %v", err)
+	}
+	if !hasConflicts || len(files) != 6 {
+		t.Fatalf("expected 6 files with conflicts, got %d (%v)", len(files), hasConflicts)
+	}
+	if files[0].Status != GitUploadFilePending || files[0].Size != 20 || !GitUploadFileNeedsContent(files[0]) {
+		t.Fatalf("expected replace to wait for an upload, got %+v", files[0])
+	}
+	if files[1].TargetPath != "data/gone.txt" || files[1].Status != GitUploadFileReady || GitUploadFileNeedsContent(files[1]) {
+		t.Fatalf("expected delete to be ready, got %+v", files[1])
+	}
+	move := files[2]
+	if move.Status != GitUploadFileReady || move.SourcePath.String != "data/keep.bam" || !move.SourceSHA.Valid || move.SourceMode.String != "100644" || move.Size != 4 {
+		t.Fatalf("expected move with source blob, got %+v", move)
+	}
+	for index, reason := range map[int]string{
+		3: "target path does not exist as a file on base branch",
+		4: "source path is already changed in this upload session",
+		5: "target path does not exist as a file on base branch",
+	} {
+		if files[index].Status != GitUploadFileCollision || files[index].Error.String != reason {
+			t.Fatalf("file %d: expected collision %q, got %+v", index, reason, files[index])
+		}
+	}
+	if GitUploadSessionStatusForFiles(files[1:3]) != GitUploadSessionReady {
+		t.Fatalf("expected a session of deletes and moves to be ready without uploads")
+	}
+
+	entries, err := buildGitUploadTreeEntries(files[1:3])
+	if err != nil {
+		t.Fatalf("build tree entries: %v", err)
+	}
+	if len(entries) != 3 || entries[0].SHA != nil || entries[0].GetPath() != "data/gone.txt" {
+		t.Fatalf("expected delete entry without sha, got %+v", entries)
+	}
+	if entries[1].GetPath() != "archive/keep.bam" || entries[1].GetSHA() != move.SourceSHA.String || entries[2].GetPath() != "data/keep.bam" || entries[2].SHA != nil {
+		t.Fatalf("expected move to add the target and delete the source, got %+v", entries[1:])
+	}
+
+	_, _, err = PlanGitUploadOperations(repo, head, "session-1", []GitUploadSessionOperation{{Operation: "copy", Path: "a"}}, DefaultGitUploadPolicy(), map[string]struct{}{})
+	var appErr *Error
+	if !errors.As(err, &appErr) || appErr.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected validation error for unknown operation, got %v", err)
+	}
+}
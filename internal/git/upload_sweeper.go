@@ -0,0 +1,108 @@
+package git
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	geckodb "github.com/calypr/gecko/internal/db"
+	"github.com/jmoiron/sqlx"
+	"github.com/uc-cdis/arborist/arborist"
+)
+
+type UploadSessionSweeperConfig struct {
+	// TTL is how long a session may go without an upload before it expires.
+	// Zero disables expiry.
+	TTL time.Duration
+	// Interval between passes over git_upload_session.
+	Interval time.Duration
+}
+
+// UploadSessionSweeper periodically marks upload sessions whose expiry has
+// passed as expired.
+type UploadSessionSweeper struct {
+	config UploadSessionSweeperConfig
+	db     *sqlx.DB
+	logger arborist.Logger
+
+	mu      sync.Mutex
+	cancel  context.CancelFunc
+	running sync.WaitGroup
+}
+
+func NewUploadSessionSweeper(db *sqlx.DB, logger arborist.Logger, config UploadSessionSweeperConfig) *UploadSessionSweeper {
+	if config.Interval <= 0 {
+		config.Interval = 5 * time.Minute
+	}
+	if config.TTL > 0 && config.Interval > config.TTL {
+		config.Interval = config.TTL
+	}
+	return &UploadSessionSweeper{config: config, db: db, logger: logger}
+}
+
+// TTL is the lifetime new and updated sessions are given.
+func (sweeper *UploadSessionSweeper) TTL() time.Duration {
+	return sweeper.config.TTL
+}
+
+// Start runs a sweep immediately, then one every Interval until Stop is
+// called. It does nothing when expiry is disabled.
+func (sweeper *UploadSessionSweeper) Start(ctx context.Context) {
+	sweeper.mu.Lock()
+	defer sweeper.mu.Unlock()
+	if sweeper.cancel != nil || sweeper.config.TTL <= 0 {
+		return
+	}
+	var runCtx context.Context
+	runCtx, sweeper.cancel = context.WithCancel(ctx)
+	sweeper.running.Add(1)
+	go sweeper.loop(runCtx)
+	sweeper.logger.Info("upload session sweeper started: ttl %s, interval %s", sweeper.config.TTL, sweeper.config.Interval)
+}
+
+// Stop ends the sweep loop and waits for a running sweep to finish.
+func (sweeper *UploadSessionSweeper) Stop() {
+	sweeper.mu.Lock()
+	cancel := sweeper.cancel
+	sweeper.cancel = nil
+	sweeper.mu.Unlock()
+	if cancel == nil {
+		return
+	}
+	cancel()
+	sweeper.running.Wait()
+	sweeper.logger.Info("upload session sweeper stopped")
+}
+
+// Sweep expires every open session whose expiry is at or before now, then
+// drops the inline file content of sessions that are no longer open.
+func (sweeper *UploadSessionSweeper) Sweep(ctx context.Context, now time.Time) (int64, error) {
+	expired, err := geckodb.ExpireGitUploadSessionsContext(ctx, sweeper.db, now.UTC())
+	if err != nil {
+		return 0, err
+	}
+	if _, err := geckodb.PruneGitUploadSessionContentsContext(ctx, sweeper.db); err != nil {
+		return expired, err
+	}
+	return expired, nil
+}
+
+func (sweeper *UploadSessionSweeper) loop(ctx context.Context) {
+	defer sweeper.running.Done()
+	ticker := time.NewTicker(sweeper.config.Interval)
+	defer ticker.Stop()
+	for {
+		if expired, err := sweeper.Sweep(ctx, time.Now()); err != nil {
+			if ctx.Err() == nil {
+				sweeper.logger.Warning("upload session sweeper could not expire sessions: %s", err)
+			}
+		} else if expired > 0 {
+			sweeper.logger.Info("expired %d upload sessions", expired)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
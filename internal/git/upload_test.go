@@ -4,14 +4,17 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	geckodb "github.com/calypr/gecko/internal/db"
 	"github.com/calypr/gecko/internal/git"
 	integrationfence "github.com/calypr/gecko/internal/integrations/fence"
+	"github.com/calypr/gecko/internal/integrations/syfon"
 )
 
 func TestCreateGitHubUploadPullRequest_PropagatesGitHub403(t *testing.T) {
@@ -47,7 +50,7 @@ func TestCreateGitHubUploadPullRequest_PropagatesGitHub403(t *testing.T) {
 		FenceClient:   integrationfence.NewClient(server.Client(), integrationfence.Config{BaseURL: server.URL}),
 	})
 
-	_, _, err := service.CreateGitHubUploadPullRequest(
+	_, err := service.CreateGitHubUploadPullRequest(
 		context.Background(),
 		"Bearer user-token",
 		"Ellrott_Lab",
@@ -62,6 +65,9 @@ func TestCreateGitHubUploadPullRequest_PropagatesGitHub403(t *testing.T) {
 			Size:       123,
 			Checksum:   sql.NullString{String: "abc123", Valid: true},
 		}},
+		nil,
+		git.GitUploadFinalizeProgress{},
+		nil,
 	)
 	if err == nil {
 		t.Fatal("expected error")
@@ -80,3 +86,373 @@ func TestCreateGitHubUploadPullRequest_PropagatesGitHub403(t *testing.T) {
 		t.Fatalf("expected write access token request, got %#v", tokenRequest)
 	}
 }
+
+func TestUploadSessionExpiryAndOpenStatuses(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	if expiry := git.GitUploadSessionExpiry(now, 0); expiry.Valid {
+		t.Fatalf("expected no expiry without a ttl, got %v", expiry.Time)
+	}
+	expiry := git.GitUploadSessionExpiry(now, 72*time.Hour)
+	if !expiry.Valid || !expiry.Time.Equal(now.Add(72*time.Hour)) {
+		t.Fatalf("unexpected expiry %+v", expiry)
+	}
+	response := git.BuildGitUploadSessionResponse(geckodb.GitUploadSession{ID: "session-1", Status: git.GitUploadSessionPending, ExpiresAt: expiry, CreatedByUserID: sql.NullString{String: "user@example.org", Valid: true}}, nil)
+	if response.ExpiresAt == nil || !response.ExpiresAt.Equal(expiry.Time) || response.CreatedBy != "user@example.org" {
+		t.Fatalf("unexpected session response %+v", response)
+	}
+	for status, open := range map[string]bool{
+		git.GitUploadSessionPending:   true,
+		git.GitUploadSessionReady:     true,
+		git.GitUploadSessionFinalized: false,
+		git.GitUploadSessionCancelled: false,
+		git.GitUploadSessionExpired:   false,
+	} {
+		if git.GitUploadSessionOpen(status) != open {
+			t.Fatalf("expected open(%s) to be %v", status, open)
+		}
+	}
+}
+
+func TestReleaseUploadSessionObjectsDeletesUncommittedObjects(t *testing.T) {
+	deleted := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			t.Fatalf("unexpected request: %s %s", r.Method, r.URL.Path)
+		}
+		deleted = append(deleted, r.URL.Path)
+		if r.URL.Path == "/index/drs-locked" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+	service := git.NewLFSDownloadService(nil, syfon.NewManager(server.URL, server.Client()))
+	files := []geckodb.GitUploadSessionFile{
+		{TargetPath: "data/a.bam", Status: git.GitUploadFileUploaded, DRSObjectID: sql.NullString{String: "drs-1", Valid: true}, ObjectCreated: true},
+		{TargetPath: "data/b.bam", Status: git.GitUploadFileUploaded, DRSObjectID: sql.NullString{String: "drs-locked", Valid: true}, ObjectCreated: true},
+		{TargetPath: "data/c.bam", Status: git.GitUploadFilePending},
+		{TargetPath: "data/d.bam", Status: git.GitUploadFileUploaded, DRSObjectID: sql.NullString{String: "drs-existing", Valid: true}},
+	}
+
+	_, err := service.ReleaseUploadSessionObjects(context.Background(), "Bearer user-token", geckodb.GitUploadSession{ID: "session-1", Status: git.GitUploadSessionPending}, files)
+	var appErr *git.Error
+	if !errors.As(err, &appErr) || appErr.StatusCode != http.StatusConflict {
+		t.Fatalf("expected an open session to be refused with 409, got %v", err)
+	}
+
+	released, err := service.ReleaseUploadSessionObjects(context.Background(), "Bearer user-token", geckodb.GitUploadSession{ID: "session-1", Status: git.GitUploadSessionCancelled}, files)
+	if err != nil {
+		t.Fatalf("release: %v", err)
+	}
+	if strings.Join(deleted, ",") != "/index/drs-1,/index/drs-locked" {
+		t.Fatalf("unexpected deletes %v", deleted)
+	}
+	if len(released.Objects) != 3 || !released.Objects[0].Released || released.Objects[1].Released || released.Objects[1].Reason == "" || released.Objects[2].Released || released.Objects[2].Reason == "" {
+		t.Fatalf("unexpected release response %+v", released)
+	}
+	if files[0].Status != git.GitUploadFileReleased || files[0].DRSObjectID.Valid || files[1].DRSObjectID.String != "drs-locked" || files[3].DRSObjectID.String != "drs-existing" {
+		t.Fatalf("unexpected files after release %+v", files)
+	}
+}
+
+func TestVerifyUploadSessionObjectsMarksMismatches(t *testing.T) {
+	oid := strings.Repeat("a", 64)
+	records := map[string]map[string]any{
+		"drs-ok":      {"did": "drs-ok", "size": 10, "hashes": map[string]string{"sha256": oid}, "authz": []string{"/programs/calypr/projects/demo"}},
+		"drs-org":     {"did": "drs-org", "size": 10, "hashes": map[string]string{"sha256": oid}, "authz": []string{"/programs/calypr"}},
+		"drs-size":    {"did": "drs-size", "size": 11, "hashes": map[string]string{"sha256": oid}, "authz": []string{"/programs/calypr/projects/demo"}},
+		"drs-sum":     {"did": "drs-sum", "size": 10, "hashes": map[string]string{"sha256": strings.Repeat("b", 64)}, "authz": []string{"/programs/calypr/projects/demo"}},
+		"drs-foreign": {"did": "drs-foreign", "size": 10, "hashes": map[string]string{"sha256": oid}, "authz": []string{"/programs/calypr/projects/demo-other"}},
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		record, ok := records[strings.TrimPrefix(r.URL.Path, "/index/")]
+		if r.Method != http.MethodGet || !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(record)
+	}))
+	defer server.Close()
+	service := git.NewLFSDownloadService(nil, syfon.NewManager(server.URL, server.Client()))
+	attached := func(path string, objectID string) geckodb.GitUploadSessionFile {
+		return geckodb.GitUploadSessionFile{TargetPath: path, Size: 10, Operation: git.GitUploadOperationAdd, Status: git.GitUploadFileUploaded, Checksum: sql.NullString{String: oid, Valid: true}, DRSObjectID: sql.NullString{String: objectID, Valid: true}}
+	}
+	files := []geckodb.GitUploadSessionFile{
+		attached("data/ok.bam", "drs-ok"),
+		attached("data/org.bam", "drs-org"),
+		attached("data/size.bam", "drs-size"),
+		attached("data/sum.bam", "drs-sum"),
+		attached("data/foreign.bam", "drs-foreign"),
+		attached("data/missing.bam", "drs-missing"),
+		{TargetPath: "data/unattached.bam", Size: 10, Operation: git.GitUploadOperationAdd, Status: git.GitUploadFileUploaded, Checksum: sql.NullString{String: oid, Valid: true}},
+		{TargetPath: "data/old.bam", Operation: git.GitUploadOperationDelete, Status: git.GitUploadFileReady},
+	}
+
+	invalid, err := service.VerifyUploadSessionObjects(context.Background(), "Bearer user-token", geckodb.GitUploadSession{ID: "session-1", Organization: "calypr", Project: "demo"}, files)
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if invalid != 5 {
+		t.Fatalf("expected 5 invalid files, got %d: %+v", invalid, files)
+	}
+	for _, file := range files[:2] {
+		if file.Status != git.GitUploadFileReady || file.Error.Valid {
+			t.Fatalf("expected %s to verify, got %+v", file.TargetPath, file)
+		}
+	}
+	for i, want := range []string{"is 11 bytes", "has sha256 " + strings.Repeat("b", 64), "not authorized under /programs/calypr/projects/demo", "does not exist", "no DRS object is attached"} {
+		file := files[2+i]
+		if file.Status != git.GitUploadFileInvalid || !strings.Contains(file.Error.String, want) {
+			t.Fatalf("expected %s to be invalid with %q, got %+v", file.TargetPath, want, file)
+		}
+	}
+	if git.GitUploadSessionStatusForFiles(files) != git.GitUploadSessionPending {
+		t.Fatal("expected invalid files to keep the session pending")
+	}
+}
+
+func TestCommitGitHubUploadDirectFastForwardsBranch(t *testing.T) {
+	var updates []map[string]any
+	var parents []string
+	heads := map[string]string{"main": "base-sha", "release": "release-sha"}
+	rejectUpdate := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/credentials/github":
+			_, _ = w.Write([]byte(`{"token":"test-token","expires_at":"2030-01-01T00:00:00Z","repository":{"owner":"EllrottLab","repo":"git_drs_test"}}`))
+		case r.Method == http.MethodGet && strings.Contains(r.URL.Path, "/git/ref/heads/"):
+			head, ok := heads[r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			_, _ = w.Write([]byte(`{"object":{"sha":"` + head + `"}}`))
+		case r.Method == http.MethodGet && strings.Contains(r.URL.Path, "/git/commits/"):
+			_, _ = w.Write([]byte(`{"tree":{"sha":"tree-sha"}}`))
+		case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/git/trees"):
+			_, _ = w.Write([]byte(`{"sha":"new-tree-sha"}`))
+		case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/git/commits"):
+			var commit struct {
+				Parents []string `json:"parents"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&commit); err != nil {
+				t.Fatalf("decode commit: %v", err)
+			}
+			parents = append(parents, strings.Join(commit.Parents, ","))
+			_, _ = w.Write([]byte(`{"sha":"new-commit-sha"}`))
+		case r.Method == http.MethodPatch && strings.Contains(r.URL.Path, "/git/refs/heads/"):
+			var update map[string]any
+			if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+				t.Fatalf("decode ref update: %v", err)
+			}
+			update["branch"] = r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+			updates = append(updates, update)
+			if rejectUpdate {
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				_, _ = w.Write([]byte(`{"message":"Update is not a fast forward"}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"object":{"sha":"new-commit-sha"}}`))
+		default:
+			t.Fatalf("unexpected request: %s %s", r.Method, r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	service := git.NewGitService(git.GitServiceConfig{
+		FenceBaseURL:  server.URL,
+		GitHubAPIBase: server.URL + "/api/v3",
+		HTTPClient:    server.Client(),
+		FenceClient:   integrationfence.NewClient(server.Client(), integrationfence.Config{BaseURL: server.URL}),
+	})
+	identity := git.GitRepositoryIdentity{Owner: "EllrottLab", Repo: "git_drs_test"}
+	files := []geckodb.GitUploadSessionFile{{TargetPath: "data/samples.tsv", Size: 3, Checksum: sql.NullString{String: "abc123", Valid: true}}}
+	commit := func(baseSHA string, branch string) (*git.GitUploadCommit, error) {
+		return service.CommitGitHubUploadDirect(context.Background(), "Bearer user-token", "Ellrott_Lab", "test", identity, baseSHA, branch, "Add samples", files, nil, git.GitUploadFinalizeProgress{}, nil)
+	}
+
+	result, err := commit("base-sha", "main")
+	if err != nil {
+		t.Fatalf("direct commit: %v", err)
+	}
+	if result.CommitSHA != "new-commit-sha" || result.Branch != "main" {
+		t.Fatalf("unexpected direct commit %+v", result)
+	}
+	if len(updates) != 1 || updates[0]["sha"] != "new-commit-sha" || updates[0]["force"] != false {
+		t.Fatalf("expected a fast-forward ref update, got %+v", updates)
+	}
+
+	if _, err := commit("release-sha", "release"); err != nil {
+		t.Fatalf("direct commit to another branch: %v", err)
+	}
+	if len(parents) != 2 || parents[1] != "release-sha" || updates[1]["branch"] != "release" {
+		t.Fatalf("expected the commit to be built on the release head, got parents %v and updates %+v", parents, updates)
+	}
+
+	rejectUpdate = true
+	var appErr *git.Error
+	if _, err := commit("base-sha", "main"); !errors.As(err, &appErr) || appErr.StatusCode != http.StatusConflict {
+		t.Fatalf("expected a rejected fast-forward to conflict, got %v", err)
+	}
+
+	heads["main"] = "other-sha"
+	if _, err := commit("base-sha", "main"); !errors.As(err, &appErr) || appErr.StatusCode != http.StatusConflict || !strings.Contains(appErr.Message, "moved from base-sha to other-sha") {
+		t.Fatalf("expected a moved branch to conflict, got %v", err)
+	}
+	if len(updates) != 3 {
+		t.Fatalf("expected no ref update once the branch moved, got %d", len(updates))
+	}
+}
+
+type finalizeRecorder struct {
+	steps []git.GitUploadFinalizeProgress
+}
+
+func (recorder *finalizeRecorder) RecordFinalizeProgress(progress git.GitUploadFinalizeProgress) error {
+	recorder.steps = append(recorder.steps, progress)
+	return nil
+}
+
+func TestCreateGitHubUploadPullRequestResumesFromRecordedProgress(t *testing.T) {
+	calls := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/credentials/github":
+			_, _ = w.Write([]byte(`{"token":"test-token","expires_at":"2030-01-01T00:00:00Z","repository":{"owner":"EllrottLab","repo":"git_drs_test"}}`))
+		case r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/git/ref/heads/main"):
+			_, _ = w.Write([]byte(`{"object":{"sha":"base-sha"}}`))
+		case r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/git/commits/base-sha"):
+			_, _ = w.Write([]byte(`{"tree":{"sha":"tree-sha"}}`))
+		case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/git/trees"):
+			calls["tree"]++
+			_, _ = w.Write([]byte(`{"sha":"new-tree-sha"}`))
+		case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/git/commits"):
+			calls["commit"]++
+			_, _ = w.Write([]byte(`{"sha":"new-commit-sha"}`))
+		case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/git/refs"):
+			calls["ref"]++
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			_, _ = w.Write([]byte(`{"message":"Reference already exists"}`))
+		case r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/git/ref/heads/gecko-upload/test"):
+			_, _ = w.Write([]byte(`{"object":{"sha":"new-commit-sha"}}`))
+		case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/pulls"):
+			calls["pull"]++
+			if calls["pull"] == 1 {
+				w.WriteHeader(http.StatusBadGateway)
+				_, _ = w.Write([]byte(`{"message":"Server Error"}`))
+				return
+			}
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			_, _ = w.Write([]byte(`{"message":"A pull request already exists for EllrottLab:gecko-upload/test."}`))
+		case r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/pulls"):
+			if r.URL.Query().Get("head") != "EllrottLab:gecko-upload/test" {
+				t.Fatalf("unexpected pull request head filter %q", r.URL.Query().Get("head"))
+			}
+			_, _ = w.Write([]byte(`[{"number":7,"html_url":"https://github.com/EllrottLab/git_drs_test/pull/7"}]`))
+		default:
+			t.Fatalf("unexpected request: %s %s", r.Method, r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	service := git.NewGitService(git.GitServiceConfig{
+		FenceBaseURL:  server.URL,
+		GitHubAPIBase: server.URL + "/api/v3",
+		HTTPClient:    server.Client(),
+		FenceClient:   integrationfence.NewClient(server.Client(), integrationfence.Config{BaseURL: server.URL}),
+	})
+	identity := git.GitRepositoryIdentity{Owner: "EllrottLab", Repo: "git_drs_test"}
+	files := []geckodb.GitUploadSessionFile{{TargetPath: "data/samples.tsv", Size: 3, Checksum: sql.NullString{String: "abc123", Valid: true}}}
+	recorder := &finalizeRecorder{}
+	finalize := func(progress git.GitUploadFinalizeProgress) (*git.GitUploadPullRequest, error) {
+		return service.CreateGitHubUploadPullRequest(context.Background(), "Bearer user-token", "Ellrott_Lab", "test", identity, "main", "gecko-upload/test", "title", "body", files, nil, progress, recorder)
+	}
+
+	if _, err := finalize(git.GitUploadFinalizeProgress{}); err == nil {
+		t.Fatal("expected the pull request step to fail")
+	}
+	if len(recorder.steps) != 3 {
+		t.Fatalf("expected the tree, commit and branch steps to be recorded, got %+v", recorder.steps)
+	}
+	progress := recorder.steps[2]
+	if progress.Step != git.GitUploadFinalizeBranch || progress.ParentSHA != "base-sha" || progress.TreeSHA != "new-tree-sha" || progress.CommitSHA != "new-commit-sha" {
+		t.Fatalf("unexpected recorded progress %+v", progress)
+	}
+
+	pullRequest, err := finalize(progress)
+	if err != nil {
+		t.Fatalf("resume finalize: %v", err)
+	}
+	if pullRequest.URL != "https://github.com/EllrottLab/git_drs_test/pull/7" || pullRequest.CommitSHA != "new-commit-sha" {
+		t.Fatalf("unexpected pull request %+v", pullRequest)
+	}
+	if calls["tree"] != 1 || calls["commit"] != 1 || calls["ref"] != 1 {
+		t.Fatalf("expected the resumed finalize to skip completed steps, got %v", calls)
+	}
+	if last := recorder.steps[len(recorder.steps)-1]; last.Step != git.GitUploadFinalizePullRequest || last.PullRequestURL != pullRequest.URL {
+		t.Fatalf("expected the pull request step to be recorded, got %+v", last)
+	}
+
+	replayed, err := finalize(recorder.steps[len(recorder.steps)-1])
+	if err != nil || replayed.URL != pullRequest.URL {
+		t.Fatalf("expected a finished finalize to replay its result, got %+v (%v)", replayed, err)
+	}
+	if calls["pull"] != 2 {
+		t.Fatalf("expected no GitHub calls for a finished finalize, got %v", calls)
+	}
+}
+
+func TestResolveUploadImportRowsChecksSyfonRecords(t *testing.T) {
+	oid := strings.Repeat("a", 64)
+	records := map[string]map[string]any{
+		"drs-ok":      {"did": "drs-ok", "size": 10, "hashes": map[string]string{"sha256": oid}, "authz": []string{"/programs/calypr/projects/demo"}},
+		"drs-size":    {"did": "drs-size", "size": 11, "hashes": map[string]string{"sha256": oid}, "authz": []string{"/programs/calypr/projects/demo"}},
+		"drs-foreign": {"did": "drs-foreign", "size": 10, "hashes": map[string]string{"sha256": oid}, "authz": []string{"/programs/calypr/projects/demo-other"}},
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/index" {
+			if r.URL.Query().Get("hash") != "sha256:"+oid {
+				_ = json.NewEncoder(w).Encode(map[string]any{"records": []any{}})
+				return
+			}
+			_ = json.NewEncoder(w).Encode(map[string]any{"records": []map[string]string{{"did": "drs-ok"}}})
+			return
+		}
+		record, ok := records[strings.TrimPrefix(r.URL.Path, "/index/")]
+		if r.Method != http.MethodGet || !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(record)
+	}))
+	defer server.Close()
+	service := git.NewLFSDownloadService(nil, syfon.NewManager(server.URL, server.Client()))
+
+	resolved, rowErrors, err := service.ResolveUploadImportRows(context.Background(), "Bearer user-token", "calypr", "demo", []git.GitUploadImportRow{
+		{Line: 2, TargetPath: "data/ok.bam", DRSObjectID: "drs-ok", Size: -1},
+		{Line: 3, TargetPath: "data/by-checksum.bam", Checksum: oid, Size: 10},
+		{Line: 4, TargetPath: "data/size.bam", DRSObjectID: "drs-size", Size: 10},
+		{Line: 5, TargetPath: "data/foreign.bam", DRSObjectID: "drs-foreign", Size: -1},
+		{Line: 6, TargetPath: "data/missing.bam", DRSObjectID: "drs-missing", Size: -1},
+		{Line: 7, TargetPath: "data/unknown.bam", Checksum: strings.Repeat("b", 64), Size: 10},
+		{Line: 8, TargetPath: "data/sum.bam", DRSObjectID: "drs-ok", Checksum: strings.Repeat("c", 64), Size: -1},
+	})
+	if err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	if len(resolved) != 2 || resolved[0].Checksum != oid || resolved[0].Size != 10 || resolved[1].DRSObjectID != "drs-ok" {
+		t.Fatalf("unexpected resolved rows %+v", resolved)
+	}
+	want := []string{"is 11 bytes", "not authorized under /programs/calypr/projects/demo", "does not exist", "no DRS object has sha256", "but the row lists " + strings.Repeat("c", 64)}
+	if len(rowErrors) != len(want) {
+		t.Fatalf("expected %d row errors, got %+v", len(want), rowErrors)
+	}
+	for i, rowError := range rowErrors {
+		if rowError.Line != 4+i || !strings.Contains(rowError.Error, want[i]) {
+			t.Fatalf("expected line %d to fail with %q, got %+v", 4+i, want[i], rowError)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package git
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	geckodb "github.com/calypr/gecko/internal/db"
+	"github.com/google/go-github/v87/github"
+)
+
+const (
+	// gitUploadTreeChunkSize is the most entries finalize sends to GitHub in
+	// one CreateTree call.
+	gitUploadTreeChunkSize = 1000
+	// gitUploadFinalizeBaseTimeout bounds the GitHub calls of a finalize
+	// other than CreateTree: the base commit, the commit, the ref and the
+	// pull request.
+	gitUploadFinalizeBaseTimeout = 60 * time.Second
+	// gitUploadTreeChunkTimeout is the time allowed for each CreateTree call.
+	gitUploadTreeChunkTimeout = 30 * time.Second
+)
+
+// GitUploadFinalizeTimeout is how long finalizing files on GitHub may take.
+// It grows with the number of CreateTree chunks the files need, so a large
+// upload is not cut off partway through its tree and made to start over
+// from the first chunk on every retry.
+func GitUploadFinalizeTimeout(files []geckodb.GitUploadSessionFile) time.Duration {
+	// One more entry covers a .gitattributes finalize may add.
+	chunks := (len(files) + gitUploadTreeChunkSize) / gitUploadTreeChunkSize
+	return gitUploadFinalizeBaseTimeout + time.Duration(chunks)*gitUploadTreeChunkTimeout
+}
+
+// createGitHubUploadTree creates the tree of baseTreeSHA with entries
+// applied and returns its SHA. Entries keep their full paths, which GitHub
+// applies on top of base_tree however deep they are, so an upload takes one
+// CreateTree call per chunkSize entries no matter how many directories it
+// touches. Each chunk builds on the tree the previous one created, in path
+// order, so no request exceeds GitHub's tree size limits.
+func createGitHubUploadTree(ctx context.Context, client *github.Client, identity GitRepositoryIdentity, baseTreeSHA string, entries []*github.TreeEntry, chunkSize int) (string, error) {
+	sorted := append([]*github.TreeEntry(nil), entries...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].GetPath() < sorted[j].GetPath()
+	})
+	sha := baseTreeSHA
+	for start := 0; start < len(sorted); start += chunkSize {
+		end := min(start+chunkSize, len(sorted))
+		tree, response, err := client.Git.CreateTree(ctx, identity.Owner, identity.Repo, sha, sorted[start:end])
+		if err != nil {
+			return "", githubWriteStatusError("failed to create GitHub tree", response, err)
+		}
+		sha = tree.GetSHA()
+	}
+	return sha, nil
+}
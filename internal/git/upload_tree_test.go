@@ -0,0 +1,86 @@
+package git
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	geckodb "github.com/calypr/gecko/internal/db"
+	"github.com/google/go-github/v87/github"
+)
+
+func TestCreateGitHubUploadTreeChunksFullPaths(t *testing.T) {
+	type treeRequest struct {
+		BaseTree string           `json:"base_tree"`
+		Tree     []map[string]any `json:"tree"`
+	}
+	var created []treeRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method != http.MethodPost || !strings.HasSuffix(r.URL.Path, "/git/trees") {
+			t.Fatalf("unexpected request: %s %s", r.Method, r.URL.Path)
+		}
+		var request treeRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Fatalf("decode tree request: %v", err)
+		}
+		created = append(created, request)
+		sha := map[string]string{"root-base": "root-1", "root-1": "root-2"}[request.BaseTree]
+		_, _ = w.Write([]byte(`{"sha":"` + sha + `"}`))
+	}))
+	defer server.Close()
+	client, err := github.NewClient(github.WithEnterpriseURLs(server.URL+"/api/v3/", server.URL+"/api/v3/"))
+	if err != nil {
+		t.Fatalf("create client: %v", err)
+	}
+	blob := func(path string, content string) *github.TreeEntry {
+		return &github.TreeEntry{Path: github.Ptr(path), Mode: github.Ptr("100644"), Type: github.Ptr("blob"), Content: github.Ptr(content)}
+	}
+	entries := []*github.TreeEntry{
+		blob("a/deep/nested/one.tsv", "1"),
+		blob("README.md", "readme"),
+		{Path: github.Ptr("b/old.tsv"), Mode: github.Ptr("100644"), Type: github.Ptr("blob")},
+		blob("a/two.tsv", "2"),
+	}
+
+	sha, err := createGitHubUploadTree(context.Background(), client, GitRepositoryIdentity{Owner: "o", Repo: "r"}, "root-base", entries, 2)
+	if err != nil {
+		t.Fatalf("create tree: %v", err)
+	}
+	if sha != "root-2" {
+		t.Fatalf("expected the last chunk's tree, got %s", sha)
+	}
+	if len(created) != 2 || created[0].BaseTree != "root-base" || created[1].BaseTree != "root-1" {
+		t.Fatalf("expected two chained chunks regardless of nesting, got %+v", created)
+	}
+	paths := []string{}
+	for _, request := range created {
+		for _, entry := range request.Tree {
+			paths = append(paths, entry["path"].(string))
+		}
+	}
+	if strings.Join(paths, ",") != "README.md,a/deep/nested/one.tsv,a/two.tsv,b/old.tsv" {
+		t.Fatalf("expected full paths in path order, got %v", paths)
+	}
+	if deleted := created[1].Tree[1]; deleted["sha"] != nil {
+		t.Fatalf("expected b/old.tsv to be deleted with a null sha, got %+v", deleted)
+	}
+	if _, ok := created[1].Tree[1]["sha"]; !ok {
+		t.Fatalf("expected the deletion to send an explicit null sha, got %+v", created[1].Tree[1])
+	}
+}
+
+func TestGitUploadFinalizeTimeoutGrowsWithTreeChunks(t *testing.T) {
+	small := GitUploadFinalizeTimeout(make([]geckodb.GitUploadSessionFile, 10))
+	if small != gitUploadFinalizeBaseTimeout+gitUploadTreeChunkTimeout {
+		t.Fatalf("expected one chunk for a small session, got %s", small)
+	}
+	// 2500 files plus a .gitattributes entry need three chunks.
+	large := GitUploadFinalizeTimeout(make([]geckodb.GitUploadSessionFile, 2500))
+	if large != gitUploadFinalizeBaseTimeout+3*gitUploadTreeChunkTimeout {
+		t.Fatalf("expected three chunks for 2500 files, got %s", large)
+	}
+}
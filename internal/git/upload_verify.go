@@ -0,0 +1,94 @@
+package git
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+
+	geckodb "github.com/calypr/gecko/internal/db"
+	"github.com/calypr/gecko/internal/git/domain"
+)
+
+// VerifyUploadSessionObjects resolves the DRS object of every LFS file that
+// carries content through syfon and checks that its sha256 checksum and
+// size match what the client attached, and that its authz covers the
+// project. Files that fail are moved to the invalid status with the reason
+// in their error; files that pass are marked ready. It returns the number of
+// invalid files. The caller persists files.
+//
+// A file that needs an object but has none attached is invalid: attach
+// rejects it, so only rows from before that check can lack one.
+func (service *LFSDownloadService) VerifyUploadSessionObjects(ctx context.Context, authorizationHeader string, session geckodb.GitUploadSession, files []geckodb.GitUploadSessionFile) (int, error) {
+	resourcePath := ProgramProjectResourcePath(session.Organization, session.Project)
+	invalid := 0
+	for i := range files {
+		file := &files[i]
+		if !GitUploadFileNeedsObject(*file) || file.Status == GitUploadFileCollision {
+			continue
+		}
+		if !file.DRSObjectID.Valid {
+			file.Status = GitUploadFileInvalid
+			file.Error = sql.NullString{String: "no DRS object is attached", Valid: true}
+			invalid++
+			continue
+		}
+		record, err := service.storage.ObjectRecord(ctx, authorizationHeader, file.DRSObjectID.String)
+		if err != nil {
+			return 0, WrapError(ErrorKindIntegration, http.StatusBadGateway, "failed to verify DRS object", err, map[string]any{"project_id": session.ProjectID, "session_id": session.ID, "target_path": file.TargetPath, "drs_object_id": file.DRSObjectID.String})
+		}
+		if reason := gitUploadObjectMismatch(*file, record, resourcePath); reason != "" {
+			file.Status = GitUploadFileInvalid
+			file.Error = sql.NullString{String: reason, Valid: true}
+			invalid++
+			continue
+		}
+		file.Status = GitUploadFileReady
+		file.Error = sql.NullString{}
+	}
+	return invalid, nil
+}
+
+// GitUploadFileNeedsObject reports whether file carries content through a
+// DRS object rather than inline.
+func GitUploadFileNeedsObject(file geckodb.GitUploadSessionFile) bool {
+	return GitUploadFileNeedsContent(file) && !GitUploadFileInline(file)
+}
+
+// gitUploadObjectMismatch describes why record does not back file, or
+// returns "" when it does.
+func gitUploadObjectMismatch(file geckodb.GitUploadSessionFile, record *domain.DRSObjectRecord, resourcePath string) string {
+	objectID := file.DRSObjectID.String
+	if record == nil {
+		return fmt.Sprintf("DRS object %s does not exist or is not visible to the caller", objectID)
+	}
+	if record.SHA256 == "" {
+		return fmt.Sprintf("DRS object %s has no sha256 checksum", objectID)
+	}
+	if !strings.EqualFold(record.SHA256, file.Checksum.String) {
+		return fmt.Sprintf("DRS object %s has sha256 %s, but %s was attached", objectID, record.SHA256, file.Checksum.String)
+	}
+	if record.Size != file.Size {
+		return fmt.Sprintf("DRS object %s is %d bytes, but %d were attached", objectID, record.Size, file.Size)
+	}
+	if !gitUploadAuthzCovers(record.Authz, resourcePath) {
+		return fmt.Sprintf("DRS object %s is not authorized under %s", objectID, resourcePath)
+	}
+	return ""
+}
+
+// gitUploadAuthzCovers reports whether one of authz is resourcePath or one
+// of its ancestors.
+func gitUploadAuthzCovers(authz []string, resourcePath string) bool {
+	for _, resource := range authz {
+		resource = strings.TrimRight(strings.TrimSpace(resource), "/")
+		if resource == "" {
+			continue
+		}
+		if resource == resourcePath || strings.HasPrefix(resourcePath, resource+"/") {
+			return true
+		}
+	}
+	return false
+}
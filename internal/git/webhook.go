@@ -0,0 +1,522 @@
+package git
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	geckodb "github.com/calypr/gecko/internal/db"
+	"github.com/google/go-github/v87/github"
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	GitPullRequestOpen   = "open"
+	GitPullRequestClosed = "closed"
+	GitPullRequestMerged = "merged"
+
+	defaultGitHubHost = "github.com"
+
+	// gitWebhookDeliveryClaimTimeout is how long a delivery may stay
+	// processing before a redelivery takes it over. Applying a delivery
+	// takes seconds, so a claim this old was left by a process that stopped.
+	gitWebhookDeliveryClaimTimeout = 10 * time.Minute
+)
+
+// ProjectRefreshTrigger queues a mirror refresh outside of a user request.
+// SyncScheduler and RefreshJobService implement it.
+type ProjectRefreshTrigger interface {
+	Trigger(ctx context.Context, projectID string) (bool, error)
+}
+
+// handledGitHubEvents lists the X-GitHub-Event values HandleDelivery applies.
+// Other deliveries are acknowledged as ignored without parsing them.
+var handledGitHubEvents = map[string]bool{
+	"push":                      true,
+	"installation":              true,
+	"installation_repositories": true,
+	"pull_request":              true,
+	"pull_request_review":       true,
+	"check_suite":               true,
+}
+
+// GitWebhookResult describes what a webhook delivery changed.
+type GitWebhookResult struct {
+	DeliveryID     string   `json:"delivery_id"`
+	Event          string   `json:"event"`
+	Action         string   `json:"action,omitempty"`
+	Duplicate      bool     `json:"duplicate,omitempty"`
+	Ignored        bool     `json:"ignored,omitempty"`
+	Organizations  []string `json:"organizations,omitempty"`
+	Projects       []string `json:"projects,omitempty"`
+	RefreshQueued  []string `json:"refresh_queued,omitempty"`
+	UploadSessions []string `json:"upload_sessions,omitempty"`
+	PendingAdded   []string `json:"pending_repositories_added,omitempty"`
+	PendingRemoved []string `json:"pending_repositories_removed,omitempty"`
+}
+
+// WebhookService applies GitHub App webhook deliveries to gecko's git state.
+type WebhookService struct {
+	db      *sqlx.DB
+	refresh ProjectRefreshTrigger
+	now     func() time.Time
+}
+
+func NewWebhookService(db *sqlx.DB, refresh ProjectRefreshTrigger) *WebhookService {
+	return &WebhookService{db: db, refresh: refresh, now: func() time.Time { return time.Now().UTC() }}
+}
+
+// VerifyGitHubWebhookSignature checks the X-Hub-Signature-256 header of a
+// delivery against the shared webhook secret.
+func VerifyGitHubWebhookSignature(signature string, payload []byte, secret string) error {
+	if strings.TrimSpace(secret) == "" {
+		return NewError(ErrorKindUnauthorized, http.StatusUnauthorized, "GitHub webhook secret is not configured", nil)
+	}
+	if !strings.HasPrefix(signature, "sha256=") {
+		return NewError(ErrorKindUnauthorized, http.StatusUnauthorized, "X-Hub-Signature-256 header is missing or malformed", nil)
+	}
+	if err := github.ValidateSignature(signature, payload, []byte(secret)); err != nil {
+		return NewError(ErrorKindUnauthorized, http.StatusUnauthorized, "GitHub webhook signature does not match", nil)
+	}
+	return nil
+}
+
+// HandleDelivery de-duplicates a delivery by its ID and applies it. A delivery
+// that fails is recorded as failed so a GitHub redelivery is processed again,
+// as is one left processing for gitWebhookDeliveryClaimTimeout.
+func (service *WebhookService) HandleDelivery(ctx context.Context, deliveryID string, event string, payload []byte) (*GitWebhookResult, error) {
+	deliveryID = strings.TrimSpace(deliveryID)
+	event = strings.TrimSpace(event)
+	if deliveryID == "" || event == "" {
+		return nil, NewError(ErrorKindValidation, http.StatusBadRequest, "X-GitHub-Delivery and X-GitHub-Event headers are required", nil)
+	}
+	result := &GitWebhookResult{DeliveryID: deliveryID, Event: event}
+	if !handledGitHubEvents[event] {
+		result.Ignored = true
+		return result, nil
+	}
+	parsed, err := github.ParseWebHook(event, payload)
+	if err != nil {
+		return nil, WrapError(ErrorKindValidation, http.StatusBadRequest, fmt.Sprintf("invalid %s payload", event), err, map[string]any{"delivery_id": deliveryID})
+	}
+	result.Action = webhookAction(parsed)
+
+	claimed, err := geckodb.ClaimGitWebhookDeliveryContext(ctx, service.db, geckodb.GitWebhookDelivery{
+		DeliveryID: deliveryID,
+		Event:      event,
+		Action:     sql.NullString{String: result.Action, Valid: result.Action != ""},
+		ReceivedAt: service.now(),
+	}, service.now().Add(-gitWebhookDeliveryClaimTimeout))
+	if err != nil {
+		return nil, WrapError(ErrorKindDatabase, http.StatusInternalServerError, "failed to record GitHub webhook delivery", err, map[string]any{"delivery_id": deliveryID})
+	}
+	if !claimed {
+		result.Duplicate = true
+		return result, nil
+	}
+
+	switch typed := parsed.(type) {
+	case *github.PushEvent:
+		err = service.handlePush(ctx, typed, result)
+	case *github.InstallationEvent:
+		err = service.handleInstallation(ctx, typed, result)
+	case *github.InstallationRepositoriesEvent:
+		err = service.handleInstallationRepositories(ctx, typed, result)
+	case *github.PullRequestEvent:
+		err = service.handlePullRequest(ctx, typed, result)
+	case *github.PullRequestReviewEvent:
+		err = service.handlePullRequestReview(ctx, typed, result)
+	case *github.CheckSuiteEvent:
+		err = service.handleCheckSuite(ctx, typed, result)
+	default:
+		result.Ignored = true
+	}
+
+	status, message := geckodb.GitWebhookDeliveryProcessed, ""
+	if err != nil {
+		status, message = geckodb.GitWebhookDeliveryFailed, err.Error()
+	}
+	// Record the outcome even if the request context has been cancelled.
+	if finishErr := geckodb.FinishGitWebhookDeliveryContext(context.WithoutCancel(ctx), service.db, deliveryID, status, message); finishErr != nil && err == nil {
+		err = WrapError(ErrorKindDatabase, http.StatusInternalServerError, "failed to record GitHub webhook outcome", finishErr, map[string]any{"delivery_id": deliveryID})
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// handlePush queues a mirror refresh for the projects backed by the pushed
+// repository whose tracked branch the push updated.
+func (service *WebhookService) handlePush(ctx context.Context, event *github.PushEvent, result *GitWebhookResult) error {
+	repo := event.GetRepo()
+	host := webhookHost(repo.GetHTMLURL())
+	states, err := geckodb.ListGitProjectStatesByRepositoryContext(ctx, service.db, host, repo.GetOwner().GetLogin(), repo.GetName())
+	if err != nil {
+		return WrapError(ErrorKindDatabase, http.StatusInternalServerError, "failed to load projects for pushed repository", err, map[string]any{"repository": repo.GetFullName()})
+	}
+	for _, state := range states {
+		result.Projects = append(result.Projects, state.ProjectID)
+		if service.refresh == nil || event.GetRef() != "refs/heads/"+trackedBranch(state, repo) {
+			continue
+		}
+		queued, err := service.refresh.Trigger(ctx, state.ProjectID)
+		if err != nil {
+			return WrapError(ErrorKindDatabase, http.StatusInternalServerError, "failed to queue mirror refresh", err, map[string]any{"project_id": state.ProjectID})
+		}
+		if queued {
+			result.RefreshQueued = append(result.RefreshQueued, state.ProjectID)
+		}
+	}
+	return nil
+}
+
+// trackedBranch returns the branch gecko mirrors for state, falling back to
+// the repository default branch when the project has not been synced yet.
+func trackedBranch(state geckodb.GitProjectState, repo *github.PushEventRepository) string {
+	if state.DefaultBranch.Valid && state.DefaultBranch.String != "" {
+		return state.DefaultBranch.String
+	}
+	if branch := repo.GetDefaultBranch(); branch != "" {
+		return branch
+	}
+	return repo.GetMasterBranch()
+}
+
+func (service *WebhookService) handleInstallation(ctx context.Context, event *github.InstallationEvent, result *GitWebhookResult) error {
+	installation := event.GetInstallation()
+	if installation.GetID() == 0 {
+		return NewError(ErrorKindValidation, http.StatusBadRequest, "installation event does not include an installation id", nil)
+	}
+	switch result.Action {
+	case "created", "unsuspend", "new_permissions_accepted":
+		organizations, err := service.applyInstallation(ctx, installation, true, result)
+		if err != nil {
+			return err
+		}
+		if result.Action == "created" {
+			return service.addPendingRepositories(installation, organizations, event.Repositories, result)
+		}
+		return nil
+	case "deleted", "suspend":
+		if _, err := service.applyInstallation(ctx, installation, false, result); err != nil {
+			return err
+		}
+		if result.Action == "deleted" {
+			return service.removePendingRepositories(installation, event.Repositories, result)
+		}
+		return nil
+	default:
+		result.Ignored = true
+		return nil
+	}
+}
+
+func (service *WebhookService) handleInstallationRepositories(ctx context.Context, event *github.InstallationRepositoriesEvent, result *GitWebhookResult) error {
+	installation := event.GetInstallation()
+	if installation.GetID() == 0 {
+		return NewError(ErrorKindValidation, http.StatusBadRequest, "installation_repositories event does not include an installation id", nil)
+	}
+	if event.RepositorySelection != nil {
+		installation.RepositorySelection = event.RepositorySelection
+	}
+	organizations, err := service.applyInstallation(ctx, installation, true, result)
+	if err != nil {
+		return err
+	}
+	if err := service.addPendingRepositories(installation, organizations, event.RepositoriesAdded, result); err != nil {
+		return err
+	}
+	if err := service.removePendingRepositories(installation, event.RepositoriesRemoved, result); err != nil {
+		return err
+	}
+	// Projects backed by a removed repository can no longer get tokens.
+	host := webhookHost(installation.GetHTMLURL())
+	for _, repo := range event.RepositoriesRemoved {
+		owner, name := webhookRepositoryOwnerAndName(repo, installation)
+		states, err := geckodb.ListGitProjectStatesByRepositoryContext(ctx, service.db, host, owner, name)
+		if err != nil {
+			return WrapError(ErrorKindDatabase, http.StatusInternalServerError, "failed to load projects for removed repository", err, map[string]any{"repository": repo.GetFullName()})
+		}
+		for _, state := range states {
+			clearInstalledState(&state)
+			if err := geckodb.UpdateGitProjectInstallationContext(ctx, service.db, state); err != nil {
+				return WrapError(ErrorKindDatabase, http.StatusInternalServerError, "failed to persist git project state", err, map[string]any{"project_id": state.ProjectID})
+			}
+			result.Projects = appendUnique(result.Projects, state.ProjectID)
+		}
+	}
+	return nil
+}
+
+func (service *WebhookService) handlePullRequest(ctx context.Context, event *github.PullRequestEvent, result *GitWebhookResult) error {
+	return service.applyPullRequest(ctx, event.GetRepo(), event.GetPullRequest(), "", result)
+}
+
+// handlePullRequestReview records the decision of a submitted review. A
+// dismissed review may change the decision in ways the event alone cannot
+// tell, so it is left for the next poll.
+func (service *WebhookService) handlePullRequestReview(ctx context.Context, event *github.PullRequestReviewEvent, result *GitWebhookResult) error {
+	decision := ""
+	switch strings.ToUpper(event.GetReview().GetState()) {
+	case "APPROVED":
+		decision = GitReviewApproved
+	case "CHANGES_REQUESTED":
+		decision = GitReviewChangesRequested
+	}
+	return service.applyPullRequest(ctx, event.GetRepo(), event.GetPullRequest(), decision, result)
+}
+
+// handleCheckSuite records the conclusion of a completed check suite on the
+// sessions whose pull request head it ran against.
+func (service *WebhookService) handleCheckSuite(ctx context.Context, event *github.CheckSuiteEvent, result *GitWebhookResult) error {
+	suite := event.GetCheckSuite()
+	if result.Action != "completed" || suite.GetHeadBranch() == "" {
+		result.Ignored = true
+		return nil
+	}
+	repo := event.GetRepo()
+	sessions, err := geckodb.ListGitUploadSessionsByBranchContext(ctx, service.db, webhookHost(repo.GetHTMLURL()), repo.GetOwner().GetLogin(), repo.GetName(), suite.GetHeadBranch())
+	if err != nil {
+		return WrapError(ErrorKindDatabase, http.StatusInternalServerError, "failed to load upload sessions for check suite", err, map[string]any{"repository": repo.GetFullName()})
+	}
+	checks := GitChecksFailure
+	switch suite.GetConclusion() {
+	case "success", "neutral", "skipped":
+		checks = GitChecksSuccess
+	}
+	for _, session := range sessions {
+		if session.PRHeadSHA.Valid && session.PRHeadSHA.String != suite.GetHeadSHA() {
+			continue
+		}
+		checkedAt := session.PRCheckedAt
+		now := service.now()
+		session.PRChecks = sql.NullString{String: checks, Valid: true}
+		session.PRCheckedAt = sql.NullTime{Time: now, Valid: true}
+		session.UpdatedAt = now
+		updated, err := geckodb.UpdateGitUploadSessionPullRequestContext(ctx, service.db, session, checkedAt)
+		if err != nil {
+			return WrapError(ErrorKindDatabase, http.StatusInternalServerError, "failed to persist upload pull request checks", err, map[string]any{"session_id": session.ID})
+		}
+		if !updated {
+			continue
+		}
+		result.UploadSessions = append(result.UploadSessions, session.ID)
+		result.Projects = appendUnique(result.Projects, session.ProjectID)
+	}
+	return nil
+}
+
+// applyPullRequest records pullRequest on the upload sessions of its head
+// branch and queues a mirror refresh for projects whose pull request was
+// just merged.
+func (service *WebhookService) applyPullRequest(ctx context.Context, repo *github.Repository, pullRequest *github.PullRequest, reviewDecision string, result *GitWebhookResult) error {
+	sessions, err := geckodb.ListGitUploadSessionsByBranchContext(ctx, service.db, webhookHost(repo.GetHTMLURL()), repo.GetOwner().GetLogin(), repo.GetName(), pullRequest.GetHead().GetRef())
+	if err != nil {
+		return WrapError(ErrorKindDatabase, http.StatusInternalServerError, "failed to load upload sessions for pull request", err, map[string]any{"repository": repo.GetFullName()})
+	}
+	for _, session := range sessions {
+		checkedAt := session.PRCheckedAt
+		merged := applyGitHubPullRequest(&session, pullRequest, service.now())
+		if reviewDecision != "" {
+			session.PRReviewDecision = sql.NullString{String: reviewDecision, Valid: true}
+		}
+		updated, err := geckodb.UpdateGitUploadSessionPullRequestContext(ctx, service.db, session, checkedAt)
+		if err != nil {
+			return WrapError(ErrorKindDatabase, http.StatusInternalServerError, "failed to persist upload pull request state", err, map[string]any{"session_id": session.ID})
+		}
+		if !updated {
+			// A concurrent delivery or poll recorded the pull request first.
+			continue
+		}
+		result.UploadSessions = append(result.UploadSessions, session.ID)
+		result.Projects = appendUnique(result.Projects, session.ProjectID)
+		if !merged || service.refresh == nil {
+			continue
+		}
+		queued, err := service.refresh.Trigger(ctx, session.ProjectID)
+		if err != nil {
+			return WrapError(ErrorKindDatabase, http.StatusInternalServerError, "failed to queue mirror refresh", err, map[string]any{"project_id": session.ProjectID})
+		}
+		if queued {
+			result.RefreshQueued = appendUnique(result.RefreshQueued, session.ProjectID)
+		}
+	}
+	return nil
+}
+
+// applyInstallation records installation on every organization bound to it,
+// either through git_organization_state or through a project whose
+// repository belongs to the installation account, and on those projects. It
+// returns the affected organizations.
+func (service *WebhookService) applyInstallation(ctx context.Context, installation *github.Installation, installed bool, result *GitWebhookResult) ([]string, error) {
+	installationID := installation.GetID()
+	account := installation.GetAccount().GetLogin()
+	now := service.now()
+	organizationStates, err := geckodb.ListGitOrganizationStatesByInstallationContext(ctx, service.db, installationID, account)
+	if err != nil {
+		return nil, WrapError(ErrorKindDatabase, http.StatusInternalServerError, "failed to load organizations for installation", err, map[string]any{"installation_id": installationID})
+	}
+	projectStates, err := geckodb.ListGitProjectStatesByOwnerOrInstallationContext(ctx, service.db, account, installationID)
+	if err != nil {
+		return nil, WrapError(ErrorKindDatabase, http.StatusInternalServerError, "failed to load projects for installation", err, map[string]any{"installation_id": installationID})
+	}
+
+	existing := make(map[string]geckodb.GitOrganizationState, len(organizationStates))
+	for _, state := range organizationStates {
+		existing[state.Organization] = state
+	}
+	organizations := make(map[string]struct{}, len(organizationStates))
+	for organization := range existing {
+		organizations[organization] = struct{}{}
+	}
+	for _, state := range projectStates {
+		if organization, _ := splitProjectID(state.ProjectID); organization != "" {
+			organizations[organization] = struct{}{}
+		}
+	}
+
+	for organization := range organizations {
+		orgState := existing[organization]
+		orgState.Organization = organization
+		orgState.UpdatedAt = now
+		orgState.LastSeenAt = sql.NullTime{Time: now, Valid: true}
+		orgState.Installed = installed
+		orgState.LastError = sql.NullString{}
+		if installed {
+			orgState.InstallationID = sql.NullInt64{Int64: installationID, Valid: true}
+			orgState.InstallationTarget = sql.NullString{String: account, Valid: account != ""}
+			orgState.InstallationTargetType = sql.NullString{String: installation.GetTargetType(), Valid: installation.GetTargetType() != ""}
+			orgState.HTMLURL = sql.NullString{String: installation.GetHTMLURL(), Valid: installation.GetHTMLURL() != ""}
+			orgState.RepositorySelection = sql.NullString{String: installation.GetRepositorySelection(), Valid: installation.GetRepositorySelection() != ""}
+			if !orgState.ConfiguredAt.Valid {
+				orgState.ConfiguredAt = sql.NullTime{Time: now, Valid: true}
+			}
+		} else {
+			orgState.InstallationID = sql.NullInt64{}
+			orgState.InstallationTarget = sql.NullString{}
+			orgState.InstallationTargetType = sql.NullString{}
+			orgState.HTMLURL = sql.NullString{}
+			orgState.RepositorySelection = sql.NullString{}
+			orgState.LastError = sql.NullString{String: fmt.Sprintf("GitHub App installation %d was %s", installationID, result.Action), Valid: true}
+		}
+		if err := geckodb.UpsertGitOrganizationState(service.db, orgState); err != nil {
+			return nil, WrapError(ErrorKindDatabase, http.StatusInternalServerError, "failed to persist git organization state", err, map[string]any{"organization": organization})
+		}
+		result.Organizations = append(result.Organizations, organization)
+	}
+	sort.Strings(result.Organizations)
+
+	for _, state := range projectStates {
+		if installed {
+			if !strings.EqualFold(state.RepoOwner, account) {
+				continue
+			}
+			applyInstalledState(&state, &installationID, account)
+			state.InstallationTargetType = sql.NullString{String: installation.GetTargetType(), Valid: installation.GetTargetType() != ""}
+		} else {
+			if !state.InstallationID.Valid || state.InstallationID.Int64 != installationID {
+				continue
+			}
+			clearInstalledState(&state)
+		}
+		if err := geckodb.UpdateGitProjectInstallationContext(ctx, service.db, state); err != nil {
+			return nil, WrapError(ErrorKindDatabase, http.StatusInternalServerError, "failed to persist git project state", err, map[string]any{"project_id": state.ProjectID})
+		}
+		result.Projects = appendUnique(result.Projects, state.ProjectID)
+	}
+	return result.Organizations, nil
+}
+
+// addPendingRepositories records repositories granted to the installation so
+// they can be offered when a project is connected. They are filed under the
+// first organization bound to the installation, or the GitHub account when
+// none is bound yet.
+func (service *WebhookService) addPendingRepositories(installation *github.Installation, organizations []string, repositories []*github.Repository, result *GitWebhookResult) error {
+	if len(repositories) == 0 {
+		return nil
+	}
+	organization := installation.GetAccount().GetLogin()
+	if len(organizations) > 0 {
+		organization = organizations[0]
+	}
+	host := webhookHost(installation.GetHTMLURL())
+	now := service.now()
+	for _, repo := range repositories {
+		owner, name := webhookRepositoryOwnerAndName(repo, installation)
+		pending := geckodb.GitPendingRepository{
+			ID:             fmt.Sprintf("webhook-%d-%d", installation.GetID(), repo.GetID()),
+			InstallationID: installation.GetID(),
+			Source:         "webhook",
+			Organization:   organization,
+			RepoID:         repo.GetID(),
+			RepoName:       name,
+			RepoFullName:   owner + "/" + name,
+			RepoHTMLURL:    sql.NullString{String: repo.GetHTMLURL(), Valid: repo.GetHTMLURL() != ""},
+			RepoCloneURL:   sql.NullString{String: repo.GetCloneURL(), Valid: repo.GetCloneURL() != ""},
+			RepoHost:       host,
+			RepoOwner:      owner,
+			RepoPath:       name,
+			AddedAt:        now,
+			UpdatedAt:      now,
+		}
+		if err := geckodb.UpsertGitPendingRepository(service.db, pending); err != nil {
+			return WrapError(ErrorKindDatabase, http.StatusInternalServerError, "failed to persist pending repository", err, map[string]any{"repository": pending.RepoFullName})
+		}
+		result.PendingAdded = append(result.PendingAdded, pending.RepoFullName)
+	}
+	return nil
+}
+
+func (service *WebhookService) removePendingRepositories(installation *github.Installation, repositories []*github.Repository, result *GitWebhookResult) error {
+	for _, repo := range repositories {
+		if err := geckodb.RemoveGitPendingRepository(service.db, installation.GetID(), repo.GetID()); err != nil {
+			return WrapError(ErrorKindDatabase, http.StatusInternalServerError, "failed to remove pending repository", err, map[string]any{"repository": repo.GetFullName()})
+		}
+		owner, name := webhookRepositoryOwnerAndName(repo, installation)
+		result.PendingRemoved = append(result.PendingRemoved, owner+"/"+name)
+	}
+	return nil
+}
+
+func webhookAction(event any) string {
+	if actioned, ok := event.(interface{ GetAction() string }); ok {
+		return actioned.GetAction()
+	}
+	return ""
+}
+
+// webhookHost returns the host of a GitHub html_url, defaulting to github.com.
+func webhookHost(htmlURL string) string {
+	parsed, err := url.Parse(htmlURL)
+	if err != nil || parsed.Host == "" {
+		return defaultGitHubHost
+	}
+	return strings.ToLower(parsed.Host)
+}
+
+// webhookRepositoryOwnerAndName splits a repository from an installation
+// payload, which carries full_name but not owner.
+func webhookRepositoryOwnerAndName(repo *github.Repository, installation *github.Installation) (string, string) {
+	if owner, name, ok := strings.Cut(repo.GetFullName(), "/"); ok {
+		return owner, name
+	}
+	if login := repo.GetOwner().GetLogin(); login != "" {
+		return login, repo.GetName()
+	}
+	return installation.GetAccount().GetLogin(), repo.GetName()
+}
+
+func appendUnique(values []string, value string) []string {
+	for _, existing := range values {
+		if existing == value {
+			return values
+		}
+	}
+	return append(values, value)
+}
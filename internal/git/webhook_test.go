@@ -0,0 +1,275 @@
+package git
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+)
+
+var webhookProjectStateColumns = []string{"project_id", "repo_host", "repo_owner", "repo_name", "installation_id", "installation_target_type", "installation_target", "mirror_path", "sync_state", "default_branch", "last_refreshed_at", "last_error"}
+
+type recordingRefreshTrigger struct {
+	projectIDs []string
+}
+
+func (trigger *recordingRefreshTrigger) Trigger(_ context.Context, projectID string) (bool, error) {
+	trigger.projectIDs = append(trigger.projectIDs, projectID)
+	return true, nil
+}
+
+func loadWebhookPayload(t *testing.T, name string) []byte {
+	t.Helper()
+	payload, err := os.ReadFile(filepath.Join("testdata", "webhooks", name))
+	if err != nil {
+		t.Fatalf("read recorded payload %s: %v", name, err)
+	}
+	return payload
+}
+
+func newWebhookTestService(t *testing.T, refresh ProjectRefreshTrigger) (*WebhookService, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("create sqlmock: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	service := NewWebhookService(sqlx.NewDb(db, "sqlmock"), refresh)
+	service.now = func() time.Time { return time.Date(2026, 3, 3, 16, 21, 0, 0, time.UTC) }
+	return service, mock
+}
+
+func TestVerifyGitHubWebhookSignature(t *testing.T) {
+	payload := loadWebhookPayload(t, "push.json")
+	mac := hmac.New(sha256.New, []byte("webhook-secret"))
+	mac.Write(payload)
+	signature := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	if err := VerifyGitHubWebhookSignature(signature, payload, "webhook-secret"); err != nil {
+		t.Fatalf("expected valid signature, got %v", err)
+	}
+	if err := VerifyGitHubWebhookSignature(signature, payload, "other-secret"); err == nil {
+		t.Fatal("expected signature with the wrong secret to be rejected")
+	}
+	if err := VerifyGitHubWebhookSignature("", payload, "webhook-secret"); err == nil {
+		t.Fatal("expected missing signature to be rejected")
+	}
+	if err := VerifyGitHubWebhookSignature(signature, payload, ""); err == nil {
+		t.Fatal("expected deliveries to be rejected when no secret is configured")
+	}
+}
+
+func TestHandleDeliveryPushQueuesRefreshForBackedProjects(t *testing.T) {
+	refresh := &recordingRefreshTrigger{}
+	service, mock := newWebhookTestService(t, refresh)
+	mock.ExpectExec(`INSERT INTO config_schema\.git_webhook_delivery`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`FROM config_schema\.git_project_state\s+WHERE lower\(repo_host\) = lower\(\$1\)`).
+		WithArgs("github.com", "calypr-data", "portal-data").
+		WillReturnRows(sqlmock.NewRows(webhookProjectStateColumns).
+			AddRow("calypr/demo", "github.com", "calypr-data", "portal-data", int64(2311213), "Organization", "calypr-data", "/data/github.com/calypr-data/portal-data.git", GitSyncReady, "main", nil, nil))
+	mock.ExpectExec(`UPDATE config_schema\.git_webhook_delivery`).
+		WithArgs("72d3162e-cc78-11e3-81ab-4c9367dc0958", "processed", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	result, err := service.HandleDelivery(context.Background(), "72d3162e-cc78-11e3-81ab-4c9367dc0958", "push", loadWebhookPayload(t, "push.json"))
+	if err != nil {
+		t.Fatalf("handle push: %v", err)
+	}
+	if len(refresh.projectIDs) != 1 || refresh.projectIDs[0] != "calypr/demo" {
+		t.Fatalf("expected refresh of calypr/demo, got %v", refresh.projectIDs)
+	}
+	if len(result.RefreshQueued) != 1 || result.Duplicate || result.Ignored {
+		t.Fatalf("unexpected result %+v", result)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHandleDeliveryPushToOtherBranchSkipsRefresh(t *testing.T) {
+	refresh := &recordingRefreshTrigger{}
+	service, mock := newWebhookTestService(t, refresh)
+	mock.ExpectExec(`INSERT INTO config_schema\.git_webhook_delivery`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`FROM config_schema\.git_project_state\s+WHERE lower\(repo_host\) = lower\(\$1\)`).
+		WithArgs("github.com", "calypr-data", "portal-data").
+		WillReturnRows(sqlmock.NewRows(webhookProjectStateColumns).
+			AddRow("calypr/demo", "github.com", "calypr-data", "portal-data", int64(2311213), "Organization", "calypr-data", "/data/github.com/calypr-data/portal-data.git", GitSyncReady, "release", nil, nil))
+	mock.ExpectExec(`UPDATE config_schema\.git_webhook_delivery`).
+		WithArgs("72d3162e-cc78-11e3-81ab-4c9367dc0958", "processed", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	result, err := service.HandleDelivery(context.Background(), "72d3162e-cc78-11e3-81ab-4c9367dc0958", "push", loadWebhookPayload(t, "push.json"))
+	if err != nil {
+		t.Fatalf("handle push: %v", err)
+	}
+	if len(refresh.projectIDs) != 0 || len(result.RefreshQueued) != 0 {
+		t.Fatalf("expected a push to main not to refresh a project tracking release, got %+v", result)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHandleDeliveryIgnoresUnhandledEvents(t *testing.T) {
+	service, mock := newWebhookTestService(t, &recordingRefreshTrigger{})
+
+	for _, event := range []string{"ping", "issues", "not_an_event"} {
+		result, err := service.HandleDelivery(context.Background(), "72d3162e-cc78-11e3-81ab-4c9367dc0958", event, []byte(`{"zen":"Keep it logically awesome."}`))
+		if err != nil {
+			t.Fatalf("handle %s: %v", event, err)
+		}
+		if !result.Ignored {
+			t.Fatalf("expected %s to be ignored, got %+v", event, result)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHandleDeliverySkipsDuplicateDeliveries(t *testing.T) {
+	refresh := &recordingRefreshTrigger{}
+	service, mock := newWebhookTestService(t, refresh)
+	mock.ExpectExec(`INSERT INTO config_schema\.git_webhook_delivery`).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	result, err := service.HandleDelivery(context.Background(), "72d3162e-cc78-11e3-81ab-4c9367dc0958", "push", loadWebhookPayload(t, "push.json"))
+	if err != nil {
+		t.Fatalf("handle duplicate push: %v", err)
+	}
+	if !result.Duplicate || len(refresh.projectIDs) != 0 {
+		t.Fatalf("expected duplicate delivery to be skipped, got %+v (refreshed %v)", result, refresh.projectIDs)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHandleDeliveryTakesOverStaleProcessingClaims(t *testing.T) {
+	refresh := &recordingRefreshTrigger{}
+	service, mock := newWebhookTestService(t, refresh)
+	now := service.now()
+	mock.ExpectExec(`INSERT INTO config_schema\.git_webhook_delivery[\s\S]+status = 'failed'\s+OR \(config_schema\.git_webhook_delivery\.status = 'processing' AND config_schema\.git_webhook_delivery\.received_at < \$6\)`).
+		WithArgs("72d3162e-cc78-11e3-81ab-4c9367dc0958", "push", sqlmock.AnyArg(), "processing", now, now.Add(-gitWebhookDeliveryClaimTimeout)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`FROM config_schema\.git_project_state\s+WHERE lower\(repo_host\) = lower\(\$1\)`).
+		WithArgs("github.com", "calypr-data", "portal-data").
+		WillReturnRows(sqlmock.NewRows(webhookProjectStateColumns).
+			AddRow("calypr/demo", "github.com", "calypr-data", "portal-data", int64(2311213), "Organization", "calypr-data", "/data/github.com/calypr-data/portal-data.git", GitSyncReady, "main", nil, nil))
+	mock.ExpectExec(`UPDATE config_schema\.git_webhook_delivery`).
+		WithArgs("72d3162e-cc78-11e3-81ab-4c9367dc0958", "processed", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	result, err := service.HandleDelivery(context.Background(), "72d3162e-cc78-11e3-81ab-4c9367dc0958", "push", loadWebhookPayload(t, "push.json"))
+	if err != nil {
+		t.Fatalf("handle redelivered push: %v", err)
+	}
+	if result.Duplicate || len(refresh.projectIDs) != 1 {
+		t.Fatalf("expected the stale claim to be taken over and applied, got %+v (refreshed %v)", result, refresh.projectIDs)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHandleDeliveryInstallationCreatedMarksOrganizationInstalled(t *testing.T) {
+	service, mock := newWebhookTestService(t, nil)
+	mock.ExpectExec(`INSERT INTO config_schema\.git_webhook_delivery`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`FROM config_schema\.git_organization_state\s+WHERE installation_id = \$1`).
+		WithArgs(int64(2311213), "calypr-data").
+		WillReturnRows(sqlmock.NewRows([]string{"organization", "installed", "installation_id", "installation_target_type", "installation_target", "html_url", "repository_selection", "configured_at", "last_seen_at", "updated_at", "last_error"}))
+	mock.ExpectQuery(`FROM config_schema\.git_project_state\s+WHERE lower\(repo_owner\) = lower\(\$1\) OR installation_id = \$2`).
+		WithArgs("calypr-data", int64(2311213)).
+		WillReturnRows(sqlmock.NewRows(webhookProjectStateColumns).
+			AddRow("calypr/demo", "github.com", "calypr-data", "portal-data", nil, nil, nil, "/data/github.com/calypr-data/portal-data.git", GitSyncNeverSynced, nil, nil, nil))
+	mock.ExpectExec(`INSERT INTO config_schema\.git_organization_state`).
+		WithArgs("calypr", true, int64(2311213), "Organization", "calypr-data", "https://github.com/organizations/calypr-data/settings/installations/2311213", "selected", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE config_schema\.git_project_state\s+SET installation_id`).
+		WithArgs(int64(2311213), "Organization", "calypr-data", "calypr/demo").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO config_schema\.git_pending_repository`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE config_schema\.git_webhook_delivery`).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	result, err := service.HandleDelivery(context.Background(), "delivery-installation", "installation", loadWebhookPayload(t, "installation_created.json"))
+	if err != nil {
+		t.Fatalf("handle installation: %v", err)
+	}
+	if len(result.Organizations) != 1 || result.Organizations[0] != "calypr" {
+		t.Fatalf("expected calypr to be marked installed, got %+v", result)
+	}
+	if len(result.PendingAdded) != 1 || result.PendingAdded[0] != "calypr-data/portal-data" {
+		t.Fatalf("expected portal-data to be pending, got %+v", result)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHandleDeliveryInstallationRepositoriesRemovedDisconnectsProject(t *testing.T) {
+	service, mock := newWebhookTestService(t, nil)
+	mock.ExpectExec(`INSERT INTO config_schema\.git_webhook_delivery`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`FROM config_schema\.git_organization_state`).
+		WillReturnRows(sqlmock.NewRows([]string{"organization", "installed", "installation_id", "installation_target_type", "installation_target", "html_url", "repository_selection", "configured_at", "last_seen_at", "updated_at", "last_error"}).
+			AddRow("calypr", true, int64(2311213), "Organization", "calypr-data", nil, "selected", time.Now(), time.Now(), time.Now(), nil))
+	mock.ExpectQuery(`FROM config_schema\.git_project_state\s+WHERE lower\(repo_owner\)`).
+		WillReturnRows(sqlmock.NewRows(webhookProjectStateColumns))
+	mock.ExpectExec(`INSERT INTO config_schema\.git_organization_state`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE config_schema\.git_pending_repository\s+SET removed_at`).
+		WithArgs(int64(2311213), int64(186853002)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`FROM config_schema\.git_project_state\s+WHERE lower\(repo_host\)`).
+		WithArgs("github.com", "calypr-data", "portal-data").
+		WillReturnRows(sqlmock.NewRows(webhookProjectStateColumns).
+			AddRow("calypr/demo", "github.com", "calypr-data", "portal-data", int64(2311213), "Organization", "calypr-data", "/data/github.com/calypr-data/portal-data.git", GitSyncReady, "main", nil, nil))
+	mock.ExpectExec(`UPDATE config_schema\.git_project_state\s+SET installation_id`).
+		WithArgs(nil, nil, nil, "calypr/demo").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE config_schema\.git_webhook_delivery`).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	result, err := service.HandleDelivery(context.Background(), "delivery-removed", "installation_repositories", loadWebhookPayload(t, "installation_repositories_removed.json"))
+	if err != nil {
+		t.Fatalf("handle installation_repositories: %v", err)
+	}
+	if len(result.Projects) != 1 || result.Projects[0] != "calypr/demo" || len(result.PendingRemoved) != 1 {
+		t.Fatalf("unexpected result %+v", result)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHandleDeliveryPullRequestTracksUploadSession(t *testing.T) {
+	refresh := &recordingRefreshTrigger{}
+	service, mock := newWebhookTestService(t, refresh)
+	mock.ExpectExec(`INSERT INTO config_schema\.git_webhook_delivery`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`FROM config_schema\.git_upload_session\s+WHERE`).
+		WithArgs("github.com", "calypr-data", "portal-data", "gecko-upload/demo-20260303").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "project_id", "organization", "project", "repo_host", "repo_owner", "repo_name", "base_branch", "target_subdirectory", "branch_name", "pr_title", "pr_body", "status", "pull_request_url", "pull_request_number", "pull_request_state", "pull_request_head_sha", "pull_request_mergeable", "pull_request_review_decision", "pull_request_checks", "pull_request_comments", "pull_request_merged_at", "pull_request_merge_commit_sha", "pull_request_checked_at", "gitattributes_added", "commit_mode", "base_sha", "finalize_step", "finalize_parent_sha", "finalize_tree_sha", "finalize_idempotency_key", "manifest_complete", "conflict_policy", "commit_sha", "last_error", "created_by_user_id", "expires_at", "created_at", "updated_at"}).
+			AddRow("session-1", "calypr/demo", "calypr", "demo", "github.com", "calypr-data", "portal-data", "main", nil, "gecko-upload/demo-20260303", "Upload 2 files to demo", "", GitUploadSessionFinalized, "https://github.com/calypr-data/portal-data/pull/42", nil, GitPullRequestOpen, nil, GitPullRequestMergeable, GitReviewApproved, GitChecksSuccess, nil, nil, nil, nil, nil, GitUploadCommitPullRequest, nil, nil, nil, nil, nil, true, GitUploadConflictFail, "c3a1d0f2", nil, "user@example.org", nil, time.Now(), time.Now()))
+	mock.ExpectExec(`UPDATE config_schema\.git_upload_session\s+SET pull_request_url`).
+		WithArgs("session-1", "https://github.com/calypr-data/portal-data/pull/42", int64(42), GitPullRequestMerged, "c3a1d0f2e4b6a8c0d2e4f6a8b0c2d4e6f8a0b2c4", nil, GitReviewApproved, GitChecksSuccess, nil,
+			sqlmock.AnyArg(), "9f1c4b7a2e0d3c5b8a6f4e2d1c0b9a8f7e6d5c4b", sqlmock.AnyArg(), sqlmock.AnyArg(), nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE config_schema\.git_webhook_delivery`).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	result, err := service.HandleDelivery(context.Background(), "delivery-pr", "pull_request", loadWebhookPayload(t, "pull_request_closed.json"))
+	if err != nil {
+		t.Fatalf("handle pull_request: %v", err)
+	}
+	if len(result.UploadSessions) != 1 || result.UploadSessions[0] != "session-1" {
+		t.Fatalf("expected session-1 to be tracked, got %+v", result)
+	}
+	if len(result.RefreshQueued) != 1 || len(refresh.projectIDs) != 1 || refresh.projectIDs[0] != "calypr/demo" {
+		t.Fatalf("expected the merge to queue a refresh of calypr/demo, got %+v (%v)", result, refresh.projectIDs)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
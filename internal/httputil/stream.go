@@ -0,0 +1,48 @@
+package httputil
+
+import (
+	"io"
+	"net"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// StreamWriteTimeout bounds how long one chunk of a streamed response body
+// may take to write. The router's WriteTimeout covers a whole response, which
+// a large file cannot meet, so SendStream moves the deadline forward before
+// every chunk instead.
+const StreamWriteTimeout = 10 * time.Second
+
+// SendStream sends body as the response like fiber's SendStream, extending
+// the connection's write deadline by StreamWriteTimeout before each chunk.
+// size is the length of body, or negative when it is unknown. body is closed
+// once it is sent when it implements io.Closer.
+func SendStream(ctx fiber.Ctx, body io.Reader, size int) error {
+	if conn := ctx.RequestCtx().Conn(); conn != nil {
+		body = &deadlineReader{reader: body, conn: conn}
+	}
+	if size < 0 {
+		return ctx.SendStream(body)
+	}
+	return ctx.SendStream(body, size)
+}
+
+// deadlineReader extends the write deadline of conn before every read, since
+// the server writes each chunk it reads before reading the next.
+type deadlineReader struct {
+	reader io.Reader
+	conn   net.Conn
+}
+
+func (reader *deadlineReader) Read(p []byte) (int, error) {
+	_ = reader.conn.SetWriteDeadline(time.Now().Add(StreamWriteTimeout))
+	return reader.reader.Read(p)
+}
+
+func (reader *deadlineReader) Close() error {
+	if closer, ok := reader.reader.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package fence
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/calypr/gecko/internal/git/domain"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// serviceTokenRefreshMargin is how long before expiry a cached service access
+// token is exchanged again.
+const serviceTokenRefreshMargin = 2 * time.Minute
+
+type fenceAccessTokenResponse struct {
+	AccessToken string `json:"access_token"`
+}
+
+// ServiceTokenSource exchanges a Fence API key for access tokens so background
+// work can call the GitHub broker without a user request. Tokens are cached
+// until shortly before they expire.
+type ServiceTokenSource struct {
+	client *Client
+	apiKey string
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+func NewServiceTokenSource(client *Client, apiKey string) *ServiceTokenSource {
+	return &ServiceTokenSource{client: client, apiKey: strings.TrimSpace(apiKey)}
+}
+
+// AuthorizationHeader returns a bearer authorization header for the service
+// identity.
+func (source *ServiceTokenSource) AuthorizationHeader(ctx context.Context) (string, error) {
+	if source == nil || source.client == nil || source.apiKey == "" {
+		return "", &domain.HTTPStatusError{
+			StatusCode: http.StatusUnauthorized,
+			Code:       "missing_authorization",
+			Message:    "no Fence API key is configured for background git work",
+		}
+	}
+	source.mu.Lock()
+	defer source.mu.Unlock()
+	if source.token != "" && time.Now().Add(serviceTokenRefreshMargin).Before(source.expires) {
+		return "Bearer " + source.token, nil
+	}
+	token, err := source.client.RequestAccessToken(ctx, source.apiKey)
+	if err != nil {
+		return "", err
+	}
+	source.token = token
+	source.expires = accessTokenExpiry(token)
+	return "Bearer " + token, nil
+}
+
+// RequestAccessToken exchanges a Fence API key for a short-lived access token.
+func (c *Client) RequestAccessToken(ctx context.Context, apiKey string) (string, error) {
+	if strings.TrimSpace(c.config.BaseURL) == "" {
+		return "", &domain.HTTPStatusError{
+			StatusCode: http.StatusBadGateway,
+			Code:       "integration_error",
+			Message:    "Fence base URL is not configured for access token requests",
+		}
+	}
+	requestBody, err := json.Marshal(map[string]string{"api_key": apiKey})
+	if err != nil {
+		return "", fmt.Errorf("marshal fence access token request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(c.config.BaseURL, "/")+"/credentials/api/access_token", bytes.NewReader(requestBody))
+	if err != nil {
+		return "", fmt.Errorf("build fence access token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", &domain.HTTPStatusError{
+			StatusCode: http.StatusBadGateway,
+			Code:       "integration_error",
+			Message:    fmt.Sprintf("Fence access token request failed: %s", err),
+		}
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("read fence access token response: %w", err)
+	}
+	if resp.StatusCode >= 400 {
+		message := decodeFenceErrorResponse(body)
+		if message == "" {
+			message = fmt.Sprintf("Fence access token request failed with status %d", resp.StatusCode)
+		}
+		return "", &domain.HTTPStatusError{
+			StatusCode: http.StatusBadGateway,
+			Code:       "integration_error",
+			Message:    message,
+		}
+	}
+	var payload fenceAccessTokenResponse
+	if err := json.Unmarshal(body, &payload); err != nil || strings.TrimSpace(payload.AccessToken) == "" {
+		return "", &domain.HTTPStatusError{
+			StatusCode: http.StatusBadGateway,
+			Code:       "integration_error",
+			Message:    "Fence access token response did not include access_token",
+		}
+	}
+	return strings.TrimSpace(payload.AccessToken), nil
+}
+
+// accessTokenExpiry reads exp from the token without verifying it; Fence
+// verifies the token on use. Tokens without exp are cached for five minutes.
+func accessTokenExpiry(token string) time.Time {
+	fallback := time.Now().Add(5 * time.Minute)
+	claims := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser(jwt.WithoutClaimsValidation()).ParseUnverified(token, claims); err != nil {
+		return fallback
+	}
+	expiresAt, err := claims.GetExpirationTime()
+	if err != nil || expiresAt == nil {
+		return fallback
+	}
+	return expiresAt.Time
+}
@@ -0,0 +1,153 @@
+package gecko
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/calypr/gecko/internal/git/domain"
+)
+
+// Peer is another gecko deployment configs can be promoted from.
+type Peer struct {
+	Name    string `json:"name"`
+	BaseURL string `json:"base_url"`
+	Token   string `json:"token,omitempty"`
+}
+
+type Client struct {
+	client *http.Client
+	peer   Peer
+}
+
+func NewClient(client *http.Client, peer Peer) *Client {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &Client{client: client, peer: peer}
+}
+
+func (c *Client) Peer() Peer {
+	return c.peer
+}
+
+// ListConfigIDs returns the config IDs the peer stores for configType.
+func (c *Client) ListConfigIDs(ctx context.Context, configType string) ([]string, error) {
+	var ids []string
+	if err := c.get(ctx, "/config/"+url.PathEscape(configType)+"/list", &ids); err != nil {
+		return nil, err
+	}
+	if ids == nil {
+		ids = []string{}
+	}
+	return ids, nil
+}
+
+// GetConfig returns the peer's document for configType and configID as served
+// by its config API.
+func (c *Client) GetConfig(ctx context.Context, configType string, configID string) (json.RawMessage, error) {
+	var content json.RawMessage
+	if err := c.get(ctx, "/config/"+url.PathEscape(configType)+"/"+url.PathEscape(configID), &content); err != nil {
+		return nil, err
+	}
+	return content, nil
+}
+
+func (c *Client) get(ctx context.Context, path string, responsePayload any) error {
+	baseURL := strings.TrimRight(strings.TrimSpace(c.peer.BaseURL), "/")
+	if baseURL == "" {
+		return &domain.HTTPStatusError{
+			StatusCode: http.StatusBadGateway,
+			Code:       "integration_error",
+			Message:    fmt.Sprintf("base URL is not configured for peer %s", c.peer.Name),
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+path, nil)
+	if err != nil {
+		return fmt.Errorf("build peer %s request: %w", c.peer.Name, err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if token := strings.TrimSpace(c.peer.Token); token != "" {
+		req.Header.Set("Authorization", "Bearer "+strings.TrimPrefix(token, "Bearer "))
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return &domain.HTTPStatusError{
+			StatusCode: http.StatusBadGateway,
+			Code:       "integration_error",
+			Message:    fmt.Sprintf("peer %s request failed: %s", c.peer.Name, err),
+		}
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("read peer %s response: %w", c.peer.Name, err)
+	}
+	if resp.StatusCode >= 400 {
+		code := "integration_error"
+		statusCode := http.StatusBadGateway
+		switch resp.StatusCode {
+		case http.StatusNotFound:
+			code = "not_found"
+			statusCode = http.StatusNotFound
+		case http.StatusUnauthorized, http.StatusForbidden:
+			code = "forbidden"
+		}
+		return &domain.HTTPStatusError{
+			StatusCode: statusCode,
+			Code:       code,
+			Message:    fmt.Sprintf("peer %s %s returned status %d: %s", c.peer.Name, path, resp.StatusCode, decodePeerErrorResponse(body)),
+		}
+	}
+	if err := json.Unmarshal(body, responsePayload); err != nil {
+		return &domain.HTTPStatusError{
+			StatusCode: http.StatusBadGateway,
+			Code:       "integration_error",
+			Message:    fmt.Sprintf("invalid response from peer %s %s: %s", c.peer.Name, path, err),
+		}
+	}
+	return nil
+}
+
+func decodePeerErrorResponse(body []byte) string {
+	var payload struct {
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(body, &payload); err == nil && strings.TrimSpace(payload.Error.Message) != "" {
+		return strings.TrimSpace(payload.Error.Message)
+	}
+	return strings.TrimSpace(string(body))
+}
+
+// ParsePeers decodes the promotion peer list, a JSON array of peers.
+func ParsePeers(raw string) ([]Peer, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil, nil
+	}
+	var peers []Peer
+	if err := json.Unmarshal([]byte(raw), &peers); err != nil {
+		return nil, fmt.Errorf("parse promotion peers: %w", err)
+	}
+	seen := map[string]bool{}
+	for i := range peers {
+		peers[i].Name = strings.TrimSpace(peers[i].Name)
+		peers[i].BaseURL = strings.TrimSpace(peers[i].BaseURL)
+		if peers[i].Name == "" || peers[i].BaseURL == "" {
+			return nil, fmt.Errorf("promotion peer %d needs a name and base_url", i)
+		}
+		if seen[peers[i].Name] {
+			return nil, fmt.Errorf("promotion peer %s is declared more than once", peers[i].Name)
+		}
+		seen[peers[i].Name] = true
+	}
+	return peers, nil
+}
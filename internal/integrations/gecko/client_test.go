@@ -0,0 +1,85 @@
+package gecko
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/calypr/gecko/internal/git/domain"
+)
+
+func newFakePeer(t *testing.T) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.Header.Get("Authorization") != "Bearer peer-token" {
+			writer.WriteHeader(http.StatusUnauthorized)
+			_, _ = writer.Write([]byte(`{"error":{"type":"missing_authorization","message":"Authorization token not provided","code":401}}`))
+			return
+		}
+		writer.Header().Set("Content-Type", "application/json")
+		switch request.URL.Path {
+		case "/config/nav/list":
+			_ = json.NewEncoder(writer).Encode([]string{"default"})
+		case "/config/nav/default":
+			_, _ = writer.Write([]byte(`{"headerProps":{"leftnav":[]}}`))
+		default:
+			writer.WriteHeader(http.StatusNotFound)
+			_, _ = writer.Write([]byte(`{"error":{"type":"config_not_found","message":"no config found","code":404}}`))
+		}
+	}))
+}
+
+func TestClientFetchesPeerConfigs(t *testing.T) {
+	server := newFakePeer(t)
+	defer server.Close()
+
+	client := NewClient(server.Client(), Peer{Name: "staging", BaseURL: server.URL + "/", Token: "peer-token"})
+	ids, err := client.ListConfigIDs(context.Background(), "nav")
+	if err != nil {
+		t.Fatalf("list config ids: %v", err)
+	}
+	if len(ids) != 1 || ids[0] != "default" {
+		t.Fatalf("unexpected ids: %v", ids)
+	}
+	content, err := client.GetConfig(context.Background(), "nav", "default")
+	if err != nil {
+		t.Fatalf("get config: %v", err)
+	}
+	if string(content) != `{"headerProps":{"leftnav":[]}}` {
+		t.Fatalf("unexpected content: %s", content)
+	}
+}
+
+func TestClientMapsPeerErrors(t *testing.T) {
+	server := newFakePeer(t)
+	defer server.Close()
+
+	client := NewClient(server.Client(), Peer{Name: "staging", BaseURL: server.URL, Token: "peer-token"})
+	_, err := client.GetConfig(context.Background(), "nav", "missing")
+	var statusErr *domain.HTTPStatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusNotFound || statusErr.Code != "not_found" {
+		t.Fatalf("expected not_found status error, got %v", err)
+	}
+
+	unauthenticated := NewClient(server.Client(), Peer{Name: "staging", BaseURL: server.URL})
+	_, err = unauthenticated.ListConfigIDs(context.Background(), "nav")
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusBadGateway || statusErr.Code != "forbidden" {
+		t.Fatalf("expected forbidden peer error, got %v", err)
+	}
+}
+
+func TestParsePeers(t *testing.T) {
+	peers, err := ParsePeers(`[{"name":"dev","base_url":"http://localhost:8081","token":"t"}]`)
+	if err != nil || len(peers) != 1 || peers[0].Name != "dev" {
+		t.Fatalf("unexpected peers %+v (%v)", peers, err)
+	}
+	if _, err := ParsePeers(`[{"name":"dev","base_url":"a"},{"name":"dev","base_url":"b"}]`); err == nil {
+		t.Fatal("expected duplicate peer names to be rejected")
+	}
+	if peers, err := ParsePeers(""); err != nil || peers != nil {
+		t.Fatalf("expected no peers for empty input, got %+v (%v)", peers, err)
+	}
+}
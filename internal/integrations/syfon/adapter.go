@@ -31,6 +31,11 @@ func NewManager(baseURL string, client *http.Client) *Manager {
 	}
 }
 
+// Configured reports whether manager has a syfon base URL to call.
+func (manager *Manager) Configured() bool {
+	return manager != nil && manager.baseURL != ""
+}
+
 func (manager *Manager) ListBuckets(ctx context.Context, authorizationHeader string) (map[string]domain.StorageBucket, error) {
 	service, err := manager.bucketsService(authorizationHeader)
 	if err != nil {
@@ -0,0 +1,210 @@
+package syfon
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/calypr/gecko/internal/git/domain"
+)
+
+type indexRecordList struct {
+	Records []struct {
+		DID string `json:"did"`
+	} `json:"records"`
+}
+
+type indexRecord struct {
+	DID    string            `json:"did"`
+	Size   int64             `json:"size"`
+	Hashes map[string]string `json:"hashes"`
+	Authz  []string          `json:"authz"`
+}
+
+type drsObject struct {
+	ID            string `json:"id"`
+	AccessMethods []struct {
+		Type      string `json:"type"`
+		AccessID  string `json:"access_id"`
+		AccessURL *struct {
+			URL     string   `json:"url"`
+			Headers []string `json:"headers"`
+		} `json:"access_url"`
+	} `json:"access_methods"`
+}
+
+type drsAccessURL struct {
+	URL     string   `json:"url"`
+	Headers []string `json:"headers"`
+}
+
+// LookupObjectIDByChecksum returns the ID of a DRS object whose sha256
+// checksum is oid, or "" when syfon has none.
+func (manager *Manager) LookupObjectIDByChecksum(ctx context.Context, authorizationHeader string, oid string) (string, error) {
+	clientBaseURL, err := manager.clientBaseURL()
+	if err != nil {
+		return "", err
+	}
+	query := url.Values{"hash": {"sha256:" + strings.ToLower(strings.TrimSpace(oid))}}
+	var records indexRecordList
+	found, err := manager.getJSON(ctx, authorizationHeader, clientBaseURL+"/index?"+query.Encode(), &records)
+	if err != nil {
+		return "", fmt.Errorf("request syfon object lookup: %w", err)
+	}
+	if !found || len(records.Records) == 0 {
+		return "", nil
+	}
+	return records.Records[0].DID, nil
+}
+
+// ObjectRecord returns the index record of objectID, or nil when syfon has
+// no such object.
+func (manager *Manager) ObjectRecord(ctx context.Context, authorizationHeader string, objectID string) (*domain.DRSObjectRecord, error) {
+	clientBaseURL, err := manager.clientBaseURL()
+	if err != nil {
+		return nil, err
+	}
+	var record indexRecord
+	found, err := manager.getJSON(ctx, authorizationHeader, clientBaseURL+"/index/"+url.PathEscape(strings.TrimSpace(objectID)), &record)
+	if err != nil {
+		return nil, fmt.Errorf("request syfon object record: %w", err)
+	}
+	if !found {
+		return nil, nil
+	}
+	result := &domain.DRSObjectRecord{ID: record.DID, Size: record.Size, Authz: record.Authz}
+	for name, value := range record.Hashes {
+		if strings.EqualFold(name, "sha256") {
+			result.SHA256 = strings.ToLower(strings.TrimSpace(value))
+		}
+	}
+	return result, nil
+}
+
+// SignedAccessURL asks syfon for a signed URL to the bytes of objectID,
+// following the DRS access method flow. It returns nil when the object does
+// not exist.
+func (manager *Manager) SignedAccessURL(ctx context.Context, authorizationHeader string, objectID string) (*domain.DRSAccessURL, error) {
+	clientBaseURL, err := manager.clientBaseURL()
+	if err != nil {
+		return nil, err
+	}
+	objectURL := clientBaseURL + "/ga4gh/drs/v1/objects/" + url.PathEscape(strings.TrimSpace(objectID))
+	var object drsObject
+	found, err := manager.getJSON(ctx, authorizationHeader, objectURL, &object)
+	if err != nil {
+		return nil, fmt.Errorf("request syfon DRS object: %w", err)
+	}
+	if !found {
+		return nil, nil
+	}
+	for _, method := range object.AccessMethods {
+		if method.AccessURL != nil && strings.TrimSpace(method.AccessURL.URL) != "" {
+			return &domain.DRSAccessURL{URL: method.AccessURL.URL, Headers: drsHeaders(method.AccessURL.Headers)}, nil
+		}
+	}
+	for _, method := range object.AccessMethods {
+		if strings.TrimSpace(method.AccessID) == "" {
+			continue
+		}
+		var access drsAccessURL
+		found, err := manager.getJSON(ctx, authorizationHeader, objectURL+"/access/"+url.PathEscape(method.AccessID), &access)
+		if err != nil {
+			return nil, fmt.Errorf("request syfon DRS access URL: %w", err)
+		}
+		if found && strings.TrimSpace(access.URL) != "" {
+			return &domain.DRSAccessURL{URL: access.URL, Headers: drsHeaders(access.Headers)}, nil
+		}
+	}
+	return nil, fmt.Errorf("DRS object %s has no usable access method", objectID)
+}
+
+// DeleteObject removes the index record of objectID and the bytes syfon
+// stored for it. An object that is already gone is not an error.
+func (manager *Manager) DeleteObject(ctx context.Context, authorizationHeader string, objectID string) error {
+	clientBaseURL, err := manager.clientBaseURL()
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, clientBaseURL+"/index/"+url.PathEscape(strings.TrimSpace(objectID)), nil)
+	if err != nil {
+		return fmt.Errorf("build syfon object delete request: %w", err)
+	}
+	req.Header.Set("Authorization", authorizationHeader)
+	resp, err := manager.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request syfon object delete: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("syfon object delete failed with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// getJSON decodes the response of a GET into target. It reports false, and no
+// error, for a 404.
+func (manager *Manager) getJSON(ctx context.Context, authorizationHeader string, requestURL string, target any) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, requestURL, nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Authorization", authorizationHeader)
+	req.Header.Set("Accept", "application/json")
+	resp, err := manager.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		return false, &ResponseError{StatusCode: resp.StatusCode}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(target); err != nil {
+		return false, &ResponseError{StatusCode: resp.StatusCode, Err: err}
+	}
+	return true, nil
+}
+
+// ResponseError is a syfon answer gecko could not use: an error status, or
+// a body that did not decode. Failures to reach syfon at all are not
+// ResponseErrors.
+type ResponseError struct {
+	StatusCode int
+	Err        error
+}
+
+func (err *ResponseError) Error() string {
+	if err.Err != nil {
+		return fmt.Sprintf("decode syfon response: %s", err.Err)
+	}
+	return fmt.Sprintf("syfon responded with status %d", err.StatusCode)
+}
+
+func (err *ResponseError) Unwrap() error {
+	return err.Err
+}
+
+// drsHeaders converts DRS "Name: value" header strings to a map.
+func drsHeaders(headers []string) map[string]string {
+	if len(headers) == 0 {
+		return nil
+	}
+	parsed := make(map[string]string, len(headers))
+	for _, header := range headers {
+		name, value, ok := strings.Cut(header, ":")
+		if !ok {
+			continue
+		}
+		parsed[strings.TrimSpace(name)] = strings.TrimSpace(value)
+	}
+	return parsed
+}
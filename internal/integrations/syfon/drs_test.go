@@ -0,0 +1,105 @@
+package syfon
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newFakeDRS(t *testing.T) *httptest.Server {
+	t.Helper()
+	oid := strings.Repeat("a", 64)
+	return httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.Header.Get("Authorization") != "Bearer user-token" {
+			writer.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		writer.Header().Set("Content-Type", "application/json")
+		switch {
+		case request.Method == http.MethodDelete && request.URL.Path == "/index/drs-1":
+			writer.WriteHeader(http.StatusNoContent)
+		case request.Method == http.MethodDelete && request.URL.Path == "/index/drs-locked":
+			writer.WriteHeader(http.StatusForbidden)
+		case request.Method == http.MethodGet && request.URL.Path == "/index/drs-1":
+			_ = json.NewEncoder(writer).Encode(map[string]any{"did": "drs-1", "size": 1024, "hashes": map[string]string{"sha256": strings.ToUpper(oid)}, "authz": []string{"/programs/calypr/projects/demo"}})
+		case request.URL.Path == "/index" && request.URL.Query().Get("hash") == "sha256:"+oid:
+			_ = json.NewEncoder(writer).Encode(map[string]any{"records": []map[string]any{{"did": "drs-1"}}})
+		case request.URL.Path == "/index":
+			_ = json.NewEncoder(writer).Encode(map[string]any{"records": []map[string]any{}})
+		case request.URL.Path == "/ga4gh/drs/v1/objects/drs-1":
+			_, _ = writer.Write([]byte(`{"id":"drs-1","access_methods":[{"type":"s3","access_id":"s3"}]}`))
+		case request.URL.Path == "/ga4gh/drs/v1/objects/drs-1/access/s3":
+			_, _ = writer.Write([]byte(`{"url":"https://bucket.example.org/drs-1?sig=abc","headers":["X-Amz-Request-Payer: requester"]}`))
+		default:
+			writer.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestManagerResolvesLFSObjectToSignedURL(t *testing.T) {
+	server := newFakeDRS(t)
+	defer server.Close()
+	manager := NewManager(server.URL+"/data", server.Client())
+	ctx := context.Background()
+
+	objectID, err := manager.LookupObjectIDByChecksum(ctx, "Bearer user-token", strings.Repeat("A", 64))
+	if err != nil || objectID != "drs-1" {
+		t.Fatalf("expected drs-1, got %q (%v)", objectID, err)
+	}
+	missing, err := manager.LookupObjectIDByChecksum(ctx, "Bearer user-token", strings.Repeat("b", 64))
+	if err != nil || missing != "" {
+		t.Fatalf("expected no object, got %q (%v)", missing, err)
+	}
+
+	access, err := manager.SignedAccessURL(ctx, "Bearer user-token", "drs-1")
+	if err != nil {
+		t.Fatalf("signed URL: %v", err)
+	}
+	if access.URL != "https://bucket.example.org/drs-1?sig=abc" || access.Headers["X-Amz-Request-Payer"] != "requester" {
+		t.Fatalf("unexpected access URL: %+v", access)
+	}
+	if access, err := manager.SignedAccessURL(ctx, "Bearer user-token", "drs-2"); err != nil || access != nil {
+		t.Fatalf("expected a missing object to return nil, got %+v (%v)", access, err)
+	}
+	if _, err := manager.SignedAccessURL(ctx, "Bearer other-token", "drs-1"); err == nil {
+		t.Fatal("expected an unauthorized request to fail")
+	}
+}
+
+func TestManagerDeletesObject(t *testing.T) {
+	server := newFakeDRS(t)
+	defer server.Close()
+	manager := NewManager(server.URL+"/data", server.Client())
+	ctx := context.Background()
+
+	if err := manager.DeleteObject(ctx, "Bearer user-token", "drs-1"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if err := manager.DeleteObject(ctx, "Bearer user-token", "drs-gone"); err != nil {
+		t.Fatalf("expected deleting a missing object to succeed, got %v", err)
+	}
+	if err := manager.DeleteObject(ctx, "Bearer user-token", "drs-locked"); err == nil {
+		t.Fatal("expected a refused delete to fail")
+	}
+}
+
+func TestManagerReadsObjectRecord(t *testing.T) {
+	server := newFakeDRS(t)
+	defer server.Close()
+	manager := NewManager(server.URL+"/data", server.Client())
+	ctx := context.Background()
+
+	record, err := manager.ObjectRecord(ctx, "Bearer user-token", "drs-1")
+	if err != nil {
+		t.Fatalf("object record: %v", err)
+	}
+	if record == nil || record.Size != 1024 || record.SHA256 != strings.Repeat("a", 64) || len(record.Authz) != 1 || record.Authz[0] != "/programs/calypr/projects/demo" {
+		t.Fatalf("unexpected object record: %+v", record)
+	}
+	if record, err := manager.ObjectRecord(ctx, "Bearer user-token", "drs-2"); err != nil || record != nil {
+		t.Fatalf("expected a missing object to return nil, got %+v (%v)", record, err)
+	}
+}
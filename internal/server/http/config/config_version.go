@@ -0,0 +1,91 @@
+package config
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/calypr/gecko/apierror"
+	"github.com/calypr/gecko/config"
+	geckodb "github.com/calypr/gecko/internal/db"
+	"github.com/calypr/gecko/internal/httputil"
+	"github.com/gofiber/fiber/v3"
+)
+
+// handleConfigVersionsGET godoc
+// @Summary Report stored config schema versions
+// @Description Report how many stored documents of each config type are at each schema version and list the ones behind the current version.
+// @Tags Config
+// @Produce json
+// @Param type query string false "Restrict the report to one configuration type"
+// @Success 200 {array} geckodb.ConfigVersionSummary "Schema version report"
+// @Failure 400 {object} ErrorResponse "Invalid config type"
+// @Failure 500 {object} ErrorResponse "Server error"
+// @Router /config/versions [get]
+func (handler *Handler) handleConfigVersionsGET(ctx fiber.Ctx) error {
+	configTypes, errResponse := configVersionTypes(ctx)
+	if errResponse != nil {
+		errResponse.WriteLog(handler.logger)
+		return errResponse.Write(ctx)
+	}
+	report, err := geckodb.ConfigVersionReportContext(ctx.Context(), handler.db, configTypes...)
+	if err != nil {
+		errResponse = httputil.NewError(apierror.TypeDatabaseError, fmt.Sprintf("config version report failed: %s", err), http.StatusInternalServerError, map[string]any{"config_types": configTypes}, nil)
+		errResponse.WriteLog(handler.logger)
+		return errResponse.Write(ctx)
+	}
+	if report == nil {
+		report = []geckodb.ConfigVersionSummary{}
+	}
+	return httputil.JSON(report, http.StatusOK).Write(ctx)
+}
+
+// handleConfigVersionsUpgradePOST godoc
+// @Summary Rewrite stored configs at the current schema version
+// @Description Run the registered upgraders over every outdated document and store the result. Documents that fail to upgrade, or that are written by someone else during the upgrade, are reported and left unchanged.
+// @Tags Config
+// @Produce json
+// @Param type query string false "Restrict the rewrite to one configuration type"
+// @Success 200 {array} geckodb.ConfigUpgradeResult "Upgrade results"
+// @Failure 400 {object} ErrorResponse "Invalid config type"
+// @Failure 500 {object} ErrorResponse "Server error"
+// @Router /config/versions/upgrade [post]
+func (handler *Handler) handleConfigVersionsUpgradePOST(ctx fiber.Ctx) error {
+	configTypes, errResponse := configVersionTypes(ctx)
+	if errResponse != nil {
+		errResponse.WriteLog(handler.logger)
+		return errResponse.Write(ctx)
+	}
+	results, err := geckodb.UpgradeStoredConfigsContext(ctx.Context(), handler.db, configTypes...)
+	if err != nil {
+		errResponse = httputil.NewError(apierror.TypeDatabaseError, fmt.Sprintf("config upgrade failed: %s", err), http.StatusInternalServerError, map[string]any{"config_types": configTypes}, nil)
+		errResponse.WriteLog(handler.logger)
+		return errResponse.Write(ctx)
+	}
+	if results == nil {
+		results = []geckodb.ConfigUpgradeResult{}
+	}
+	for _, result := range results {
+		if len(result.Upgraded) > 0 {
+			handler.logger.Info("Upgraded %d %s config documents to schema version %d", len(result.Upgraded), result.ConfigType, config.CurrentSchemaVersion(config.Type(result.ConfigType)))
+		}
+		for _, name := range result.Changed {
+			handler.logger.Warning("Skipped upgrading %s config %s: it changed during the upgrade", result.ConfigType, name)
+		}
+		for name, failure := range result.Failed {
+			handler.logger.Warning("Failed to upgrade %s config %s: %s", result.ConfigType, name, failure)
+		}
+	}
+	return httputil.JSON(results, http.StatusOK).Write(ctx)
+}
+
+func configVersionTypes(ctx fiber.Ctx) ([]string, *httputil.ErrorResponse) {
+	configType := strings.TrimSpace(ctx.Query("type"))
+	if configType == "" {
+		return config.KnownTypes(), nil
+	}
+	if !isKnownType(configType) {
+		return nil, httputil.NewError(apierror.TypeInvalidConfigType, fmt.Sprintf("Unknown config type: %s", configType), http.StatusBadRequest, map[string]any{"config_type": configType}, nil)
+	}
+	return []string{configType}, nil
+}
@@ -12,6 +12,7 @@ import (
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/calypr/gecko/config"
+	geckodb "github.com/calypr/gecko/internal/db"
 	geckologging "github.com/calypr/gecko/internal/logging"
 	"github.com/calypr/gecko/internal/server/http/shared"
 	servermw "github.com/calypr/gecko/internal/server/middleware"
@@ -122,8 +123,13 @@ func TestProjectConfigPUT_ByOrganizationAndProject(t *testing.T) {
 		t.Fatalf("failed to marshal project fixture: %v", err)
 	}
 
+	storedContent, err := config.StampSchemaVersion(config.TypeProjects, content)
+	if err != nil {
+		t.Fatalf("failed to stamp project fixture: %v", err)
+	}
+
 	mock.ExpectExec(`INSERT INTO config_schema\.projects`).
-		WithArgs("HTAN_INT/BForePC", content).
+		WithArgs("HTAN_INT/BForePC", storedContent).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
 	app := fiber.New()
@@ -142,3 +148,36 @@ func TestProjectConfigPUT_ByOrganizationAndProject(t *testing.T) {
 		t.Fatalf("unmet sql expectations: %v", err)
 	}
 }
+
+func TestConfigVersionsUpgradePOST_ReportsDocumentsChangedDuringUpgrade(t *testing.T) {
+	srv, mock, cleanup := newProjectConfigTestServer(t)
+	defer cleanup()
+
+	mock.ExpectQuery(`SELECT name, content FROM config_schema\.nav ORDER BY name`).
+		WillReturnRows(sqlmock.NewRows([]string{"name", "content"}).AddRow("default", []byte(`{}`)).AddRow("edited", []byte(`{}`)))
+	mock.ExpectExec(`UPDATE config_schema\.nav SET content`).
+		WithArgs("default", sqlmock.AnyArg(), `{}`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE config_schema\.nav SET content`).
+		WithArgs("edited", sqlmock.AnyArg(), `{}`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	app := fiber.New()
+	app.Post("/config/versions/upgrade", srv.handleConfigVersionsUpgradePOST)
+	resp := runProjectConfigRequest(t, app, httptest.NewRequest(http.MethodPost, "/config/versions/upgrade?type=nav", nil))
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.StatusCode)
+	}
+	var results []geckodb.ConfigUpgradeResult
+	if err := json.NewDecoder(resp.Body).Decode(&results); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if len(results) != 1 || len(results[0].Upgraded) != 1 || results[0].Upgraded[0] != "default" || len(results[0].Changed) != 1 || results[0].Changed[0] != "edited" {
+		t.Fatalf("expected default upgraded and edited reported as changed, got %+v", results)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet sql expectations: %v", err)
+	}
+}
@@ -0,0 +1,492 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/calypr/gecko/apierror"
+	"github.com/calypr/gecko/config"
+	geckodb "github.com/calypr/gecko/internal/db"
+	"github.com/calypr/gecko/internal/git/domain"
+	"github.com/calypr/gecko/internal/httputil"
+	integrationgecko "github.com/calypr/gecko/internal/integrations/gecko"
+	"github.com/gofiber/fiber/v3"
+)
+
+const (
+	PromotionStatusAdded        = "added"
+	PromotionStatusChanged      = "changed"
+	PromotionStatusUnchanged    = "unchanged"
+	PromotionStatusLocalOnly    = "local_only"
+	PromotionStatusIncompatible = "incompatible"
+)
+
+// promotableTypes are the config types shared verbatim between environments.
+// Project configs are environment specific and never promoted.
+var promotableTypes = []string{
+	string(config.TypeExplorer),
+	string(config.TypeNav),
+	string(config.TypeFileSummary),
+}
+
+type PromotionPeerResponse struct {
+	Name    string `json:"name"`
+	BaseURL string `json:"base_url"`
+}
+
+type PromotionRecordResponse struct {
+	SourceEnvironment string    `json:"source_environment"`
+	SourceURL         string    `json:"source_url"`
+	SourceRevision    string    `json:"source_revision"`
+	PreviousRevision  string    `json:"previous_revision,omitempty"`
+	PromotedBy        string    `json:"promoted_by,omitempty"`
+	PromotedAt        time.Time `json:"promoted_at"`
+}
+
+type PromotionDiffEntry struct {
+	ConfigType     string                   `json:"config_type"`
+	ConfigID       string                   `json:"config_id"`
+	Status         string                   `json:"status"`
+	SourceRevision string                   `json:"source_revision,omitempty"`
+	LocalRevision  string                   `json:"local_revision,omitempty"`
+	ChangedFields  []string                 `json:"changed_fields,omitempty"`
+	Error          string                   `json:"error,omitempty"`
+	LastPromotion  *PromotionRecordResponse `json:"last_promotion,omitempty"`
+	Source         json.RawMessage          `json:"source,omitempty"`
+	Local          json.RawMessage          `json:"local,omitempty"`
+}
+
+type PromotionDiffResponse struct {
+	Peer      string               `json:"peer"`
+	SourceURL string               `json:"source_url"`
+	Documents []PromotionDiffEntry `json:"documents"`
+}
+
+type PromotionApplyDocument struct {
+	ConfigType     string `json:"config_type"`
+	ConfigID       string `json:"config_id"`
+	SourceRevision string `json:"source_revision,omitempty"`
+}
+
+type PromotionApplyRequest struct {
+	Documents []PromotionApplyDocument `json:"documents"`
+}
+
+type PromotionApplyResult struct {
+	ConfigType       string `json:"config_type"`
+	ConfigID         string `json:"config_id"`
+	Applied          bool   `json:"applied"`
+	SourceRevision   string `json:"source_revision,omitempty"`
+	PreviousRevision string `json:"previous_revision,omitempty"`
+	Error            string `json:"error,omitempty"`
+}
+
+type PromotionApplyResponse struct {
+	Peer      string                 `json:"peer"`
+	SourceURL string                 `json:"source_url"`
+	Documents []PromotionApplyResult `json:"documents"`
+}
+
+// handlePromotionPeersGET godoc
+// @Summary List promotion peers
+// @Description List the peer gecko environments configs can be promoted from.
+// @Tags Config
+// @Produce json
+// @Success 200 {array} PromotionPeerResponse "Configured peers"
+// @Router /config/promotion/peers [get]
+func (handler *Handler) handlePromotionPeersGET(ctx fiber.Ctx) error {
+	peers := make([]PromotionPeerResponse, 0, len(handler.PromotionPeers))
+	for _, peer := range handler.PromotionPeers {
+		peers = append(peers, PromotionPeerResponse{Name: peer.Name, BaseURL: peer.BaseURL})
+	}
+	return httputil.JSON(peers, http.StatusOK).Write(ctx)
+}
+
+// handlePromotionDiffGET godoc
+// @Summary Diff a peer environment's configs against local
+// @Description Fetch explorer, nav and file_summary configs from a peer gecko and compare them with the local documents.
+// @Tags Config
+// @Produce json
+// @Param peer path string true "Peer name"
+// @Param type query string false "Restrict the diff to one configuration type"
+// @Param include_content query bool false "Include source and local documents in the response"
+// @Success 200 {object} PromotionDiffResponse "Per-document diff"
+// @Failure 400 {object} ErrorResponse "Invalid config type"
+// @Failure 404 {object} ErrorResponse "Unknown peer"
+// @Failure 502 {object} ErrorResponse "Peer request failed"
+// @Router /config/promotion/{peer}/diff [get]
+func (handler *Handler) handlePromotionDiffGET(ctx fiber.Ctx) error {
+	client, errResponse := handler.promotionClient(ctx)
+	if errResponse != nil {
+		errResponse.WriteLog(handler.logger)
+		return errResponse.Write(ctx)
+	}
+	configTypes, errResponse := promotionTypes(ctx.Query("type"))
+	if errResponse != nil {
+		errResponse.WriteLog(handler.logger)
+		return errResponse.Write(ctx)
+	}
+	includeContent := ctx.Query("include_content") == "true"
+
+	response := PromotionDiffResponse{Peer: client.Peer().Name, SourceURL: client.Peer().BaseURL, Documents: []PromotionDiffEntry{}}
+	for _, configType := range configTypes {
+		entries, err := handler.diffPromotionType(ctx.Context(), client, configType, includeContent)
+		if err != nil {
+			errResponse = promotionError(err, map[string]any{"peer": client.Peer().Name, "config_type": configType})
+			errResponse.WriteLog(handler.logger)
+			return errResponse.Write(ctx)
+		}
+		response.Documents = append(response.Documents, entries...)
+	}
+	return httputil.JSON(response, http.StatusOK).Write(ctx)
+}
+
+// handlePromotionApplyPOST godoc
+// @Summary Promote selected configs from a peer environment
+// @Description Copy the selected documents from a peer gecko into this environment, recording the source environment and revision. When source_revision is given, the document is only applied if the peer still serves that revision.
+// @Tags Config
+// @Accept json
+// @Produce json
+// @Param peer path string true "Peer name"
+// @Param body body PromotionApplyRequest true "Documents to promote"
+// @Success 200 {object} PromotionApplyResponse "Per-document outcome"
+// @Failure 400 {object} ErrorResponse "Invalid request body"
+// @Failure 404 {object} ErrorResponse "Unknown peer"
+// @Router /config/promotion/{peer}/apply [post]
+func (handler *Handler) handlePromotionApplyPOST(ctx fiber.Ctx) error {
+	client, errResponse := handler.promotionClient(ctx)
+	if errResponse != nil {
+		errResponse.WriteLog(handler.logger)
+		return errResponse.Write(ctx)
+	}
+	var request PromotionApplyRequest
+	if errResponse = httputil.ParseJSONBody(ctx.Body(), &request, map[string]any{"peer": client.Peer().Name}); errResponse != nil {
+		errResponse.WriteLog(handler.logger)
+		return errResponse.Write(ctx)
+	}
+	if len(request.Documents) == 0 {
+		errResponse = httputil.NewError(apierror.TypeValidationFailed, "at least one document is required", http.StatusBadRequest, nil, nil)
+		errResponse.WriteLog(handler.logger)
+		return errResponse.Write(ctx)
+	}
+	for _, document := range request.Documents {
+		if _, errResponse = promotionTypes(document.ConfigType); errResponse != nil || strings.TrimSpace(document.ConfigType) == "" || strings.TrimSpace(document.ConfigID) == "" {
+			errResponse = httputil.NewError(apierror.TypeValidationFailed, "every document needs a promotable config_type and a config_id", http.StatusBadRequest, map[string]any{"config_type": document.ConfigType, "config_id": document.ConfigID}, nil)
+			errResponse.WriteLog(handler.logger)
+			return errResponse.Write(ctx)
+		}
+	}
+
+	promotedBy := ""
+	if userID, userErr := handler.AuthenticatedUserID(ctx); userErr == nil {
+		promotedBy = userID
+	}
+
+	response := PromotionApplyResponse{Peer: client.Peer().Name, SourceURL: client.Peer().BaseURL, Documents: make([]PromotionApplyResult, 0, len(request.Documents))}
+	for _, document := range request.Documents {
+		result := handler.applyPromotion(ctx.Context(), client, document, promotedBy)
+		if result.Applied {
+			handler.logger.Info("Promoted %s config %s from %s at revision %s", result.ConfigType, result.ConfigID, client.Peer().Name, result.SourceRevision)
+		} else {
+			handler.logger.Warning("Failed to promote %s config %s from %s: %s", result.ConfigType, result.ConfigID, client.Peer().Name, result.Error)
+		}
+		response.Documents = append(response.Documents, result)
+	}
+	return httputil.JSON(response, http.StatusOK).Write(ctx)
+}
+
+func (handler *Handler) promotionClient(ctx fiber.Ctx) (*integrationgecko.Client, *httputil.ErrorResponse) {
+	name := strings.TrimSpace(ctx.Params("peer"))
+	for _, peer := range handler.PromotionPeers {
+		if peer.Name == name {
+			return integrationgecko.NewClient(nil, peer), nil
+		}
+	}
+	return nil, httputil.NewError(apierror.TypeNotFound, fmt.Sprintf("unknown promotion peer: %s", name), http.StatusNotFound, map[string]any{"peer": name}, nil)
+}
+
+func promotionTypes(configType string) ([]string, *httputil.ErrorResponse) {
+	configType = strings.TrimSpace(configType)
+	if configType == "" {
+		return promotableTypes, nil
+	}
+	for _, promotable := range promotableTypes {
+		if promotable == configType {
+			return []string{configType}, nil
+		}
+	}
+	return nil, httputil.NewError(apierror.TypeInvalidConfigType, fmt.Sprintf("config type %s cannot be promoted", configType), http.StatusBadRequest, map[string]any{"config_type": configType, "promotable_types": promotableTypes}, nil)
+}
+
+func (handler *Handler) diffPromotionType(ctx context.Context, client *integrationgecko.Client, configType string, includeContent bool) ([]PromotionDiffEntry, error) {
+	remoteIDs, err := client.ListConfigIDs(ctx, configType)
+	if err != nil {
+		return nil, err
+	}
+	localIDs, err := geckodb.ConfigListByType(handler.db, configType)
+	if err != nil {
+		return nil, err
+	}
+	promotions, err := geckodb.LatestConfigPromotionsContext(ctx, handler.db, configType)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := map[string]bool{}
+	for _, id := range remoteIDs {
+		ids[id] = true
+	}
+	for _, id := range localIDs {
+		ids[id] = true
+	}
+	sortedIDs := make([]string, 0, len(ids))
+	for id := range ids {
+		sortedIDs = append(sortedIDs, id)
+	}
+	sort.Strings(sortedIDs)
+
+	remoteSet := map[string]bool{}
+	for _, id := range remoteIDs {
+		remoteSet[id] = true
+	}
+
+	entries := make([]PromotionDiffEntry, 0, len(sortedIDs))
+	for _, configID := range sortedIDs {
+		entry := PromotionDiffEntry{ConfigType: configType, ConfigID: configID}
+		if promotion, ok := promotions[configID]; ok {
+			entry.LastPromotion = promotionRecordResponse(promotion)
+		}
+
+		local, localRevision, err := handler.localPromotionDocument(ctx, configType, configID)
+		if err != nil {
+			return nil, err
+		}
+		entry.LocalRevision = localRevision
+
+		if !remoteSet[configID] {
+			entry.Status = PromotionStatusLocalOnly
+			if includeContent {
+				entry.Local = local
+			}
+			entries = append(entries, entry)
+			continue
+		}
+
+		raw, err := client.GetConfig(ctx, configType, configID)
+		if err != nil {
+			return nil, err
+		}
+		source, sourceRevision, err := normalizePromotionDocument(configType, raw)
+		if err != nil {
+			entry.Status = PromotionStatusIncompatible
+			entry.Error = err.Error()
+			entries = append(entries, entry)
+			continue
+		}
+		entry.SourceRevision = sourceRevision
+		switch {
+		case local == nil:
+			entry.Status = PromotionStatusAdded
+		case localRevision == sourceRevision:
+			entry.Status = PromotionStatusUnchanged
+		default:
+			entry.Status = PromotionStatusChanged
+			entry.ChangedFields = changedTopLevelFields(local, source)
+		}
+		if includeContent {
+			entry.Source = source
+			entry.Local = local
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func (handler *Handler) applyPromotion(ctx context.Context, client *integrationgecko.Client, document PromotionApplyDocument, promotedBy string) PromotionApplyResult {
+	result := PromotionApplyResult{ConfigType: document.ConfigType, ConfigID: document.ConfigID}
+	raw, err := client.GetConfig(ctx, document.ConfigType, document.ConfigID)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	cfg, errResponse := configForType(document.ConfigType)
+	if errResponse != nil {
+		result.Error = errResponse.Error.Message
+		return result
+	}
+	if err := decodePromotionDocument(raw, cfg); err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	if validatable, ok := cfg.(interface{ Validate() error }); ok {
+		if err := validatable.Validate(); err != nil {
+			result.Error = fmt.Sprintf("source document failed validation: %s", err)
+			return result
+		}
+	}
+	sourceRevision, err := promotionRevision(cfg)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.SourceRevision = sourceRevision
+	if expected := strings.TrimSpace(document.SourceRevision); expected != "" && expected != sourceRevision {
+		result.Error = fmt.Sprintf("peer now serves revision %s, not the reviewed revision %s", sourceRevision, expected)
+		return result
+	}
+	_, previousRevision, err := handler.localPromotionDocument(ctx, document.ConfigType, document.ConfigID)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.PreviousRevision = previousRevision
+
+	tx, err := handler.db.BeginTxx(ctx, nil)
+	if err != nil {
+		result.Error = fmt.Sprintf("begin promotion transaction: %s", err)
+		return result
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+	if err := geckodb.ConfigPUTGenericTxContext(ctx, tx, document.ConfigID, document.ConfigType, cfg); err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	if err := geckodb.InsertConfigPromotionTxContext(ctx, tx, geckodb.ConfigPromotion{
+		ConfigType:        document.ConfigType,
+		ConfigID:          document.ConfigID,
+		SourceEnvironment: client.Peer().Name,
+		SourceURL:         client.Peer().BaseURL,
+		SourceRevision:    sourceRevision,
+		PreviousRevision:  sql.NullString{String: previousRevision, Valid: previousRevision != ""},
+		PromotedBy:        sql.NullString{String: promotedBy, Valid: promotedBy != ""},
+		PromotedAt:        time.Now().UTC(),
+	}); err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	if err := tx.Commit(); err != nil {
+		result.Error = fmt.Sprintf("commit promotion: %s", err)
+		return result
+	}
+	result.Applied = true
+	return result
+}
+
+// localPromotionDocument returns the local document in the same normalized
+// form used for peer documents, or nil when it does not exist.
+func (handler *Handler) localPromotionDocument(ctx context.Context, configType string, configID string) (json.RawMessage, string, error) {
+	cfg, errResponse := configForType(configType)
+	if errResponse != nil {
+		return nil, "", errors.New(errResponse.Error.Message)
+	}
+	if err := geckodb.ConfigGETGenericContext(ctx, handler.db, configID, configType, cfg); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, "", nil
+		}
+		return nil, "", err
+	}
+	content, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, "", err
+	}
+	revision, err := promotionRevision(cfg)
+	if err != nil {
+		return nil, "", err
+	}
+	return content, revision, nil
+}
+
+func normalizePromotionDocument(configType string, raw json.RawMessage) (json.RawMessage, string, error) {
+	cfg, errResponse := configForType(configType)
+	if errResponse != nil {
+		return nil, "", errors.New(errResponse.Error.Message)
+	}
+	if err := decodePromotionDocument(raw, cfg); err != nil {
+		return nil, "", err
+	}
+	content, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, "", err
+	}
+	revision, err := promotionRevision(cfg)
+	if err != nil {
+		return nil, "", err
+	}
+	return content, revision, nil
+}
+
+// decodePromotionDocument rejects fields this build does not know about so a
+// peer running a newer schema can never have data silently dropped.
+func decodePromotionDocument(raw json.RawMessage, target any) error {
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(target); err != nil {
+		return fmt.Errorf("peer document is not compatible with this environment: %w", err)
+	}
+	return nil
+}
+
+// promotionRevision identifies a document by the hash of its normalized JSON
+// so the same content has the same revision in every environment.
+func promotionRevision(cfg any) (string, error) {
+	content, err := json.Marshal(cfg)
+	if err != nil {
+		return "", fmt.Errorf("marshal config revision: %w", err)
+	}
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func changedTopLevelFields(local json.RawMessage, source json.RawMessage) []string {
+	var localFields, sourceFields map[string]json.RawMessage
+	if err := json.Unmarshal(local, &localFields); err != nil {
+		return nil
+	}
+	if err := json.Unmarshal(source, &sourceFields); err != nil {
+		return nil
+	}
+	changed := []string{}
+	for field, value := range sourceFields {
+		if !bytes.Equal(localFields[field], value) {
+			changed = append(changed, field)
+		}
+	}
+	for field := range localFields {
+		if _, ok := sourceFields[field]; !ok {
+			changed = append(changed, field)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+func promotionRecordResponse(promotion geckodb.ConfigPromotion) *PromotionRecordResponse {
+	return &PromotionRecordResponse{
+		SourceEnvironment: promotion.SourceEnvironment,
+		SourceURL:         promotion.SourceURL,
+		SourceRevision:    promotion.SourceRevision,
+		PreviousRevision:  promotion.PreviousRevision.String,
+		PromotedBy:        promotion.PromotedBy.String,
+		PromotedAt:        promotion.PromotedAt,
+	}
+}
+
+func promotionError(err error, details map[string]any) *httputil.ErrorResponse {
+	var statusErr *domain.HTTPStatusError
+	if errors.As(err, &statusErr) {
+		return httputil.NewError(apierror.Type(statusErr.Code), statusErr.Message, statusErr.StatusCode, details, nil)
+	}
+	return httputil.NewError(apierror.TypeDatabaseError, err.Error(), http.StatusInternalServerError, details, nil)
+}
@@ -0,0 +1,63 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	integrationgecko "github.com/calypr/gecko/internal/integrations/gecko"
+	"github.com/calypr/gecko/internal/server/http/shared"
+	"github.com/gofiber/fiber/v3"
+)
+
+func TestPromotionApplyPOST_CopiesPeerDocumentAndRecordsSource(t *testing.T) {
+	peer := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.URL.Path != "/config/nav/default" {
+			t.Fatalf("unexpected peer request path: %s", request.URL.Path)
+		}
+		writer.Header().Set("Content-Type", "application/json")
+		_, _ = writer.Write([]byte(`{}`))
+	}))
+	defer peer.Close()
+
+	srv, mock, cleanup := newProjectConfigTestServer(t)
+	defer cleanup()
+	srv.Handler = &shared.Handler{PromotionPeers: []integrationgecko.Peer{{Name: "staging", BaseURL: peer.URL}}}
+
+	mock.ExpectQuery(`SELECT name, content FROM config_schema\.nav WHERE name=\$1`).
+		WithArgs("default").
+		WillReturnRows(sqlmock.NewRows([]string{"name", "content"}))
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO config_schema\.nav`).
+		WithArgs("default", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`INSERT INTO config_schema\.config_promotion`).
+		WithArgs("nav", "default", "staging", peer.URL, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	app := fiber.New()
+	app.Post("/config/promotion/:peer/apply", srv.handlePromotionApplyPOST)
+	body := bytes.NewBufferString(`{"documents":[{"config_type":"nav","config_id":"default"}]}`)
+	req := httptest.NewRequest(http.MethodPost, "/config/promotion/staging/apply", body)
+	req.Header.Set("Content-Type", "application/json")
+	resp := runProjectConfigRequest(t, app, req)
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.StatusCode)
+	}
+	var payload PromotionApplyResponse
+	if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if len(payload.Documents) != 1 || !payload.Documents[0].Applied || payload.Documents[0].SourceRevision == "" {
+		t.Fatalf("expected applied document with a source revision, got %+v", payload.Documents)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet sql expectations: %v", err)
+	}
+}
@@ -16,6 +16,11 @@ func RegisterRoutes(app *fiber.App, sharedHandler *shared.Handler, authzHandler
 	configGroup := app.Group("/config")
 	configGroup.Get("/types", handler.handleConfigTypesGET)
 	configGroup.Get("/list", handler.handleConfigListGET)
+	configGroup.Get("/versions", servermw.BaseConfigsAuth(handler.Logger, authzHandler, "read", "*", "/programs"), handler.handleConfigVersionsGET)
+	configGroup.Post("/versions/upgrade", servermw.BaseConfigsAuth(handler.Logger, authzHandler, "update", "*", "/programs"), handler.handleConfigVersionsUpgradePOST)
+	configGroup.Get("/promotion/peers", servermw.BaseConfigsAuth(handler.Logger, authzHandler, "read", "*", "/programs"), handler.handlePromotionPeersGET)
+	configGroup.Get("/promotion/:peer/diff", servermw.BaseConfigsAuth(handler.Logger, authzHandler, "read", "*", "/programs"), handler.handlePromotionDiffGET)
+	configGroup.Post("/promotion/:peer/apply", servermw.BaseConfigsAuth(handler.Logger, authzHandler, "update", "*", "/programs"), handler.handlePromotionApplyPOST)
 
 	handler.registerTypedConfigRoutes(configGroup.Group("/explorer", shared.ConfigTypeMiddleware("explorer")), true, authzHandler)
 	handler.registerTypedConfigRoutes(configGroup.Group("/nav", shared.ConfigTypeMiddleware("nav")), false, authzHandler)
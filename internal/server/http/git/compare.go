@@ -0,0 +1,50 @@
+package git
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/calypr/gecko/apierror"
+	"github.com/calypr/gecko/internal/git"
+	"github.com/calypr/gecko/internal/httputil"
+	"github.com/gofiber/fiber/v3"
+)
+
+func (handler *Handler) handleGitProjectCompareGET(ctx fiber.Ctx) error {
+	_, _, projectID, _, identity, errResponse := handler.resolveGitProject(ctx)
+	if errResponse != nil {
+		return errResponse.Write(ctx)
+	}
+	defer handler.holdGitMirror(identity)()
+	baseRef := strings.TrimSpace(ctx.Query("base"))
+	headRef := strings.TrimSpace(ctx.Query("head"))
+	if baseRef == "" || headRef == "" {
+		response := httputil.NewError(apierror.TypeValidationFailed, "base and head are required", http.StatusBadRequest, map[string]any{"project_id": projectID, "base": baseRef, "head": headRef}, nil)
+		response.WriteLog(handler.logger)
+		return response.Write(ctx)
+	}
+	_, repo, errResponse := handler.openGitProjectMirror(ctx, projectID, identity, "compare")
+	if errResponse != nil {
+		return errResponse.Write(ctx)
+	}
+	resolvedBase, baseHash, err := git.ResolveGitCompareRef(repo, baseRef)
+	if err != nil {
+		response := httputil.NewError("not_found", fmt.Sprintf("failed to resolve base ref: %s", err), http.StatusNotFound, map[string]any{"project_id": projectID, "base": baseRef}, nil)
+		response.WriteLog(handler.logger)
+		return response.Write(ctx)
+	}
+	resolvedHead, headHash, err := git.ResolveGitCompareRef(repo, headRef)
+	if err != nil {
+		response := httputil.NewError("not_found", fmt.Sprintf("failed to resolve head ref: %s", err), http.StatusNotFound, map[string]any{"project_id": projectID, "head": headRef}, nil)
+		response.WriteLog(handler.logger)
+		return response.Write(ctx)
+	}
+	compareResponse, err := git.BuildGitCompareResponse(ctx.Context(), projectID, resolvedBase, baseHash, resolvedHead, headHash, repo)
+	if err != nil {
+		response := httputil.NewError("integration_error", fmt.Sprintf("failed to compare git refs: %s", err), http.StatusBadGateway, map[string]any{"project_id": projectID, "base": resolvedBase, "head": resolvedHead}, nil)
+		response.WriteLog(handler.logger)
+		return response.Write(ctx)
+	}
+	return httputil.JSON(compareResponse, http.StatusOK).Write(ctx)
+}
@@ -1,9 +1,12 @@
 package git
 
 import (
+	"time"
+
 	"github.com/bmeg/grip/gripql"
 	"github.com/calypr/gecko/internal/git"
 	"github.com/calypr/gecko/internal/server/http/shared"
+	servermw "github.com/calypr/gecko/internal/server/middleware"
 	"github.com/calypr/gecko/internal/thumbnail"
 	"github.com/jmoiron/sqlx"
 	"github.com/qdrant/go-client/qdrant"
@@ -22,6 +25,13 @@ type Handler struct {
 	projectSetup   *git.SetupService
 	projectSync    *git.ReconcileService
 	thumbnailStore thumbnail.Manager
+	webhooks       *git.WebhookService
+	webhookSecret  string
+	refreshJobs    *git.RefreshJobService
+	lfsDownloads   *git.LFSDownloadService
+	uploadTTL      time.Duration
+	uploadPolicy   git.GitUploadPolicy
+	authz          servermw.ResourceAccessHandler
 }
 
 func NewHandler(sharedHandler *shared.Handler) *Handler {
@@ -37,5 +47,11 @@ func NewHandler(sharedHandler *shared.Handler) *Handler {
 		projectSetup:   sharedHandler.ProjectSetup,
 		projectSync:    sharedHandler.ProjectSync,
 		thumbnailStore: sharedHandler.ThumbnailStore,
+		webhooks:       sharedHandler.Webhooks,
+		webhookSecret:  sharedHandler.GitHubWebhookSecret,
+		refreshJobs:    sharedHandler.RefreshJobs,
+		lfsDownloads:   sharedHandler.LFSDownloads,
+		uploadTTL:      sharedHandler.UploadSessionTTL,
+		uploadPolicy:   sharedHandler.UploadPolicy,
 	}
 }
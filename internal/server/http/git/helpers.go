@@ -38,6 +38,8 @@ func writeAppError(ctx fiber.Ctx, logger any, err error) error {
 			errorType = apierror.TypeDatabaseError
 		case git.ErrorKindUnauthorized:
 			errorType = apierror.TypeMissingAuthorization
+		case git.ErrorKindConflict:
+			errorType = apierror.Type("conflict")
 		}
 		return httputil.NewError(errorType, appErr.Error(), statusCode, appErr.Details, nil).Write(ctx)
 	}
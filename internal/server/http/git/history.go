@@ -0,0 +1,126 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/calypr/gecko/apierror"
+	geckodb "github.com/calypr/gecko/internal/db"
+	"github.com/calypr/gecko/internal/git"
+	"github.com/calypr/gecko/internal/httputil"
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/gofiber/fiber/v3"
+)
+
+func (handler *Handler) handleGitProjectCommitsGET(ctx fiber.Ctx) error {
+	_, _, projectID, _, identity, errResponse := handler.resolveGitProject(ctx)
+	if errResponse != nil {
+		return errResponse.Write(ctx)
+	}
+	defer handler.holdGitMirror(identity)()
+	query, errResponse := parseGitCommitQuery(ctx)
+	if errResponse != nil {
+		errResponse.WriteLog(handler.logger)
+		return errResponse.Write(ctx)
+	}
+	state, repo, errResponse := handler.openGitProjectMirror(ctx, projectID, identity, "commits")
+	if errResponse != nil {
+		return errResponse.Write(ctx)
+	}
+	if git.RepositoryIsEmpty(repo) {
+		refName := strings.TrimSpace(ctx.Query("ref"))
+		if refName == "" {
+			refName = state.DefaultBranch.String
+		}
+		return httputil.JSON(&git.GitProjectCommitsResponse{
+			ProjectID: projectID,
+			Ref:       refName,
+			Path:      strings.Trim(query.Path, "/"),
+			Commits:   []git.GitCommit{},
+		}, http.StatusOK).Write(ctx)
+	}
+	refName, hash, err := git.ResolveGitReference(repo, strings.TrimSpace(ctx.Query("ref")), state.DefaultBranch.String)
+	if err != nil {
+		response := httputil.NewError("not_found", fmt.Sprintf("failed to resolve git ref: %s", err), http.StatusNotFound, map[string]any{"project_id": projectID, "ref": ctx.Query("ref")}, nil)
+		response.WriteLog(handler.logger)
+		return response.Write(ctx)
+	}
+	commitsResponse, err := git.BuildGitCommitsResponse(projectID, refName, repo, hash, query)
+	if err != nil {
+		var appErr *git.Error
+		if errors.As(err, &appErr) {
+			return handler.writeAppError(ctx, appErr)
+		}
+		response := httputil.NewError("integration_error", fmt.Sprintf("failed to read git history: %s", err), http.StatusBadGateway, map[string]any{"project_id": projectID, "ref": refName}, nil)
+		response.WriteLog(handler.logger)
+		return response.Write(ctx)
+	}
+	return httputil.JSON(commitsResponse, http.StatusOK).Write(ctx)
+}
+
+func parseGitCommitQuery(ctx fiber.Ctx) (git.GitCommitQuery, *httputil.ErrorResponse) {
+	query := git.GitCommitQuery{
+		Path:   strings.TrimSpace(ctx.Query("path")),
+		Author: strings.TrimSpace(ctx.Query("author")),
+		Cursor: strings.TrimSpace(ctx.Query("cursor")),
+	}
+	for _, bound := range []struct {
+		name   string
+		target **time.Time
+	}{{"since", &query.Since}, {"until", &query.Until}} {
+		value := strings.TrimSpace(ctx.Query(bound.name))
+		if value == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return query, httputil.NewError(apierror.TypeValidationFailed, fmt.Sprintf("%s must be an RFC 3339 timestamp", bound.name), http.StatusBadRequest, map[string]any{bound.name: value}, nil)
+		}
+		*bound.target = &parsed
+	}
+	if value := strings.TrimSpace(ctx.Query("limit")); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			return query, httputil.NewError(apierror.TypeValidationFailed, "limit must be a positive integer", http.StatusBadRequest, map[string]any{"limit": value}, nil)
+		}
+		query.Limit = limit
+	}
+	return query, nil
+}
+
+// openGitProjectMirror loads projectID's state, warms its mirror when the
+// caller sent credentials, and opens it. purpose names the read in logs.
+func (handler *Handler) openGitProjectMirror(ctx fiber.Ctx, projectID string, identity git.GitRepositoryIdentity, purpose string) (*geckodb.GitProjectState, *gogit.Repository, *httputil.ErrorResponse) {
+	state, err := handler.loadGitProjectState(projectID, identity)
+	if err != nil {
+		response := httputil.NewError("database_error", fmt.Sprintf("failed to read git state: %s", err), http.StatusInternalServerError, map[string]any{"project_id": projectID}, nil)
+		response.WriteLog(handler.logger)
+		return nil, nil, response
+	}
+	if state == nil || state.MirrorPath == "" {
+		response := httputil.NewError("conflict", fmt.Sprintf("project %s has not been refreshed yet", projectID), http.StatusConflict, map[string]any{"project_id": projectID}, nil)
+		response.WriteLog(handler.logger)
+		return nil, nil, response
+	}
+	authorizationHeader := strings.TrimSpace(ctx.Get("Authorization"))
+	if authorizationHeader != "" {
+		refreshCtx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+		defer cancel()
+		state, err = handler.ensureMirrorReadyForRead(refreshCtx, authorizationHeader, projectID, identity, state)
+		if err != nil {
+			handler.logger.Warning("failed to warm git mirror for %s %s: %v", projectID, purpose, err)
+		}
+	}
+	repo, err := git.OpenRepository(state.MirrorPath)
+	if err != nil {
+		response := httputil.NewError("integration_error", fmt.Sprintf("failed to open git mirror: %s", err), http.StatusBadGateway, map[string]any{"project_id": projectID}, nil)
+		response.WriteLog(handler.logger)
+		return nil, nil, response
+	}
+	return state, repo, nil
+}
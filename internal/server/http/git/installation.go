@@ -3,6 +3,7 @@ package git
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
@@ -378,6 +379,23 @@ func (handler *Handler) handleGitProjectUpdatePOST(ctx fiber.Ctx) error {
 		response.WriteLog(handler.logger)
 		return response.Write(ctx)
 	}
+	if handler.refreshJobs != nil {
+		requestedBy, _ := handler.authenticatedUserID(ctx)
+		job, err := handler.refreshJobs.Submit(ctx.Context(), git.RefreshJobRequest{
+			ProjectID:           projectID,
+			Organization:        organization,
+			Project:             project,
+			Identity:            identity,
+			State:               state,
+			AuthorizationHeader: authorizationHeader,
+			RequestedBy:         requestedBy,
+		})
+		if err != nil {
+			return handler.writeAppError(ctx, err)
+		}
+		ctx.Set("Location", "/git/jobs/"+job.ID)
+		return httputil.JSON(git.BuildGitRefreshJobResponse(*job), http.StatusAccepted).Write(ctx)
+	}
 	refreshCtx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
 	defer cancel()
 	accessToken, err := handler.gitService.RequestInstallationToken(refreshCtx, authorizationHeader, organization, project, identity, "read")
@@ -391,26 +409,15 @@ func (handler *Handler) handleGitProjectUpdatePOST(ctx fiber.Ctx) error {
 		response.WriteLog(handler.logger)
 		return response.Write(ctx)
 	}
-	state.SyncState = git.GitSyncUpdating
-	state.LastError = sql.NullString{}
-	if err := geckodb.UpsertGitProjectState(handler.db, *state); err != nil {
-		response := httputil.NewError(apierror.TypeDatabaseError, fmt.Sprintf("failed to persist updating git state: %s", err), http.StatusInternalServerError, map[string]any{"project_id": projectID}, nil)
-		response.WriteLog(handler.logger)
-		return response.Write(ctx)
-	}
-	refreshResponse, updatedState, err := handler.gitService.RefreshProject(refreshCtx, projectID, identity, state, accessToken)
+	refreshResponse, _, err := handler.gitService.SyncProject(refreshCtx, handler.db, projectID, identity, state, accessToken)
 	if err != nil {
-		state.SyncState = git.GitSyncError
-		state.LastError = sql.NullString{String: err.Error(), Valid: true}
-		_ = geckodb.UpsertGitProjectState(handler.db, *state)
+		var appErr *git.Error
+		if errors.As(err, &appErr) {
+			return handler.writeAppError(ctx, appErr)
+		}
 		response := httputil.NewError(apierror.Type("integration_error"), fmt.Sprintf("failed to update git checkout for %s/%s: %s", organization, project, err), http.StatusBadGateway, map[string]any{"project_id": projectID, "repository": cfg.SrcRepo}, nil)
 		response.WriteLog(handler.logger)
 		return response.Write(ctx)
 	}
-	if err := geckodb.UpsertGitProjectState(handler.db, *updatedState); err != nil {
-		response := httputil.NewError(apierror.TypeDatabaseError, fmt.Sprintf("failed to persist updated git state: %s", err), http.StatusInternalServerError, map[string]any{"project_id": projectID}, nil)
-		response.WriteLog(handler.logger)
-		return response.Write(ctx)
-	}
 	return httputil.JSON(refreshResponse, http.StatusOK).Write(ctx)
 }
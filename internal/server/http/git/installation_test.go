@@ -314,6 +314,10 @@ func TestGitProjectEditConnectUpdatesProjectConfigAndState(t *testing.T) {
 	if err != nil {
 		t.Fatalf("marshal updated project config: %v", err)
 	}
+	updatedContent, err = appconfig.StampSchemaVersion(appconfig.TypeProjects, updatedContent)
+	if err != nil {
+		t.Fatalf("stamp updated project config: %v", err)
+	}
 	mock.ExpectQuery(`SELECT project_id, repo_host, repo_owner, repo_name, installation_id, installation_target_type, installation_target, mirror_path, sync_state, default_branch, last_refreshed_at, last_error FROM config_schema\.git_project_state WHERE project_id = \$1`).
 		WithArgs("TEST/proj-a").
 		WillReturnError(sql.ErrNoRows)
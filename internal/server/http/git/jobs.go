@@ -0,0 +1,43 @@
+package git
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/calypr/gecko/apierror"
+	"github.com/calypr/gecko/internal/git"
+	"github.com/calypr/gecko/internal/httputil"
+	servermw "github.com/calypr/gecko/internal/server/middleware"
+	"github.com/gofiber/fiber/v3"
+)
+
+func (handler *Handler) handleGitJobGET(ctx fiber.Ctx) error {
+	jobID := strings.TrimSpace(ctx.Params("jobID"))
+	if handler.refreshJobs == nil {
+		response := httputil.NewError(apierror.TypeNotFound, "refresh jobs are not enabled", http.StatusNotFound, map[string]any{"job_id": jobID}, nil)
+		response.WriteLog(handler.logger)
+		return response.Write(ctx)
+	}
+	job, err := handler.refreshJobs.Get(ctx.Context(), jobID)
+	if err != nil {
+		return handler.writeAppError(ctx, err)
+	}
+	if job == nil {
+		response := httputil.NewError(apierror.TypeNotFound, "refresh job not found", http.StatusNotFound, map[string]any{"job_id": jobID}, nil)
+		response.WriteLog(handler.logger)
+		return response.Write(ctx)
+	}
+	organization, project, _ := strings.Cut(job.ProjectID, "/")
+	resources, errResponse := gitAllowedReadResources(strings.TrimSpace(ctx.Get("Authorization")))
+	if errResponse != nil {
+		errResponse.WriteLog(handler.logger)
+		return errResponse.Write(ctx)
+	}
+	if !servermw.GitProjectReadable(resources, organization, project) {
+		// Answer as for an unknown job so the ID does not reveal the job.
+		response := httputil.NewError(apierror.TypeNotFound, "refresh job not found", http.StatusNotFound, map[string]any{"job_id": jobID}, nil)
+		response.WriteLog(handler.logger)
+		return response.Write(ctx)
+	}
+	return httputil.JSON(git.BuildGitRefreshJobResponse(*job), http.StatusOK).Write(ctx)
+}
@@ -0,0 +1,73 @@
+package git
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/calypr/gecko/internal/git"
+	"github.com/calypr/gecko/internal/httputil"
+	servermw "github.com/calypr/gecko/internal/server/middleware"
+	"github.com/gofiber/fiber/v3"
+)
+
+func (handler *Handler) handleGitProjectLFSInventoryGET(ctx fiber.Ctx) error {
+	_, _, projectID, _, identity, errResponse := handler.resolveGitProject(ctx)
+	if errResponse != nil {
+		return errResponse.Write(ctx)
+	}
+	defer handler.holdGitMirror(identity)()
+	verify := strings.EqualFold(strings.TrimSpace(ctx.Query("verify")), "true")
+	authorizationHeader := ""
+	if verify {
+		header, tokenErr := servermw.ValidateAuthorizationHeader(ctx.Get("Authorization"))
+		if tokenErr != nil {
+			response := httputil.NewError("missing_authorization", tokenErr.Error(), http.StatusUnauthorized, map[string]any{"project_id": projectID}, nil)
+			response.WriteLog(handler.logger)
+			return response.Write(ctx)
+		}
+		authorizationHeader = header
+	}
+	state, repo, errResponse := handler.openGitProjectMirror(ctx, projectID, identity, "lfs inventory")
+	if errResponse != nil {
+		return errResponse.Write(ctx)
+	}
+	if git.RepositoryIsEmpty(repo) {
+		refName := strings.TrimSpace(ctx.Query("ref"))
+		if refName == "" {
+			refName = state.DefaultBranch.String
+		}
+		return httputil.JSON(&git.GitLFSInventoryResponse{
+			ProjectID:   projectID,
+			Ref:         refName,
+			Objects:     []git.GitLFSInventoryEntry{},
+			Duplicates:  []git.GitLFSDuplicate{},
+			Directories: []git.GitLFSDirectoryRollup{},
+			Verified:    verify,
+		}, http.StatusOK).Write(ctx)
+	}
+	refName, hash, err := git.ResolveGitReference(repo, strings.TrimSpace(ctx.Query("ref")), state.DefaultBranch.String)
+	if err != nil {
+		response := httputil.NewError("not_found", fmt.Sprintf("failed to resolve git ref: %s", err), http.StatusNotFound, map[string]any{"project_id": projectID, "ref": ctx.Query("ref")}, nil)
+		response.WriteLog(handler.logger)
+		return response.Write(ctx)
+	}
+	inventory, err := handler.gitService.LFSInventory(state.MirrorPath, projectID, refName, repo, hash)
+	if err != nil {
+		response := httputil.NewError("integration_error", fmt.Sprintf("failed to build LFS inventory: %s", err), http.StatusBadGateway, map[string]any{"project_id": projectID, "ref": refName}, nil)
+		response.WriteLog(handler.logger)
+		return response.Write(ctx)
+	}
+	if verify {
+		if handler.lfsDownloads == nil {
+			response := httputil.NewError("integration_error", "LFS storage checks are not configured", http.StatusBadGateway, map[string]any{"project_id": projectID}, nil)
+			response.WriteLog(handler.logger)
+			return response.Write(ctx)
+		}
+		inventory, err = handler.lfsDownloads.VerifyLFSInventory(ctx.Context(), authorizationHeader, projectID, inventory)
+		if err != nil {
+			return handler.writeAppError(ctx, err)
+		}
+	}
+	return httputil.JSON(inventory, http.StatusOK).Write(ctx)
+}
@@ -0,0 +1,18 @@
+package git
+
+import (
+	"net/http"
+
+	"github.com/calypr/gecko/internal/httputil"
+	"github.com/gofiber/fiber/v3"
+)
+
+// handleGitMirrorsGET reports the disk usage of every mirror under the git
+// data directory, including orphaned and evicted ones, against the quota.
+func (handler *Handler) handleGitMirrorsGET(ctx fiber.Ctx) error {
+	report, err := handler.gitService.MirrorUsage(ctx.Context(), handler.db)
+	if err != nil {
+		return handler.writeAppError(ctx, err)
+	}
+	return httputil.JSON(report, http.StatusOK).Write(ctx)
+}
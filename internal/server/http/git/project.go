@@ -75,12 +75,18 @@ func (handler *Handler) resolveGitProject(ctx fiber.Ctx) (string, string, string
 	return organization, project, projectID, cfg, identity, nil
 }
 
+// loadGitProjectState reads the git state of projectID, moving it to the
+// mirror of identity when the project's repository changed. Loading the
+// state counts as a read of the mirror for quota eviction.
 func (handler *Handler) loadGitProjectState(projectID string, identity git.GitRepositoryIdentity) (*geckodb.GitProjectState, error) {
 	state, err := geckodb.GitProjectStateByProjectID(handler.db, projectID)
 	if err != nil || state == nil {
 		return state, err
 	}
 	expectedMirrorPath := handler.gitService.MirrorPathForIdentity(identity)
+	if err := handler.gitService.RecordMirrorAccess(context.Background(), handler.db, expectedMirrorPath, time.Now()); err != nil {
+		handler.logger.Warning("failed to record git mirror access for %s: %v", projectID, err)
+	}
 	if state.RepoHost == identity.Host &&
 		state.RepoOwner == identity.Owner &&
 		state.RepoName == identity.Repo &&
@@ -97,6 +103,13 @@ func (handler *Handler) loadGitProjectState(projectID string, identity git.GitRe
 	return state, nil
 }
 
+// holdGitMirror keeps mirror maintenance from repacking or evicting the
+// mirror of identity until the returned release is called. Handlers that
+// read a mirror hold it for the whole request.
+func (handler *Handler) holdGitMirror(identity git.GitRepositoryIdentity) func() {
+	return handler.gitService.HoldMirror(handler.gitService.MirrorPathForIdentity(identity))
+}
+
 func (handler *Handler) ensureMirrorReadyForRead(ctx context.Context, authorizationHeader string, projectID string, identity git.GitRepositoryIdentity, state *geckodb.GitProjectState) (*geckodb.GitProjectState, error) {
 	if state == nil || !state.InstallationID.Valid {
 		return state, nil
@@ -115,16 +128,10 @@ func (handler *Handler) ensureMirrorReadyForRead(ctx context.Context, authorizat
 		_ = geckodb.UpsertGitProjectState(handler.db, *state)
 		return state, err
 	}
-	_, updatedState, err := handler.gitService.RefreshProject(ctx, projectID, identity, state, accessToken)
+	_, updatedState, err := handler.gitService.SyncProject(ctx, handler.db, projectID, identity, state, accessToken)
 	if err != nil {
-		state.SyncState = git.GitSyncError
-		state.LastError = sql.NullString{String: err.Error(), Valid: true}
-		_ = geckodb.UpsertGitProjectState(handler.db, *state)
 		return state, err
 	}
-	if err := geckodb.UpsertGitProjectState(handler.db, *updatedState); err != nil {
-		return nil, fmt.Errorf("persist refreshed git project state: %w", err)
-	}
 	return updatedState, nil
 }
 
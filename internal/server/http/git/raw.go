@@ -0,0 +1,234 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/calypr/gecko/apierror"
+	geckodb "github.com/calypr/gecko/internal/db"
+	"github.com/calypr/gecko/internal/git"
+	"github.com/calypr/gecko/internal/httputil"
+	servermw "github.com/calypr/gecko/internal/server/middleware"
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/gofiber/fiber/v3"
+)
+
+func (handler *Handler) handleGitProjectRawGET(ctx fiber.Ctx) error {
+	organization, project, projectID, _, identity, errResponse := handler.resolveGitProject(ctx)
+	if errResponse != nil {
+		return errResponse.Write(ctx)
+	}
+	defer handler.holdGitMirror(identity)()
+	state, repo, errResponse := handler.localGitProjectMirror(projectID, identity)
+	if errResponse != nil {
+		return errResponse.Write(ctx)
+	}
+	if repo == nil {
+		return handler.redirectToGitHubDownload(ctx, organization, project, projectID, identity, false)
+	}
+	return handler.serveGitBlob(ctx, projectID, state, repo, false)
+}
+
+// localGitProjectMirror opens the mirror of projectID if it has been cloned.
+// It returns a nil repository, and no error, when the mirror is missing so
+// callers can fall back to GitHub.
+func (handler *Handler) localGitProjectMirror(projectID string, identity git.GitRepositoryIdentity) (*geckodb.GitProjectState, *gogit.Repository, *httputil.ErrorResponse) {
+	state, err := handler.loadGitProjectState(projectID, identity)
+	if err != nil {
+		response := httputil.NewError("database_error", fmt.Sprintf("failed to read git state: %s", err), http.StatusInternalServerError, map[string]any{"project_id": projectID}, nil)
+		response.WriteLog(handler.logger)
+		return nil, nil, response
+	}
+	if state == nil || strings.TrimSpace(state.MirrorPath) == "" {
+		return state, nil, nil
+	}
+	if _, err := os.Stat(state.MirrorPath); err != nil {
+		return state, nil, nil
+	}
+	repo, err := git.OpenRepository(state.MirrorPath)
+	if err != nil {
+		handler.logger.Warning("failed to open git mirror for %s, falling back to GitHub: %v", projectID, err)
+		return state, nil, nil
+	}
+	if git.RepositoryIsEmpty(repo) {
+		return state, nil, nil
+	}
+	return state, repo, nil
+}
+
+// serveGitBlob streams the requested file from repo, honoring conditional
+// and Range requests. download serves the file as an attachment and sends the
+// data behind an LFS pointer instead of the pointer itself.
+func (handler *Handler) serveGitBlob(ctx fiber.Ctx, projectID string, state *geckodb.GitProjectState, repo *gogit.Repository, download bool) error {
+	path := strings.Trim(ctx.Params("*"), "/")
+	requestedRef := strings.TrimSpace(ctx.Query("ref"))
+	refName, hash, err := git.ResolveGitReference(repo, requestedRef, state.DefaultBranch.String)
+	if err != nil {
+		response := httputil.NewError("not_found", fmt.Sprintf("failed to resolve git ref: %s", err), http.StatusNotFound, map[string]any{"project_id": projectID, "ref": requestedRef}, nil)
+		response.WriteLog(handler.logger)
+		return response.Write(ctx)
+	}
+	blob, err := git.OpenGitBlob(repo, refName, hash, path)
+	if err != nil {
+		response := httputil.NewError("not_found", fmt.Sprintf("failed to read git file: %s", err), http.StatusNotFound, map[string]any{"project_id": projectID, "ref": refName, "path": path}, nil)
+		response.WriteLog(handler.logger)
+		return response.Write(ctx)
+	}
+
+	if download {
+		if pointer := blob.LFSPointer(); pointer != nil {
+			return handler.serveLFSObject(ctx, projectID, blob.Name, pointer)
+		}
+	}
+
+	etag := blob.ETag()
+	ctx.Set(fiber.HeaderETag, etag)
+	ctx.Set(fiber.HeaderAcceptRanges, "bytes")
+	if download {
+		ctx.Set(fiber.HeaderContentDisposition, mime.FormatMediaType("attachment", map[string]string{"filename": blob.Name}))
+	}
+	if etagMatches(ctx.Get(fiber.HeaderIfNoneMatch), etag) {
+		return ctx.SendStatus(http.StatusNotModified)
+	}
+
+	start, length, partial := int64(0), blob.Size, false
+	rangeHeader := ctx.Get(fiber.HeaderRange)
+	if rangeHeader != "" && (ctx.Get(fiber.HeaderIfRange) == "" || ctx.Get(fiber.HeaderIfRange) == etag) {
+		start, length, partial, err = git.ParseGitByteRange(rangeHeader, blob.Size)
+		if errors.Is(err, git.ErrGitByteRangeUnsatisfiable) {
+			ctx.Set(fiber.HeaderContentRange, fmt.Sprintf("bytes */%d", blob.Size))
+			response := httputil.NewError(apierror.TypeValidationFailed, err.Error(), http.StatusRequestedRangeNotSatisfiable, map[string]any{"project_id": projectID, "path": blob.Path, "range": rangeHeader}, nil)
+			return response.Write(ctx)
+		}
+	}
+
+	reader, err := blob.Reader(start, length)
+	if err != nil {
+		response := httputil.NewError("integration_error", fmt.Sprintf("failed to read git file: %s", err), http.StatusBadGateway, map[string]any{"project_id": projectID, "ref": refName, "path": blob.Path}, nil)
+		response.WriteLog(handler.logger)
+		return response.Write(ctx)
+	}
+	ctx.Set(fiber.HeaderContentType, blob.ContentType)
+	ctx.Set(fiber.HeaderContentLength, strconv.FormatInt(length, 10))
+	if partial {
+		ctx.Set(fiber.HeaderContentRange, fmt.Sprintf("bytes %d-%d/%d", start, start+length-1, blob.Size))
+		ctx.Status(http.StatusPartialContent)
+	} else {
+		ctx.Status(http.StatusOK)
+	}
+	// The body is streamed after the handler returns, so the mirror stays
+	// held until the stream is closed.
+	return httputil.SendStream(ctx, heldMirrorReader{ReadCloser: reader, release: handler.gitService.HoldMirror(state.MirrorPath)}, int(length))
+}
+
+// heldMirrorReader releases its hold on a mirror when the blob read from it
+// is closed.
+type heldMirrorReader struct {
+	io.ReadCloser
+	release func()
+}
+
+func (reader heldMirrorReader) Close() error {
+	defer reader.release()
+	return reader.ReadCloser.Close()
+}
+
+func etagMatches(header string, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// redirectToGitHubDownload sends the client to GitHub's download URL for the
+// requested file; it is the fallback when the mirror has not been cloned.
+// With download set, LFS pointers are resolved to their data.
+func (handler *Handler) redirectToGitHubDownload(ctx fiber.Ctx, organization string, project string, projectID string, identity git.GitRepositoryIdentity, download bool) error {
+	authorizationHeader, tokenErr := servermw.ValidateAuthorizationHeader(ctx.Get("Authorization"))
+	if tokenErr != nil {
+		response := httputil.NewError("missing_authorization", tokenErr.Error(), http.StatusUnauthorized, map[string]any{"project_id": projectID}, nil)
+		response.WriteLog(handler.logger)
+		return response.Write(ctx)
+	}
+	path := strings.Trim(ctx.Params("*"), "/")
+	requestedRef := strings.TrimSpace(ctx.Query("ref"))
+	metadata, contentBytes, err := handler.gitService.GetGitHubFileMetadata(ctx.Context(), authorizationHeader, organization, project, identity, requestedRef, path)
+	if err != nil {
+		statusCode := http.StatusNotFound
+		code := "not_found"
+		message := fmt.Sprintf("failed to download git file: %s", err)
+		if statusErr, ok := err.(*git.HTTPStatusError); ok {
+			statusCode = statusErr.StatusCode
+			code = statusErr.Code
+			message = statusErr.Message
+		}
+		response := httputil.NewError(apierror.Type(code), message, statusCode, map[string]any{"project_id": projectID, "ref": requestedRef, "path": path}, nil)
+		response.WriteLog(handler.logger)
+		return response.Write(ctx)
+	}
+	if download {
+		if pointer := git.ParseGitLFSPointer(contentBytes); pointer != nil {
+			return handler.serveLFSObject(ctx, projectID, filepath.Base(path), pointer)
+		}
+	}
+	if metadata == nil || strings.TrimSpace(metadata.GetDownloadURL()) == "" {
+		response := httputil.NewError("integration_error", "github download url is unavailable for this file", http.StatusBadGateway, map[string]any{"project_id": projectID, "ref": requestedRef, "path": path}, nil)
+		response.WriteLog(handler.logger)
+		return response.Write(ctx)
+	}
+	return ctx.Redirect().To(strings.TrimSpace(metadata.GetDownloadURL()))
+}
+
+// serveLFSObject sends the client the data behind pointer: a redirect to the
+// signed URL, or a proxied response when the URL needs request headers a
+// redirect cannot carry.
+func (handler *Handler) serveLFSObject(ctx fiber.Ctx, projectID string, name string, pointer *git.GitLFSPointerInfo) error {
+	authorizationHeader, tokenErr := servermw.ValidateAuthorizationHeader(ctx.Get("Authorization"))
+	if tokenErr != nil {
+		response := httputil.NewError("missing_authorization", tokenErr.Error(), http.StatusUnauthorized, map[string]any{"project_id": projectID}, nil)
+		response.WriteLog(handler.logger)
+		return response.Write(ctx)
+	}
+	if handler.lfsDownloads == nil {
+		response := httputil.NewError("integration_error", "LFS downloads are not configured", http.StatusBadGateway, map[string]any{"project_id": projectID, "oid": pointer.OID}, nil)
+		response.WriteLog(handler.logger)
+		return response.Write(ctx)
+	}
+	access, err := handler.lfsDownloads.ResolveDownload(ctx.Context(), authorizationHeader, projectID, pointer)
+	if err != nil {
+		return handler.writeAppError(ctx, err)
+	}
+	if len(access.Headers) == 0 {
+		return ctx.Redirect().To(access.URL)
+	}
+	upstream, err := handler.lfsDownloads.FetchData(ctx.Context(), access, ctx.Get(fiber.HeaderRange))
+	if err != nil {
+		response := httputil.NewError("integration_error", fmt.Sprintf("failed to fetch LFS data: %s", err), http.StatusBadGateway, map[string]any{"project_id": projectID, "oid": pointer.OID}, nil)
+		response.WriteLog(handler.logger)
+		return response.Write(ctx)
+	}
+	if upstream.StatusCode >= http.StatusBadRequest {
+		_ = upstream.Body.Close()
+		response := httputil.NewError("integration_error", fmt.Sprintf("LFS data request failed with status %d", upstream.StatusCode), http.StatusBadGateway, map[string]any{"project_id": projectID, "oid": pointer.OID}, nil)
+		response.WriteLog(handler.logger)
+		return response.Write(ctx)
+	}
+	for _, header := range []string{fiber.HeaderContentType, fiber.HeaderContentRange, fiber.HeaderAcceptRanges, fiber.HeaderETag} {
+		if value := upstream.Header.Get(header); value != "" {
+			ctx.Set(header, value)
+		}
+	}
+	ctx.Set(fiber.HeaderContentDisposition, mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	ctx.Status(upstream.StatusCode)
+	return httputil.SendStream(ctx, upstream.Body, int(upstream.ContentLength))
+}
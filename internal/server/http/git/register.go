@@ -11,22 +11,31 @@ func RegisterRoutes(app *fiber.App, sharedHandler *shared.Handler, authzHandler
 	if handler.GitService == nil {
 		return
 	}
+	handler.authz = authzHandler
 	gitGroup := app.Group("/git")
+	gitGroup.Post("/webhooks/github", handler.handleGitHubWebhookPOST)
 	gitGroup.Get("/projects", servermw.RequireAuthorization(handler.Logger), handler.handleGitProjectsGET)
 	gitGroup.Get("/organizations/status", servermw.RequireAuthorization(handler.Logger), handler.handleGitOrganizationsStatusGET)
 	gitGroup.Post("/organizations/reconcile", servermw.RequireAuthorization(handler.Logger), handler.handleGitOrganizationsReconcilePOST)
 	gitGroup.Post("/organizations/:orgTitle/init-connect", servermw.RequireAuthorization(handler.Logger), handler.handleGitOrganizationInitConnectPOST)
 	gitGroup.Post("/organizations/:orgTitle/connect", servermw.RequireAuthorization(handler.Logger), handler.handleGitOrganizationConnectPOST)
 	gitGroup.Get("/organizations/:orgTitle/status", servermw.GitOrganizationAuth(handler.Logger, authzHandler), handler.handleGitOrganizationStatusGET)
+	gitGroup.Get("/mirrors", servermw.BaseConfigsAuth(handler.Logger, authzHandler, "read", "*", "/programs"), handler.handleGitMirrorsGET)
+	gitGroup.Get("/jobs/:jobID", servermw.RequireAuthorization(handler.Logger), handler.handleGitJobGET)
+	gitGroup.Get("/uploads/sessions", servermw.RequireAuthorization(handler.Logger), handler.handleGitUploadSessionsGET)
 	gitGroup.Post("/organizations/:orgTitle/reconcile", servermw.GitOrganizationAuth(handler.Logger, authzHandler), handler.handleGitOrganizationReconcilePOST)
 
 	projectReadAuth := servermw.GitProjectAuth(handler.Logger, authzHandler)
 	gitGroup.Get("/projects/:orgTitle/:projectTitle", projectReadAuth, handler.handleGitProjectGET)
 	gitGroup.Get("/projects/:orgTitle/:projectTitle/refs", projectReadAuth, handler.handleGitProjectRefsGET)
+	gitGroup.Get("/projects/:orgTitle/:projectTitle/commits", projectReadAuth, handler.handleGitProjectCommitsGET)
+	gitGroup.Get("/projects/:orgTitle/:projectTitle/compare", projectReadAuth, handler.handleGitProjectCompareGET)
+	gitGroup.Get("/projects/:orgTitle/:projectTitle/lfs/inventory", projectReadAuth, handler.handleGitProjectLFSInventoryGET)
 	gitGroup.Get("/projects/:orgTitle/:projectTitle/tree", projectReadAuth, handler.handleGitProjectTreeGET)
 	gitGroup.Get("/projects/:orgTitle/:projectTitle/tree/*", projectReadAuth, handler.handleGitProjectTreeGET)
 	gitGroup.Get("/projects/:orgTitle/:projectTitle/file/*", projectReadAuth, handler.handleGitProjectFileGET)
 	gitGroup.Get("/projects/:orgTitle/:projectTitle/download/*", projectReadAuth, handler.handleGitProjectDownloadGET)
+	gitGroup.Get("/projects/:orgTitle/:projectTitle/raw/*", projectReadAuth, handler.handleGitProjectRawGET)
 	gitGroup.Get("/projects/:orgTitle/:projectTitle/thumbnail", handler.handleGitProjectThumbnailGET)
 
 	projectGitWrite := gitGroup.Group("/projects/:orgTitle/:projectTitle", servermw.RequireAuthorization(handler.Logger))
@@ -36,8 +45,15 @@ func RegisterRoutes(app *fiber.App, sharedHandler *shared.Handler, authzHandler
 	projectGitWrite.Delete("/thumbnail", handler.handleGitProjectThumbnailDELETE)
 	projectGitWrite.Post("/edit-connect", handler.handleGitProjectEditConnectPOST)
 	projectGitWrite.Post("/update", handler.handleGitProjectUpdatePOST)
+	projectGitWrite.Get("/uploads/sessions", projectReadAuth, handler.handleGitProjectUploadSessionsGET)
 	projectGitWrite.Post("/uploads/session", handler.handleGitProjectUploadSessionPOST)
+	projectGitWrite.Post("/uploads/import", handler.handleGitProjectUploadImportPOST)
 	projectGitWrite.Get("/uploads/session/:sessionID", handler.handleGitProjectUploadSessionGET)
+	projectGitWrite.Post("/uploads/session/:sessionID/manifest", handler.handleGitProjectUploadSessionManifestPOST)
+	projectGitWrite.Post("/uploads/session/:sessionID/conflicts", handler.handleGitProjectUploadSessionConflictsPOST)
 	projectGitWrite.Post("/uploads/session/:sessionID/files", handler.handleGitProjectUploadSessionFilesPOST)
+	projectGitWrite.Put("/uploads/session/:sessionID/content/*", handler.handleGitProjectUploadSessionContentPUT)
 	projectGitWrite.Post("/uploads/session/:sessionID/finalize", handler.handleGitProjectUploadSessionFinalizePOST)
+	projectGitWrite.Post("/uploads/session/:sessionID/cancel", handler.handleGitProjectUploadSessionCancelPOST)
+	projectGitWrite.Post("/uploads/session/:sessionID/release", handler.handleGitProjectUploadSessionReleasePOST)
 }
@@ -2,8 +2,10 @@ package git
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -19,6 +21,7 @@ func (handler *Handler) handleGitProjectRefsGET(ctx fiber.Ctx) error {
 	if errResponse != nil {
 		return errResponse.Write(ctx)
 	}
+	defer handler.holdGitMirror(identity)()
 	state, err := handler.loadGitProjectState(projectID, identity)
 	if err != nil {
 		response := httputil.NewError("database_error", fmt.Sprintf("failed to read git state: %s", err), http.StatusInternalServerError, map[string]any{"project_id": projectID}, nil)
@@ -59,6 +62,12 @@ func (handler *Handler) handleGitProjectTreeGET(ctx fiber.Ctx) error {
 	if errResponse != nil {
 		return errResponse.Write(ctx)
 	}
+	defer handler.holdGitMirror(identity)()
+	query, listing, errResponse := parseGitTreeQuery(ctx)
+	if errResponse != nil {
+		errResponse.WriteLog(handler.logger)
+		return errResponse.Write(ctx)
+	}
 	state, err := handler.loadGitProjectState(projectID, identity)
 	if err != nil {
 		response := httputil.NewError("database_error", fmt.Sprintf("failed to read git state: %s", err), http.StatusInternalServerError, map[string]any{"project_id": projectID}, nil)
@@ -104,20 +113,98 @@ func (handler *Handler) handleGitProjectTreeGET(ctx fiber.Ctx) error {
 		return response.Write(ctx)
 	}
 	path := strings.Trim(ctx.Params("*"), "/")
-	treeResponse, err := git.BuildGitTreeResponse(projectID, refName, path, repo, hash)
+	var treeResponse *git.GitProjectTreeResponse
+	if listing {
+		treeResponse, err = git.BuildGitTreeListing(projectID, refName, path, repo, hash, query)
+	} else {
+		treeResponse, err = git.BuildGitTreeResponse(projectID, refName, path, repo, hash)
+	}
 	if err != nil {
+		var appErr *git.Error
+		if errors.As(err, &appErr) {
+			return handler.writeAppError(ctx, appErr)
+		}
 		response := httputil.NewError("not_found", fmt.Sprintf("failed to read git tree: %s", err), http.StatusNotFound, map[string]any{"project_id": projectID, "ref": refName, "path": path}, nil)
 		response.WriteLog(handler.logger)
 		return response.Write(ctx)
 	}
+	handler.gitService.IndexLastModifiedInBackground(state.MirrorPath, repo, hash)
 	return httputil.JSON(treeResponse, http.StatusOK).Write(ctx)
 }
 
+// parseGitTreeQuery reads the filtering and paging parameters of a tree
+// listing. listing is false when none are set, so plain listings keep their
+// unpaged response.
+func parseGitTreeQuery(ctx fiber.Ctx) (git.GitTreeQuery, bool, *httputil.ErrorResponse) {
+	query := git.GitTreeQuery{
+		Include: splitGitQueryList(ctx.Query("include")),
+		Exclude: splitGitQueryList(ctx.Query("exclude")),
+		Types:   splitGitQueryList(strings.ToLower(ctx.Query("type"))),
+		Cursor:  strings.TrimSpace(ctx.Query("cursor")),
+	}
+	if value := strings.TrimSpace(ctx.Query("recursive")); value != "" {
+		recursive, err := strconv.ParseBool(value)
+		if err != nil {
+			return query, false, httputil.NewError(apierror.TypeValidationFailed, "recursive must be true or false", http.StatusBadRequest, map[string]any{"recursive": value}, nil)
+		}
+		query.Recursive = recursive
+	}
+	for _, bound := range []struct {
+		name   string
+		target *int
+	}{{"max_depth", &query.MaxDepth}, {"limit", &query.Limit}} {
+		value := strings.TrimSpace(ctx.Query(bound.name))
+		if value == "" {
+			continue
+		}
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			return query, false, httputil.NewError(apierror.TypeValidationFailed, fmt.Sprintf("%s must be a positive integer", bound.name), http.StatusBadRequest, map[string]any{bound.name: value}, nil)
+		}
+		*bound.target = parsed
+	}
+	listing := query.Recursive || len(query.Include) > 0 || len(query.Exclude) > 0 || len(query.Types) > 0 || query.Cursor != "" || query.Limit > 0
+	return query, listing, nil
+}
+
+// splitGitQueryList splits a comma separated query parameter.
+func splitGitQueryList(value string) []string {
+	items := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
 func (handler *Handler) handleGitProjectFileGET(ctx fiber.Ctx) error {
 	organization, project, projectID, _, identity, errResponse := handler.resolveGitProject(ctx)
 	if errResponse != nil {
 		return errResponse.Write(ctx)
 	}
+	defer handler.holdGitMirror(identity)()
+	state, repo, errResponse := handler.localGitProjectMirror(projectID, identity)
+	if errResponse != nil {
+		return errResponse.Write(ctx)
+	}
+	if repo != nil {
+		path := strings.Trim(ctx.Params("*"), "/")
+		requestedRef := strings.TrimSpace(ctx.Query("ref"))
+		refName, hash, err := git.ResolveGitReference(repo, requestedRef, state.DefaultBranch.String)
+		if err != nil {
+			response := httputil.NewError("not_found", fmt.Sprintf("failed to resolve git ref: %s", err), http.StatusNotFound, map[string]any{"project_id": projectID, "ref": requestedRef}, nil)
+			response.WriteLog(handler.logger)
+			return response.Write(ctx)
+		}
+		fileResponse, err := git.BuildGitFileResponse(projectID, refName, path, repo, hash)
+		if err != nil {
+			response := httputil.NewError("not_found", fmt.Sprintf("failed to read git file: %s", err), http.StatusNotFound, map[string]any{"project_id": projectID, "ref": refName, "path": path}, nil)
+			response.WriteLog(handler.logger)
+			return response.Write(ctx)
+		}
+		return httputil.JSON(fileResponse, http.StatusOK).Write(ctx)
+	}
 	authorizationHeader, tokenErr := servermw.ValidateAuthorizationHeader(ctx.Get("Authorization"))
 	if tokenErr != nil {
 		response := httputil.NewError("missing_authorization", tokenErr.Error(), http.StatusUnauthorized, map[string]any{"project_id": projectID}, nil)
@@ -149,32 +236,13 @@ func (handler *Handler) handleGitProjectDownloadGET(ctx fiber.Ctx) error {
 	if errResponse != nil {
 		return errResponse.Write(ctx)
 	}
-	authorizationHeader, tokenErr := servermw.ValidateAuthorizationHeader(ctx.Get("Authorization"))
-	if tokenErr != nil {
-		response := httputil.NewError("missing_authorization", tokenErr.Error(), http.StatusUnauthorized, map[string]any{"project_id": projectID}, nil)
-		response.WriteLog(handler.logger)
-		return response.Write(ctx)
-	}
-	path := strings.Trim(ctx.Params("*"), "/")
-	requestedRef := strings.TrimSpace(ctx.Query("ref"))
-	metadata, _, err := handler.gitService.GetGitHubFileMetadata(ctx.Context(), authorizationHeader, organization, project, identity, requestedRef, path)
-	if err != nil {
-		statusCode := http.StatusNotFound
-		code := "not_found"
-		message := fmt.Sprintf("failed to download git file: %s", err)
-		if statusErr, ok := err.(*git.HTTPStatusError); ok {
-			statusCode = statusErr.StatusCode
-			code = statusErr.Code
-			message = statusErr.Message
-		}
-		response := httputil.NewError(apierror.Type(code), message, statusCode, map[string]any{"project_id": projectID, "ref": requestedRef, "path": path}, nil)
-		response.WriteLog(handler.logger)
-		return response.Write(ctx)
+	defer handler.holdGitMirror(identity)()
+	state, repo, errResponse := handler.localGitProjectMirror(projectID, identity)
+	if errResponse != nil {
+		return errResponse.Write(ctx)
 	}
-	if metadata == nil || strings.TrimSpace(metadata.GetDownloadURL()) == "" {
-		response := httputil.NewError("integration_error", "github download url is unavailable for this file", http.StatusBadGateway, map[string]any{"project_id": projectID, "ref": requestedRef, "path": path}, nil)
-		response.WriteLog(handler.logger)
-		return response.Write(ctx)
+	if repo == nil {
+		return handler.redirectToGitHubDownload(ctx, organization, project, projectID, identity, true)
 	}
-	return ctx.Redirect().To(strings.TrimSpace(metadata.GetDownloadURL()))
+	return handler.serveGitBlob(ctx, projectID, state, repo, true)
 }
@@ -3,6 +3,7 @@ package git
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
@@ -63,58 +64,36 @@ func (handler *Handler) ensureMirrorReadyForUpload(ctx context.Context, authoriz
 	return updatedState, nil
 }
 
-func sessionFilesFromManifest(sessionID string, subdirectory string, baseBranch string, files []git.GitUploadSessionFileManifest, mirrorState *geckodb.GitProjectState) ([]geckodb.GitUploadSessionFile, bool, error) {
+// sessionFilesFromManifest plans a manifest against baseRef in the mirror: a
+// branch for a new session, the session's base SHA for a later manifest
+// page. claimed holds the paths earlier pages already use, which collide
+// like duplicates within a page; it may be nil. Added files whose target
+// path is taken are resolved with conflictPolicy, and stamp names the
+// directory rename_subdirectory moves them to.
+func sessionFilesFromManifest(sessionID string, subdirectory string, baseRef string, files []git.GitUploadSessionFileManifest, operations []git.GitUploadSessionOperation, policy git.GitUploadPolicy, conflictPolicy string, stamp time.Time, mirrorState *geckodb.GitProjectState, claimed map[string]struct{}) ([]geckodb.GitUploadSessionFile, string, bool, error) {
 	openedRepo, err := git.OpenRepository(mirrorState.MirrorPath)
 	if err != nil {
-		return nil, false, err
+		return nil, "", false, err
 	}
-	refName, hash, err := git.ResolveGitReference(openedRepo, baseBranch, mirrorState.DefaultBranch.String)
+	refName, hash, err := git.ResolveGitReference(openedRepo, baseRef, mirrorState.DefaultBranch.String)
 	if err != nil {
-		return nil, false, err
+		return nil, "", false, err
 	}
 	_ = refName
-	sessionFiles := make([]geckodb.GitUploadSessionFile, 0, len(files))
-	hasConflicts := false
-	seenPaths := make(map[string]struct{}, len(files))
-	for _, manifest := range files {
-		fileName, err := git.NormalizeGitUploadFileName(manifest.Name)
-		if err != nil {
-			return nil, false, err
-		}
-		targetPath := git.BuildGitUploadTargetPath(subdirectory, fileName)
-		targetPath = strings.Trim(strings.TrimSpace(targetPath), "/")
-		if _, ok := seenPaths[targetPath]; ok {
-			sessionFiles = append(sessionFiles, geckodb.GitUploadSessionFile{
-				SessionID:  sessionID,
-				FileName:   fileName,
-				TargetPath: targetPath,
-				Size:       manifest.Size,
-				Status:     git.GitUploadFileCollision,
-				Error:      sql.NullString{String: "duplicate target path in upload batch", Valid: true},
-			})
-			hasConflicts = true
-			continue
-		}
-		seenPaths[targetPath] = struct{}{}
-		exists, err := git.GitPathExistsInRef(openedRepo, hash, targetPath)
-		if err != nil {
-			return nil, false, err
-		}
-		fileState := geckodb.GitUploadSessionFile{
-			SessionID:  sessionID,
-			FileName:   fileName,
-			TargetPath: targetPath,
-			Size:       manifest.Size,
-			Status:     git.GitUploadFilePending,
-		}
-		if exists {
-			fileState.Status = git.GitUploadFileCollision
-			fileState.Error = sql.NullString{String: "target path already exists on base branch", Valid: true}
-			hasConflicts = true
-		}
-		sessionFiles = append(sessionFiles, fileState)
+	seenPaths := make(map[string]struct{}, len(files)+len(claimed))
+	for claimedPath := range claimed {
+		seenPaths[claimedPath] = struct{}{}
 	}
-	return sessionFiles, hasConflicts, nil
+	sessionFiles, hasConflicts, err := git.PlanGitUploadFiles(openedRepo, hash, sessionID, subdirectory, files, policy, conflictPolicy, stamp, seenPaths)
+	if err != nil {
+		return nil, "", false, err
+	}
+	operationFiles, operationConflicts, err := git.PlanGitUploadOperations(openedRepo, hash, sessionID, operations, policy, seenPaths)
+	if err != nil {
+		return nil, "", false, err
+	}
+	sessionFiles = append(sessionFiles, operationFiles...)
+	return sessionFiles, hash.String(), hasConflicts || operationConflicts, nil
 }
 
 func (handler *Handler) handleGitProjectUploadSessionPOST(ctx fiber.Ctx) error {
@@ -122,6 +101,7 @@ func (handler *Handler) handleGitProjectUploadSessionPOST(ctx fiber.Ctx) error {
 	if errResponse != nil {
 		return errResponse.Write(ctx)
 	}
+	defer handler.holdGitMirror(identity)()
 	authorizationHeader, tokenErr := servermw.ValidateAuthorizationHeader(ctx.Get("Authorization"))
 	if tokenErr != nil {
 		response := httputil.NewError("missing_authorization", tokenErr.Error(), http.StatusUnauthorized, map[string]any{"project_id": projectID}, nil)
@@ -146,16 +126,37 @@ func (handler *Handler) handleGitProjectUploadSessionPOST(ctx fiber.Ctx) error {
 		response.WriteLog(handler.logger)
 		return response.Write(ctx)
 	}
-	if len(requestBody.Files) == 0 {
-		response := httputil.NewError("invalid_request", "at least one file is required", http.StatusBadRequest, map[string]any{"project_id": projectID}, nil)
+	if len(requestBody.Files) == 0 && len(requestBody.Operations) == 0 && !requestBody.Partial {
+		response := httputil.NewError("invalid_request", "at least one file or operation is required", http.StatusBadRequest, map[string]any{"project_id": projectID}, nil)
 		response.WriteLog(handler.logger)
 		return response.Write(ctx)
 	}
+	commitMode, err := git.NormalizeGitUploadCommitMode(requestBody.CommitMode)
+	if err != nil {
+		return handler.writeAppError(ctx, err)
+	}
+	conflictPolicy, err := git.NormalizeGitUploadConflictPolicy(requestBody.ConflictPolicy)
+	if err != nil {
+		return handler.writeAppError(ctx, err)
+	}
+	if conflictPolicy == "" {
+		conflictPolicy = git.GitUploadConflictFail
+	}
+	branchName := git.BuildGitUploadBranchName(project)
+	if commitMode == git.GitUploadCommitDirect {
+		if errResponse := handler.authorizeDirectCommit(authorizationHeader, organization, project); errResponse != nil {
+			return errResponse.Write(ctx)
+		}
+		branchName = strings.TrimSpace(requestBody.Branch)
+		if branchName == "" {
+			branchName = baseBranch
+		}
+	}
 	targetSubdir := git.NormalizeGitUploadSubdirectory(requestBody.TargetSubdir)
 	sessionID := uuid.NewString()
 	prepareCtx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
 	defer cancel()
-	state, err := handler.ensureMirrorReadyForUpload(prepareCtx, authorizationHeader, projectID, identity, state)
+	state, err = handler.ensureMirrorReadyForUpload(prepareCtx, authorizationHeader, projectID, identity, state)
 	if err != nil {
 		if statusErr, ok := err.(*git.HTTPStatusError); ok {
 			response := httputil.NewError(apierror.Type(statusErr.Code), statusErr.Message, statusErr.StatusCode, map[string]any{"project_id": projectID}, nil)
@@ -166,13 +167,29 @@ func (handler *Handler) handleGitProjectUploadSessionPOST(ctx fiber.Ctx) error {
 		response.WriteLog(handler.logger)
 		return response.Write(ctx)
 	}
-	files, hasConflicts, err := sessionFilesFromManifest(sessionID, targetSubdir, baseBranch, requestBody.Files, state)
+	// A direct commit lands on branchName, so its files are planned against
+	// that branch's head rather than the base branch.
+	planRef := baseBranch
+	if commitMode == git.GitUploadCommitDirect {
+		for _, branch := range []string{baseBranch, branchName} {
+			if errResponse := handler.ensureMirrorBranch(projectID, state, branch); errResponse != nil {
+				return errResponse.Write(ctx)
+			}
+		}
+		planRef = branchName
+	}
+	now := time.Now().UTC()
+	files, baseSHA, hasConflicts, err := sessionFilesFromManifest(sessionID, targetSubdir, planRef, requestBody.Files, requestBody.Operations, handler.uploadPolicy, conflictPolicy, now, state, nil)
 	if err != nil {
+		var appErr *git.Error
+		if errors.As(err, &appErr) {
+			return handler.writeAppError(ctx, appErr)
+		}
 		response := httputil.NewError("integration_error", fmt.Sprintf("failed to prepare upload session: %s", err), http.StatusBadGateway, map[string]any{"project_id": projectID}, nil)
 		response.WriteLog(handler.logger)
 		return response.Write(ctx)
 	}
-	now := time.Now().UTC()
+	createdBy, _ := handler.authenticatedUserID(ctx)
 	session := geckodb.GitUploadSession{
 		ID:           sessionID,
 		ProjectID:    projectID,
@@ -183,13 +200,20 @@ func (handler *Handler) handleGitProjectUploadSessionPOST(ctx fiber.Ctx) error {
 		RepoName:     identity.Repo,
 		BaseBranch:   baseBranch,
 		TargetSubdir: sql.NullString{String: targetSubdir, Valid: targetSubdir != ""},
-		BranchName:   git.BuildGitUploadBranchName(project),
-		PRTitle:      git.BuildDefaultUploadPRTitle(project, len(requestBody.Files)),
+		BranchName:   branchName,
+		PRTitle:      git.BuildDefaultGitUploadPRTitle(project, files),
 		PRBody:       git.BuildDefaultUploadPRBody(baseBranch, targetSubdir),
-		Status:       git.GitUploadSessionPending,
+		CommitMode:   commitMode,
+		BaseSHA:      sql.NullString{String: baseSHA, Valid: baseSHA != ""},
 		CreatedAt:    now,
 		UpdatedAt:    now,
+		ExpiresAt:    git.GitUploadSessionExpiry(now, handler.uploadTTL),
 	}
+	// A partial manifest stays open for more pages.
+	session.ManifestComplete = !requestBody.Partial
+	session.ConflictPolicy = conflictPolicy
+	session.Status = git.GitUploadSessionStatus(session, files)
+	session.CreatedByUserID = sql.NullString{String: createdBy, Valid: createdBy != ""}
 	if hasConflicts {
 		session.Status = git.GitUploadSessionPending
 	}
@@ -227,6 +251,99 @@ func (handler *Handler) resolveGitUploadSession(projectID string, sessionID stri
 	return session, files, nil
 }
 
+// rejectClosedUploadSession fails requests that would change a cancelled or
+// expired session.
+func (handler *Handler) rejectClosedUploadSession(session *geckodb.GitUploadSession) *httputil.ErrorResponse {
+	if session.Status != git.GitUploadSessionCancelled && session.Status != git.GitUploadSessionExpired {
+		return nil
+	}
+	response := httputil.NewError("conflict", fmt.Sprintf("upload session is %s", session.Status), http.StatusConflict, map[string]any{"project_id": session.ProjectID, "session_id": session.ID, "status": session.Status}, nil)
+	response.WriteLog(handler.logger)
+	return response
+}
+
+// touchUploadSession records an upload on session: its recomputed status,
+// updated_at and a new expiry. Only those columns are written, and a session
+// that was cancelled or expired while the request ran is reported as a
+// conflict.
+func (handler *Handler) touchUploadSession(ctx context.Context, session *geckodb.GitUploadSession, files []geckodb.GitUploadSessionFile) *httputil.ErrorResponse {
+	details := map[string]any{"project_id": session.ProjectID, "session_id": session.ID}
+	session.Status = git.GitUploadSessionStatus(*session, files)
+	session.UpdatedAt = time.Now().UTC()
+	session.ExpiresAt = git.GitUploadSessionExpiry(session.UpdatedAt, handler.uploadTTL)
+	open, err := geckodb.TouchGitUploadSessionContext(ctx, handler.db, session.ID, session.Status, session.UpdatedAt, session.ExpiresAt)
+	if err != nil {
+		response := httputil.NewError(apierror.TypeDatabaseError, fmt.Sprintf("failed to update upload session: %s", err), http.StatusInternalServerError, details, nil)
+		response.WriteLog(handler.logger)
+		return response
+	}
+	if !open {
+		response := httputil.NewError("conflict", "upload session was closed while the request ran", http.StatusConflict, details, nil)
+		response.WriteLog(handler.logger)
+		return response
+	}
+	return nil
+}
+
+// mirrorGitAttributes reads the root .gitattributes of baseBranch from the
+// project mirror. When the mirror cannot be read it returns a source with no
+// commit, so finalize reads the file from GitHub instead.
+func (handler *Handler) mirrorGitAttributes(projectID string, identity git.GitRepositoryIdentity, baseBranch string) *git.GitAttributesSource {
+	state, err := handler.loadGitProjectState(projectID, identity)
+	if err != nil || state == nil {
+		return &git.GitAttributesSource{Policy: &handler.uploadPolicy}
+	}
+	repo, err := git.OpenRepository(state.MirrorPath)
+	if err != nil {
+		return &git.GitAttributesSource{Policy: &handler.uploadPolicy}
+	}
+	_, hash, err := git.ResolveGitReference(repo, baseBranch, state.DefaultBranch.String)
+	if err != nil {
+		return &git.GitAttributesSource{Policy: &handler.uploadPolicy}
+	}
+	attributes, err := git.ReadGitAttributes(repo, hash)
+	if err != nil {
+		handler.logger.Warning("failed to read .gitattributes of %s from the mirror: %s", projectID, err)
+		return &git.GitAttributesSource{Policy: &handler.uploadPolicy}
+	}
+	attributes.Policy = &handler.uploadPolicy
+	return attributes
+}
+
+// gitUploadNeedsObjects reports whether any of files is committed from a
+// DRS object that finalize has to verify.
+func gitUploadNeedsObjects(files []geckodb.GitUploadSessionFile) bool {
+	for _, file := range files {
+		if git.GitUploadFileNeedsObject(file) {
+			return true
+		}
+	}
+	return false
+}
+
+// writeInvalidUploadSessionObjects moves a session whose DRS objects failed
+// verification back to pending_upload and reports the failing files.
+func (handler *Handler) writeInvalidUploadSessionObjects(ctx fiber.Ctx, session *geckodb.GitUploadSession, files []geckodb.GitUploadSessionFile) error {
+	details := map[string]any{"project_id": session.ProjectID, "session_id": session.ID}
+	session.Status = git.GitUploadSessionStatus(*session, files)
+	session.UpdatedAt = time.Now().UTC()
+	if _, err := geckodb.UpdateGitUploadSessionStatusContext(ctx.Context(), handler.db, session.ID, []string{git.GitUploadSessionPending, git.GitUploadSessionReady}, session.Status, session.UpdatedAt); err != nil {
+		response := httputil.NewError(apierror.TypeDatabaseError, fmt.Sprintf("failed to update upload session: %s", err), http.StatusInternalServerError, details, nil)
+		response.WriteLog(handler.logger)
+		return response.Write(ctx)
+	}
+	invalid := []map[string]any{}
+	for _, file := range files {
+		if file.Status == git.GitUploadFileInvalid {
+			invalid = append(invalid, map[string]any{"target_path": file.TargetPath, "drs_object_id": file.DRSObjectID.String, "error": file.Error.String})
+		}
+	}
+	details["files"] = invalid
+	response := httputil.NewError("conflict", fmt.Sprintf("%d upload session files do not match their DRS objects", len(invalid)), http.StatusConflict, details, nil)
+	response.WriteLog(handler.logger)
+	return response.Write(ctx)
+}
+
 func (handler *Handler) handleGitProjectUploadSessionGET(ctx fiber.Ctx) error {
 	_, _, projectID, _, _, errResponse := handler.resolveGitProject(ctx)
 	if errResponse != nil {
@@ -237,6 +354,7 @@ func (handler *Handler) handleGitProjectUploadSessionGET(ctx fiber.Ctx) error {
 	if errResponse != nil {
 		return errResponse.Write(ctx)
 	}
+	handler.pollUploadPullRequest(ctx, session)
 	return httputil.JSON(git.BuildGitUploadSessionResponse(*session, files), http.StatusOK).Write(ctx)
 }
 
@@ -250,6 +368,12 @@ func (handler *Handler) handleGitProjectUploadSessionFilesPOST(ctx fiber.Ctx) er
 	if errResponse != nil {
 		return errResponse.Write(ctx)
 	}
+	if errResponse := handler.rejectClosedUploadSession(session); errResponse != nil {
+		return errResponse.Write(ctx)
+	}
+	if errResponse := handler.rejectFinalizingUploadSession(session); errResponse != nil {
+		return errResponse.Write(ctx)
+	}
 	var requestBody git.GitUploadSessionAttachFilesRequest
 	if errResponse := httputil.ParseJSONBody(ctx.Body(), &requestBody, map[string]any{"project_id": projectID, "session_id": sessionID}); errResponse != nil {
 		errResponse.WriteLog(handler.logger)
@@ -259,6 +383,7 @@ func (handler *Handler) handleGitProjectUploadSessionFilesPOST(ctx fiber.Ctx) er
 	for i := range files {
 		fileMap[files[i].TargetPath] = &files[i]
 	}
+	attached := make([]*geckodb.GitUploadSessionFile, 0, len(requestBody.Files))
 	for _, attachment := range requestBody.Files {
 		targetPath := strings.Trim(strings.TrimSpace(attachment.TargetPath), "/")
 		fileState, ok := fileMap[targetPath]
@@ -267,31 +392,44 @@ func (handler *Handler) handleGitProjectUploadSessionFilesPOST(ctx fiber.Ctx) er
 			response.WriteLog(handler.logger)
 			return response.Write(ctx)
 		}
+		if fileState.Status == git.GitUploadFileSkipped {
+			response := httputil.NewError("invalid_request", fmt.Sprintf("target path %s is skipped because it exists on the base branch and takes no upload", targetPath), http.StatusBadRequest, map[string]any{"project_id": projectID, "session_id": sessionID}, nil)
+			response.WriteLog(handler.logger)
+			return response.Write(ctx)
+		}
+		if !git.GitUploadFileNeedsContent(*fileState) {
+			response := httputil.NewError("invalid_request", fmt.Sprintf("target path %s is a %s operation and takes no upload", targetPath, git.GitUploadFileOperation(*fileState)), http.StatusBadRequest, map[string]any{"project_id": projectID, "session_id": sessionID}, nil)
+			response.WriteLog(handler.logger)
+			return response.Write(ctx)
+		}
+		if git.GitUploadFileInline(*fileState) {
+			response := httputil.NewError("invalid_request", fmt.Sprintf("target path %s is an inline file; upload its content instead of attaching a DRS object", targetPath), http.StatusBadRequest, map[string]any{"project_id": projectID, "session_id": sessionID}, nil)
+			response.WriteLog(handler.logger)
+			return response.Write(ctx)
+		}
+		if strings.TrimSpace(attachment.DRSObjectID) == "" {
+			response := httputil.NewError("invalid_request", fmt.Sprintf("target path %s needs a drs_object_id", targetPath), http.StatusBadRequest, map[string]any{"project_id": projectID, "session_id": sessionID}, nil)
+			response.WriteLog(handler.logger)
+			return response.Write(ctx)
+		}
 		fileState.Size = attachment.Size
 		fileState.Checksum = sql.NullString{String: strings.ToLower(strings.TrimSpace(attachment.Checksum)), Valid: strings.TrimSpace(attachment.Checksum) != ""}
 		fileState.DRSObjectID = sql.NullString{String: strings.TrimSpace(attachment.DRSObjectID), Valid: strings.TrimSpace(attachment.DRSObjectID) != ""}
+		fileState.ObjectCreated = attachment.Created
 		if fileState.Status != git.GitUploadFileCollision {
 			fileState.Status = git.GitUploadFileUploaded
 			fileState.Error = sql.NullString{}
 		}
+		attached = append(attached, fileState)
 	}
-	session.Status = git.GitUploadSessionReady
-	for _, file := range files {
-		if file.Status == git.GitUploadFileCollision {
-			session.Status = git.GitUploadSessionPending
-			break
-		}
-		if !file.Checksum.Valid || !file.DRSObjectID.Valid {
-			session.Status = git.GitUploadSessionPending
-		}
+	if errResponse := handler.touchUploadSession(ctx.Context(), session, files); errResponse != nil {
+		return errResponse.Write(ctx)
 	}
-	session.UpdatedAt = time.Now().UTC()
-	if err := geckodb.UpsertGitUploadSession(handler.db, *session); err != nil {
-		response := httputil.NewError(apierror.TypeDatabaseError, fmt.Sprintf("failed to update upload session: %s", err), http.StatusInternalServerError, map[string]any{"project_id": projectID, "session_id": sessionID}, nil)
-		response.WriteLog(handler.logger)
-		return response.Write(ctx)
+	changed := make([]geckodb.GitUploadSessionFile, 0, len(attached))
+	for _, fileState := range attached {
+		changed = append(changed, *fileState)
 	}
-	if err := geckodb.ReplaceGitUploadSessionFiles(handler.db, sessionID, files); err != nil {
+	if err := geckodb.UpsertGitUploadSessionFilesContext(ctx.Context(), handler.db, changed); err != nil {
 		response := httputil.NewError(apierror.TypeDatabaseError, fmt.Sprintf("failed to update upload session files: %s", err), http.StatusInternalServerError, map[string]any{"project_id": projectID, "session_id": sessionID}, nil)
 		response.WriteLog(handler.logger)
 		return response.Write(ctx)
@@ -304,6 +442,7 @@ func (handler *Handler) handleGitProjectUploadSessionFinalizePOST(ctx fiber.Ctx)
 	if errResponse != nil {
 		return errResponse.Write(ctx)
 	}
+	defer handler.holdGitMirror(identity)()
 	authorizationHeader, tokenErr := servermw.ValidateAuthorizationHeader(ctx.Get("Authorization"))
 	if tokenErr != nil {
 		response := httputil.NewError("missing_authorization", tokenErr.Error(), http.StatusUnauthorized, map[string]any{"project_id": projectID}, nil)
@@ -315,6 +454,21 @@ func (handler *Handler) handleGitProjectUploadSessionFinalizePOST(ctx fiber.Ctx)
 	if errResponse != nil {
 		return errResponse.Write(ctx)
 	}
+	if errResponse := handler.rejectClosedUploadSession(session); errResponse != nil {
+		return errResponse.Write(ctx)
+	}
+	idempotencyKey, err := git.CheckGitUploadIdempotencyKey(*session, ctx.Get("Idempotency-Key"))
+	if err != nil {
+		return handler.writeAppError(ctx, err)
+	}
+	if session.Status == git.GitUploadSessionFinalized {
+		// A retry of a finalize that already succeeded gets its result again.
+		return httputil.JSON(git.BuildGitUploadSessionResponse(*session, files), http.StatusOK).Write(ctx)
+	}
+	readKey := session.IdempotencyKey
+	if idempotencyKey != "" {
+		session.IdempotencyKey = sql.NullString{String: idempotencyKey, Valid: true}
+	}
 	var requestBody git.GitUploadSessionFinalizeRequest
 	if len(ctx.Body()) > 0 {
 		if errResponse := httputil.ParseJSONBody(ctx.Body(), &requestBody, map[string]any{"project_id": projectID, "session_id": sessionID}); errResponse != nil {
@@ -328,23 +482,66 @@ func (handler *Handler) handleGitProjectUploadSessionFinalizePOST(ctx fiber.Ctx)
 	if strings.TrimSpace(requestBody.PRBody) != "" {
 		session.PRBody = strings.TrimSpace(requestBody.PRBody)
 	}
+	if !session.ManifestComplete {
+		response := httputil.NewError("conflict", "upload session manifest is incomplete; append its last page first", http.StatusConflict, map[string]any{"project_id": projectID, "session_id": sessionID}, nil)
+		response.WriteLog(handler.logger)
+		return response.Write(ctx)
+	}
 	for _, file := range files {
 		if file.Status == git.GitUploadFileCollision {
 			response := httputil.NewError("conflict", "upload session contains target path conflicts", http.StatusConflict, map[string]any{"project_id": projectID, "session_id": sessionID}, nil)
 			response.WriteLog(handler.logger)
 			return response.Write(ctx)
 		}
-		if !file.Checksum.Valid || !file.DRSObjectID.Valid {
+		if !git.GitUploadFileAttached(file) {
 			response := httputil.NewError("conflict", fmt.Sprintf("upload session file %s is not fully attached", file.TargetPath), http.StatusConflict, map[string]any{"project_id": projectID, "session_id": sessionID}, nil)
 			response.WriteLog(handler.logger)
 			return response.Write(ctx)
 		}
 	}
-	finalizeCtx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	if errResponse := handler.claimUploadFinalize(ctx.Context(), session, readKey, idempotencyKey, git.GitUploadFinalizeTimeout(files)); errResponse != nil {
+		return errResponse.Write(ctx)
+	}
+	defer handler.releaseUploadFinalize(session)
+	if gitUploadNeedsObjects(files) {
+		// Unverified objects are never committed, so finalize waits for
+		// syfon rather than skipping the check.
+		if !handler.lfsDownloads.Configured() {
+			response := httputil.NewError("service_unavailable", "DRS object verification is not configured", http.StatusServiceUnavailable, map[string]any{"project_id": projectID, "session_id": sessionID}, nil)
+			response.WriteLog(handler.logger)
+			return response.Write(ctx)
+		}
+		invalid, err := handler.lfsDownloads.VerifyUploadSessionObjects(ctx.Context(), authorizationHeader, *session, files)
+		if err != nil {
+			return handler.writeAppError(ctx, err)
+		}
+		if err := geckodb.UpsertGitUploadSessionFilesContext(ctx.Context(), handler.db, files); err != nil {
+			response := httputil.NewError(apierror.TypeDatabaseError, fmt.Sprintf("failed to record upload session verification: %s", err), http.StatusInternalServerError, map[string]any{"project_id": projectID, "session_id": sessionID}, nil)
+			response.WriteLog(handler.logger)
+			return response.Write(ctx)
+		}
+		if invalid > 0 {
+			return handler.writeInvalidUploadSessionObjects(ctx, session, files)
+		}
+	}
+	if errResponse := handler.loadInlineUploadContents(ctx.Context(), session, files); errResponse != nil {
+		return errResponse.Write(ctx)
+	}
+	if git.GitUploadSessionCommitMode(*session) == git.GitUploadCommitDirect {
+		return handler.finalizeDirectUploadSession(ctx, authorizationHeader, identity, session, files)
+	}
+	finalizeCtx, cancel := context.WithTimeout(context.Background(), git.GitUploadFinalizeTimeout(files))
 	defer cancel()
 	org, project, _ := strings.Cut(projectID, "/")
-	commitSHA, prURL, err := handler.gitService.CreateGitHubUploadPullRequest(finalizeCtx, authorizationHeader, org, project, identity, session.BaseBranch, session.BranchName, session.PRTitle, session.PRBody, files)
+	attributes := handler.mirrorGitAttributes(projectID, identity, session.BaseBranch)
+	recorder := &uploadFinalizeRecorder{handler: handler, session: session}
+	pullRequest, err := handler.gitService.CreateGitHubUploadPullRequest(finalizeCtx, authorizationHeader, org, project, identity, session.BaseBranch, session.BranchName, session.PRTitle, session.PRBody, files, attributes, git.GitUploadSessionFinalizeProgress(*session), recorder)
 	if err != nil {
+		handler.recordUploadFinalizeError(session, err)
+		var appErr *git.Error
+		if errors.As(err, &appErr) {
+			return handler.writeAppError(ctx, appErr)
+		}
 		if statusErr, ok := err.(*git.HTTPStatusError); ok {
 			response := httputil.NewError(apierror.Type(statusErr.Code), statusErr.Message, statusErr.StatusCode, map[string]any{"project_id": projectID, "session_id": sessionID}, nil)
 			response.WriteLog(handler.logger)
@@ -354,14 +551,23 @@ func (handler *Handler) handleGitProjectUploadSessionFinalizePOST(ctx fiber.Ctx)
 		response.WriteLog(handler.logger)
 		return response.Write(ctx)
 	}
+	prURL := pullRequest.URL
 	session.Status = git.GitUploadSessionFinalized
-	session.CommitSHA = sql.NullString{String: commitSHA, Valid: commitSHA != ""}
+	session.CommitSHA = sql.NullString{String: pullRequest.CommitSHA, Valid: pullRequest.CommitSHA != ""}
 	session.PullRequestURL = sql.NullString{String: prURL, Valid: prURL != ""}
+	session.PRState = sql.NullString{String: git.GitPullRequestOpen, Valid: prURL != ""}
+	session.AttributesAdded = pullRequest.GitAttributesAdded
+	session.LastError = sql.NullString{}
+	if number := git.ParseGitPullRequestNumber(prURL); number != 0 {
+		session.PRNumber = sql.NullInt64{Int64: number, Valid: true}
+	}
 	session.UpdatedAt = time.Now().UTC()
-	if err := geckodb.UpsertGitUploadSession(handler.db, *session); err != nil {
+	session.ExpiresAt = sql.NullTime{}
+	if err := geckodb.FinishGitUploadSessionFinalizeContext(ctx.Context(), handler.db, *session); err != nil {
 		response := httputil.NewError(apierror.TypeDatabaseError, fmt.Sprintf("failed to persist finalized upload session: %s", err), http.StatusInternalServerError, map[string]any{"project_id": projectID, "session_id": sessionID}, nil)
 		response.WriteLog(handler.logger)
 		return response.Write(ctx)
 	}
+	handler.dropInlineUploadContents(ctx.Context(), session)
 	return httputil.JSON(git.BuildGitUploadSessionResponse(*session, files), http.StatusOK).Write(ctx)
 }
@@ -0,0 +1,131 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/calypr/gecko/apierror"
+	geckodb "github.com/calypr/gecko/internal/db"
+	"github.com/calypr/gecko/internal/git"
+	"github.com/calypr/gecko/internal/httputil"
+	servermw "github.com/calypr/gecko/internal/server/middleware"
+	"github.com/gofiber/fiber/v3"
+)
+
+// handleGitProjectUploadSessionConflictsPOST changes the conflict policy of
+// a session or the policy and target path of some of its conflicted files,
+// then evaluates every conflicted file again against the base commit of the
+// session in the refreshed mirror. Files a policy renames keep their
+// attachments and stored content.
+func (handler *Handler) handleGitProjectUploadSessionConflictsPOST(ctx fiber.Ctx) error {
+	_, _, projectID, _, identity, errResponse := handler.resolveGitProject(ctx)
+	if errResponse != nil {
+		return errResponse.Write(ctx)
+	}
+	defer handler.holdGitMirror(identity)()
+	authorizationHeader, tokenErr := servermw.ValidateAuthorizationHeader(ctx.Get("Authorization"))
+	if tokenErr != nil {
+		response := httputil.NewError("missing_authorization", tokenErr.Error(), http.StatusUnauthorized, map[string]any{"project_id": projectID}, nil)
+		response.WriteLog(handler.logger)
+		return response.Write(ctx)
+	}
+	sessionID := strings.TrimSpace(ctx.Params("sessionID"))
+	session, files, errResponse := handler.resolveGitUploadSession(projectID, sessionID)
+	if errResponse != nil {
+		return errResponse.Write(ctx)
+	}
+	if errResponse := handler.rejectClosedUploadSession(session); errResponse != nil {
+		return errResponse.Write(ctx)
+	}
+	if errResponse := handler.rejectFinalizingUploadSession(session); errResponse != nil {
+		return errResponse.Write(ctx)
+	}
+	details := map[string]any{"project_id": projectID, "session_id": sessionID}
+	if session.Status == git.GitUploadSessionFinalized {
+		response := httputil.NewError("conflict", "upload session is already finalized", http.StatusConflict, details, nil)
+		response.WriteLog(handler.logger)
+		return response.Write(ctx)
+	}
+	var requestBody git.GitUploadSessionConflictsRequest
+	if len(ctx.Body()) > 0 {
+		if errResponse := httputil.ParseJSONBody(ctx.Body(), &requestBody, details); errResponse != nil {
+			errResponse.WriteLog(handler.logger)
+			return errResponse.Write(ctx)
+		}
+	}
+	conflictPolicy, err := git.NormalizeGitUploadConflictPolicy(requestBody.ConflictPolicy)
+	if err != nil {
+		return handler.writeAppError(ctx, err)
+	}
+	if conflictPolicy != "" {
+		session.ConflictPolicy = conflictPolicy
+	}
+	if err := git.ApplyGitUploadConflictChanges(files, requestBody.Files); err != nil {
+		return handler.writeAppError(ctx, err)
+	}
+	state, errResponse := handler.ensureConnectedMirrorProject(projectID, identity)
+	if errResponse != nil {
+		return errResponse.Write(ctx)
+	}
+	prepareCtx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+	state, err = handler.ensureMirrorReadyForUpload(prepareCtx, authorizationHeader, projectID, identity, state)
+	if err != nil {
+		if statusErr, ok := err.(*git.HTTPStatusError); ok {
+			response := httputil.NewError(apierror.Type(statusErr.Code), statusErr.Message, statusErr.StatusCode, details, nil)
+			response.WriteLog(handler.logger)
+			return response.Write(ctx)
+		}
+		response := httputil.NewError("integration_error", fmt.Sprintf("failed to prepare upload session: %s", err), http.StatusBadGateway, details, nil)
+		response.WriteLog(handler.logger)
+		return response.Write(ctx)
+	}
+	resolved, moved, err := reevaluateSessionConflicts(session, files, state)
+	if err != nil {
+		var appErr *git.Error
+		if errors.As(err, &appErr) {
+			return handler.writeAppError(ctx, appErr)
+		}
+		response := httputil.NewError("integration_error", fmt.Sprintf("failed to evaluate upload session conflicts: %s", err), http.StatusBadGateway, details, nil)
+		response.WriteLog(handler.logger)
+		return response.Write(ctx)
+	}
+	session.PRTitle = git.BuildDefaultGitUploadPRTitle(session.Project, files)
+	session.Status = git.GitUploadSessionStatus(*session, files)
+	session.UpdatedAt = time.Now().UTC()
+	session.ExpiresAt = git.GitUploadSessionExpiry(session.UpdatedAt, handler.uploadTTL)
+	if err := geckodb.MoveGitUploadSessionFilesContext(ctx.Context(), handler.db, sessionID, moved, resolved); err != nil {
+		response := httputil.NewError(apierror.TypeDatabaseError, fmt.Sprintf("failed to update upload session files: %s", err), http.StatusInternalServerError, details, nil)
+		response.WriteLog(handler.logger)
+		return response.Write(ctx)
+	}
+	if err := geckodb.UpsertGitUploadSession(handler.db, *session); err != nil {
+		response := httputil.NewError(apierror.TypeDatabaseError, fmt.Sprintf("failed to update upload session: %s", err), http.StatusInternalServerError, details, nil)
+		response.WriteLog(handler.logger)
+		return response.Write(ctx)
+	}
+	return httputil.JSON(git.BuildGitUploadSessionResponse(*session, files), http.StatusOK).Write(ctx)
+}
+
+// reevaluateSessionConflicts evaluates the conflicted files of session
+// again against its base commit, or its base branch when the session
+// predates base commits, in the mirror.
+func reevaluateSessionConflicts(session *geckodb.GitUploadSession, files []geckodb.GitUploadSessionFile, mirrorState *geckodb.GitProjectState) ([]geckodb.GitUploadSessionFile, map[string]string, error) {
+	openedRepo, err := git.OpenRepository(mirrorState.MirrorPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	baseRef := session.BaseSHA.String
+	if baseRef == "" {
+		baseRef = session.BaseBranch
+	}
+	_, hash, err := git.ResolveGitReference(openedRepo, baseRef, mirrorState.DefaultBranch.String)
+	if err != nil {
+		return nil, nil, err
+	}
+	return git.ReevaluateGitUploadConflicts(openedRepo, hash, files, git.GitUploadSessionConflictPolicy(*session), session.CreatedAt)
+}
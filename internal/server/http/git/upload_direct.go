@@ -0,0 +1,94 @@
+package git
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/calypr/gecko/apierror"
+	geckodb "github.com/calypr/gecko/internal/db"
+	"github.com/calypr/gecko/internal/git"
+	"github.com/calypr/gecko/internal/httputil"
+	servermw "github.com/calypr/gecko/internal/server/middleware"
+	"github.com/gofiber/fiber/v3"
+)
+
+// authorizeDirectCommit requires the caller to hold
+// git.GitUploadDirectCommitPermission on the project resource path or one of
+// its ancestors, as ProjectConfigAuth does for project configs.
+func (handler *Handler) authorizeDirectCommit(authorizationHeader string, organization string, project string) *httputil.ErrorResponse {
+	if handler.authz == nil {
+		response := httputil.NewError(apierror.TypeForbidden, "direct commits require authorization to be configured", http.StatusForbidden, map[string]any{"organization": organization, "project": project}, nil)
+		response.WriteLog(handler.logger)
+		return response
+	}
+	if response := servermw.CheckProjectPermission(handler.authz, authorizationHeader, git.GitUploadDirectCommitPermission, organization, project); response != nil {
+		response.WriteLog(handler.logger)
+		return response
+	}
+	return nil
+}
+
+// ensureMirrorBranch fails with a conflict when the project mirror has no
+// branch named branch.
+func (handler *Handler) ensureMirrorBranch(projectID string, state *geckodb.GitProjectState, branch string) *httputil.ErrorResponse {
+	details := map[string]any{"project_id": projectID, "branch": branch}
+	repo, err := git.OpenRepository(state.MirrorPath)
+	if err != nil {
+		response := httputil.NewError("integration_error", fmt.Sprintf("failed to open project mirror: %s", err), http.StatusBadGateway, details, nil)
+		response.WriteLog(handler.logger)
+		return response
+	}
+	if !git.GitBranchExists(repo, branch) {
+		response := httputil.NewError("conflict", fmt.Sprintf("branch %s does not exist; direct commits only update existing branches", branch), http.StatusConflict, details, nil)
+		response.WriteLog(handler.logger)
+		return response
+	}
+	return nil
+}
+
+// finalizeDirectUploadSession commits the files of a direct-commit session
+// straight to its branch and queues a mirror refresh.
+func (handler *Handler) finalizeDirectUploadSession(ctx fiber.Ctx, authorizationHeader string, identity git.GitRepositoryIdentity, session *geckodb.GitUploadSession, files []geckodb.GitUploadSessionFile) error {
+	details := map[string]any{"project_id": session.ProjectID, "session_id": session.ID}
+	if errResponse := handler.authorizeDirectCommit(authorizationHeader, session.Organization, session.Project); errResponse != nil {
+		return errResponse.Write(ctx)
+	}
+	finalizeCtx, cancel := context.WithTimeout(context.Background(), git.GitUploadFinalizeTimeout(files))
+	defer cancel()
+	attributes := handler.mirrorGitAttributes(session.ProjectID, identity, session.BranchName)
+	recorder := &uploadFinalizeRecorder{handler: handler, session: session}
+	commit, err := handler.gitService.CommitGitHubUploadDirect(finalizeCtx, authorizationHeader, session.Organization, session.Project, identity, session.BaseSHA.String, session.BranchName, session.PRTitle, files, attributes, git.GitUploadSessionFinalizeProgress(*session), recorder)
+	if err != nil {
+		handler.recordUploadFinalizeError(session, err)
+		var appErr *git.Error
+		if errors.As(err, &appErr) {
+			return handler.writeAppError(ctx, appErr)
+		}
+		if statusErr, ok := err.(*git.HTTPStatusError); ok {
+			response := httputil.NewError(apierror.Type(statusErr.Code), statusErr.Message, statusErr.StatusCode, details, nil)
+			response.WriteLog(handler.logger)
+			return response.Write(ctx)
+		}
+		response := httputil.NewError("integration_error", fmt.Sprintf("failed to commit upload session: %s", err), http.StatusBadGateway, details, nil)
+		response.WriteLog(handler.logger)
+		return response.Write(ctx)
+	}
+	session.Status = git.GitUploadSessionFinalized
+	session.CommitSHA = sql.NullString{String: commit.CommitSHA, Valid: commit.CommitSHA != ""}
+	session.AttributesAdded = commit.GitAttributesAdded
+	session.LastError = sql.NullString{}
+	session.UpdatedAt = time.Now().UTC()
+	session.ExpiresAt = sql.NullTime{}
+	if err := geckodb.FinishGitUploadSessionFinalizeContext(ctx.Context(), handler.db, *session); err != nil {
+		response := httputil.NewError(apierror.TypeDatabaseError, fmt.Sprintf("failed to persist finalized upload session: %s", err), http.StatusInternalServerError, details, nil)
+		response.WriteLog(handler.logger)
+		return response.Write(ctx)
+	}
+	handler.dropInlineUploadContents(ctx.Context(), session)
+	handler.queueUploadRefresh(ctx, session, authorizationHeader, "a direct upload commit to "+session.BranchName)
+	return httputil.JSON(git.BuildGitUploadSessionResponse(*session, files), http.StatusOK).Write(ctx)
+}
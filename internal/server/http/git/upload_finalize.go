@@ -0,0 +1,90 @@
+package git
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/calypr/gecko/apierror"
+	geckodb "github.com/calypr/gecko/internal/db"
+	"github.com/calypr/gecko/internal/git"
+	"github.com/calypr/gecko/internal/httputil"
+)
+
+// uploadFinalizeRecorder persists each finalize step on the session, so a
+// retried finalize skips the GitHub calls that already succeeded. The
+// session stops expiring once GitHub holds its files: the sweeper must not
+// release DRS objects a pushed tree points at.
+type uploadFinalizeRecorder struct {
+	handler *Handler
+	session *geckodb.GitUploadSession
+}
+
+func (recorder *uploadFinalizeRecorder) RecordFinalizeProgress(progress git.GitUploadFinalizeProgress) error {
+	git.ApplyGitUploadFinalizeProgress(recorder.session, progress)
+	recorder.session.UpdatedAt = time.Now().UTC()
+	recorder.session.ExpiresAt = sql.NullTime{}
+	return geckodb.RecordGitUploadSessionFinalizeProgressContext(context.Background(), recorder.handler.db, *recorder.session)
+}
+
+// gitUploadFinalizeClaim is how long a finalize holds its session, on top of
+// its GitHub timeout, before a retry may take over from one that died. It
+// covers verifying DRS objects and loading inline contents.
+const gitUploadFinalizeClaim = 5 * time.Minute
+
+// claimUploadFinalize claims the finalize of session before any GitHub work,
+// so concurrent finalize requests cannot both build commits or pull
+// requests. readKey is the Idempotency-Key the session had when it was read
+// and timeout is the finalize's GitHub timeout, which the claim outlasts.
+func (handler *Handler) claimUploadFinalize(ctx context.Context, session *geckodb.GitUploadSession, readKey sql.NullString, key string, timeout time.Duration) *httputil.ErrorResponse {
+	details := map[string]any{"project_id": session.ProjectID, "session_id": session.ID}
+	now := time.Now().UTC()
+	claimed, err := geckodb.ClaimGitUploadSessionFinalizeContext(ctx, handler.db, session.ID, readKey, key, now, now.Add(timeout+gitUploadFinalizeClaim))
+	if err != nil {
+		response := httputil.NewError(apierror.TypeDatabaseError, fmt.Sprintf("failed to claim upload session finalize: %s", err), http.StatusInternalServerError, details, nil)
+		response.WriteLog(handler.logger)
+		return response
+	}
+	if !claimed {
+		response := httputil.NewError("conflict", "upload session is already being finalized or changed since it was read; retry finalize", http.StatusConflict, details, nil)
+		response.WriteLog(handler.logger)
+		return response
+	}
+	session.UpdatedAt = now
+	return nil
+}
+
+// releaseUploadFinalize drops the finalize claim of session once the request
+// is done with it. Failures are logged; the claim then expires on its own.
+func (handler *Handler) releaseUploadFinalize(session *geckodb.GitUploadSession) {
+	if err := geckodb.ReleaseGitUploadSessionFinalizeContext(context.Background(), handler.db, session.ID); err != nil {
+		handler.logger.Warning("failed to release finalize of upload session %s: %s", session.ID, err)
+	}
+}
+
+// recordUploadFinalizeError stores why a finalize that already changed
+// GitHub stopped, so the session shows what a retry has to get past.
+// Failures are logged.
+func (handler *Handler) recordUploadFinalizeError(session *geckodb.GitUploadSession, finalizeErr error) {
+	if !session.FinalizeStep.Valid {
+		return
+	}
+	session.LastError = sql.NullString{String: finalizeErr.Error(), Valid: true}
+	session.UpdatedAt = time.Now().UTC()
+	if err := geckodb.RecordGitUploadSessionErrorContext(context.Background(), handler.db, session.ID, session.LastError.String, session.UpdatedAt); err != nil {
+		handler.logger.Warning("failed to record finalize error of upload session %s: %s", session.ID, err)
+	}
+}
+
+// rejectFinalizingUploadSession refuses changes to the files of a session
+// whose finalize already built its tree on GitHub.
+func (handler *Handler) rejectFinalizingUploadSession(session *geckodb.GitUploadSession) *httputil.ErrorResponse {
+	if !session.FinalizeStep.Valid || session.Status == git.GitUploadSessionFinalized {
+		return nil
+	}
+	response := httputil.NewError("conflict", fmt.Sprintf("upload session finalize stopped after the %s step; retry finalize", session.FinalizeStep.String), http.StatusConflict, map[string]any{"project_id": session.ProjectID, "session_id": session.ID, "finalize_step": session.FinalizeStep.String}, nil)
+	response.WriteLog(handler.logger)
+	return response
+}
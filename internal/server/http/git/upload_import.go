@@ -0,0 +1,169 @@
+package git
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/calypr/gecko/apierror"
+	geckodb "github.com/calypr/gecko/internal/db"
+	"github.com/calypr/gecko/internal/git"
+	"github.com/calypr/gecko/internal/httputil"
+	servermw "github.com/calypr/gecko/internal/server/middleware"
+	"github.com/gofiber/fiber/v3"
+	"github.com/google/uuid"
+)
+
+// handleGitProjectUploadImportPOST opens an upload session from a CSV or
+// TSV manifest of DRS objects already registered in syfon, so their LFS
+// pointers can be committed without uploading the data again. Every row is
+// resolved against syfon and checked against the base branch before the
+// session is created; when a row fails, nothing is created and the response
+// lists the errors by manifest line. The base branch and conflict policy
+// come from the base_branch and conflict_policy query parameters.
+func (handler *Handler) handleGitProjectUploadImportPOST(ctx fiber.Ctx) error {
+	organization, project, projectID, _, identity, errResponse := handler.resolveGitProject(ctx)
+	if errResponse != nil {
+		return errResponse.Write(ctx)
+	}
+	defer handler.holdGitMirror(identity)()
+	authorizationHeader, tokenErr := servermw.ValidateAuthorizationHeader(ctx.Get("Authorization"))
+	if tokenErr != nil {
+		response := httputil.NewError("missing_authorization", tokenErr.Error(), http.StatusUnauthorized, map[string]any{"project_id": projectID}, nil)
+		response.WriteLog(handler.logger)
+		return response.Write(ctx)
+	}
+	details := map[string]any{"project_id": projectID}
+	if handler.lfsDownloads == nil {
+		response := httputil.NewError("integration_error", "DRS storage is not configured", http.StatusBadGateway, details, nil)
+		response.WriteLog(handler.logger)
+		return response.Write(ctx)
+	}
+	state, errResponse := handler.ensureConnectedMirrorProject(projectID, identity)
+	if errResponse != nil {
+		return errResponse.Write(ctx)
+	}
+	baseBranch := strings.TrimSpace(ctx.Query("base_branch"))
+	if baseBranch == "" {
+		baseBranch = strings.TrimSpace(state.DefaultBranch.String)
+	}
+	if baseBranch == "" {
+		response := httputil.NewError("conflict", "repository has no default branch yet. Initialize your repo first before uploading files.", http.StatusConflict, details, nil)
+		response.WriteLog(handler.logger)
+		return response.Write(ctx)
+	}
+	conflictPolicy, err := git.NormalizeGitUploadConflictPolicy(ctx.Query("conflict_policy"))
+	if err != nil {
+		return handler.writeAppError(ctx, err)
+	}
+	if conflictPolicy == "" {
+		conflictPolicy = git.GitUploadConflictFail
+	}
+	content := ctx.Body()
+	rows, rowErrors, err := git.ParseGitUploadImportManifest(content, git.GitUploadImportDelimiter(ctx.Get("Content-Type"), content))
+	if err != nil {
+		return handler.writeAppError(ctx, err)
+	}
+	rows, resolveErrors, err := handler.lfsDownloads.ResolveUploadImportRows(ctx.Context(), authorizationHeader, organization, project, rows)
+	if err != nil {
+		return handler.writeAppError(ctx, err)
+	}
+	rowErrors = append(rowErrors, resolveErrors...)
+	if len(rowErrors) > 0 {
+		sort.SliceStable(rowErrors, func(a int, b int) bool {
+			return rowErrors[a].Line < rowErrors[b].Line
+		})
+		details["rows"] = rowErrors
+		response := httputil.NewError("invalid_request", fmt.Sprintf("%d import manifest rows are invalid", len(rowErrors)), http.StatusBadRequest, details, nil)
+		response.WriteLog(handler.logger)
+		return response.Write(ctx)
+	}
+	if len(rows) == 0 {
+		response := httputil.NewError("invalid_request", "import manifest has no rows", http.StatusBadRequest, details, nil)
+		response.WriteLog(handler.logger)
+		return response.Write(ctx)
+	}
+	sessionID := uuid.NewString()
+	prepareCtx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+	state, err = handler.ensureMirrorReadyForUpload(prepareCtx, authorizationHeader, projectID, identity, state)
+	if err != nil {
+		if statusErr, ok := err.(*git.HTTPStatusError); ok {
+			response := httputil.NewError(apierror.Type(statusErr.Code), statusErr.Message, statusErr.StatusCode, details, nil)
+			response.WriteLog(handler.logger)
+			return response.Write(ctx)
+		}
+		response := httputil.NewError("integration_error", fmt.Sprintf("failed to prepare upload session: %s", err), http.StatusBadGateway, details, nil)
+		response.WriteLog(handler.logger)
+		return response.Write(ctx)
+	}
+	now := time.Now().UTC()
+	files, baseSHA, err := sessionFilesFromImport(sessionID, baseBranch, rows, conflictPolicy, now, state)
+	if err != nil {
+		var appErr *git.Error
+		if errors.As(err, &appErr) {
+			return handler.writeAppError(ctx, appErr)
+		}
+		response := httputil.NewError("integration_error", fmt.Sprintf("failed to prepare upload session: %s", err), http.StatusBadGateway, details, nil)
+		response.WriteLog(handler.logger)
+		return response.Write(ctx)
+	}
+	createdBy, _ := handler.authenticatedUserID(ctx)
+	session := geckodb.GitUploadSession{
+		ID:           sessionID,
+		ProjectID:    projectID,
+		Organization: organization,
+		Project:      project,
+		RepoHost:     identity.Host,
+		RepoOwner:    identity.Owner,
+		RepoName:     identity.Repo,
+		BaseBranch:   baseBranch,
+		BranchName:   git.BuildGitUploadBranchName(project),
+		PRTitle:      git.BuildDefaultGitUploadPRTitle(project, files),
+		PRBody:       git.BuildDefaultUploadPRBody(baseBranch, ""),
+		CommitMode:   git.GitUploadCommitPullRequest,
+		BaseSHA:      sql.NullString{String: baseSHA, Valid: baseSHA != ""},
+		CreatedAt:    now,
+		UpdatedAt:    now,
+		ExpiresAt:    git.GitUploadSessionExpiry(now, handler.uploadTTL),
+	}
+	session.ManifestComplete = true
+	session.ConflictPolicy = conflictPolicy
+	session.Status = git.GitUploadSessionStatus(session, files)
+	session.CreatedByUserID = sql.NullString{String: createdBy, Valid: createdBy != ""}
+	if err := geckodb.UpsertGitUploadSession(handler.db, session); err != nil {
+		response := httputil.NewError(apierror.TypeDatabaseError, fmt.Sprintf("failed to persist upload session: %s", err), http.StatusInternalServerError, details, nil)
+		response.WriteLog(handler.logger)
+		return response.Write(ctx)
+	}
+	if err := geckodb.ReplaceGitUploadSessionFiles(handler.db, session.ID, files); err != nil {
+		response := httputil.NewError(apierror.TypeDatabaseError, fmt.Sprintf("failed to persist upload session files: %s", err), http.StatusInternalServerError, map[string]any{"project_id": projectID, "session_id": session.ID}, nil)
+		response.WriteLog(handler.logger)
+		return response.Write(ctx)
+	}
+	return httputil.JSON(git.BuildGitUploadSessionResponse(session, files), http.StatusOK).Write(ctx)
+}
+
+// sessionFilesFromImport plans resolved import rows against baseRef in the
+// mirror and returns the session files with the base commit they were
+// checked against.
+func sessionFilesFromImport(sessionID string, baseRef string, rows []git.GitUploadImportRow, conflictPolicy string, stamp time.Time, mirrorState *geckodb.GitProjectState) ([]geckodb.GitUploadSessionFile, string, error) {
+	openedRepo, err := git.OpenRepository(mirrorState.MirrorPath)
+	if err != nil {
+		return nil, "", err
+	}
+	_, hash, err := git.ResolveGitReference(openedRepo, baseRef, mirrorState.DefaultBranch.String)
+	if err != nil {
+		return nil, "", err
+	}
+	files, err := git.PlanGitUploadImport(openedRepo, hash, sessionID, rows, conflictPolicy, stamp)
+	if err != nil {
+		return nil, "", err
+	}
+	return files, hash.String(), nil
+}
@@ -0,0 +1,117 @@
+package git
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/calypr/gecko/apierror"
+	geckodb "github.com/calypr/gecko/internal/db"
+	"github.com/calypr/gecko/internal/git"
+	"github.com/calypr/gecko/internal/httputil"
+	"github.com/gofiber/fiber/v3"
+)
+
+// handleGitProjectUploadSessionContentPUT stores the request body as the
+// content of an inline session file. Uploading again replaces it.
+func (handler *Handler) handleGitProjectUploadSessionContentPUT(ctx fiber.Ctx) error {
+	_, _, projectID, _, _, errResponse := handler.resolveGitProject(ctx)
+	if errResponse != nil {
+		return errResponse.Write(ctx)
+	}
+	sessionID := strings.TrimSpace(ctx.Params("sessionID"))
+	session, files, errResponse := handler.resolveGitUploadSession(projectID, sessionID)
+	if errResponse != nil {
+		return errResponse.Write(ctx)
+	}
+	details := map[string]any{"project_id": projectID, "session_id": sessionID}
+	if !git.GitUploadSessionOpen(session.Status) {
+		response := httputil.NewError("conflict", fmt.Sprintf("upload session is %s", session.Status), http.StatusConflict, details, nil)
+		response.WriteLog(handler.logger)
+		return response.Write(ctx)
+	}
+	if errResponse := handler.rejectFinalizingUploadSession(session); errResponse != nil {
+		return errResponse.Write(ctx)
+	}
+	targetPath := strings.Trim(ctx.Params("*"), "/")
+	details["target_path"] = targetPath
+	var fileState *geckodb.GitUploadSessionFile
+	for i := range files {
+		if files[i].TargetPath == targetPath {
+			fileState = &files[i]
+		}
+	}
+	if fileState == nil {
+		response := httputil.NewError("invalid_request", fmt.Sprintf("upload session does not contain target path %s", targetPath), http.StatusBadRequest, details, nil)
+		response.WriteLog(handler.logger)
+		return response.Write(ctx)
+	}
+	if !git.GitUploadFileInline(*fileState) {
+		response := httputil.NewError("invalid_request", fmt.Sprintf("target path %s is not an inline file", targetPath), http.StatusBadRequest, details, nil)
+		response.WriteLog(handler.logger)
+		return response.Write(ctx)
+	}
+	content := append([]byte(nil), ctx.Body()...)
+	checksum, err := handler.uploadPolicy.CheckInlineContent(targetPath, content)
+	if err != nil {
+		return handler.writeAppError(ctx, err)
+	}
+	if err := geckodb.PutGitUploadSessionContentContext(ctx.Context(), handler.db, sessionID, targetPath, content); err != nil {
+		response := httputil.NewError(apierror.TypeDatabaseError, fmt.Sprintf("failed to store upload session content: %s", err), http.StatusInternalServerError, details, nil)
+		response.WriteLog(handler.logger)
+		return response.Write(ctx)
+	}
+	fileState.Size = int64(len(content))
+	fileState.Checksum = sql.NullString{String: checksum, Valid: true}
+	if fileState.Status != git.GitUploadFileCollision {
+		fileState.Status = git.GitUploadFileUploaded
+		fileState.Error = sql.NullString{}
+	}
+	if errResponse := handler.touchUploadSession(ctx.Context(), session, files); errResponse != nil {
+		return errResponse.Write(ctx)
+	}
+	if err := geckodb.UpsertGitUploadSessionFilesContext(ctx.Context(), handler.db, []geckodb.GitUploadSessionFile{*fileState}); err != nil {
+		response := httputil.NewError(apierror.TypeDatabaseError, fmt.Sprintf("failed to update upload session files: %s", err), http.StatusInternalServerError, details, nil)
+		response.WriteLog(handler.logger)
+		return response.Write(ctx)
+	}
+	return httputil.JSON(git.BuildGitUploadSessionResponse(*session, files), http.StatusOK).Write(ctx)
+}
+
+// loadInlineUploadContents sets the Content of every inline file of session
+// for finalize. It fails with a conflict when the stored bytes of one are
+// missing.
+func (handler *Handler) loadInlineUploadContents(ctx context.Context, session *geckodb.GitUploadSession, files []geckodb.GitUploadSessionFile) *httputil.ErrorResponse {
+	details := map[string]any{"project_id": session.ProjectID, "session_id": session.ID}
+	contents, err := geckodb.ListGitUploadSessionContentsContext(ctx, handler.db, session.ID)
+	if err != nil {
+		response := httputil.NewError(apierror.TypeDatabaseError, fmt.Sprintf("failed to read upload session content: %s", err), http.StatusInternalServerError, details, nil)
+		response.WriteLog(handler.logger)
+		return response
+	}
+	for i := range files {
+		if !git.GitUploadFileInline(files[i]) {
+			continue
+		}
+		content, ok := contents[files[i].TargetPath]
+		if !ok {
+			details["target_path"] = files[i].TargetPath
+			response := httputil.NewError("conflict", fmt.Sprintf("upload session file %s has no stored content; upload it again", files[i].TargetPath), http.StatusConflict, details, nil)
+			response.WriteLog(handler.logger)
+			return response
+		}
+		files[i].Content = content
+	}
+	return nil
+}
+
+// dropInlineUploadContents deletes the stored inline file bytes of a session
+// that will not be committed again. Failures are logged; the upload session
+// sweeper prunes what is left.
+func (handler *Handler) dropInlineUploadContents(ctx context.Context, session *geckodb.GitUploadSession) {
+	if err := geckodb.DeleteGitUploadSessionContentsContext(ctx, handler.db, session.ID); err != nil {
+		handler.logger.Warning("failed to delete inline content of upload session %s: %s", session.ID, err)
+	}
+}
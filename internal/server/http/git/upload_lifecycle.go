@@ -0,0 +1,264 @@
+package git
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/calypr/gecko/apierror"
+	geckodb "github.com/calypr/gecko/internal/db"
+	"github.com/calypr/gecko/internal/git"
+	"github.com/calypr/gecko/internal/httputil"
+	servermw "github.com/calypr/gecko/internal/server/middleware"
+	"github.com/gofiber/fiber/v3"
+)
+
+const (
+	defaultGitUploadSessionListLimit = 50
+	maxGitUploadSessionListLimit     = 200
+
+	gitUploadPullRequestPollAge = time.Minute
+
+	// gitUploadSessionManagePermission lets a caller who did not create an
+	// upload session cancel it or release its objects.
+	gitUploadSessionManagePermission = "update"
+)
+
+var gitUploadSessionStatuses = []string{
+	git.GitUploadSessionPending,
+	git.GitUploadSessionReady,
+	git.GitUploadSessionFinalized,
+	git.GitUploadSessionCancelled,
+	git.GitUploadSessionExpired,
+}
+
+// parseGitUploadSessionFilter reads the comma separated status list and the
+// limit of an upload session listing.
+func parseGitUploadSessionFilter(ctx fiber.Ctx) (geckodb.GitUploadSessionFilter, *httputil.ErrorResponse) {
+	filter := geckodb.GitUploadSessionFilter{Limit: defaultGitUploadSessionListLimit}
+	for _, status := range splitGitQueryList(ctx.Query("status")) {
+		if !slices.Contains(gitUploadSessionStatuses, status) {
+			return filter, httputil.NewError(apierror.TypeValidationFailed, fmt.Sprintf("unknown upload session status %q", status), http.StatusBadRequest, map[string]any{"status": status, "allowed": gitUploadSessionStatuses}, nil)
+		}
+		filter.Statuses = append(filter.Statuses, status)
+	}
+	if value := strings.TrimSpace(ctx.Query("limit")); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			return filter, httputil.NewError(apierror.TypeValidationFailed, "limit must be a positive integer", http.StatusBadRequest, map[string]any{"limit": value}, nil)
+		}
+		filter.Limit = min(limit, maxGitUploadSessionListLimit)
+	}
+	return filter, nil
+}
+
+func (handler *Handler) writeGitUploadSessionList(ctx fiber.Ctx, filter geckodb.GitUploadSessionFilter, details map[string]any) error {
+	sessions, err := geckodb.ListGitUploadSessionsContext(ctx.Context(), handler.db, filter)
+	if err != nil {
+		response := httputil.NewError(apierror.TypeDatabaseError, fmt.Sprintf("failed to list upload sessions: %s", err), http.StatusInternalServerError, details, nil)
+		response.WriteLog(handler.logger)
+		return response.Write(ctx)
+	}
+	list := git.GitUploadSessionListResponse{Sessions: make([]git.GitUploadSessionResponse, 0, len(sessions))}
+	for _, session := range sessions {
+		files, err := geckodb.ListGitUploadSessionFiles(handler.db, session.ID)
+		if err != nil {
+			response := httputil.NewError(apierror.TypeDatabaseError, fmt.Sprintf("failed to read upload session files: %s", err), http.StatusInternalServerError, details, nil)
+			response.WriteLog(handler.logger)
+			return response.Write(ctx)
+		}
+		list.Sessions = append(list.Sessions, git.BuildGitUploadSessionResponse(session, files))
+	}
+	return httputil.JSON(list, http.StatusOK).Write(ctx)
+}
+
+func (handler *Handler) handleGitProjectUploadSessionsGET(ctx fiber.Ctx) error {
+	_, _, projectID, _, _, errResponse := handler.resolveGitProject(ctx)
+	if errResponse != nil {
+		return errResponse.Write(ctx)
+	}
+	filter, errResponse := parseGitUploadSessionFilter(ctx)
+	if errResponse != nil {
+		errResponse.WriteLog(handler.logger)
+		return errResponse.Write(ctx)
+	}
+	filter.ProjectID = projectID
+	return handler.writeGitUploadSessionList(ctx, filter, map[string]any{"project_id": projectID})
+}
+
+// handleGitUploadSessionsGET lists the upload sessions the caller created
+// across every project.
+func (handler *Handler) handleGitUploadSessionsGET(ctx fiber.Ctx) error {
+	userID, errResponse := handler.authenticatedUserID(ctx)
+	if errResponse != nil {
+		errResponse.WriteLog(handler.logger)
+		return errResponse.Write(ctx)
+	}
+	filter, errResponse := parseGitUploadSessionFilter(ctx)
+	if errResponse != nil {
+		errResponse.WriteLog(handler.logger)
+		return errResponse.Write(ctx)
+	}
+	filter.UserID = userID
+	return handler.writeGitUploadSessionList(ctx, filter, map[string]any{"user_id": userID})
+}
+
+// authorizeUploadSessionChange lets the user who created session, or a
+// caller with gitUploadSessionManagePermission on its project, cancel it or
+// release its objects.
+func (handler *Handler) authorizeUploadSessionChange(ctx fiber.Ctx, session *geckodb.GitUploadSession) *httputil.ErrorResponse {
+	userID, errResponse := handler.authenticatedUserID(ctx)
+	if errResponse != nil {
+		errResponse.WriteLog(handler.logger)
+		return errResponse
+	}
+	if session.CreatedByUserID.Valid && session.CreatedByUserID.String == userID {
+		return nil
+	}
+	if handler.authz != nil && servermw.CheckProjectPermission(handler.authz, ctx.Get("Authorization"), gitUploadSessionManagePermission, session.Organization, session.Project) == nil {
+		return nil
+	}
+	response := httputil.NewError(apierror.TypeForbidden, "only the creator of the upload session or a project maintainer may change it", http.StatusForbidden, map[string]any{
+		"project_id": session.ProjectID,
+		"session_id": session.ID,
+		"method":     gitUploadSessionManagePermission,
+		"resource":   servermw.ProgramProjectResourcePath(session.Organization, session.Project),
+	}, nil)
+	response.WriteLog(handler.logger)
+	return response
+}
+
+func (handler *Handler) handleGitProjectUploadSessionCancelPOST(ctx fiber.Ctx) error {
+	_, _, projectID, _, _, errResponse := handler.resolveGitProject(ctx)
+	if errResponse != nil {
+		return errResponse.Write(ctx)
+	}
+	sessionID := strings.TrimSpace(ctx.Params("sessionID"))
+	session, files, errResponse := handler.resolveGitUploadSession(projectID, sessionID)
+	if errResponse != nil {
+		return errResponse.Write(ctx)
+	}
+	if errResponse := handler.authorizeUploadSessionChange(ctx, session); errResponse != nil {
+		return errResponse.Write(ctx)
+	}
+	if !git.GitUploadSessionOpen(session.Status) {
+		response := httputil.NewError("conflict", fmt.Sprintf("upload session is %s and can no longer be cancelled", session.Status), http.StatusConflict, map[string]any{"project_id": projectID, "session_id": sessionID, "status": session.Status}, nil)
+		response.WriteLog(handler.logger)
+		return response.Write(ctx)
+	}
+	previous := session.Status
+	session.Status = git.GitUploadSessionCancelled
+	session.UpdatedAt = time.Now().UTC()
+	cancelled, err := geckodb.UpdateGitUploadSessionStatusContext(ctx.Context(), handler.db, session.ID, []string{git.GitUploadSessionPending, git.GitUploadSessionReady}, session.Status, session.UpdatedAt)
+	if err != nil {
+		response := httputil.NewError(apierror.TypeDatabaseError, fmt.Sprintf("failed to cancel upload session: %s", err), http.StatusInternalServerError, map[string]any{"project_id": projectID, "session_id": sessionID}, nil)
+		response.WriteLog(handler.logger)
+		return response.Write(ctx)
+	}
+	if !cancelled {
+		response := httputil.NewError("conflict", fmt.Sprintf("upload session changed from %s while it was being cancelled", previous), http.StatusConflict, map[string]any{"project_id": projectID, "session_id": sessionID}, nil)
+		response.WriteLog(handler.logger)
+		return response.Write(ctx)
+	}
+	handler.dropInlineUploadContents(ctx.Context(), session)
+	return httputil.JSON(git.BuildGitUploadSessionResponse(*session, files), http.StatusOK).Write(ctx)
+}
+
+// handleGitProjectUploadSessionReleasePOST deletes the DRS objects a
+// cancelled or expired session had attached. Only the creator of the session
+// or a project maintainer may release it, and Syfon checks the caller may
+// delete the objects.
+func (handler *Handler) handleGitProjectUploadSessionReleasePOST(ctx fiber.Ctx) error {
+	_, _, projectID, _, _, errResponse := handler.resolveGitProject(ctx)
+	if errResponse != nil {
+		return errResponse.Write(ctx)
+	}
+	authorizationHeader, tokenErr := servermw.ValidateAuthorizationHeader(ctx.Get("Authorization"))
+	if tokenErr != nil {
+		response := httputil.NewError("missing_authorization", tokenErr.Error(), http.StatusUnauthorized, map[string]any{"project_id": projectID}, nil)
+		response.WriteLog(handler.logger)
+		return response.Write(ctx)
+	}
+	if handler.lfsDownloads == nil {
+		response := httputil.NewError("integration_error", "DRS storage is not configured", http.StatusBadGateway, map[string]any{"project_id": projectID}, nil)
+		response.WriteLog(handler.logger)
+		return response.Write(ctx)
+	}
+	sessionID := strings.TrimSpace(ctx.Params("sessionID"))
+	session, files, errResponse := handler.resolveGitUploadSession(projectID, sessionID)
+	if errResponse != nil {
+		return errResponse.Write(ctx)
+	}
+	if errResponse := handler.authorizeUploadSessionChange(ctx, session); errResponse != nil {
+		return errResponse.Write(ctx)
+	}
+	released, err := handler.lfsDownloads.ReleaseUploadSessionObjects(ctx.Context(), authorizationHeader, *session, files)
+	if err != nil {
+		return handler.writeAppError(ctx, err)
+	}
+	return httputil.JSON(released, http.StatusOK).Write(ctx)
+}
+
+// pollUploadPullRequest refreshes the pull request state of a finalized
+// session from GitHub when it was last checked more than
+// gitUploadPullRequestPollAge ago, so a session read shows current review and
+// check results without waiting for a webhook or the scheduler. A merge
+// queues a mirror refresh. Failures are logged and the stored state is served.
+func (handler *Handler) pollUploadPullRequest(ctx fiber.Ctx, session *geckodb.GitUploadSession) {
+	if !git.GitUploadPullRequestPending(*session) || handler.gitService == nil {
+		return
+	}
+	if session.PRCheckedAt.Valid && time.Since(session.PRCheckedAt.Time) < gitUploadPullRequestPollAge {
+		return
+	}
+	authorizationHeader, tokenErr := servermw.ValidateAuthorizationHeader(ctx.Get("Authorization"))
+	if tokenErr != nil {
+		return
+	}
+	polled := *session
+	merged, err := handler.gitService.PollUploadPullRequest(ctx.Context(), authorizationHeader, &polled)
+	if err != nil {
+		handler.logger.Warning("failed to poll pull request of upload session %s: %s", session.ID, err)
+		return
+	}
+	updated, err := geckodb.UpdateGitUploadSessionPullRequestContext(ctx.Context(), handler.db, polled, session.PRCheckedAt)
+	if err != nil {
+		handler.logger.Warning("failed to persist pull request state of upload session %s: %s", session.ID, err)
+		return
+	}
+	if !updated {
+		// The scheduler or a webhook recorded the pull request meanwhile.
+		return
+	}
+	*session = polled
+	if merged {
+		handler.queueUploadRefresh(ctx, session, authorizationHeader, "its upload pull request merged")
+	}
+}
+
+// queueUploadRefresh submits a mirror refresh of the project of session,
+// whose changes just reached a branch. Failures are logged.
+func (handler *Handler) queueUploadRefresh(ctx fiber.Ctx, session *geckodb.GitUploadSession, authorizationHeader string, reason string) {
+	if handler.refreshJobs == nil {
+		return
+	}
+	state, err := geckodb.GitProjectStateByProjectIDContext(ctx.Context(), handler.db, session.ProjectID)
+	if err != nil || state == nil {
+		return
+	}
+	requestedBy, _ := handler.authenticatedUserID(ctx)
+	if _, err := handler.refreshJobs.Submit(ctx.Context(), git.RefreshJobRequest{
+		ProjectID:           session.ProjectID,
+		Organization:        session.Organization,
+		Project:             session.Project,
+		Identity:            git.GitRepositoryIdentity{Host: state.RepoHost, Owner: state.RepoOwner, Repo: state.RepoName},
+		State:               state,
+		AuthorizationHeader: authorizationHeader,
+		RequestedBy:         requestedBy,
+	}); err != nil {
+		handler.logger.Warning("failed to queue refresh of %s after %s: %s", session.ProjectID, reason, err)
+	}
+}
@@ -0,0 +1,73 @@
+package git
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	appconfig "github.com/calypr/gecko/config"
+	"github.com/gofiber/fiber/v3"
+)
+
+type fakeGitJWTDecoder struct {
+	subject string
+}
+
+func (decoder fakeGitJWTDecoder) Decode(string) (*map[string]interface{}, error) {
+	claims := map[string]interface{}{"sub": decoder.subject}
+	return &claims, nil
+}
+
+type fakeGitAccessHandler struct {
+	resources []any
+}
+
+func (handler fakeGitAccessHandler) GetAllowedResources(string, string, string) ([]any, error) {
+	return handler.resources, nil
+}
+
+func (handler fakeGitAccessHandler) CheckResourceServiceAccess(string, string, string, string) (bool, error) {
+	return false, nil
+}
+
+func TestGitUploadSessionCancelRejectsOtherUsers(t *testing.T) {
+	fenceServer := httptest.NewServer(http.NotFoundHandler())
+	defer fenceServer.Close()
+	handler, mock, cleanup := newGitHandlerTestServer(t, fenceServer, nil)
+	defer cleanup()
+	handler.Handler.JWTApp = fakeGitJWTDecoder{subject: "bob"}
+	handler.authz = fakeGitAccessHandler{resources: []any{"/programs/TEST/projects/other"}}
+
+	projectContent, err := json.Marshal(appconfig.ProjectConfig{Title: "proj-a", OrgTitle: "TEST", ProjectTitle: "proj-a", SrcRepo: "https://github.com/EllrottLab/git_drs_test"})
+	if err != nil {
+		t.Fatalf("marshal project config: %v", err)
+	}
+	mock.ExpectQuery(`SELECT name, content FROM config_schema\.projects WHERE name=\$1`).
+		WithArgs("TEST/proj-a").
+		WillReturnRows(sqlmock.NewRows([]string{"name", "content"}).AddRow("TEST/proj-a", projectContent))
+	mock.ExpectQuery(`FROM config_schema\.git_upload_session WHERE id = \$1`).
+		WithArgs("session-1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "project_id", "organization", "project", "status", "created_by_user_id"}).
+			AddRow("session-1", "TEST/proj-a", "TEST", "proj-a", "ready", "alice"))
+	mock.ExpectQuery(`FROM config_schema\.git_upload_session_file`).
+		WithArgs("session-1").
+		WillReturnRows(sqlmock.NewRows([]string{"session_id", "target_path"}))
+
+	app := fiber.New()
+	app.Post("/git/projects/:orgTitle/:projectTitle/uploads/session/:sessionID/cancel", handler.handleGitProjectUploadSessionCancelPOST)
+	req := httptest.NewRequest(http.MethodPost, "/git/projects/TEST/proj-a/uploads/session/session-1/cancel", nil)
+	req.Header.Set("Authorization", "Bearer test")
+
+	resp := runGitRequest(t, app, req)
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		payload, _ := io.ReadAll(resp.Body)
+		t.Fatalf("expected 403, got %d: %s", resp.StatusCode, payload)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet sql expectations: %v", err)
+	}
+}
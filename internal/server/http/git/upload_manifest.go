@@ -0,0 +1,119 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/calypr/gecko/apierror"
+	geckodb "github.com/calypr/gecko/internal/db"
+	"github.com/calypr/gecko/internal/git"
+	"github.com/calypr/gecko/internal/httputil"
+	servermw "github.com/calypr/gecko/internal/server/middleware"
+	"github.com/gofiber/fiber/v3"
+)
+
+// handleGitProjectUploadSessionManifestPOST appends a manifest page to a
+// partial session. The page is planned against the base commit of the
+// session, and a path an earlier page already uses is a collision.
+func (handler *Handler) handleGitProjectUploadSessionManifestPOST(ctx fiber.Ctx) error {
+	_, _, projectID, _, identity, errResponse := handler.resolveGitProject(ctx)
+	if errResponse != nil {
+		return errResponse.Write(ctx)
+	}
+	defer handler.holdGitMirror(identity)()
+	authorizationHeader, tokenErr := servermw.ValidateAuthorizationHeader(ctx.Get("Authorization"))
+	if tokenErr != nil {
+		response := httputil.NewError("missing_authorization", tokenErr.Error(), http.StatusUnauthorized, map[string]any{"project_id": projectID}, nil)
+		response.WriteLog(handler.logger)
+		return response.Write(ctx)
+	}
+	sessionID := strings.TrimSpace(ctx.Params("sessionID"))
+	session, files, errResponse := handler.resolveGitUploadSession(projectID, sessionID)
+	if errResponse != nil {
+		return errResponse.Write(ctx)
+	}
+	if errResponse := handler.rejectClosedUploadSession(session); errResponse != nil {
+		return errResponse.Write(ctx)
+	}
+	if errResponse := handler.rejectFinalizingUploadSession(session); errResponse != nil {
+		return errResponse.Write(ctx)
+	}
+	details := map[string]any{"project_id": projectID, "session_id": sessionID}
+	if session.ManifestComplete || session.Status == git.GitUploadSessionFinalized {
+		response := httputil.NewError("conflict", "upload session manifest is already complete", http.StatusConflict, details, nil)
+		response.WriteLog(handler.logger)
+		return response.Write(ctx)
+	}
+	var requestBody git.GitUploadSessionManifestRequest
+	if errResponse := httputil.ParseJSONBody(ctx.Body(), &requestBody, details); errResponse != nil {
+		errResponse.WriteLog(handler.logger)
+		return errResponse.Write(ctx)
+	}
+	state, errResponse := handler.ensureConnectedMirrorProject(projectID, identity)
+	if errResponse != nil {
+		return errResponse.Write(ctx)
+	}
+	prepareCtx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+	state, err := handler.ensureMirrorReadyForUpload(prepareCtx, authorizationHeader, projectID, identity, state)
+	if err != nil {
+		if statusErr, ok := err.(*git.HTTPStatusError); ok {
+			response := httputil.NewError(apierror.Type(statusErr.Code), statusErr.Message, statusErr.StatusCode, details, nil)
+			response.WriteLog(handler.logger)
+			return response.Write(ctx)
+		}
+		response := httputil.NewError("integration_error", fmt.Sprintf("failed to prepare upload session: %s", err), http.StatusBadGateway, details, nil)
+		response.WriteLog(handler.logger)
+		return response.Write(ctx)
+	}
+	baseRef := session.BaseSHA.String
+	if baseRef == "" {
+		baseRef = session.BaseBranch
+	}
+	page, _, _, err := sessionFilesFromManifest(sessionID, session.TargetSubdir.String, baseRef, requestBody.Files, requestBody.Operations, handler.uploadPolicy, git.GitUploadSessionConflictPolicy(*session), session.CreatedAt, state, git.GitUploadSessionPaths(files))
+	if err != nil {
+		var appErr *git.Error
+		if errors.As(err, &appErr) {
+			return handler.writeAppError(ctx, appErr)
+		}
+		response := httputil.NewError("integration_error", fmt.Sprintf("failed to prepare upload session: %s", err), http.StatusBadGateway, details, nil)
+		response.WriteLog(handler.logger)
+		return response.Write(ctx)
+	}
+	// The page is checked again and applied under the session's row lock,
+	// since a concurrent page may have landed since files was read.
+	complete := requestBody.Complete
+	stored, files, err := geckodb.AppendGitUploadSessionFilesContext(ctx.Context(), handler.db, sessionID, func(locked *geckodb.GitUploadSession, current []geckodb.GitUploadSessionFile) ([]geckodb.GitUploadSessionFile, error) {
+		if locked.Status == git.GitUploadSessionCancelled || locked.Status == git.GitUploadSessionExpired {
+			return nil, git.NewError(git.ErrorKindConflict, http.StatusConflict, fmt.Sprintf("upload session is %s", locked.Status), details)
+		}
+		if locked.ManifestComplete || locked.Status == git.GitUploadSessionFinalized || locked.FinalizeStep.Valid {
+			return nil, git.NewError(git.ErrorKindConflict, http.StatusConflict, "upload session manifest is already complete", details)
+		}
+		if overlaps := git.GitUploadManifestOverlaps(current, page); len(overlaps) > 0 {
+			overlapDetails := map[string]any{"project_id": projectID, "session_id": sessionID, "paths": overlaps}
+			return nil, git.NewError(git.ErrorKindConflict, http.StatusConflict, "manifest page reuses target paths already in the upload session", overlapDetails)
+		}
+		all := append(append([]geckodb.GitUploadSessionFile(nil), current...), page...)
+		locked.ManifestComplete = complete
+		locked.PRTitle = git.BuildDefaultGitUploadPRTitle(locked.Project, all)
+		locked.Status = git.GitUploadSessionStatus(*locked, all)
+		locked.UpdatedAt = time.Now().UTC()
+		locked.ExpiresAt = git.GitUploadSessionExpiry(locked.UpdatedAt, handler.uploadTTL)
+		return page, nil
+	})
+	if err != nil {
+		var appErr *git.Error
+		if errors.As(err, &appErr) {
+			return handler.writeAppError(ctx, appErr)
+		}
+		response := httputil.NewError(apierror.TypeDatabaseError, fmt.Sprintf("failed to persist upload session files: %s", err), http.StatusInternalServerError, details, nil)
+		response.WriteLog(handler.logger)
+		return response.Write(ctx)
+	}
+	return httputil.JSON(git.BuildGitUploadSessionResponse(*stored, files), http.StatusOK).Write(ctx)
+}
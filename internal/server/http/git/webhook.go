@@ -0,0 +1,26 @@
+package git
+
+import (
+	"net/http"
+
+	"github.com/calypr/gecko/internal/git"
+	"github.com/calypr/gecko/internal/httputil"
+	"github.com/gofiber/fiber/v3"
+)
+
+// handleGitHubWebhookPOST receives GitHub App deliveries. It is authenticated
+// by the X-Hub-Signature-256 HMAC rather than a bearer token.
+func (handler *Handler) handleGitHubWebhookPOST(ctx fiber.Ctx) error {
+	payload := append([]byte(nil), ctx.Body()...)
+	if err := git.VerifyGitHubWebhookSignature(ctx.Get("X-Hub-Signature-256"), payload, handler.webhookSecret); err != nil {
+		return handler.writeAppError(ctx, err)
+	}
+	result, err := handler.webhooks.HandleDelivery(ctx.Context(), ctx.Get("X-GitHub-Delivery"), ctx.Get("X-GitHub-Event"), payload)
+	if err != nil {
+		return handler.writeAppError(ctx, err)
+	}
+	if !result.Duplicate && !result.Ignored {
+		handler.logger.Info("processed GitHub %s webhook %s (action %q, projects %v)", result.Event, result.DeliveryID, result.Action, result.Projects)
+	}
+	return httputil.JSON(result, http.StatusOK).Write(ctx)
+}
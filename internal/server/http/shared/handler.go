@@ -4,9 +4,11 @@ import (
 	"net/http"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/bmeg/grip/gripql"
 	"github.com/calypr/gecko/internal/git"
+	integrationgecko "github.com/calypr/gecko/internal/integrations/gecko"
 	gintegrationsyfon "github.com/calypr/gecko/internal/integrations/syfon"
 	servermw "github.com/calypr/gecko/internal/server/middleware"
 	"github.com/calypr/gecko/internal/thumbnail"
@@ -24,24 +26,45 @@ type Dependencies struct {
 	GripGraphName  string
 	GitService     *git.GitService
 	ThumbnailStore thumbnail.Manager
+	PromotionPeers []integrationgecko.Peer
+	// SyncScheduler, when set, refreshes mirrors for push webhooks; without
+	// it they are queued as RefreshJobs.
+	SyncScheduler       *git.SyncScheduler
+	GitHubWebhookSecret string
+	RefreshJobs         *git.RefreshJobService
+	// UploadSessionTTL is how long an upload session lives without activity;
+	// zero means sessions never expire.
+	UploadSessionTTL time.Duration
+	// UploadPolicy decides which upload session files may be committed
+	// inline instead of through Git LFS.
+	UploadPolicy git.GitUploadPolicy
 }
 
 type Handler struct {
-	DB             *sqlx.DB
-	Logger         arborist.Logger
-	JWTApp         arborist.JWTDecoder
-	QdrantClient   *qdrant.Client
-	GripqlClient   *gripql.Client
-	GripGraphName  string
-	GitService     *git.GitService
-	ProjectSetup   *git.SetupService
-	ProjectSync    *git.ReconcileService
-	ThumbnailStore thumbnail.Manager
+	DB                  *sqlx.DB
+	Logger              arborist.Logger
+	JWTApp              arborist.JWTDecoder
+	QdrantClient        *qdrant.Client
+	GripqlClient        *gripql.Client
+	GripGraphName       string
+	GitService          *git.GitService
+	ProjectSetup        *git.SetupService
+	ProjectSync         *git.ReconcileService
+	ThumbnailStore      thumbnail.Manager
+	PromotionPeers      []integrationgecko.Peer
+	Webhooks            *git.WebhookService
+	GitHubWebhookSecret string
+	RefreshJobs         *git.RefreshJobService
+	LFSDownloads        *git.LFSDownloadService
+	UploadSessionTTL    time.Duration
+	UploadPolicy        git.GitUploadPolicy
 }
 
 func NewHandler(deps Dependencies) *Handler {
 	var projectSetup *git.SetupService
 	var projectSync *git.ReconcileService
+	var webhooks *git.WebhookService
+	var lfsDownloads *git.LFSDownloadService
 	if deps.GitService != nil {
 		storageManager := gintegrationsyfon.NewManager(strings.TrimSpace(os.Getenv("SYFON_DATA_API_BASE_URL")), http.DefaultClient)
 		projectSetup = git.NewSetupService(deps.DB, deps.GitService, storageManager, servermw.NewFenceUserAccessHandler(nil))
@@ -50,18 +73,32 @@ func NewHandler(deps Dependencies) *Handler {
 			storageManager,
 			deps.GitService,
 		)
+		var refresh git.ProjectRefreshTrigger
+		if deps.SyncScheduler != nil {
+			refresh = deps.SyncScheduler
+		} else if deps.RefreshJobs != nil {
+			refresh = deps.RefreshJobs
+		}
+		webhooks = git.NewWebhookService(deps.DB, refresh)
+		lfsDownloads = git.NewLFSDownloadService(deps.DB, storageManager)
 	}
 	return &Handler{
-		DB:             deps.DB,
-		Logger:         deps.Logger,
-		JWTApp:         deps.JWTApp,
-		QdrantClient:   deps.QdrantClient,
-		GripqlClient:   deps.GripqlClient,
-		GripGraphName:  deps.GripGraphName,
-		GitService:     deps.GitService,
-		ProjectSetup:   projectSetup,
-		ProjectSync:    projectSync,
-		ThumbnailStore: deps.ThumbnailStore,
+		DB:                  deps.DB,
+		Logger:              deps.Logger,
+		JWTApp:              deps.JWTApp,
+		QdrantClient:        deps.QdrantClient,
+		GripqlClient:        deps.GripqlClient,
+		GripGraphName:       deps.GripGraphName,
+		GitService:          deps.GitService,
+		ProjectSetup:        projectSetup,
+		ProjectSync:         projectSync,
+		ThumbnailStore:      deps.ThumbnailStore,
+		PromotionPeers:      deps.PromotionPeers,
+		Webhooks:            webhooks,
+		GitHubWebhookSecret: deps.GitHubWebhookSecret,
+		RefreshJobs:         deps.RefreshJobs,
+		LFSDownloads:        lfsDownloads,
+		UploadSessionTTL:    deps.UploadSessionTTL,
+		UploadPolicy:        deps.UploadPolicy,
 	}
 }
-
@@ -43,6 +43,8 @@ func (handler *Handler) WriteAppError(ctx fiber.Ctx, err error) error {
 		errorType = apierror.TypeDatabaseError
 	case git.ErrorKindUnauthorized:
 		errorType = apierror.TypeMissingAuthorization
+	case git.ErrorKindConflict:
+		errorType = apierror.Type("conflict")
 	}
 	statusCode := appErr.StatusCode
 	if statusCode == 0 {
@@ -154,38 +154,49 @@ func ProjectConfigAuth(logger arborist.Logger, authzHandler ResourceAccessHandle
 		if organization == "" || project == "" {
 			return writeError(ctx, logger, httputil.NewError("invalid_request", "organization and project are required", http.StatusBadRequest, nil, nil))
 		}
-		resourcePath := ProgramProjectResourcePath(organization, project)
-		allowed, err := authzHandler.CheckResourceServiceAccess(authorizationHeader, method, "*", resourcePath)
-		if err != nil {
-			if serverErr, ok := err.(*AccessError); ok {
-				return writeError(ctx, logger, httputil.NewError(serviceErrorType(serverErr.StatusCode), serverErr.Message, serverErr.StatusCode, nil, nil))
-			}
-			return writeError(ctx, logger, httputil.NewError(apierror.TypeAuthorizationServiceError, err.Error(), http.StatusForbidden, nil, nil))
+		if response := CheckProjectPermission(authzHandler, authorizationHeader, method, organization, project); response != nil {
+			return writeError(ctx, logger, response)
 		}
-		if !allowed {
-			anyList, listErr := authzHandler.GetAllowedResources(authorizationHeader, method, "*")
-			if listErr != nil {
-				if serverErr, ok := listErr.(*AccessError); ok {
-					return writeError(ctx, logger, httputil.NewError(serviceErrorType(serverErr.StatusCode), serverErr.Message, serverErr.StatusCode, nil, nil))
-				}
-				return writeError(ctx, logger, httputil.NewError(apierror.TypeAuthorizationServiceError, listErr.Error(), http.StatusForbidden, nil, nil))
-			}
-			resources, conversionErr := convertAnyToStringSlice(anyList)
-			if conversionErr != nil {
-				return writeError(ctx, logger, conversionErr)
+		return ctx.Next()
+	}
+}
+
+// CheckProjectPermission reports whether the caller holds method on the
+// project resource path, or on one of its ancestors, and returns the error
+// response to send when they do not. Handlers whose permission depends on
+// the request body use it directly; ProjectConfigAuth wraps it for routes.
+func CheckProjectPermission(authzHandler ResourceAccessHandler, authorizationHeader string, method string, organization string, project string) *httputil.ErrorResponse {
+	resourcePath := ProgramProjectResourcePath(organization, project)
+	allowed, err := authzHandler.CheckResourceServiceAccess(authorizationHeader, method, "*", resourcePath)
+	if err != nil {
+		if serverErr, ok := err.(*AccessError); ok {
+			return httputil.NewError(serviceErrorType(serverErr.StatusCode), serverErr.Message, serverErr.StatusCode, nil, nil)
+		}
+		return httputil.NewError(apierror.TypeAuthorizationServiceError, err.Error(), http.StatusForbidden, nil, nil)
+	}
+	if !allowed {
+		anyList, listErr := authzHandler.GetAllowedResources(authorizationHeader, method, "*")
+		if listErr != nil {
+			if serverErr, ok := listErr.(*AccessError); ok {
+				return httputil.NewError(serviceErrorType(serverErr.StatusCode), serverErr.Message, serverErr.StatusCode, nil, nil)
 			}
-			allowed = resourceListAllowsProjectAdminAction(resources, organization, project)
+			return httputil.NewError(apierror.TypeAuthorizationServiceError, listErr.Error(), http.StatusForbidden, nil, nil)
 		}
-		if !allowed {
-			return writeError(ctx, logger, httputil.NewError(apierror.TypeForbidden, fmt.Sprintf("User does not have required %s permission on resource %s", method, resourcePath), http.StatusForbidden, map[string]any{
-				"resource":     resourcePath,
-				"method":       method,
-				"organization": organization,
-				"project":      project,
-			}, nil))
+		resources, conversionErr := convertAnyToStringSlice(anyList)
+		if conversionErr != nil {
+			return conversionErr
 		}
-		return ctx.Next()
+		allowed = resourceListAllowsProjectAdminAction(resources, organization, project)
+	}
+	if !allowed {
+		return httputil.NewError(apierror.TypeForbidden, fmt.Sprintf("User does not have required %s permission on resource %s", method, resourcePath), http.StatusForbidden, map[string]any{
+			"resource":     resourcePath,
+			"method":       method,
+			"organization": organization,
+			"project":      project,
+		}, nil)
 	}
+	return nil
 }
 
 func resourceListAllowsProjectAdminAction(resources []string, organization string, project string) bool {
@@ -285,6 +285,16 @@ func TestProjectConfigAuthAllowsAdminWildcardResource(t *testing.T) {
 	}
 }
 
+func TestCheckProjectPermissionReportsMissingMethod(t *testing.T) {
+	if errResponse := CheckProjectPermission(fakeJWTAllowedResourceHandler{resources: []any{"/programs/org-a/projects/proj-a"}}, "Bearer test", "direct-commit", "org-a", "proj-a"); errResponse != nil {
+		t.Fatalf("expected the project resource to allow the method, got %+v", errResponse)
+	}
+	errResponse := CheckProjectPermission(fakeJWTAllowedResourceHandler{resources: []any{"/programs/org-a/projects/other"}}, "Bearer test", "direct-commit", "org-a", "proj-a")
+	if errResponse == nil || errResponse.Error.Code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %+v", errResponse)
+	}
+}
+
 func TestSnapshotAllowsAcceptsWildcardMethod(t *testing.T) {
 	raw := []any{
 		map[string]any{
@@ -1,13 +1,16 @@
 package server
 
 import (
+	"context"
 	"errors"
 	"log"
 	"net/http"
 	"time"
 
 	"github.com/bmeg/grip/gripql"
+	geckodb "github.com/calypr/gecko/internal/db"
 	"github.com/calypr/gecko/internal/git"
+	integrationgecko "github.com/calypr/gecko/internal/integrations/gecko"
 	geckologging "github.com/calypr/gecko/internal/logging"
 	httpapi "github.com/calypr/gecko/internal/server/http"
 	servermw "github.com/calypr/gecko/internal/server/middleware"
@@ -28,6 +31,18 @@ type Server struct {
 	gripGraphName  string
 	gitService     *git.GitService
 	thumbnailStore thumbnail.Manager
+	promotionPeers []integrationgecko.Peer
+	syncConfig     *git.SyncSchedulerConfig
+	syncScheduler  *git.SyncScheduler
+	refreshJobs    *git.RefreshJobService
+	refreshAuth    git.AuthorizationSource
+	jobRetention   *time.Duration
+	webhookSecret  string
+	uploadConfig   *git.UploadSessionSweeperConfig
+	uploadSweeper  *git.UploadSessionSweeper
+	uploadPolicy   *git.GitUploadPolicy
+	mirrorConfig   *git.MirrorMaintainerConfig
+	mirrorMaint    *git.MirrorMaintainer
 }
 
 func NewServer() *Server { return &Server{} }
@@ -69,6 +84,60 @@ func (server *Server) WithThumbnailStore(store thumbnail.Manager) *Server {
 	return server
 }
 
+func (server *Server) WithPromotionPeers(peers []integrationgecko.Peer) *Server {
+	server.promotionPeers = peers
+	return server
+}
+
+// WithSyncScheduler enables background mirror refreshes once the server is
+// started.
+func (server *Server) WithSyncScheduler(config git.SyncSchedulerConfig) *Server {
+	server.syncConfig = &config
+	return server
+}
+
+// WithRefreshAuthorization sets the Fence authorization source of refreshes
+// that webhooks queue as refresh jobs when no sync scheduler is configured.
+func (server *Server) WithRefreshAuthorization(source git.AuthorizationSource) *Server {
+	server.refreshAuth = source
+	return server
+}
+
+// WithRefreshJobRetention sets how long finished refresh jobs are kept; zero
+// keeps them forever. Without it git.DefaultRefreshJobRetention applies.
+func (server *Server) WithRefreshJobRetention(retention time.Duration) *Server {
+	server.jobRetention = &retention
+	return server
+}
+
+// WithUploadSessionExpiry expires upload sessions that see no activity for
+// config.TTL, checking every config.Interval once the server is started.
+func (server *Server) WithUploadSessionExpiry(config git.UploadSessionSweeperConfig) *Server {
+	server.uploadConfig = &config
+	return server
+}
+
+// WithMirrorMaintenance repacks the git mirrors, removes orphaned ones and
+// applies the mirror quota every config.Interval once the server is started.
+func (server *Server) WithMirrorMaintenance(config git.MirrorMaintainerConfig) *Server {
+	server.mirrorConfig = &config
+	return server
+}
+
+// WithGitHubWebhookSecret sets the secret GitHub signs webhook deliveries
+// with. Without it /git/webhooks/github rejects every delivery.
+func (server *Server) WithGitHubWebhookSecret(secret string) *Server {
+	server.webhookSecret = secret
+	return server
+}
+
+// WithUploadPolicy sets which upload session files may be committed inline.
+// Without it git.DefaultGitUploadPolicy applies.
+func (server *Server) WithUploadPolicy(policy git.GitUploadPolicy) *Server {
+	server.uploadPolicy = &policy
+	return server
+}
+
 func (server *Server) Init() (*Server, error) {
 	if server.jwtApp == nil {
 		return nil, errors.New("gecko server initialized without JWT app")
@@ -78,6 +147,8 @@ func (server *Server) Init() (*Server, error) {
 	}
 	if server.db == nil {
 		server.Logger.Warning("Database endpoints will be disabled.")
+	} else if err := geckodb.EnsureConfigPromotionTable(server.db); err != nil {
+		return nil, err
 	}
 	if server.qdrantClient == nil {
 		server.Logger.Warning("Qdrant endpoints will be disabled.")
@@ -86,9 +157,30 @@ func (server *Server) Init() (*Server, error) {
 		server.Logger.Warning("Grip endpoints will be disabled.")
 	}
 	if server.gitService != nil {
+		server.gitService.WithLogger(server.Logger)
 		if err := server.gitService.Init(server.db); err != nil {
 			return nil, err
 		}
+		if server.db != nil {
+			if failed, err := geckodb.FailInterruptedGitRefreshJobs(server.db); err != nil {
+				server.Logger.Warning("failed to close interrupted git refresh jobs: %s", err)
+			} else if failed > 0 {
+				server.Logger.Info("marked %d interrupted git refresh jobs as failed", failed)
+			}
+			server.refreshJobs = git.NewRefreshJobService(server.db, server.gitService, server.Logger).WithAuthorization(server.refreshAuth)
+			if server.jobRetention != nil {
+				server.refreshJobs.WithRetention(*server.jobRetention)
+			}
+		}
+		if server.syncConfig != nil && server.db != nil {
+			server.syncScheduler = git.NewSyncScheduler(server.gitService, server.db, server.Logger, *server.syncConfig)
+		}
+		if server.uploadConfig != nil && server.db != nil {
+			server.uploadSweeper = git.NewUploadSessionSweeper(server.db, server.Logger, *server.uploadConfig)
+		}
+		if server.mirrorConfig != nil && server.db != nil {
+			server.mirrorMaint = git.NewMirrorMaintainer(server.gitService, server.db, server.Logger, *server.mirrorConfig)
+		}
 	} else {
 		server.Logger.Warning("Git endpoints will be disabled.")
 	}
@@ -96,12 +188,65 @@ func (server *Server) Init() (*Server, error) {
 	return server, nil
 }
 
-func (server *Server) MakeRouter() *fiber.App {
-	app := fiber.New(fiber.Config{
+// Start launches background work such as the mirror sync scheduler.
+func (server *Server) Start(ctx context.Context) {
+	if server.syncScheduler != nil {
+		server.syncScheduler.Start(ctx)
+	}
+	if server.uploadSweeper != nil {
+		server.uploadSweeper.Start(ctx)
+	}
+	if server.mirrorMaint != nil {
+		server.mirrorMaint.Start(ctx)
+	}
+	if server.refreshJobs != nil {
+		server.refreshJobs.Start(ctx)
+	}
+}
+
+// Shutdown stops background work and waits for it to finish.
+func (server *Server) Shutdown() {
+	if server.syncScheduler != nil {
+		server.syncScheduler.Stop()
+	}
+	if server.uploadSweeper != nil {
+		server.uploadSweeper.Stop()
+	}
+	if server.mirrorMaint != nil {
+		server.mirrorMaint.Stop()
+	}
+	if server.refreshJobs != nil {
+		server.refreshJobs.Stop()
+	}
+}
+
+func (server *Server) uploadSessionTTL() time.Duration {
+	if server.uploadSweeper == nil {
+		return 0
+	}
+	return server.uploadSweeper.TTL()
+}
+
+func (server *Server) gitUploadPolicy() git.GitUploadPolicy {
+	if server.uploadPolicy == nil {
+		return git.DefaultGitUploadPolicy()
+	}
+	return *server.uploadPolicy
+}
+
+// routerConfig bounds each request and response. WriteTimeout covers a
+// whole response; streamed file bodies are sent with httputil.SendStream,
+// which bounds each chunk instead.
+func routerConfig() fiber.Config {
+	return fiber.Config{
 		ReadBufferSize: 32 * 1024,
 		ReadTimeout:    10 * time.Second,
 		WriteTimeout:   10 * time.Second,
-	})
+	}
+}
+
+func (server *Server) MakeRouter() *fiber.App {
+	app := fiber.New(routerConfig())
 
 	app.Use(func(ctx fiber.Ctx) error {
 		defer func() {
@@ -116,14 +261,20 @@ func (server *Server) MakeRouter() *fiber.App {
 	app.Use(servermw.RequestLogger(server.Logger))
 
 	httpapi.Register(app, httpapi.Dependencies{
-		DB:             server.db,
-		Logger:         server.Logger,
-		JWTApp:         server.jwtApp,
-		QdrantClient:   server.qdrantClient,
-		GripqlClient:   server.gripqlClient,
-		GripGraphName:  server.gripGraphName,
-		GitService:     server.gitService,
-		ThumbnailStore: server.thumbnailStore,
+		DB:                  server.db,
+		Logger:              server.Logger,
+		JWTApp:              server.jwtApp,
+		QdrantClient:        server.qdrantClient,
+		GripqlClient:        server.gripqlClient,
+		GripGraphName:       server.gripGraphName,
+		GitService:          server.gitService,
+		ThumbnailStore:      server.thumbnailStore,
+		PromotionPeers:      server.promotionPeers,
+		SyncScheduler:       server.syncScheduler,
+		GitHubWebhookSecret: server.webhookSecret,
+		RefreshJobs:         server.refreshJobs,
+		UploadSessionTTL:    server.uploadSessionTTL(),
+		UploadPolicy:        server.gitUploadPolicy(),
 	})
 	return app
 }
@@ -0,0 +1,222 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/calypr/gecko/apierror"
+	"github.com/calypr/gecko/internal/httputil"
+	integrationgecko "github.com/calypr/gecko/internal/integrations/gecko"
+	geckologging "github.com/calypr/gecko/internal/logging"
+	"github.com/gofiber/fiber/v3"
+)
+
+// TenantHeader selects a tenant explicitly when the request host does not
+// identify one.
+const TenantHeader = "X-Gecko-Tenant"
+
+// TenantConfig describes one portal served by a shared gecko instance. Every
+// tenant gets its own database, JWKS endpoint, fence base URL and data
+// directory so configs, projects, git state and thumbnails never mix.
+type TenantConfig struct {
+	Name          string   `json:"name"`
+	Hosts         []string `json:"hosts"`
+	DBURL         string   `json:"db"`
+	JWKSEndpoint  string   `json:"jwks"`
+	FenceBaseURL  string   `json:"fence_base_url"`
+	GitHubAPIBase string   `json:"github_api_base_url,omitempty"`
+	GitDataDir    string   `json:"git_data_dir,omitempty"`
+	// PromotionPeers overrides the instance-wide promotion peers when set.
+	PromotionPeers []integrationgecko.Peer `json:"promotion_peers,omitempty"`
+	// GitSyncAPIKey is the Fence API key background mirror refreshes use for
+	// this tenant; it overrides the instance-wide key.
+	GitSyncAPIKey string `json:"git_sync_api_key,omitempty"`
+	// GitHubWebhookSecret overrides the instance-wide webhook secret.
+	GitHubWebhookSecret string `json:"github_webhook_secret,omitempty"`
+}
+
+// TenantsFile is the on-disk layout of the tenants configuration.
+type TenantsFile struct {
+	Default string         `json:"default,omitempty"`
+	Tenants []TenantConfig `json:"tenants"`
+}
+
+// LoadTenantsFile reads and validates a tenants configuration file. Tenants
+// without an explicit git data directory are placed under baseDataDir.
+func LoadTenantsFile(path string, baseDataDir string) (*TenantsFile, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read tenants file %s: %w", path, err)
+	}
+	var file TenantsFile
+	if err := json.Unmarshal(content, &file); err != nil {
+		return nil, fmt.Errorf("parse tenants file %s: %w", path, err)
+	}
+	if err := file.normalize(baseDataDir); err != nil {
+		return nil, fmt.Errorf("invalid tenants file %s: %w", path, err)
+	}
+	return &file, nil
+}
+
+func (file *TenantsFile) normalize(baseDataDir string) error {
+	if len(file.Tenants) == 0 {
+		return fmt.Errorf("at least one tenant is required")
+	}
+	names := map[string]bool{}
+	hosts := map[string]string{}
+	for i := range file.Tenants {
+		tenant := &file.Tenants[i]
+		tenant.Name = strings.TrimSpace(tenant.Name)
+		if tenant.Name == "" {
+			return fmt.Errorf("tenant %d has no name", i)
+		}
+		if strings.ContainsAny(tenant.Name, "/\\ ") || tenant.Name == "." || tenant.Name == ".." {
+			return fmt.Errorf("tenant name %q must not contain path separators or spaces", tenant.Name)
+		}
+		if names[tenant.Name] {
+			return fmt.Errorf("tenant %s is declared more than once", tenant.Name)
+		}
+		names[tenant.Name] = true
+		if strings.TrimSpace(tenant.DBURL) == "" {
+			return fmt.Errorf("tenant %s has no db", tenant.Name)
+		}
+		for j, host := range tenant.Hosts {
+			host = normalizeTenantHost(host)
+			if host == "" {
+				return fmt.Errorf("tenant %s has an empty host", tenant.Name)
+			}
+			if owner, exists := hosts[host]; exists {
+				return fmt.Errorf("host %s is claimed by tenants %s and %s", host, owner, tenant.Name)
+			}
+			hosts[host] = tenant.Name
+			tenant.Hosts[j] = host
+		}
+		if strings.TrimSpace(tenant.GitDataDir) == "" && strings.TrimSpace(baseDataDir) != "" {
+			tenant.GitDataDir = strings.TrimRight(strings.TrimSpace(baseDataDir), "/") + "/" + tenant.Name
+		}
+	}
+	if err := file.checkGitDataDirs(); err != nil {
+		return err
+	}
+	file.Default = strings.TrimSpace(file.Default)
+	if file.Default != "" && !names[file.Default] {
+		return fmt.Errorf("default tenant %s is not declared", file.Default)
+	}
+	return nil
+}
+
+// checkGitDataDirs rejects tenants whose git data directories are the same
+// or nested in one another. Mirror maintenance treats everything under a
+// data directory as its tenant's and removes mirrors no project of that
+// tenant uses, so a shared directory would lose another tenant's mirrors.
+func (file *TenantsFile) checkGitDataDirs() error {
+	dirs := make([]string, 0, len(file.Tenants))
+	for _, tenant := range file.Tenants {
+		if strings.TrimSpace(tenant.GitDataDir) == "" {
+			dirs = append(dirs, "")
+			continue
+		}
+		dir, err := filepath.Abs(strings.TrimSpace(tenant.GitDataDir))
+		if err != nil {
+			return fmt.Errorf("tenant %s has an invalid git data directory: %w", tenant.Name, err)
+		}
+		for i, otherDir := range dirs {
+			if otherDir != "" && gitDataDirsOverlap(dir, otherDir) {
+				return fmt.Errorf("tenants %s and %s share git data directory %s", file.Tenants[i].Name, tenant.Name, tenant.GitDataDir)
+			}
+		}
+		dirs = append(dirs, dir)
+	}
+	return nil
+}
+
+func gitDataDirsOverlap(a string, b string) bool {
+	return a == b || strings.HasPrefix(a, b+string(filepath.Separator)) || strings.HasPrefix(b, a+string(filepath.Separator))
+}
+
+// TenantResolver maps a request onto a tenant name.
+type TenantResolver struct {
+	hosts         map[string]string
+	names         map[string]bool
+	defaultTenant string
+}
+
+func NewTenantResolver(file *TenantsFile) *TenantResolver {
+	resolver := &TenantResolver{hosts: map[string]string{}, names: map[string]bool{}}
+	if file == nil {
+		return resolver
+	}
+	for _, tenant := range file.Tenants {
+		resolver.names[tenant.Name] = true
+		for _, host := range tenant.Hosts {
+			resolver.hosts[normalizeTenantHost(host)] = tenant.Name
+		}
+	}
+	resolver.defaultTenant = file.Default
+	return resolver
+}
+
+// Resolve returns the tenant for a request host and tenant header. A host
+// mapping wins; the header is only consulted for hosts that are not mapped and
+// must not contradict the host. The default tenant is used when neither
+// identifies one.
+func (resolver *TenantResolver) Resolve(host string, header string) (string, error) {
+	header = strings.TrimSpace(header)
+	if header != "" && !resolver.names[header] {
+		return "", fmt.Errorf("unknown tenant %s", header)
+	}
+	if tenant, ok := resolver.hosts[normalizeTenantHost(host)]; ok {
+		if header != "" && header != tenant {
+			return "", fmt.Errorf("tenant header %s does not match host %s", header, host)
+		}
+		return tenant, nil
+	}
+	if header != "" {
+		return header, nil
+	}
+	if resolver.defaultTenant != "" {
+		return resolver.defaultTenant, nil
+	}
+	return "", fmt.Errorf("no tenant configured for host %s", host)
+}
+
+func normalizeTenantHost(host string) string {
+	host = strings.ToLower(strings.TrimSpace(host))
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		host = hostname
+	}
+	return strings.TrimSuffix(host, ".")
+}
+
+// NewTenantRouter builds the top-level app that dispatches every request to
+// the router of the tenant it resolves to.
+func NewTenantRouter(logger *geckologging.Handler, resolver *TenantResolver, tenants map[string]*fiber.App) *fiber.App {
+	app := fiber.New(routerConfig())
+	handlers := make(map[string]func(ctx fiber.Ctx), len(tenants))
+	for name, tenantApp := range tenants {
+		handler := tenantApp.Handler()
+		handlers[name] = func(ctx fiber.Ctx) { handler(ctx.RequestCtx()) }
+	}
+	app.Use(func(ctx fiber.Ctx) error {
+		tenant, err := resolver.Resolve(ctx.Hostname(), ctx.Get(TenantHeader))
+		if err != nil {
+			errResponse := httputil.NewError(apierror.TypeUnknownTenant, err.Error(), http.StatusNotFound, map[string]any{"host": ctx.Hostname()}, nil)
+			errResponse.WriteLog(logger)
+			return errResponse.Write(ctx)
+		}
+		handler, ok := handlers[tenant]
+		if !ok {
+			errResponse := httputil.NewError(apierror.TypeTenantUnavailable, fmt.Sprintf("tenant %s is not available", tenant), http.StatusServiceUnavailable, map[string]any{"tenant": tenant}, nil)
+			errResponse.WriteLog(logger)
+			return errResponse.Write(ctx)
+		}
+		handler(ctx)
+		return nil
+	})
+	return app
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeTenantsFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "tenants.json")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write tenants file: %v", err)
+	}
+	return path
+}
+
+func TestLoadTenantsFileDefaultsDataDir(t *testing.T) {
+	path := writeTenantsFile(t, `{
+		"default": "calypr",
+		"tenants": [
+			{"name": "calypr", "hosts": ["Calypr.Example.org:443"], "db": "postgres://calypr"},
+			{"name": "htan", "hosts": ["htan.example.org"], "db": "postgres://htan", "git_data_dir": "/srv/htan"}
+		]
+	}`)
+
+	file, err := LoadTenantsFile(path, "/var/lib/gecko")
+	if err != nil {
+		t.Fatalf("load tenants: %v", err)
+	}
+	if got := file.Tenants[0].GitDataDir; got != "/var/lib/gecko/calypr" {
+		t.Fatalf("expected derived data dir, got %q", got)
+	}
+	if got := file.Tenants[1].GitDataDir; got != "/srv/htan" {
+		t.Fatalf("expected explicit data dir to be kept, got %q", got)
+	}
+	if got := file.Tenants[0].Hosts[0]; got != "calypr.example.org" {
+		t.Fatalf("expected normalized host, got %q", got)
+	}
+}
+
+func TestLoadTenantsFileRejectsSharedHost(t *testing.T) {
+	path := writeTenantsFile(t, `{"tenants": [
+		{"name": "a", "hosts": ["portal.example.org"], "db": "postgres://a"},
+		{"name": "b", "hosts": ["portal.example.org"], "db": "postgres://b"}
+	]}`)
+	if _, err := LoadTenantsFile(path, ""); err == nil {
+		t.Fatal("expected duplicate host to be rejected")
+	}
+}
+
+func TestLoadTenantsFileRejectsSharedGitDataDir(t *testing.T) {
+	cases := map[string]string{
+		"same":   `{"tenants": [{"name": "a", "db": "postgres://a", "git_data_dir": "/srv/git"}, {"name": "b", "db": "postgres://b", "git_data_dir": "/srv/git/"}]}`,
+		"nested": `{"tenants": [{"name": "a", "db": "postgres://a"}, {"name": "b", "db": "postgres://b", "git_data_dir": "/var/lib/gecko/a/b"}]}`,
+	}
+	for name, content := range cases {
+		if _, err := LoadTenantsFile(writeTenantsFile(t, content), "/var/lib/gecko"); err == nil {
+			t.Fatalf("%s: expected overlapping git data directories to be rejected", name)
+		}
+	}
+	content := `{"tenants": [{"name": "a", "db": "postgres://a", "git_data_dir": "/srv/git"}, {"name": "b", "db": "postgres://b", "git_data_dir": "/srv/git-b"}]}`
+	if _, err := LoadTenantsFile(writeTenantsFile(t, content), ""); err != nil {
+		t.Fatalf("expected sibling git data directories to be accepted: %v", err)
+	}
+}
+
+func TestTenantResolverResolve(t *testing.T) {
+	resolver := NewTenantResolver(&TenantsFile{
+		Default: "calypr",
+		Tenants: []TenantConfig{
+			{Name: "calypr", Hosts: []string{"calypr.example.org"}},
+			{Name: "htan", Hosts: []string{"htan.example.org"}},
+		},
+	})
+
+	cases := []struct {
+		name    string
+		host    string
+		header  string
+		want    string
+		wantErr bool
+	}{
+		{name: "host", host: "htan.example.org:8080", want: "htan"},
+		{name: "header on unmapped host", host: "localhost", header: "htan", want: "htan"},
+		{name: "default", host: "localhost", want: "calypr"},
+		{name: "header matches host", host: "htan.example.org", header: "htan", want: "htan"},
+		{name: "header contradicts host", host: "calypr.example.org", header: "htan", wantErr: true},
+		{name: "unknown header", host: "localhost", header: "other", wantErr: true},
+	}
+	for _, tc := range cases {
+		got, err := resolver.Resolve(tc.host, tc.header)
+		if tc.wantErr {
+			if err == nil {
+				t.Fatalf("%s: expected error, got tenant %q", tc.name, got)
+			}
+			continue
+		}
+		if err != nil || got != tc.want {
+			t.Fatalf("%s: expected %q, got %q (%v)", tc.name, tc.want, got, err)
+		}
+	}
+}
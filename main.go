@@ -1,12 +1,16 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
 	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/bmeg/grip/gripql"
 	"github.com/bmeg/grip/util/rpc"
@@ -17,7 +21,9 @@ import (
 
 	"github.com/calypr/gecko/internal/git"
 	integrationfence "github.com/calypr/gecko/internal/integrations/fence"
+	integrationgecko "github.com/calypr/gecko/internal/integrations/gecko"
 	integrationgithub "github.com/calypr/gecko/internal/integrations/github"
+	geckologging "github.com/calypr/gecko/internal/logging"
 	server "github.com/calypr/gecko/internal/server"
 	"github.com/calypr/gecko/internal/thumbnail"
 )
@@ -45,6 +51,19 @@ func main() {
 	var githubAPIBaseFlag = flag.String("github-api-base-url", "", "GitHub API base URL (overrides GITHUB_API_BASE_URL env var)")
 	var fenceBaseURLFlag = flag.String("fence-base-url", "", "Fence base URL for GitHub App token exchange (overrides FENCE_BASE_URL env var)")
 	var gitDataDirFlag = flag.String("git-data-dir", "", "Directory for local git mirrors (overrides GIT_DATA_DIR env var)")
+	var promotionPeersFlag = flag.String("promotion-peers", "", "JSON list of peer gecko deployments configs can be promoted from (overrides PROMOTION_PEERS env var)")
+	var tenantsFlag = flag.String("tenants", "", "JSON file describing the tenants served by this instance (overrides TENANTS_CONFIG env var)")
+	var gitSyncIntervalFlag = flag.String("git-sync-interval", "", "Interval between background mirror refreshes, e.g. 15m; empty disables them (overrides GIT_SYNC_INTERVAL env var)")
+	var gitSyncWorkersFlag = flag.Int("git-sync-workers", 0, "Number of mirrors refreshed concurrently in the background (overrides GIT_SYNC_WORKERS env var)")
+	var gitSyncAPIKeyFlag = flag.String("git-sync-api-key", "", "Fence API key background refreshes authenticate with (overrides GIT_SYNC_API_KEY env var)")
+	var gitUploadSessionTTLFlag = flag.String("git-upload-session-ttl", "", "How long an upload session may go without activity before it expires, e.g. 72h; empty keeps sessions forever (overrides GIT_UPLOAD_SESSION_TTL env var)")
+	var gitRefreshJobRetentionFlag = flag.String("git-refresh-job-retention", "", "How long finished refresh jobs are kept, e.g. 720h; 0 keeps them forever (overrides GIT_REFRESH_JOB_RETENTION env var, default 720h)")
+	var gitUploadInlineMaxBytesFlag = flag.String("git-upload-inline-max-bytes", "", "Largest file an upload session may commit inline instead of through Git LFS; 0 disables inline files (overrides GIT_UPLOAD_INLINE_MAX_BYTES env var)")
+	var gitUploadLFSPathsFlag = flag.String("git-upload-lfs-paths", "", "Comma-separated .gitattributes patterns of files that must go through Git LFS (overrides GIT_UPLOAD_LFS_PATHS env var)")
+	var gitMirrorMaintenanceIntervalFlag = flag.String("git-mirror-maintenance-interval", "", "Interval between passes that repack git mirrors, remove orphaned ones and apply the mirror quota, e.g. 1h (overrides GIT_MIRROR_MAINTENANCE_INTERVAL env var)")
+	var gitMirrorQuotaFlag = flag.String("git-mirror-quota", "", "Bytes the git mirrors of each tenant may use before idle mirrors are evicted; empty or 0 means no cap (overrides GIT_MIRROR_QUOTA env var)")
+	var gitMirrorIdleFlag = flag.String("git-mirror-idle", "", "How long a mirror must go unread before the quota may evict it, e.g. 24h (overrides GIT_MIRROR_IDLE env var)")
+	var githubWebhookSecretFlag = flag.String("github-webhook-secret", "", "Secret GitHub signs App webhook deliveries with (overrides GITHUB_WEBHOOK_SECRET env var)")
 	flag.Parse()
 
 	gripGraph := firstNonEmpty(*gripGraphName, os.Getenv("GRIP_GRAPH"))
@@ -60,41 +79,15 @@ func main() {
 		}
 	}
 	qdrantAPIKey := firstNonEmpty(*qdrantAPIKeyFlag, os.Getenv("QDRANT_API_KEY"))
-	finalJWK := firstNonEmpty(*jwkEndpoint, os.Getenv("JWKS_ENDPOINT"))
-	if finalJWK == "" {
-		logger.Println("WARNING: no $JWKS_ENDPOINT or --jwks specified; endpoints requiring JWT validation will error")
-	}
-
-	serverBuilder := server.NewServer().WithLogger(logger).WithJWTApp(authutils.NewJWTApplication(finalJWK))
-	if db, err := sqlx.Open("postgres", *dbURL); err != nil {
-		logger.Printf("WARNING: Failed to open database connection with URL %s: %v. Database endpoints will not be available.", *dbURL, err)
-	} else if err = db.Ping(); err != nil {
-		logger.Printf("WARNING: DB ping failed for URL %s: %v. Database endpoints will not be available.", *dbURL, err)
-		_ = db.Close()
-	} else {
-		logger.Println("Successfully connected to PostgreSQL database.")
-		serverBuilder = serverBuilder.WithDB(db)
-		githubAPIBase := firstNonEmpty(*githubAPIBaseFlag, os.Getenv("GITHUB_API_BASE_URL"))
-		fenceBaseURL := firstNonEmpty(*fenceBaseURLFlag, os.Getenv("FENCE_BASE_URL"))
-		gitDataDir := firstNonEmpty(*gitDataDirFlag, os.Getenv("GIT_DATA_DIR"))
-		gitService := git.NewGitService(git.GitServiceConfig{
-			GitHubAPIBase: githubAPIBase,
-			FenceBaseURL:  fenceBaseURL,
-			DataDir:       gitDataDir,
-			FenceClient:   integrationfence.NewClient(nil, integrationfence.Config{BaseURL: fenceBaseURL}),
-			GitHubClient:  integrationgithub.NewClient(nil, integrationgithub.Config{APIBase: githubAPIBase}),
-		})
-		serverBuilder = serverBuilder.WithGitService(gitService)
-		serverBuilder = serverBuilder.WithThumbnailStore(thumbnail.NewFilesystemStore(gitDataDir))
-	}
-
+	var sharedQdrant *qdrant.Client
+	var sharedGripql *gripql.Client
 	if qdrantHost != "" && qdrantPort != 0 {
 		logger.Printf("Attempting to connect to Qdrant at %s:%d", qdrantHost, qdrantPort)
 		if qdrantClient, err := qdrant.NewClient(&qdrant.Config{Host: qdrantHost, Port: qdrantPort, APIKey: qdrantAPIKey}); err != nil {
 			logger.Printf("WARNING: Failed to initialize Qdrant client at %s:%d: %v. Qdrant endpoints will not be available.", qdrantHost, qdrantPort, err)
 		} else {
 			logger.Println("Successfully connected to Qdrant.")
-			serverBuilder = serverBuilder.WithQdrantClient(qdrantClient)
+			sharedQdrant = qdrantClient
 		}
 	} else {
 		logger.Println("INFO: Qdrant configuration (--qdrant-host or QDRANT_HOST) not fully specified. Qdrant endpoints will not be available.")
@@ -106,22 +99,304 @@ func main() {
 			logger.Printf("WARNING: Failed to initialize Grip client: %v. Grip endpoints will not be available.", err)
 		} else {
 			logger.Println("Successfully connected to Grip.")
-			serverBuilder = serverBuilder.WithGripqlClient(&gripqlClient, gripGraph)
+			sharedGripql = &gripqlClient
 		}
 	} else {
 		logger.Println("INFO: Grip configuration (--grip-host and --grip-port or environment variables) not fully specified. Grip endpoints will not be available.")
 	}
 
-	geckoServer, err := serverBuilder.Init()
+	promotionPeers, err := integrationgecko.ParsePeers(firstNonEmpty(*promotionPeersFlag, os.Getenv("PROMOTION_PEERS")))
+	if err != nil {
+		log.Fatalf("Failed to load promotion peers: %v", err)
+	}
+
+	gitSync, err := parseGitSyncSettings(
+		firstNonEmpty(*gitSyncIntervalFlag, os.Getenv("GIT_SYNC_INTERVAL")),
+		*gitSyncWorkersFlag,
+		os.Getenv("GIT_SYNC_WORKERS"),
+		firstNonEmpty(*gitSyncAPIKeyFlag, os.Getenv("GIT_SYNC_API_KEY")),
+	)
 	if err != nil {
-		log.Fatalf("Failed to initialize gecko server: %v", err)
+		log.Fatalf("Failed to load git sync settings: %v", err)
 	}
-	app := geckoServer.MakeRouter()
+
+	var uploadSessionTTL time.Duration
+	if value := firstNonEmpty(*gitUploadSessionTTLFlag, os.Getenv("GIT_UPLOAD_SESSION_TTL")); value != "" {
+		if uploadSessionTTL, err = time.ParseDuration(value); err != nil {
+			log.Fatalf("Failed to load upload session TTL: invalid duration %q: %v", value, err)
+		}
+	}
+
+	refreshJobRetention := git.DefaultRefreshJobRetention
+	if value := firstNonEmpty(*gitRefreshJobRetentionFlag, os.Getenv("GIT_REFRESH_JOB_RETENTION")); value != "" {
+		if refreshJobRetention, err = time.ParseDuration(value); err != nil {
+			log.Fatalf("Failed to load refresh job retention: invalid duration %q: %v", value, err)
+		}
+	}
+
+	uploadPolicy, err := parseGitUploadPolicy(
+		firstNonEmpty(*gitUploadInlineMaxBytesFlag, os.Getenv("GIT_UPLOAD_INLINE_MAX_BYTES")),
+		firstNonEmpty(*gitUploadLFSPathsFlag, os.Getenv("GIT_UPLOAD_LFS_PATHS")),
+	)
+	if err != nil {
+		log.Fatalf("Failed to load upload policy: %v", err)
+	}
+
+	gitMirror, err := parseGitMirrorSettings(
+		firstNonEmpty(*gitMirrorMaintenanceIntervalFlag, os.Getenv("GIT_MIRROR_MAINTENANCE_INTERVAL")),
+		firstNonEmpty(*gitMirrorQuotaFlag, os.Getenv("GIT_MIRROR_QUOTA")),
+		firstNonEmpty(*gitMirrorIdleFlag, os.Getenv("GIT_MIRROR_IDLE")),
+	)
+	if err != nil {
+		log.Fatalf("Failed to load git mirror settings: %v", err)
+	}
+
+	defaults := instanceSettings{
+		dbURL:         *dbURL,
+		jwks:          firstNonEmpty(*jwkEndpoint, os.Getenv("JWKS_ENDPOINT")),
+		githubAPIBase: firstNonEmpty(*githubAPIBaseFlag, os.Getenv("GITHUB_API_BASE_URL")),
+		fenceBaseURL:  firstNonEmpty(*fenceBaseURLFlag, os.Getenv("FENCE_BASE_URL")),
+		gitDataDir:    firstNonEmpty(*gitDataDirFlag, os.Getenv("GIT_DATA_DIR")),
+		peers:         promotionPeers,
+		gitSync:       gitSync,
+		gitMirror:     gitMirror,
+		webhookSecret: firstNonEmpty(*githubWebhookSecretFlag, os.Getenv("GITHUB_WEBHOOK_SECRET")),
+		uploadTTL:     uploadSessionTTL,
+		uploadPolicy:  uploadPolicy,
+		jobRetention:  refreshJobRetention,
+	}
+
+	var app *fiber.App
+	var servers []*server.Server
+	if tenantsPath := firstNonEmpty(*tenantsFlag, os.Getenv("TENANTS_CONFIG")); tenantsPath != "" {
+		tenantsFile, err := server.LoadTenantsFile(tenantsPath, defaults.gitDataDir)
+		if err != nil {
+			log.Fatalf("Failed to load tenants: %v", err)
+		}
+		tenantApps := make(map[string]*fiber.App, len(tenantsFile.Tenants))
+		for _, tenant := range tenantsFile.Tenants {
+			tenantLogger := log.New(os.Stdout, "["+tenant.Name+"] ", log.Ldate|log.Ltime)
+			settings := instanceSettings{
+				dbURL:         tenant.DBURL,
+				jwks:          firstNonEmpty(tenant.JWKSEndpoint, defaults.jwks),
+				githubAPIBase: firstNonEmpty(tenant.GitHubAPIBase, defaults.githubAPIBase),
+				fenceBaseURL:  firstNonEmpty(tenant.FenceBaseURL, defaults.fenceBaseURL),
+				gitDataDir:    tenant.GitDataDir,
+				peers:         defaults.peers,
+				gitSync:       defaults.gitSync,
+				gitMirror:     defaults.gitMirror,
+				webhookSecret: firstNonEmpty(tenant.GitHubWebhookSecret, defaults.webhookSecret),
+				uploadTTL:     defaults.uploadTTL,
+				uploadPolicy:  defaults.uploadPolicy,
+				jobRetention:  defaults.jobRetention,
+			}
+			if tenant.PromotionPeers != nil {
+				settings.peers = tenant.PromotionPeers
+			}
+			if tenant.GitSyncAPIKey != "" {
+				settings.gitSync.apiKey = tenant.GitSyncAPIKey
+			}
+			tenantServer, err := newServerBuilder(tenantLogger, settings).
+				WithQdrantClient(sharedQdrant).
+				WithGripqlClient(sharedGripql, gripGraph).
+				Init()
+			if err != nil {
+				log.Fatalf("Failed to initialize gecko server for tenant %s: %v", tenant.Name, err)
+			}
+			servers = append(servers, tenantServer)
+			tenantApps[tenant.Name] = tenantServer.MakeRouter()
+			logger.Printf("Tenant %s serving hosts %v", tenant.Name, tenant.Hosts)
+		}
+		app = server.NewTenantRouter(&geckologging.Handler{Logger: logger}, server.NewTenantResolver(tenantsFile), tenantApps)
+	} else {
+		geckoServer, err := newServerBuilder(logger, defaults).
+			WithQdrantClient(sharedQdrant).
+			WithGripqlClient(sharedGripql, gripGraph).
+			Init()
+		if err != nil {
+			log.Fatalf("Failed to initialize gecko server: %v", err)
+		}
+		servers = append(servers, geckoServer)
+		app = geckoServer.MakeRouter()
+	}
+
+	backgroundCtx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+	for _, geckoServer := range servers {
+		geckoServer.Start(backgroundCtx)
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		logger.Printf("Received %s, shutting down", sig)
+		if err := app.Shutdown(); err != nil {
+			logger.Printf("WARNING: HTTP shutdown failed: %v", err)
+		}
+	}()
+
 	addr := fmt.Sprintf(":%d", *port)
 	logger.Println("gecko serving at", addr)
-	if err := app.Listen(addr, fiber.ListenConfig{DisableStartupMessage: true}); err != nil {
-		log.Fatal("Server failed to start:", err)
+	listenErr := app.Listen(addr, fiber.ListenConfig{DisableStartupMessage: true})
+	stopBackground()
+	for _, geckoServer := range servers {
+		geckoServer.Shutdown()
+	}
+	if listenErr != nil {
+		log.Fatal("Server failed to start:", listenErr)
+	}
+}
+
+// gitSyncSettings configures the background mirror refresh. A zero interval
+// leaves it disabled.
+type gitSyncSettings struct {
+	interval time.Duration
+	workers  int
+	apiKey   string
+}
+
+func parseGitSyncSettings(interval string, workers int, workersEnv string, apiKey string) (gitSyncSettings, error) {
+	settings := gitSyncSettings{workers: workers, apiKey: apiKey}
+	if interval != "" {
+		parsed, err := time.ParseDuration(interval)
+		if err != nil {
+			return settings, fmt.Errorf("invalid git sync interval %q: %w", interval, err)
+		}
+		settings.interval = parsed
+	}
+	if settings.workers == 0 && workersEnv != "" {
+		parsed, err := strconv.Atoi(workersEnv)
+		if err != nil {
+			return settings, fmt.Errorf("invalid GIT_SYNC_WORKERS %q: %w", workersEnv, err)
+		}
+		settings.workers = parsed
+	}
+	return settings, nil
+}
+
+// gitMirrorSettings configures mirror maintenance. Maintenance runs when an
+// interval or a quota is set.
+type gitMirrorSettings struct {
+	interval time.Duration
+	quota    int64
+	idle     time.Duration
+}
+
+func parseGitMirrorSettings(interval string, quota string, idle string) (gitMirrorSettings, error) {
+	settings := gitMirrorSettings{}
+	if interval != "" {
+		parsed, err := time.ParseDuration(interval)
+		if err != nil {
+			return settings, fmt.Errorf("invalid git mirror maintenance interval %q: %w", interval, err)
+		}
+		settings.interval = parsed
+	}
+	if quota != "" {
+		parsed, err := strconv.ParseInt(quota, 10, 64)
+		if err != nil || parsed < 0 {
+			return settings, fmt.Errorf("invalid git mirror quota %q", quota)
+		}
+		settings.quota = parsed
+	}
+	if idle != "" {
+		parsed, err := time.ParseDuration(idle)
+		if err != nil {
+			return settings, fmt.Errorf("invalid git mirror idle time %q: %w", idle, err)
+		}
+		settings.idle = parsed
+	}
+	return settings, nil
+}
+
+// parseGitUploadPolicy starts from git.DefaultGitUploadPolicy and overrides
+// the inline size cap and LFS patterns that are set.
+func parseGitUploadPolicy(inlineMaxBytes string, lfsPaths string) (git.GitUploadPolicy, error) {
+	policy := git.DefaultGitUploadPolicy()
+	if inlineMaxBytes != "" {
+		parsed, err := strconv.ParseInt(inlineMaxBytes, 10, 64)
+		if err != nil || parsed < 0 {
+			return policy, fmt.Errorf("invalid inline upload size %q", inlineMaxBytes)
+		}
+		policy.InlineMaxBytes = parsed
+	}
+	if lfsPaths != "" {
+		policy.LFSPaths = []string{}
+		for _, pattern := range strings.Split(lfsPaths, ",") {
+			if pattern = strings.TrimSpace(pattern); pattern != "" {
+				policy.LFSPaths = append(policy.LFSPaths, pattern)
+			}
+		}
+	}
+	return policy, nil
+}
+
+// instanceSettings holds the per-portal wiring. A single-tenant deployment
+// takes it from flags; a multi-tenant deployment takes one per tenant.
+type instanceSettings struct {
+	dbURL         string
+	jwks          string
+	githubAPIBase string
+	fenceBaseURL  string
+	gitDataDir    string
+	peers         []integrationgecko.Peer
+	gitSync       gitSyncSettings
+	gitMirror     gitMirrorSettings
+	webhookSecret string
+	uploadTTL     time.Duration
+	uploadPolicy  git.GitUploadPolicy
+	jobRetention  time.Duration
+}
+
+func newServerBuilder(logger *log.Logger, settings instanceSettings) *server.Server {
+	if settings.jwks == "" {
+		logger.Println("WARNING: no $JWKS_ENDPOINT or --jwks specified; endpoints requiring JWT validation will error")
+	}
+	serverBuilder := server.NewServer().WithLogger(logger).WithJWTApp(authutils.NewJWTApplication(settings.jwks)).WithPromotionPeers(settings.peers).WithGitHubWebhookSecret(settings.webhookSecret).WithUploadPolicy(settings.uploadPolicy).WithRefreshJobRetention(settings.jobRetention)
+	if db, err := sqlx.Open("postgres", settings.dbURL); err != nil {
+		logger.Printf("WARNING: Failed to open database connection with URL %s: %v. Database endpoints will not be available.", settings.dbURL, err)
+	} else if err = db.Ping(); err != nil {
+		logger.Printf("WARNING: DB ping failed for URL %s: %v. Database endpoints will not be available.", settings.dbURL, err)
+		_ = db.Close()
+	} else {
+		logger.Println("Successfully connected to PostgreSQL database.")
+		serverBuilder = serverBuilder.WithDB(db)
+		fenceClient := integrationfence.NewClient(nil, integrationfence.Config{BaseURL: settings.fenceBaseURL})
+		gitService := git.NewGitService(git.GitServiceConfig{
+			GitHubAPIBase: settings.githubAPIBase,
+			FenceBaseURL:  settings.fenceBaseURL,
+			DataDir:       settings.gitDataDir,
+			FenceClient:   fenceClient,
+			GitHubClient:  integrationgithub.NewClient(nil, integrationgithub.Config{APIBase: settings.githubAPIBase}),
+			MirrorQuota:   settings.gitMirror.quota,
+		})
+		serverBuilder = serverBuilder.WithGitService(gitService)
+		if settings.gitSync.apiKey != "" {
+			serverBuilder = serverBuilder.WithRefreshAuthorization(integrationfence.NewServiceTokenSource(fenceClient, settings.gitSync.apiKey).AuthorizationHeader)
+		}
+		if settings.gitSync.interval > 0 {
+			if settings.gitSync.apiKey == "" {
+				logger.Println("WARNING: --git-sync-interval is set without --git-sync-api-key; background mirror refreshes are disabled")
+			} else {
+				serverBuilder = serverBuilder.WithSyncScheduler(git.SyncSchedulerConfig{
+					Interval:      settings.gitSync.interval,
+					Workers:       settings.gitSync.workers,
+					Jitter:        settings.gitSync.interval / 10,
+					Authorization: integrationfence.NewServiceTokenSource(fenceClient, settings.gitSync.apiKey).AuthorizationHeader,
+				})
+			}
+		}
+		if settings.uploadTTL > 0 {
+			serverBuilder = serverBuilder.WithUploadSessionExpiry(git.UploadSessionSweeperConfig{TTL: settings.uploadTTL})
+		}
+		if settings.gitMirror.interval > 0 || settings.gitMirror.quota > 0 {
+			serverBuilder = serverBuilder.WithMirrorMaintenance(git.MirrorMaintainerConfig{
+				Interval:  settings.gitMirror.interval,
+				IdleAfter: settings.gitMirror.idle,
+			})
+		}
+		serverBuilder = serverBuilder.WithThumbnailStore(thumbnail.NewFilesystemStore(settings.gitDataDir))
 	}
+	return serverBuilder
 }
 
 func firstNonEmpty(values ...string) string {